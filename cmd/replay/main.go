@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cigar/sshmcp/pkg/replay"
+	"github.com/cigar/sshmcp/pkg/sshmcp"
+)
+
+func main() {
+	at := flag.Float64("at", -1, "snapshot time in seconds (default: end of recording)")
+	every := flag.Float64("every", 0, "emit a frame every N seconds instead of a single snapshot")
+	format := flag.String("format", "text", "output format: text, color or frames (JSON)")
+	emulator := flag.String("emulator", "", "terminal emulator: vt10x, vt100 or ansi (default: $SSH_MCP_TERMINAL_EMULATOR)")
+	width := flag.Int("width", 0, "override terminal width (raw logs default to 80)")
+	height := flag.Int("height", 0, "override terminal height (raw logs default to 24)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <recording.cast | raw-output.log>\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Replays a recorded shell session through the terminal emulator and prints the screen.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	outputFormat, err := replay.ParseOutputFormat(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	rec, err := replay.Load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	opts := replay.Options{
+		Width:    *width,
+		Height:   *height,
+		Emulator: sshmcp.TerminalEmulatorType(*emulator),
+	}
+
+	// 单个快照或按间隔生成帧序列
+	var frames []replay.Frame
+	if *every > 0 {
+		frames, err = replay.Frames(rec, *every, opts)
+	} else {
+		var frame replay.Frame
+		frame, err = replay.Snapshot(rec, *at, opts)
+		frames = []replay.Frame{frame}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	output, err := replay.Render(frames, outputFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(output)
+}
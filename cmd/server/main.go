@@ -40,7 +40,13 @@ func main() {
 		SessionTimeout:     cfg.Session.SessionTimeout,
 		IdleTimeout:        cfg.Session.IdleTimeout,
 		CleanupInterval:    cfg.Session.CleanupInterval,
-		Logger:             logger,
+		Recording: sshmcp.RecordingConfig{
+			Dir:      cfg.Recording.Dir,
+			MaxBytes: cfg.Recording.MaxFileSize,
+			MaxFiles: cfg.Recording.MaxFiles,
+			MaxAge:   cfg.Recording.MaxAge,
+		},
+		Logger: logger,
 	}
 
 	sessionManager := sshmcp.NewSessionManager(managerConfig)
@@ -13,12 +13,13 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	SSH     SSHConfig     `mapstructure:"ssh"`
-	Session SessionConfig `mapstructure:"session"`
-	SFTP    SFTPConfig    `mapstructure:"sftp"`
-	Hosts   HostsConfig   `mapstructure:"hosts"`
-	Logging logger.Config `mapstructure:"logging"`
+	Server    ServerConfig    `mapstructure:"server"`
+	SSH       SSHConfig       `mapstructure:"ssh"`
+	Session   SessionConfig   `mapstructure:"session"`
+	SFTP      SFTPConfig      `mapstructure:"sftp"`
+	Recording RecordingConfig `mapstructure:"recording"`
+	Hosts     HostsConfig     `mapstructure:"hosts"`
+	Logging   logger.Config   `mapstructure:"logging"`
 }
 
 // ServerConfig represents the server configuration
@@ -50,6 +51,14 @@ type SFTPConfig struct {
 	TransferTimeout time.Duration `mapstructure:"transfer_timeout"`
 }
 
+// RecordingConfig represents the shell recording configuration
+type RecordingConfig struct {
+	Dir         string        `mapstructure:"dir"`
+	MaxFileSize int64         `mapstructure:"max_file_size"`
+	MaxFiles    int           `mapstructure:"max_files"`
+	MaxAge      time.Duration `mapstructure:"max_age"`
+}
+
 // HostConfig represents a predefined SSH host configuration
 type HostConfig struct {
 	Host            string `mapstructure:"host"`
@@ -158,6 +167,13 @@ sftp:
   chunk_size: 4194304        # 4MB in bytes
   transfer_timeout: 5m
 
+# Shell recordings (asciicast v2), see ssh_record_start
+recording:
+  dir: "~/.sshmcp/recordings"
+  max_file_size: 67108864  # 64MB per recording
+  max_files: 100           # oldest recordings are deleted beyond this
+  max_age: 168h            # recordings older than 7 days are deleted
+
 # Predefined hosts for quick connection
 # You can reference these hosts by name when connecting
 hosts:
@@ -206,6 +222,12 @@ func setDefaults() {
 	viper.SetDefault("sftp.chunk_size", "4MB")
 	viper.SetDefault("sftp.transfer_timeout", "5m")
 
+	// Recording
+	viper.SetDefault("recording.dir", "~/.sshmcp/recordings")
+	viper.SetDefault("recording.max_file_size", 64*1024*1024)
+	viper.SetDefault("recording.max_files", 100)
+	viper.SetDefault("recording.max_age", "168h")
+
 	// Logging
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "console")
@@ -2,11 +2,16 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/cigar/sshmcp/pkg/replay"
 	"github.com/cigar/sshmcp/pkg/sshmcp"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
@@ -307,6 +312,11 @@ func (s *Server) handleSSHShell(ctx context.Context, req *mcp.CallToolRequest, a
 	rowsVal, _ := args["rows"].(float64)
 	colsVal, _ := args["cols"].(float64)
 	workingDir, _ := args["working_dir"].(string)
+	shellID, _ := args["shell_id"].(string)
+	shellIntegration, _ := args["shell_integration"].(bool)
+	trackCwd, hasTrackCwd := args["track_cwd"].(bool)
+	ansiModeStr, _ := args["ansi_mode"].(string)
+	emulatorStr, _ := args["emulator"].(string)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -329,13 +339,37 @@ func (s *Server) handleSSHShell(ctx context.Context, req *mcp.CallToolRequest, a
 	config := sshmcp.DefaultShellConfig()
 	config.Mode = sshmcp.TerminalModeRaw  // 强制使用 raw 模式（交互式程序专用）
 	config.ANSIMode = sshmcp.ANSIRaw      // 保留 ANSI 序列（支持颜色和光标）
+	if ansiModeStr != "" {
+		// ssh_read_output 默认使用的 ANSI 处理方式（缓冲区始终保存原始输出）
+		config.ANSIMode, err = sshmcp.ParseANSIMode(ansiModeStr)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+	}
+	if emulatorStr != "" {
+		// 快照使用的终端模拟器（省略时使用 SSH_MCP_TERMINAL_EMULATOR）
+		config.Emulator, err = sshmcp.ParseTerminalEmulatorType(emulatorStr)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+	}
 	// read_timeout 使用默认值 100ms
+	config.ShellIntegration = shellIntegration
+	if hasTrackCwd {
+		config.CwdHook = trackCwd
+	}
 
 	// 使用固定的终端类型
 	term := "xterm-256color"
 
 	// 使用配置创建 Shell
-	shellSession, err := session.CreateShellWithConfig(term, rows, cols, config)
+	shellSession, err := session.CreateNamedShell(shellID, term, rows, cols, config)
 	if err != nil {
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to create shell: %v", err)}},
@@ -343,6 +377,16 @@ func (s *Server) handleSSHShell(ctx context.Context, req *mcp.CallToolRequest, a
 		}, nil, nil
 	}
 
+	// 等待 Shell 集成钩子安装完成
+	var integrationMsg string
+	if shellIntegration {
+		if mode, err := shellSession.WaitShellIntegration(0); err != nil {
+			integrationMsg = fmt.Sprintf("- Shell 集成: ⚠️ %v\n", err)
+		} else {
+			integrationMsg = fmt.Sprintf("- Shell 集成: %s（可使用 ssh_shell_run 执行命令并获取退出码）\n", mode)
+		}
+	}
+
 	// 如果指定了工作目录，切换到该目录
 	var workingDirMsg string
 	if workingDir != "" {
@@ -360,12 +404,13 @@ func (s *Server) handleSSHShell(ctx context.Context, req *mcp.CallToolRequest, a
 
 📋 会话信息：
 - 会话 ID: %s
+- Shell ID: %s
 - 模式: %s
 - 终端: %dx%d
 - ANSI 模式: %s
-%s
+%s%s
 💾 后台缓冲区：
-- 容量: %d 行 (~%d MB)
+- 容量: %d 行 / %d MB（原始输出，读取时按 ANSI 模式处理）
 - 状态: 输出持续读取中
 
 ❤️ 保活机制（已启用）：
@@ -376,27 +421,29 @@ func (s *Server) handleSSHShell(ctx context.Context, req *mcp.CallToolRequest, a
 🔧 后续操作指引：
 
 1️⃣ 发送命令（启动交互式程序）：
-   ssh_write_input(session_id="%s", input="htop")
+   ssh_write_input(session_id="%s", shell_id="%s", input="htop")
 
 2️⃣ 查看界面：
 
    a) 查看交互式程序界面（推荐）：
-      ssh_terminal_snapshot(session_id="%s")
+      ssh_terminal_snapshot(session_id="%s", shell_id="%s")
 
    b) 查看大量文本输出（日志等）：
-      ssh_read_output(session_id="%s", strategy="latest_lines", limit=50)
+      ssh_read_output(session_id="%s", shell_id="%s", strategy="latest_lines", limit=50)
 
 3️⃣ 查看会话状态：
-   ssh_shell_status(session_id="%s")
+   ssh_shell_status(session_id="%s", shell_id="%s")
 
 4️⃣ 退出交互式程序：
-   ssh_write_input(session_id="%s", special_char="ctrl+c")  # 中断程序
+   ssh_write_input(session_id="%s", shell_id="%s", special_char="ctrl+c")  # 中断程序
 
 💡 提示：
 - 本会话专门用于交互式程序（htop/vim/gdb/tmux）
 - 简单命令建议使用 ssh_exec，更高效
 - 使用 ssh_terminal_snapshot 查看完整的交互式界面
 - 会话在后台持续运行，随时可查看
+- 同一会话可启动多个 Shell（指定不同 shell_id），省略 shell_id 时使用最近创建的 Shell
+- 使用 ssh_list_shells 查看所有 Shell，ssh_close_shell 关闭不再需要的 Shell
 `,
 				func() string {
 					if session.Alias != "" {
@@ -404,13 +451,19 @@ func (s *Server) handleSSHShell(ctx context.Context, req *mcp.CallToolRequest, a
 					}
 					return sessionID
 				}(),
+				shellSession.ID,
 				"raw",  // 固定为 raw 模式
 				cols, rows,
-				"raw",  // 固定为 raw ANSI 模式
+				config.ANSIMode,
+				integrationMsg,
 				workingDirMsg,
 				status.BufferTotal,
-				status.BufferTotal / 1024,  // 估算 KB
-				sessionID, sessionID, sessionID, sessionID),
+				status.BufferBytesTotal/1024/1024,
+				sessionID, shellSession.ID,
+				sessionID, shellSession.ID,
+				sessionID, shellSession.ID,
+				sessionID, shellSession.ID,
+				sessionID, shellSession.ID),
 		}},
 	}, nil, nil
 }
@@ -422,6 +475,10 @@ func (s *Server) handleSFTPUpload(ctx context.Context, req *mcp.CallToolRequest,
 	remotePath, _ := args["remote_path"].(string)
 	createDirsVal, _ := args["create_dirs"].(bool)
 	overwriteVal, _ := args["overwrite"].(bool)
+	verifyVal, _ := args["verify"].(bool)
+	checksumAlgorithm, _ := args["checksum_algorithm"].(string)
+	keepOnMismatch, _ := args["keep_on_mismatch"].(bool)
+	archive, _ := args["archive"].(string)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -431,7 +488,16 @@ func (s *Server) handleSFTPUpload(ctx context.Context, req *mcp.CallToolRequest,
 		}, nil, nil
 	}
 
-	result, err := session.UploadFile(localPath, remotePath, createDirsVal, overwriteVal)
+	result, err := session.UploadFileWithOptions(localPath, remotePath, &sshmcp.TransferOptions{
+		CreateDirs:        createDirsVal,
+		Overwrite:         overwriteVal,
+		Verify:            verifyVal,
+		ChecksumAlgorithm: checksumAlgorithm,
+		KeepOnMismatch:    keepOnMismatch,
+		Archive:           archive,
+		Include:           stringSliceArg(args, "include"),
+		Exclude:           stringSliceArg(args, "exclude"),
+	})
 	if err != nil {
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Upload failed: %v", err)}},
@@ -442,6 +508,9 @@ func (s *Server) handleSFTPUpload(ctx context.Context, req *mcp.CallToolRequest,
 	// 构建详细的输出消息
 	output := fmt.Sprintf("Upload successful:\n")
 	output += fmt.Sprintf("  Status: %s\n", result.Status)
+	if result.Backend != "" {
+		output += fmt.Sprintf("  Backend: %s\n", result.Backend)
+	}
 	output += fmt.Sprintf("  Local: %s\n", localPath)
 	output += fmt.Sprintf("  Remote: %s\n", remotePath)
 	output += fmt.Sprintf("  Size: %s\n", formatBytes(float64(result.FileSize)))
@@ -451,6 +520,8 @@ func (s *Server) handleSFTPUpload(ctx context.Context, req *mcp.CallToolRequest,
 		output += fmt.Sprintf("  Speed: %s\n", result.Speed)
 	}
 	output += fmt.Sprintf("  Duration: %s\n", result.Duration)
+	output += formatArchiveTransfer(result)
+	output += formatVerification(result)
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{&mcp.TextContent{Text: output}},
@@ -464,6 +535,10 @@ func (s *Server) handleSFTPDownload(ctx context.Context, req *mcp.CallToolReques
 	localPath, _ := args["local_path"].(string)
 	createDirsVal, _ := args["create_dirs"].(bool)
 	overwriteVal, _ := args["overwrite"].(bool)
+	verifyVal, _ := args["verify"].(bool)
+	checksumAlgorithm, _ := args["checksum_algorithm"].(string)
+	keepOnMismatch, _ := args["keep_on_mismatch"].(bool)
+	archive, _ := args["archive"].(string)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -473,7 +548,16 @@ func (s *Server) handleSFTPDownload(ctx context.Context, req *mcp.CallToolReques
 		}, nil, nil
 	}
 
-	result, err := session.DownloadFile(remotePath, localPath, createDirsVal, overwriteVal)
+	result, err := session.DownloadFileWithOptions(remotePath, localPath, &sshmcp.TransferOptions{
+		CreateDirs:        createDirsVal,
+		Overwrite:         overwriteVal,
+		Verify:            verifyVal,
+		ChecksumAlgorithm: checksumAlgorithm,
+		KeepOnMismatch:    keepOnMismatch,
+		Archive:           archive,
+		Include:           stringSliceArg(args, "include"),
+		Exclude:           stringSliceArg(args, "exclude"),
+	})
 	if err != nil {
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Download failed: %v", err)}},
@@ -484,6 +568,9 @@ func (s *Server) handleSFTPDownload(ctx context.Context, req *mcp.CallToolReques
 	// 构建详细的输出消息
 	output := fmt.Sprintf("Download successful:\n")
 	output += fmt.Sprintf("  Status: %s\n", result.Status)
+	if result.Backend != "" {
+		output += fmt.Sprintf("  Backend: %s\n", result.Backend)
+	}
 	output += fmt.Sprintf("  Remote: %s\n", remotePath)
 	output += fmt.Sprintf("  Local: %s\n", localPath)
 	output += fmt.Sprintf("  Size: %s\n", formatBytes(float64(result.FileSize)))
@@ -493,17 +580,24 @@ func (s *Server) handleSFTPDownload(ctx context.Context, req *mcp.CallToolReques
 		output += fmt.Sprintf("  Speed: %s\n", result.Speed)
 	}
 	output += fmt.Sprintf("  Duration: %s\n", result.Duration)
+	output += formatArchiveTransfer(result)
+	output += formatVerification(result)
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSFTPListDir handles the sftp_list_dir tool
-func (s *Server) handleSFTPListDir(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSFTPReadFile handles the sftp_read_file tool
+func (s *Server) handleSFTPReadFile(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
 	remotePath, _ := args["remote_path"].(string)
-	recursiveVal, _ := args["recursive"].(bool)
+	offsetVal, _ := args["offset"].(float64)
+	lengthVal, _ := args["length"].(float64)
+	startLineVal, _ := args["start_line"].(float64)
+	endLineVal, _ := args["end_line"].(float64)
+	maxBytesVal, _ := args["max_bytes"].(float64)
+	encoding, _ := args["encoding"].(string)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -513,32 +607,90 @@ func (s *Server) handleSFTPListDir(ctx context.Context, req *mcp.CallToolRequest
 		}, nil, nil
 	}
 
-	files, err := session.ListDirectory(remotePath, recursiveVal)
+	result, err := session.ReadRemoteFile(remotePath, &sshmcp.ReadFileOptions{
+		Offset:    int64(offsetVal),
+		Length:    int64(lengthVal),
+		StartLine: int(startLineVal),
+		EndLine:   int(endLineVal),
+		MaxBytes:  int64(maxBytesVal),
+		Encoding:  encoding,
+	})
 	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("List directory failed: %v", err)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Read failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	output := fmt.Sprintf("Directory listing for: %s\n", remotePath)
-	output += fmt.Sprintf("Total entries: %d\n\n", len(files))
-
-	for _, file := range files {
-		output += fmt.Sprintf("- %s (%s, %d bytes)\n", file.Name, file.Type, file.Size)
+	output := fmt.Sprintf("File: %s\n", result.Path)
+	output += fmt.Sprintf("  Size: %d bytes (%s) | Mode: %s | Modified: %s\n", result.Size, formatBytes(float64(result.Size)), result.Mode, result.Modified.Format(time.RFC3339))
+	if result.StartLine > 0 {
+		output += fmt.Sprintf("  Lines: %d-%d\n", result.StartLine, result.EndLine)
+	}
+	if result.BytesRead > 0 {
+		output += fmt.Sprintf("  Bytes: %d-%d (%s)\n", result.Offset, result.Offset+result.BytesRead-1, formatBytes(float64(result.BytesRead)))
+	} else {
+		output += "  Bytes: none (range is empty)\n"
 	}
+	output += fmt.Sprintf("  Encoding: %s", result.Encoding)
+	if result.Binary {
+		output += " (binary content)"
+	}
+	output += "\n"
+	if result.Truncated {
+		output += "  ⚠️ Truncated at max_bytes, read the next range to continue\n"
+	}
+	output += "\n" + result.Content
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSFTPMkdir handles the sftp_mkdir tool
-func (s *Server) handleSFTPMkdir(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSFTPWriteFile handles the sftp_write_file tool
+func (s *Server) handleSFTPWriteFile(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
 	remotePath, _ := args["remote_path"].(string)
-	recursiveVal, _ := args["recursive"].(bool)
-	modeVal, _ := args["mode"].(float64)
+	content, hasContent := args["content"].(string)
+	contentBase64, hasBase64 := args["content_base64"].(string)
+	modeStr, _ := args["mode"].(string)
+	createDirsVal, _ := args["create_dirs"].(bool)
+	backupVal, _ := args["backup"].(bool)
+	atomic := true
+	if atomicVal, ok := args["atomic"].(bool); ok {
+		atomic = atomicVal
+	}
+
+	if hasContent == hasBase64 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Exactly one of content or content_base64 must be provided"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	data := []byte(content)
+	if hasBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(contentBase64)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid content_base64: %v", err)}},
+				IsError: true,
+			}, nil, nil
+		}
+		data = decoded
+	}
+
+	var mode os.FileMode
+	if modeStr != "" {
+		parsed, err := strconv.ParseUint(modeStr, 8, 32)
+		if err != nil || parsed > 0777 {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid mode %q: expected octal permissions such as 0644", modeStr)}},
+				IsError: true,
+			}, nil, nil
+		}
+		mode = os.FileMode(parsed)
+	}
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -548,29 +700,86 @@ func (s *Server) handleSFTPMkdir(ctx context.Context, req *mcp.CallToolRequest,
 		}, nil, nil
 	}
 
-	mode := os.FileMode(modeVal)
-	if mode == 0 {
-		mode = 0755
-	}
-
-	err = session.MakeDirectory(remotePath, recursiveVal, mode)
+	result, err := session.WriteRemoteFile(remotePath, data, &sshmcp.WriteFileOptions{
+		Mode:       mode,
+		CreateDirs: createDirsVal,
+		Atomic:     atomic,
+		Backup:     backupVal,
+	})
 	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Mkdir failed: %v", err)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
+	status := "updated"
+	if result.Created {
+		status = "created"
+	}
+	output := fmt.Sprintf("File %s: %s\n", status, result.Path)
+	output += fmt.Sprintf("  Written: %s\n", formatBytes(float64(result.BytesWritten)))
+	output += fmt.Sprintf("  Mode: %s\n", result.Mode)
+	output += fmt.Sprintf("  Atomic: %v\n", result.Atomic)
+	if result.BackupPath != "" {
+		output += fmt.Sprintf("  Backup: %s\n", result.BackupPath)
+	}
+
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Directory created: %s", remotePath)}},
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSFTPDelete handles the sftp_delete tool
-func (s *Server) handleSFTPDelete(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSFTPEditFile handles the sftp_edit_file tool
+func (s *Server) handleSFTPEditFile(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
 	remotePath, _ := args["remote_path"].(string)
-	recursiveVal, _ := args["recursive"].(bool)
+	patch, _ := args["patch"].(string)
+	expectedMtime, _ := args["expected_mtime"].(string)
+	dryRun, _ := args["dry_run"].(bool)
+	backup := true
+	if backupVal, ok := args["backup"].(bool); ok {
+		backup = backupVal
+	}
+
+	opts := &sshmcp.EditFileOptions{
+		Patch:  patch,
+		Backup: backup,
+		DryRun: dryRun,
+	}
+
+	editsVal, _ := args["edits"].([]any)
+	for _, item := range editsVal {
+		editMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		oldText, _ := editMap["old_text"].(string)
+		newText, _ := editMap["new_text"].(string)
+		regexVal, _ := editMap["regex"].(bool)
+		countVal, _ := editMap["expected_count"].(float64)
+		opts.Edits = append(opts.Edits, sshmcp.FileEdit{
+			OldText:       oldText,
+			NewText:       newText,
+			Regex:         regexVal,
+			ExpectedCount: int(countVal),
+		})
+	}
+
+	if sizeVal, ok := args["expected_size"].(float64); ok {
+		size := int64(sizeVal)
+		opts.ExpectedSize = &size
+	}
+	if expectedMtime != "" {
+		mtime, err := parseTimeArg(expectedMtime)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid expected_mtime: %v", err)}},
+				IsError: true,
+			}, nil, nil
+		}
+		opts.ExpectedModTime = mtime
+	}
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -580,24 +789,55 @@ func (s *Server) handleSFTPDelete(ctx context.Context, req *mcp.CallToolRequest,
 		}, nil, nil
 	}
 
-	err = session.RemoveFile(remotePath, recursiveVal)
+	result, err := session.EditRemoteFile(remotePath, opts)
 	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Delete failed: %v", err)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Edit failed: %v\nThe file was not modified.", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
+	var output string
+	switch {
+	case !result.Changed:
+		output = fmt.Sprintf("No changes: %s already has the requested content\n", result.Path)
+	case result.DryRun:
+		output = fmt.Sprintf("Edit preview (dry run, file not modified): %s\n", result.Path)
+	default:
+		output = fmt.Sprintf("File edited: %s\n", result.Path)
+	}
+	if result.Replacements > 0 {
+		output += fmt.Sprintf("  Replacements: %d\n", result.Replacements)
+	}
+	if result.HunksApplied > 0 {
+		output += fmt.Sprintf("  Hunks Applied: %d\n", result.HunksApplied)
+	}
+	output += fmt.Sprintf("  Size: %d bytes | Modified: %s\n", result.Size, result.Modified.Format(time.RFC3339))
+	if result.BackupPath != "" {
+		output += fmt.Sprintf("  Backup: %s\n", result.BackupPath)
+	}
+	if result.Diff != "" {
+		output += "\n" + result.Diff
+	}
+
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Deleted: %s", remotePath)}},
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSSHWriteInput handles the ssh_write_input tool
-func (s *Server) handleSSHWriteInput(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// parseTimeArg parses an RFC3339 timestamp or Unix seconds
+func parseTimeArg(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// handleSFTPStat handles the sftp_stat tool
+func (s *Server) handleSFTPStat(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
-	input, _ := args["input"].(string)
-	specialChar, _ := args["special_char"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	followVal, _ := args["follow_symlinks"].(bool)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -607,81 +847,101 @@ func (s *Server) handleSSHWriteInput(ctx context.Context, req *mcp.CallToolReque
 		}, nil, nil
 	}
 
-	session.RLock()
-	hasShell := session.ShellSession != nil
-	session.RUnlock()
+	stat, err := session.StatRemoteFile(remotePath, followVal)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Stat failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
-	if !hasShell {
+	owner := stat.Owner
+	if owner == "" {
+		owner = "?"
+	}
+	group := stat.Group
+	if group == "" {
+		group = "?"
+	}
+
+	output := fmt.Sprintf("File: %s\n", stat.Path)
+	if stat.LinkTarget != "" {
+		output += fmt.Sprintf("  Link Target: %s\n", stat.LinkTarget)
+	}
+	output += fmt.Sprintf("  Type: %s\n", stat.Type)
+	output += fmt.Sprintf("  Size: %d bytes (%s)\n", stat.Size, formatBytes(float64(stat.Size)))
+	output += fmt.Sprintf("  Permissions: %s (%s)\n", stat.ModeOctal, stat.Mode)
+	output += fmt.Sprintf("  Owner: %s (%d)\n", owner, stat.UID)
+	output += fmt.Sprintf("  Group: %s (%d)\n", group, stat.GID)
+	output += fmt.Sprintf("  Modified: %s\n", stat.Modified.Format(time.RFC3339))
+	output += fmt.Sprintf("  Accessed: %s\n", stat.Accessed.Format(time.RFC3339))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// handleSFTPChmod handles the sftp_chmod tool
+func (s *Server) handleSFTPChmod(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	modeSpec, _ := args["mode"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No active shell session for session_id: %s\nHint: Use ssh_shell() to start an interactive shell first", sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	// Use special character if provided
-	if specialChar != "" {
-		err = session.ShellSession.WriteSpecialChars(specialChar)
-		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write special character failed: %v", err)}},
-				IsError: true,
-			}, nil, nil
-		}
+	mode, err := session.ChmodRemoteFile(remotePath, modeSpec)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Special character '%s' sent to shell session %s", specialChar, sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Chmod failed: %v", err)}},
+			IsError: true,
 		}, nil, nil
 	}
 
-	// Check if input contains newline - if so, automatically send Enter after writing
-	containsNewline := strings.Contains(input, "\n")
-	if containsNewline {
-		// Split by newline and write each part
-		lines := strings.Split(input, "\n")
-		for i, line := range lines {
-			if len(line) > 0 {
-				err = session.ShellSession.WriteInput(line)
-				if err != nil {
-					return &mcp.CallToolResult{
-						Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write input failed: %v", err)}},
-						IsError: true,
-					}, nil, nil
-				}
-			}
-			// Send Enter after each line except the last empty one
-			if i < len(lines)-1 || (len(lines) > 0 && lines[len(lines)-1] == "") {
-				err = session.ShellSession.WriteSpecialChars("enter")
-				if err != nil {
-					return &mcp.CallToolResult{
-						Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Send Enter failed: %v", err)}},
-						IsError: true,
-					}, nil, nil
-				}
-			}
-		}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Mode changed: %s → %s (%s)", remotePath, sshmcp.FormatModeOctal(mode), mode)}},
+	}, nil, nil
+}
+
+// handleSFTPChown handles the sftp_chown tool
+func (s *Server) handleSFTPChown(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	owner, _ := args["owner"].(string)
+	group, _ := args["group"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Input written to shell session %s (auto-sent Enter due to newline)", sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
 		}, nil, nil
 	}
 
-	// Otherwise write regular input
-	err = session.ShellSession.WriteInput(input)
+	uid, gid, err := session.ChownRemoteFile(remotePath, owner, group)
 	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write input failed: %v", err)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Chown failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Input written to shell session %s", sessionID)}},
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Ownership changed: %s → uid=%d gid=%d", remotePath, uid, gid)}},
 	}, nil, nil
 }
 
-// handleSSHReadOutput handles the ssh_read_output tool (异步模式)
-func (s *Server) handleSSHReadOutput(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSFTPRename handles the sftp_rename tool
+func (s *Server) handleSFTPRename(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
-	strategy, _ := args["strategy"].(string)
-	limitVal, _ := args["limit"].(float64)
+	oldPath, _ := args["old_path"].(string)
+	newPath, _ := args["new_path"].(string)
+	overwriteVal, _ := args["overwrite"].(bool)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -691,136 +951,389 @@ func (s *Server) handleSSHReadOutput(ctx context.Context, req *mcp.CallToolReque
 		}, nil, nil
 	}
 
-	session.RLock()
-	hasShell := session.ShellSession != nil
-	session.RUnlock()
-
-	if !hasShell {
+	err = session.RenameRemoteFile(oldPath, newPath, overwriteVal)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No active shell session for session_id: %s\nHint: Use ssh_shell() to start an interactive shell first", sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Rename failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	shellSession := session.ShellSession
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Renamed: %s → %s", oldPath, newPath)}},
+	}, nil, nil
+}
 
-	// 获取当前状态
-	status := shellSession.GetStatus()
+// handleSFTPSymlink handles the sftp_symlink tool
+func (s *Server) handleSFTPSymlink(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	target, _ := args["target"].(string)
+	linkPath, _ := args["link_path"].(string)
 
-	// 设置默认值
-	if strategy == "" {
-		strategy = "latest_lines"
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
 	}
 
-	limit := 20
-	if limitVal > 0 {
-		limit = int(limitVal)
+	err = session.SymlinkRemote(target, linkPath)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Symlink failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
 	}
 
-	// 根据 strategy 读取数据
-	var output string
-	var lineCount int
-	var byteCount int
-
-	switch strategy {
-	case "latest_lines":
-		lines := shellSession.OutputBuffer.ReadLatestLines(limit)
-		output = strings.Join(lines, "\n")
-		lineCount = len(lines)
-		if output != "" {
-			byteCount = len(output)
-		}
-
-	case "all_unread":
-		lines := shellSession.OutputBuffer.ReadAllUnread()
-		output = strings.Join(lines, "\n")
-		lineCount = len(lines)
-		if output != "" {
-			byteCount = len(output)
-		}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Symlink created: %s → %s", linkPath, target)}},
+	}, nil, nil
+}
 
-	case "latest_bytes":
-		output = shellSession.OutputBuffer.ReadLatestBytes(limit)
-		if output != "" {
-			byteCount = len(output)
-			lineCount = len(strings.Split(output, "\n"))
-		}
+// handleSFTPReadlink handles the sftp_readlink tool
+func (s *Server) handleSFTPReadlink(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
 
-	default:
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid strategy: %s\nValid strategies: latest_lines, all_unread, latest_bytes", strategy)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	// 重新获取状态（可能已更新）
-	status = shellSession.GetStatus()
+	target, resolved, err := session.ReadLinkRemote(remotePath)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Readlink failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
-	// 计算缓冲区使用率
-	bufferPercent := float64(status.BufferUsed) / float64(status.BufferTotal) * 100
+	output := fmt.Sprintf("%s → %s\n", remotePath, target)
+	if resolved != "" {
+		output += fmt.Sprintf("  Resolved: %s\n", resolved)
+	} else {
+		output += "  ⚠️ Dangling link: target does not exist\n"
+	}
 
-	// 构建返回消息
-	var result string
-	if output != "" {
-		result = fmt.Sprintf(`📄 输出读取结果
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
 
-读取策略: %s
-读取行数: %d
-读取字节数: %d
-剩余未读: %d 行
+// handleSFTPTruncate handles the sftp_truncate tool
+func (s *Server) handleSFTPTruncate(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	sizeVal, _ := args["size"].(float64)
 
-💾 缓冲区状态：
-- 已用: %d/%d 行 (%.1f%%)
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
---- 输出内容 ---
-%s
---- 输出结束 ---
+	err = session.TruncateRemoteFile(remotePath, int64(sizeVal))
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Truncate failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
-💡 提示：
-- 如需查看更多输出，增加 limit 参数
-- 如需查看所有未读输出，使用 strategy="all_unread"
-- 查看详细状态：ssh_shell_status(session_id="%s")`,
-			strategy,
-			lineCount,
-			byteCount,
-			status.BufferUsed,
-			status.BufferUsed,
-			status.BufferTotal,
-			bufferPercent,
-			output,
-			sessionID)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Truncated: %s to %d bytes", remotePath, int64(sizeVal))}},
+	}, nil, nil
+}
+
+// handleSFTPStatvfs handles the sftp_statvfs tool
+func (s *Server) handleSFTPStatvfs(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	if remotePath == "" {
+		remotePath = "/"
+	}
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	usage, err := session.StatVFSRemote(remotePath)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Statvfs failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	output := fmt.Sprintf("Filesystem of %s:\n", usage.Path)
+	output += fmt.Sprintf("  Total: %s\n", formatBytes(float64(usage.TotalBytes)))
+	output += fmt.Sprintf("  Used: %s (%.1f%%)\n", formatBytes(float64(usage.UsedBytes)), usage.UsedPercent)
+	output += fmt.Sprintf("  Available: %s\n", formatBytes(float64(usage.AvailableBytes)))
+	if usage.TotalInodes > 0 {
+		output += fmt.Sprintf("  Inodes: %d free of %d\n", usage.FreeInodes, usage.TotalInodes)
+	}
+	output += fmt.Sprintf("  Source: %s\n", usage.Source)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// handleSFTPSync handles the sftp_sync tool
+func (s *Server) handleSFTPSync(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	localPath, _ := args["local_path"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	direction, _ := args["direction"].(string)
+	compare, _ := args["compare"].(string)
+	checksumAlgorithm, _ := args["checksum_algorithm"].(string)
+	deleteVal, _ := args["delete"].(bool)
+	dryRun, _ := args["dry_run"].(bool)
+	preserve := true
+	if preserveVal, ok := args["preserve"].(bool); ok {
+		preserve = preserveVal
+	}
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	result, err := session.SyncDirectory(localPath, remotePath, &sshmcp.SyncOptions{
+		Direction:         sshmcp.SyncDirection(direction),
+		Compare:           sshmcp.SyncCompareMode(compare),
+		ChecksumAlgorithm: checksumAlgorithm,
+		Delete:            deleteVal,
+		Include:           stringSliceArg(args, "include"),
+		Exclude:           stringSliceArg(args, "exclude"),
+		IgnoreFiles:       stringSliceArg(args, "ignore_files"),
+		DryRun:            dryRun,
+		Preserve:          preserve,
+	})
+	if err != nil {
+		output := fmt.Sprintf("Sync failed: %v", err)
+		if result != nil {
+			output += "\n\n" + formatSyncResult(result, localPath, remotePath)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: output}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: formatSyncResult(result, localPath, remotePath)}},
+	}, nil, nil
+}
+
+// handleSFTPCopyBetween handles the sftp_copy_between tool
+func (s *Server) handleSFTPCopyBetween(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sourceSessionID, _ := args["source_session_id"].(string)
+	sourcePath, _ := args["source_path"].(string)
+	destSessionID, _ := args["dest_session_id"].(string)
+	destPath, _ := args["dest_path"].(string)
+	overwriteVal, _ := args["overwrite"].(bool)
+	verifyVal, _ := args["verify"].(bool)
+	checksumAlgorithm, _ := args["checksum_algorithm"].(string)
+	keepOnMismatch, _ := args["keep_on_mismatch"].(bool)
+	direct, _ := args["direct"].(bool)
+	directHost, _ := args["direct_host"].(string)
+	acceptNewHostKey, _ := args["accept_new_host_key"].(bool)
+	createDirs := true
+	if createDirsVal, ok := args["create_dirs"].(bool); ok {
+		createDirs = createDirsVal
+	}
+
+	source, err := s.sessionManager.GetSessionByIDOrAlias(sourceSessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Source session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+	dest, err := s.sessionManager.GetSessionByIDOrAlias(destSessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Destination session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	opts := &sshmcp.CopyOptions{
+		TransferOptions: sshmcp.TransferOptions{
+			CreateDirs:        createDirs,
+			Overwrite:         overwriteVal,
+			Verify:            verifyVal,
+			ChecksumAlgorithm: checksumAlgorithm,
+			KeepOnMismatch:    keepOnMismatch,
+		},
+		Direct:           direct,
+		DirectHost:       directHost,
+		AcceptNewHostKey: acceptNewHostKey,
+	}
+
+	// 客户端提供了 progressToken 时发送进度通知（最多每 500ms 一次）
+	if token := req.Params.GetProgressToken(); token != nil && req.Session != nil {
+		var lastNotify time.Time
+		opts.Progress = func(copied, total int64) {
+			if copied < total && time.Since(lastNotify) < 500*time.Millisecond {
+				return
+			}
+			lastNotify = time.Now()
+			req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+				ProgressToken: token,
+				Progress:      float64(copied),
+				Total:         float64(total),
+				Message:       fmt.Sprintf("%s / %s", formatBytes(float64(copied)), formatBytes(float64(total))),
+			})
+		}
+	}
+
+	result, err := sshmcp.CopyBetweenSessions(source, sourcePath, dest, destPath, opts)
+	if err != nil {
+		output := fmt.Sprintf("Copy failed: %v", err)
+		if result != nil && result.Fallback != "" {
+			output += fmt.Sprintf("\nNote: %s", result.Fallback)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: output}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	output := fmt.Sprintf("Copy successful:\n")
+	output += fmt.Sprintf("  Status: %s\n", result.Status)
+	output += fmt.Sprintf("  Source: %s:%s\n", source.ID, sourcePath)
+	output += fmt.Sprintf("  Destination: %s:%s\n", dest.ID, destPath)
+	output += fmt.Sprintf("  Method: %s\n", result.Method)
+	output += fmt.Sprintf("  Size: %s\n", formatBytes(float64(result.FileSize)))
+	output += fmt.Sprintf("  Transferred: %s\n", formatBytes(float64(result.BytesTransferred)))
+	if result.Speed != "" {
+		output += fmt.Sprintf("  Speed: %s\n", result.Speed)
+	}
+	output += fmt.Sprintf("  Duration: %s\n", result.Duration)
+	output += formatArchiveTransfer(result)
+	output += formatVerification(result)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// maxSyncActionsShown limits the number of actions listed in sftp_sync output
+const maxSyncActionsShown = 200
+
+// formatSyncResult formats a sync result for display
+func formatSyncResult(result *sshmcp.SyncResult, localPath, remotePath string) string {
+	output := "Sync completed:\n"
+	if result.DryRun {
+		output = "Sync plan (dry run, nothing changed):\n"
+	}
+	if result.Direction == sshmcp.SyncPull {
+		output += fmt.Sprintf("  Direction: pull (%s → %s)\n", remotePath, localPath)
 	} else {
-		result = fmt.Sprintf(`📄 输出读取结果
+		output += fmt.Sprintf("  Direction: push (%s → %s)\n", localPath, remotePath)
+	}
 
-读取策略: %s
-结果: 无新输出
+	if !result.DryRun {
+		output += fmt.Sprintf("  Dirs Created: %d | Created: %d | Updated: %d | Deleted: %d\n", result.DirsCreated, result.Created, result.Updated, result.Deleted)
+		output += fmt.Sprintf("  Transferred: %s\n", formatBytes(float64(result.BytesTransferred)))
+	}
+	output += fmt.Sprintf("  Unchanged: %d | Excluded: %d | Skipped: %d\n", result.Unchanged, result.Excluded, result.Skipped)
+	output += fmt.Sprintf("  Duration: %s\n", result.Duration)
 
-💾 缓冲区状态：
-- 已用: %d/%d 行 (%.1f%%)
-- 未读数据: 否
+	if len(result.Actions) == 0 {
+		output += "\nAlready in sync, nothing to do.\n"
+		return output
+	}
 
-💡 提示：
-- 暂无新输出，可能需要：
-  1. 等待程序产生输出
-  2. 发送命令或输入
-  3. 检查会话状态：ssh_shell_status(session_id="%s")`,
-			strategy,
-			status.BufferUsed,
-			status.BufferTotal,
-			bufferPercent,
-			sessionID)
+	output += fmt.Sprintf("\nActions (%d):\n", len(result.Actions))
+	for i, action := range result.Actions {
+		if i >= maxSyncActionsShown {
+			output += fmt.Sprintf("  ... and %d more\n", len(result.Actions)-maxSyncActionsShown)
+			break
+		}
+		line := fmt.Sprintf("  %-6s %s", action.Action, action.Path)
+		if action.Action == "create" || action.Action == "update" {
+			line += fmt.Sprintf(" (%s)", formatBytes(float64(action.Size)))
+		}
+		if action.Reason != "" {
+			line += fmt.Sprintf(" - %s", action.Reason)
+		}
+		output += line + "\n"
+	}
+
+	return output
+}
+
+// stringSliceArg extracts a string array argument
+func stringSliceArg(args map[string]any, key string) []string {
+	values, _ := args[key].([]any)
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok && str != "" {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
+// handleSFTPListDir handles the sftp_list_dir tool
+func (s *Server) handleSFTPListDir(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	recursiveVal, _ := args["recursive"].(bool)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	files, err := session.ListDirectory(remotePath, recursiveVal)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("List directory failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	output := fmt.Sprintf("Directory listing for: %s\n", remotePath)
+	if sftpErr := session.SFTPError(); sftpErr != nil {
+		output += fmt.Sprintf("Backend: %s (%v)\n", sshmcp.FileBackendExec, sftpErr)
+	}
+	output += fmt.Sprintf("Total entries: %d\n\n", len(files))
+
+	for _, file := range files {
+		output += fmt.Sprintf("- %s (%s, %d bytes)\n", file.Name, file.Type, file.Size)
 	}
 
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: result}},
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSSHResizePty handles the ssh_resize_pty tool
-func (s *Server) handleSSHResizePty(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSFTPMkdir handles the sftp_mkdir tool
+func (s *Server) handleSFTPMkdir(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
-	rowsVal, _ := args["rows"].(float64)
-	colsVal, _ := args["cols"].(float64)
+	remotePath, _ := args["remote_path"].(string)
+	recursiveVal, _ := args["recursive"].(bool)
+	modeVal, _ := args["mode"].(float64)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -830,116 +1343,1076 @@ func (s *Server) handleSSHResizePty(ctx context.Context, req *mcp.CallToolReques
 		}, nil, nil
 	}
 
-	session.RLock()
-	hasShell := session.ShellSession != nil
-	session.RUnlock()
+	mode := os.FileMode(modeVal)
+	if mode == 0 {
+		mode = 0755
+	}
 
-	if !hasShell {
+	err = session.MakeDirectory(remotePath, recursiveVal, mode)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No active shell session for session_id: %s\nHint: Use ssh_shell() to start an interactive shell first", sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Mkdir failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	rows := uint16(rowsVal)
-	cols := uint16(colsVal)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Directory created: %s", remotePath)}},
+	}, nil, nil
+}
+
+// handleSFTPDelete handles the sftp_delete tool
+func (s *Server) handleSFTPDelete(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	remotePath, _ := args["remote_path"].(string)
+	recursiveVal, _ := args["recursive"].(bool)
 
-	err = session.ShellSession.Resize(rows, cols)
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Resize PTY failed: %v", err)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	err = session.RemoveFile(remotePath, recursiveVal)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Delete failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Terminal resized to %dx%d for session %s", rows, cols, sessionID)}},
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Deleted: %s", remotePath)}},
 	}, nil, nil
 }
 
-// handleSSHTerminalSnapshot handles the ssh_terminal_snapshot tool
-func (s *Server) handleSSHTerminalSnapshot(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSSHWriteInput handles the ssh_write_input tool
+func (s *Server) handleSSHWriteInput(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
-	withColor, _ := args["with_color"].(bool)
-	includeCursorInfo, _ := args["include_cursor_info"].(bool)
+	shellID, _ := args["shell_id"].(string)
+	input, _ := args["input"].(string)
+	specialChar, _ := args["special_char"].(string)
+	keys, _ := args["keys"].(string)
+	waitQuietVal, _ := args["wait_quiet"].(float64)
+	waitTimeoutVal, _ := args["wait_timeout"].(float64)
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	// Optionally wait until the program stops producing output before returning
+	written := func(msg string) (*mcp.CallToolResult, any, error) {
+		if waitQuietVal > 0 {
+			msg += "\n" + waitQuiet(ctx, shellSession, waitQuietVal, waitTimeoutVal)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: msg}},
+		}, nil, nil
+	}
+
+	// Text mixed with <key> tokens takes precedence
+	if keys != "" {
+		err = shellSession.WriteKeys(keys)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write keys failed: %v", err)}},
+				IsError: true,
+			}, nil, nil
+		}
+		return written(fmt.Sprintf("Keys '%s' sent to shell %s of session %s", keys, shellSession.ID, sessionID))
+	}
+
+	// Use special character if provided
+	if specialChar != "" {
+		err = shellSession.WriteSpecialChars(specialChar)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write special character failed: %v", err)}},
+				IsError: true,
+			}, nil, nil
+		}
+		return written(fmt.Sprintf("Special character '%s' sent to shell %s of session %s", specialChar, shellSession.ID, sessionID))
+	}
+
+	// Check if input contains newline - if so, automatically send Enter after writing
+	containsNewline := strings.Contains(input, "\n")
+
+	// Programs with bracketed paste enabled get multi-line input as one paste,
+	// so editors don't auto-indent it and shells don't run it line by line
+	if containsNewline && shellSession.GetTerminalModes().BracketedPaste {
+		text, submit := strings.CutSuffix(input, "\n")
+		err = shellSession.WritePaste(text)
+		if err == nil && submit {
+			err = shellSession.WriteSpecialChars("enter")
+		}
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write input failed: %v", err)}},
+				IsError: true,
+			}, nil, nil
+		}
+		note := "bracketed paste"
+		if submit {
+			note += ", auto-sent Enter due to trailing newline"
+		}
+		return written(fmt.Sprintf("Input pasted to shell %s of session %s (%s)", shellSession.ID, sessionID, note))
+	}
+
+	if containsNewline {
+		// Split by newline and write each part
+		lines := strings.Split(input, "\n")
+		for i, line := range lines {
+			if len(line) > 0 {
+				err = shellSession.WriteInput(line)
+				if err != nil {
+					return &mcp.CallToolResult{
+						Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write input failed: %v", err)}},
+						IsError: true,
+					}, nil, nil
+				}
+			}
+			// Send Enter after each line except the last empty one
+			if i < len(lines)-1 || (len(lines) > 0 && lines[len(lines)-1] == "") {
+				err = shellSession.WriteSpecialChars("enter")
+				if err != nil {
+					return &mcp.CallToolResult{
+						Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Send Enter failed: %v", err)}},
+						IsError: true,
+					}, nil, nil
+				}
+			}
+		}
+		return written(fmt.Sprintf("Input written to shell %s of session %s (auto-sent Enter due to newline)", shellSession.ID, sessionID))
+	}
+
+	// Otherwise write regular input
+	err = shellSession.WriteInput(input)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Write input failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	return written(fmt.Sprintf("Input written to shell %s of session %s", shellSession.ID, sessionID))
+}
+
+// handleSSHReadOutput handles the ssh_read_output tool (异步模式)
+func (s *Server) handleSSHReadOutput(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+	strategy, _ := args["strategy"].(string)
+	limitVal, _ := args["limit"].(float64)
+	sinceSeqVal, hasSinceSeq := args["since_seq"].(float64)
+	ansiModeStr, _ := args["ansi_mode"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	// 缓冲区保存原始输出，ANSI 处理按本次请求或 Shell 配置进行
+	ansiMode := shellSession.Config.ANSIMode
+	if ansiModeStr != "" {
+		ansiMode, err = sshmcp.ParseANSIMode(ansiModeStr)
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+	}
+
+	// 设置默认值
+	if strategy == "" {
+		strategy = "latest_lines"
+	}
+
+	limit := 20
+	if hasSinceSeq {
+		// 游标读取默认返回更多行，便于一次追上
+		limit = 500
+		strategy = "since_seq"
+	}
+	if limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	// 根据 strategy 读取数据
+	var output string
+	var lineCount int
+	var byteCount int
+	// 游标信息：本次返回内容的起始序号、下次读取的游标、溢出丢失行数
+	var firstSeq, nextSeq, dropped, remaining int64
+	firstSeq = -1
+	// 尚未收到换行的最后一行（如提示符），附加在输出末尾但不计入序号
+	var partial string
+
+	switch strategy {
+	case "since_seq":
+		read := shellSession.OutputBuffer.ReadSince(int64(sinceSeqVal), limit)
+		output = strings.Join(read.Lines, "\n")
+		lineCount = len(read.Lines)
+		partial = read.Partial
+		if lineCount > 0 {
+			firstSeq = read.FirstSeq
+		}
+		nextSeq = read.NextSeq
+		dropped = read.Dropped
+		remaining = read.Remaining
+
+	case "latest_lines":
+		read := shellSession.OutputBuffer.ReadLatest(limit)
+		output = strings.Join(read.Lines, "\n")
+		lineCount = len(read.Lines)
+		partial = read.Partial
+		if lineCount > 0 {
+			firstSeq = read.FirstSeq
+		}
+		nextSeq = read.NextSeq
+
+	case "all_unread":
+		read := shellSession.OutputBuffer.ReadUnread()
+		output = strings.Join(read.Lines, "\n")
+		lineCount = len(read.Lines)
+		if lineCount > 0 {
+			firstSeq = read.FirstSeq
+		}
+		nextSeq = read.NextSeq
+
+	case "latest_bytes":
+		// 游标与内容在同一次加锁中读取，之后用 since_seq 不会漏行
+		output, nextSeq = shellSession.OutputBuffer.ReadLatestBytesSeq(limit)
+		if output != "" {
+			lineCount = len(strings.Split(output, "\n"))
+		}
+
+	default:
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid strategy: %s\nValid strategies: latest_lines, all_unread, latest_bytes", strategy)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	if partial != "" {
+		if lineCount > 0 {
+			output += "\n"
+		}
+		output += partial
+	}
+	status := shellSession.GetStatus()
+	output = sshmcp.RenderOutput(output, ansiMode, int(status.Cols))
+	byteCount = len(output)
+
+	// 计算缓冲区使用率
+	bufferPercent := float64(status.BufferUsed) / float64(status.BufferTotal) * 100
+
+	// 游标状态
+	cursorInfo := fmt.Sprintf("- next_seq: %d（下次传入 since_seq=%d 只读取新输出）", nextSeq, nextSeq)
+	if firstSeq >= 0 {
+		cursorInfo = fmt.Sprintf("- 序号范围: %d-%d\n", firstSeq, firstSeq+int64(lineCount)-1) + cursorInfo
+	}
+	if strategy == "since_seq" {
+		cursorInfo += fmt.Sprintf("\n- 溢出丢失: %d 行", dropped)
+		if remaining > 0 {
+			cursorInfo += fmt.Sprintf("\n- 尚有 %d 行未返回（受 limit 限制），使用 since_seq=%d 继续读取", remaining, nextSeq)
+		}
+	} else {
+		cursorInfo += fmt.Sprintf("\n- 缓冲区累计溢出丢失: %d 行", status.BufferDropped)
+	}
+	if partial != "" {
+		cursorInfo += "\n- 输出末尾包含尚未换行的最后一行（不计入序号，换行后会再次返回）"
+	}
+
+	// 构建返回消息
+	var result string
+	if output != "" {
+		result = fmt.Sprintf(`📄 输出读取结果
+
+读取策略: %s
+ANSI 模式: %s
+读取行数: %d
+读取字节数: %d
+剩余未读: %d 行
+
+🔢 游标：
+%s
+
+💾 缓冲区状态：
+- 已用: %d/%d 行 (%.1f%%)
+- 字节: %d/%d
+
+--- 输出内容 ---
+%s
+--- 输出结束 ---
+
+💡 提示：
+- 如需查看更多输出，增加 limit 参数
+- 如需查看所有未读输出，使用 strategy="all_unread"
+- 如需纯文本或保留颜色，使用 ansi_mode="strip" / "raw"
+- 多个读取方或恢复会话时，使用 since_seq 游标读取，不会遗漏或重复输出
+- 查看详细状态：ssh_shell_status(session_id="%s", shell_id="%s")`,
+			strategy,
+			ansiMode,
+			lineCount,
+			byteCount,
+			shellSession.OutputBuffer.GetCount(),
+			cursorInfo,
+			status.BufferUsed,
+			status.BufferTotal,
+			bufferPercent,
+			status.BufferBytes,
+			status.BufferBytesTotal,
+			output,
+			sessionID, shellSession.ID)
+	} else {
+		result = fmt.Sprintf(`📄 输出读取结果
+
+读取策略: %s
+结果: 无新输出
+
+🔢 游标：
+%s
+
+💾 缓冲区状态：
+- 已用: %d/%d 行 (%.1f%%)
+- 未读数据: 否
+
+💡 提示：
+- 暂无新输出，可能需要：
+  1. 等待程序产生输出
+  2. 发送命令或输入
+  3. 检查会话状态：ssh_shell_status(session_id="%s", shell_id="%s")`,
+			strategy,
+			cursorInfo,
+			status.BufferUsed,
+			status.BufferTotal,
+			bufferPercent,
+			sessionID, shellSession.ID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: result}},
+	}, nil, nil
+}
+
+// handleSSHResizePty handles the ssh_resize_pty tool
+func (s *Server) handleSSHResizePty(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+	rowsVal, _ := args["rows"].(float64)
+	colsVal, _ := args["cols"].(float64)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	rows := uint16(rowsVal)
+	cols := uint16(colsVal)
+
+	err = shellSession.Resize(rows, cols)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Resize PTY failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Terminal resized to %dx%d for shell %s of session %s", rows, cols, shellSession.ID, sessionID)}},
+	}, nil, nil
+}
+
+// handleSSHTerminalSnapshot handles the ssh_terminal_snapshot tool
+func (s *Server) handleSSHTerminalSnapshot(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+	withColor, _ := args["with_color"].(bool)
+	includeCursorInfo, _ := args["include_cursor_info"].(bool)
+	format, _ := args["format"].(string)
+	scrollbackVal, _ := args["scrollback_lines"].(float64)
+	waitQuietVal, _ := args["wait_quiet"].(float64)
+	waitTimeoutVal, _ := args["wait_timeout"].(float64)
+
+	if scrollbackVal < 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "scrollback_lines must not be negative"}},
+			IsError: true,
+		}, nil, nil
+	}
+	scrollbackLines := int(scrollbackVal)
+	diffMode, _ := args["diff"].(string)
+	reader, _ := args["reader"].(string)
+	sinceSeqVal, _ := args["since_seq"].(float64)
+
+	if reader == "" {
+		reader = sshmcp.DefaultScreenReader
+	}
+	switch diffMode {
+	case "", "none", "rows", "unified":
+	default:
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid diff mode: %s\nValid modes: none, rows, unified", diffMode)}},
+			IsError: true,
+		}, nil, nil
+	}
+	if (diffMode == "rows" || diffMode == "unified") && format != "" && format != "text" {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "diff only supports format=\"text\""}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	// 可选：等待输出稳定后再截取屏幕，避免拿到绘制到一半的界面
+	var waitMsg string
+	if waitQuietVal > 0 {
+		waitMsg = waitQuiet(ctx, shellSession, waitQuietVal, waitTimeoutVal) + "\n\n"
+	}
+
+	// 差异模式：只返回相对上次快照变化的行
+	if diffMode == "rows" || diffMode == "unified" {
+		diff := shellSession.DiffTerminalSnapshot(reader, uint64(sinceSeqVal))
+		result := fmt.Sprintf("📸 Terminal Snapshot for shell %s of session %s\n\n", shellSession.ID, sessionID)
+		result += waitMsg
+		if includeCursorInfo {
+			x, y := shellSession.GetCursorPosition()
+			w, h := shellSession.GetTerminalSize()
+			result += fmt.Sprintf("Cursor Position: (%d, %d)\n", x, y)
+			result += fmt.Sprintf("Terminal Size: %dx%d\n\n", w, h)
+		}
+		result += renderTerminalModes(shellSession.GetTerminalModes())
+		result += renderScreenDiff(&diff, diffMode, sinceSeqVal > 0)
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: result}},
+		}, nil, nil
+	}
+
+	// Get the terminal snapshot, with scrolled-off lines above the screen.
+	// 所有格式和 diff 基准都来自同一次截取，保证记录的正是返回的屏幕
+	capture := shellSession.CaptureTerminal()
+	var snapshot string
+	var image []byte
+	historyLines := 0
+	fence := "```"
+	switch format {
+	case "", "text":
+		var history string
+		if withColor {
+			snapshot = capture.Color()
+			history = shellSession.GetTerminalScrollbackWithColor(scrollbackLines)
+		} else {
+			snapshot = capture.Plain()
+			history = shellSession.GetTerminalScrollback(scrollbackLines)
+		}
+		if history != "" {
+			historyLines = strings.Count(history, "\n") + 1
+			snapshot = history + "\n" + snapshot
+		}
+	case "spans":
+		history := shellSession.GetTerminalScrollbackSpans(scrollbackLines)
+		historyLines = len(history)
+		snapshot = sshmcp.StyledJSON(append(history, capture.Spans()...))
+		fence = "```json"
+	case "html":
+		snapshot = capture.Picture().HTML()
+		fence = "```html"
+	case "png":
+		// PNG 以图片内容块返回，文本块只包含快照信息
+		var err error
+		image, err = capture.Picture().PNG()
+		if err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Render PNG failed: %v", err)}},
+				IsError: true,
+			}, nil, nil
+		}
+	default:
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Invalid format: %s\nValid formats: text, spans, html, png", format)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	// Build result
+	result := fmt.Sprintf("📸 Terminal Snapshot for shell %s of session %s\n\n", shellSession.ID, sessionID)
+	result += waitMsg
+
+	if includeCursorInfo {
+		result += fmt.Sprintf("Cursor Position: (%d, %d)\n", capture.CursorX, capture.CursorY)
+		result += fmt.Sprintf("Terminal Size: %dx%d\n\n", capture.Width, capture.Height)
+	}
+
+	// 全屏程序、光标隐藏、括号粘贴等模式和窗口标题
+	result += renderTerminalModes(shellSession.GetTerminalModes())
+
+	// 记录本次快照，作为该读取方后续 diff 的基准
+	result += fmt.Sprintf("Screen Seq: %d\n\n", shellSession.RecordTerminalSnapshot(reader, capture))
+
+	if scrollbackLines > 0 {
+		result += fmt.Sprintf("Scrollback: %d lines above the screen\n\n", historyLines)
+	}
+
+	if image != nil {
+		result += fmt.Sprintf("PNG image of the %dx%d screen (%s)", capture.Width, capture.Height, formatBytes(float64(len(image))))
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: result},
+				&mcp.ImageContent{Data: image, MIMEType: "image/png"},
+			},
+		}, nil, nil
+	}
+
+	result += fence + "\n"
+	result += snapshot
+	result += "\n```"
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: result}},
+	}, nil, nil
+}
+
+// waitQuiet waits until the shell output settles and describes how long it took
+func waitQuiet(ctx context.Context, shellSession *sshmcp.SSHShellSession, quietSeconds, timeoutSeconds float64) string {
+	quiet := time.Duration(quietSeconds * float64(time.Second))
+	timeout := time.Duration(timeoutSeconds * float64(time.Second))
+	result, err := shellSession.WaitQuiet(ctx, quiet, timeout)
+	waited := result.Waited.Round(time.Millisecond)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("⚠️ Stopped waiting for output to settle after %s: %v", waited, err)
+	case result.TimedOut:
+		return fmt.Sprintf("⏱️ Output still changing after %s (timed out; last output %s ago)", waited, result.Quiet.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("✅ Output settled after %s (no output for %s)", waited, result.Quiet.Round(time.Millisecond))
+}
+
+// renderTerminalModes formats the terminal modes and window title of a snapshot
+func renderTerminalModes(modes sshmcp.TerminalModes) string {
+	result := fmt.Sprintf("Terminal Modes: %s\n", modes)
+	if modes.Title != "" {
+		result += fmt.Sprintf("Window Title: %s\n", modes.Title)
+	}
+	return result + "\n"
+}
+
+// renderScreenDiff formats a screen diff as changed rows or a unified diff
+func renderScreenDiff(diff *sshmcp.ScreenDiff, mode string, explicitBase bool) string {
+	switch {
+	case diff.Unchanged:
+		return fmt.Sprintf("Screen unchanged since seq %d", diff.BaseSeq)
+	case diff.Full:
+		note := "no previous snapshot for this reader"
+		if explicitBase {
+			note = "requested seq is no longer available"
+		}
+		return fmt.Sprintf("Screen Seq: %d (%s, full screen follows)\n\n```\n%s\n```", diff.Seq, note, strings.Join(diff.Lines, "\n"))
+	}
+
+	result := fmt.Sprintf("Screen Seq: %d (since seq %d): %d rows changed, %d cells\n\n",
+		diff.Seq, diff.BaseSeq, len(diff.Changes), diff.ChangedCells())
+	if mode == "unified" {
+		return result + "```diff\n" + strings.TrimRight(diff.Unified(), "\n") + "\n```"
+	}
+
+	// 每行：行号（0 起始，与光标位置一致）、变化的单元格数、新内容
+	result += "```\n"
+	for _, change := range diff.Changes {
+		result += fmt.Sprintf("%3d (%d cells) │ %s\n", change.Row, change.Cells, change.New)
+	}
+	return result + "```"
+}
+
+// handleSSHListHosts handles the ssh_list_hosts tool
+func (s *Server) handleSSHListHosts(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	if s.hostManager == nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Host manager is not available"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	hosts := s.hostManager.ListHosts()
+
+	if len(hosts) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "No predefined hosts configured.\nYou can save hosts using ssh_save_host."}},
+		}, nil, nil
+	}
+
+	output := fmt.Sprintf("Predefined hosts (%d):\n\n", len(hosts))
+	for name, host := range hosts {
+		output += fmt.Sprintf("- %s:\n", name)
+		output += fmt.Sprintf("  Host: %s:%d\n", host.Host, host.Port)
+		output += fmt.Sprintf("  Username: %s\n", host.Username)
+		if host.Description != "" {
+			output += fmt.Sprintf("  Description: %s\n", host.Description)
+		}
+		if host.Password != "" {
+			output += "  Auth: password\n"
+		} else if host.PrivateKeyPath != "" {
+			output += fmt.Sprintf("  Auth: private_key (%s)\n", host.PrivateKeyPath)
+		}
+		output += "\n"
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// handleSSHSaveHost handles the ssh_save_host tool
+func (s *Server) handleSSHSaveHost(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	if s.hostManager == nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Host manager is not available"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	name, _ := args["name"].(string)
+	host, _ := args["host"].(string)
+	username, _ := args["username"].(string)
+	portVal, _ := args["port"].(float64)
+	password, _ := args["password"].(string)
+	privateKeyPath, _ := args["private_key_path"].(string)
+	description, _ := args["description"].(string)
+
+	if name == "" {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Host name is required"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	if host == "" {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Host address is required"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	if username == "" {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Username is required"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	// Check if host already exists
+	if s.hostManager.HostExists(name) {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Host '%s' already exists. Please use a different name or remove the existing host first.", name)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	port := int(portVal)
+	if port == 0 {
+		port = 22
+	}
+
+	hostConfig := sshmcp.HostConfig{
+		Host:            host,
+		Port:            port,
+		Username:        username,
+		Password:        password,
+		PrivateKeyPath:  privateKeyPath,
+		Description:     description,
+	}
+
+	if err := s.hostManager.SaveHost(name, hostConfig); err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to save host: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Host '%s' saved successfully.\nYou can now connect using: hostname=%s", name, name)}},
+	}, nil, nil
+}
+
+// handleSSHRemoveHost handles the ssh_remove_host tool
+func (s *Server) handleSSHRemoveHost(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	if s.hostManager == nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Host manager is not available"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	name, _ := args["name"].(string)
+
+	if name == "" {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: "Host name is required"}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	if err := s.hostManager.RemoveHost(name); err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to remove host: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Host '%s' removed successfully", name)}},
+	}, nil, nil
+}
+
+// handleSSHShellStatus handles the ssh_shell_status tool
+func (s *Server) handleSSHShellStatus(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	status := shellSession.GetStatus()
+	// GetStatus 只返回已知的目录，这里才按需通过 /proc 解析（结果会缓存）
+	status.CurrentDir, status.CurrentDirSource = shellSession.CurrentDir()
+
+	// 计算缓冲区使用百分比
+	bufferPercent := 0.0
+	if status.BufferTotal > 0 {
+		bufferPercent = float64(status.BufferUsed) / float64(status.BufferTotal) * 100
+	}
+
+	// 计算距离上次保活的时间
+	lastKeepalive := "未记录"
+	if !status.LastKeepAlive.IsZero() {
+		lastKeepalive = fmt.Sprintf("%s 前", formatDuration(time.Since(status.LastKeepAlive)))
+	}
+
+	// 格式化输出（异步模式增强版）
+	output := "🔍 Shell 会话状态\n\n"
+
+	// === 基本信息 ===
+	output += "📋 基本信息:\n"
+	output += fmt.Sprintf("  会话 ID: %s\n", sessionID)
+	output += fmt.Sprintf("  Shell ID: %s\n", shellSession.ID)
+	if session.Alias != "" {
+		output += fmt.Sprintf("  会话别名: %s\n", session.Alias)
+	}
+	output += fmt.Sprintf("  状态: %s\n", getStatusEmoji(status.IsActive))
+	if status.CurrentDirSource != "" {
+		output += fmt.Sprintf("  当前目录: %s（来源: %s）\n", status.CurrentDir, status.CurrentDirSource)
+	} else {
+		output += "  当前目录: 未知\n"
+	}
+	output += fmt.Sprintf("  终端: %s (%dx%d)\n", status.TerminalType, status.Rows, status.Cols)
+	output += fmt.Sprintf("  模式: %s\n", status.Mode)
+	output += fmt.Sprintf("  ANSI 处理: %s\n", status.ANSIMode)
+	if status.Emulator != "" {
+		output += fmt.Sprintf("  终端模拟器: %s\n", status.Emulator)
+	}
+	output += fmt.Sprintf("  终端模式: %s\n", status.TerminalModes)
+	if status.TerminalModes.Title != "" {
+		output += fmt.Sprintf("  窗口标题: %s\n", status.TerminalModes.Title)
+	}
+	if status.ShellIntegration != "" {
+		output += fmt.Sprintf("  Shell 集成: %s\n", status.ShellIntegration)
+	}
+	output += "\n"
+
+	// === 活动时间 ===
+	output += "⏱️ 活动时间:\n"
+	output += fmt.Sprintf("  最后读取: %s\n", formatTimeAgo(status.LastReadTime))
+	output += fmt.Sprintf("  最后写入: %s\n", formatTimeAgo(status.LastWriteTime))
+	output += fmt.Sprintf("  最后输出: %s\n", formatTimeAgo(status.LastOutputTime))
+	output += fmt.Sprintf("  会话时长: %s\n", formatDuration(time.Since(session.CreatedAt)))
+	output += "\n"
+
+	// === 缓冲区状态 ===
+	output += "💾 后台缓冲区:\n"
+	output += fmt.Sprintf("  使用量: %d / %d 行 (%.1f%%)\n", status.BufferUsed, status.BufferTotal, bufferPercent)
+	output += fmt.Sprintf("  原始字节: %.2f / %.2f MB\n", float64(status.BufferBytes)/1024/1024, float64(status.BufferBytesTotal)/1024/1024)
+
+	// 缓冲区健康度提示
+	if bufferPercent > 90 {
+		output += "  ⚠️ 警告: 缓冲区接近满载，建议尽快读取或清空\n"
+	} else if bufferPercent > 70 {
+		output += "  ⚡ 提示: 缓冲区使用较高，定期读取可避免数据丢失\n"
+	} else if status.BufferUsed == 0 {
+		output += "  ℹ️ 缓冲区为空，使用 ssh_write_input 发送命令后使用 ssh_read_output 读取\n"
+	} else {
+		output += "  ✅ 缓冲区状态正常\n"
+	}
+	output += "\n"
+
+	// === 保活状态 ===
+	output += "❤️ 保活机制:\n"
+	output += fmt.Sprintf("  TCP Keepalive: 启用 (30秒间隔)\n")
+	output += fmt.Sprintf("  SSH Keepalive: 启用 (30秒间隔)\n")
+	output += fmt.Sprintf("  应用层心跳: 启用 (60秒间隔)\n")
+	output += fmt.Sprintf("  上次成功: %s\n", lastKeepalive)
+
+	// 保活健康度提示
+	if status.KeepAliveFails > 0 {
+		output += fmt.Sprintf("  ⚠️ 连续失败: %d 次\n", status.KeepAliveFails)
+		if status.KeepAliveFails >= 3 {
+			output += "  🚨 严重: 会话可能已断开，建议重新连接\n"
+		} else {
+			output += "  ⚡ 提示: 检测到网络不稳定，监控中...\n"
+		}
+	} else {
+		output += "  ✅ 保活状态正常\n"
+	}
+	output += "\n"
+
+	// === 推荐操作 ===
+	output += "🎯 推荐操作:\n"
+	if !status.IsActive {
+		output += "  ❌ 会话已断开，请使用 ssh_disconnect 断开后重新连接\n"
+	} else if status.BufferUsed > 0 {
+		output += fmt.Sprintf("  📖 读取输出: ssh_read_output(session_id=\"%s\", shell_id=\"%s\", strategy=\"latest_lines\", limit=20)\n", sessionID, shellSession.ID)
+	}
+	if status.LastWriteTime.IsZero() || time.Since(status.LastWriteTime) > 5*time.Minute {
+		output += fmt.Sprintf("  ⌨️ 发送命令: ssh_write_input(session_id=\"%s\", shell_id=\"%s\", input=\"your_command\")\n", sessionID, shellSession.ID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// handleSSHListShells handles the ssh_list_shells tool
+func (s *Server) handleSSHListShells(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shells := session.ListShells()
+	if len(shells) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No shells in session %s\nHint: Use ssh_shell() to start an interactive shell", sessionID)}},
+		}, nil, nil
+	}
+
+	defaultShell := session.GetShellSession()
+
+	output := fmt.Sprintf("🐚 Shells in session %s (%d):\n\n", sessionID, len(shells))
+	for _, shell := range shells {
+		status := shell.GetStatus()
+		marker := ""
+		if shell == defaultShell {
+			marker = " (default)"
+		}
+		output += fmt.Sprintf("- %s%s\n", shell.ID, marker)
+		output += fmt.Sprintf("  状态: %s\n", getStatusEmoji(status.IsActive))
+		output += fmt.Sprintf("  终端: %s (%dx%d)\n", status.TerminalType, status.Rows, status.Cols)
+		output += fmt.Sprintf("  缓冲区: %d / %d 行\n", status.BufferUsed, status.BufferTotal)
+		output += fmt.Sprintf("  创建时间: %s\n", formatTimeAgo(shell.CreatedAt))
+		output += fmt.Sprintf("  最后写入: %s\n", formatTimeAgo(status.LastWriteTime))
+		if rec := shell.Recording(); rec != nil && rec.Active {
+			output += fmt.Sprintf("  录制: %s\n", rec.Path)
+		} else if rec != nil {
+			output += fmt.Sprintf("  录制: %s（已达大小上限，已停止）\n", rec.Path)
+		}
+	}
+	output += "\n💡 省略 shell_id 时，Shell 工具使用标记为 default 的 Shell"
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// handleSSHCloseShell handles the ssh_close_shell tool
+func (s *Server) handleSSHCloseShell(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	if err := session.CloseShell(shellSession.ID); err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Close shell failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	output := fmt.Sprintf("Shell %s of session %s closed", shellSession.ID, sessionID)
+	if next := session.GetShellSession(); next != nil {
+		output += fmt.Sprintf("\nDefault shell is now %s", next.ID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+	}, nil, nil
+}
+
+// handleSSHRecordStart handles the ssh_record_start tool
+func (s *Server) handleSSHRecordStart(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+	input, _ := args["input"].(bool)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
+	}
+
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	session.RLock()
-	hasShell := session.ShellSession != nil
-	session.RUnlock()
-
-	if !hasShell {
+	info, err := session.StartRecording(shellSession.ID, input)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No active shell session for session_id: %s\nHint: Use ssh_shell() to start an interactive shell first", sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Start recording failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	// Get the terminal snapshot
-	var snapshot string
-	if withColor {
-		snapshot = session.ShellSession.GetTerminalSnapshotWithColor()
+	output := fmt.Sprintf("⏺️ Recording shell %s of session %s\n", shellSession.ID, sessionID)
+	output += fmt.Sprintf("  文件: %s\n", info.Path)
+	output += "  格式: asciicast v2（可用 asciinema play 回放）\n"
+	if info.Input {
+		output += "  输入事件: 已记录\n"
 	} else {
-		snapshot = session.ShellSession.GetTerminalSnapshot()
-	}
-
-	// Build result
-	result := fmt.Sprintf("📸 Terminal Snapshot for session %s\n\n", sessionID)
-
-	if includeCursorInfo {
-		x, y := session.ShellSession.GetCursorPosition()
-		w, h := session.ShellSession.GetTerminalSize()
-		result += fmt.Sprintf("Cursor Position: (%d, %d)\n", x, y)
-		result += fmt.Sprintf("Terminal Size: %dx%d\n\n", w, h)
+		output += "  输入事件: 未记录（input=true 可记录键入内容）\n"
 	}
-
-	result += "```\n"
-	result += snapshot
-	result += "\n```"
+	output += "\n💡 使用 ssh_record_stop 结束录制"
 
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: result}},
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSSHListHosts handles the ssh_list_hosts tool
-func (s *Server) handleSSHListHosts(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
-	if s.hostManager == nil {
+// handleSSHRecordStop handles the ssh_record_stop tool
+func (s *Server) handleSSHRecordStop(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Host manager is not available"}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	hosts := s.hostManager.ListHosts()
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
-	if len(hosts) == 0 {
+	info, err := session.StopRecording(shellSession.ID)
+	if info == nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "No predefined hosts configured.\nYou can save hosts using ssh_save_host."}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Stop recording failed: %v\nHint: Use ssh_record_start() to start recording", err)}},
+			IsError: true,
 		}, nil, nil
 	}
 
-	output := fmt.Sprintf("Predefined hosts (%d):\n\n", len(hosts))
-	for name, host := range hosts {
-		output += fmt.Sprintf("- %s:\n", name)
-		output += fmt.Sprintf("  Host: %s:%d\n", host.Host, host.Port)
-		output += fmt.Sprintf("  Username: %s\n", host.Username)
-		if host.Description != "" {
-			output += fmt.Sprintf("  Description: %s\n", host.Description)
-		}
-		if host.Password != "" {
-			output += "  Auth: password\n"
-		} else if host.PrivateKeyPath != "" {
-			output += fmt.Sprintf("  Auth: private_key (%s)\n", host.PrivateKeyPath)
-		}
-		output += "\n"
+	output := fmt.Sprintf("⏹️ Recording of shell %s stopped\n", shellSession.ID)
+	output += fmt.Sprintf("  文件: %s\n", info.Path)
+	output += fmt.Sprintf("  时长: %s\n", formatDuration(info.Duration))
+	output += fmt.Sprintf("  大小: %s\n", formatBytes(float64(info.Bytes)))
+	output += fmt.Sprintf("  事件数: %d\n", info.Events)
+	if info.Truncated {
+		output += "  ⚠️ 已达到录制大小上限，之后的输出未记录\n"
+	}
+	if err != nil {
+		output += fmt.Sprintf("  ⚠️ 写入录制文件时出错: %v\n", err)
 	}
 
 	return &mcp.CallToolResult{
@@ -947,111 +2420,170 @@ func (s *Server) handleSSHListHosts(ctx context.Context, req *mcp.CallToolReques
 	}, nil, nil
 }
 
-// handleSSHSaveHost handles the ssh_save_host tool
-func (s *Server) handleSSHSaveHost(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
-	if s.hostManager == nil {
+// handleSSHReplaySnapshot handles the ssh_replay_snapshot tool
+func (s *Server) handleSSHReplaySnapshot(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	name, _ := args["recording"].(string)
+	formatArg, _ := args["format"].(string)
+	emulator, _ := args["emulator"].(string)
+
+	at := -1.0
+	if v, ok := args["at"].(float64); ok {
+		at = v
+	}
+	interval := 0.0
+	if v, ok := args["interval"].(float64); ok {
+		interval = v
+	}
+	opts := replay.Options{Emulator: sshmcp.TerminalEmulatorType(emulator)}
+	if v, ok := args["width"].(float64); ok {
+		opts.Width = int(v)
+	}
+	if v, ok := args["height"].(float64); ok {
+		opts.Height = int(v)
+	}
+
+	format, err := replay.ParseOutputFormat(formatArg)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Host manager is not available"}},
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
 			IsError: true,
 		}, nil, nil
 	}
+	if emulator != "" {
+		if _, err := sshmcp.ParseTerminalEmulatorType(emulator); err != nil {
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+				IsError: true,
+			}, nil, nil
+		}
+	}
 
-	name, _ := args["name"].(string)
-	host, _ := args["host"].(string)
-	username, _ := args["username"].(string)
-	portVal, _ := args["port"].(float64)
-	password, _ := args["password"].(string)
-	privateKeyPath, _ := args["private_key_path"].(string)
-	description, _ := args["description"].(string)
-
-	if name == "" {
+	// 只允许读取录制目录中的文件
+	path, err := s.sessionManager.ResolveRecording(name)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Host name is required"}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_list_recordings() to see available recordings", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	if host == "" {
+	rec, err := replay.Load(path)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Host address is required"}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_list_recordings() to see available recordings", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	if username == "" {
+	var frames []replay.Frame
+	if interval > 0 {
+		frames, err = replay.Frames(rec, interval, opts)
+	} else {
+		var frame replay.Frame
+		frame, err = replay.Snapshot(rec, at, opts)
+		frames = []replay.Frame{frame}
+	}
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Username is required"}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Replay failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	// Check if host already exists
-	if s.hostManager.HostExists(name) {
+	screen, err := replay.Render(frames, format)
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Host '%s' already exists. Please use a different name or remove the existing host first.", name)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Replay failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	port := int(portVal)
-	if port == 0 {
-		port = 22
-	}
-
-	hostConfig := sshmcp.HostConfig{
-		Host:            host,
-		Port:            port,
-		Username:        username,
-		Password:        password,
-		PrivateKeyPath:  privateKeyPath,
-		Description:     description,
+	last := frames[len(frames)-1]
+	output := fmt.Sprintf("🎞️ Replay of %s\n", filepath.Base(path))
+	output += fmt.Sprintf("  录制时长: %.3fs\n", rec.Duration)
+	if len(frames) == 1 {
+		output += fmt.Sprintf("  快照时间: %.3fs\n", last.Time)
+	} else {
+		output += fmt.Sprintf("  帧数: %d（间隔 %.3fs）\n", len(frames), interval)
 	}
-
-	if err := s.hostManager.SaveHost(name, hostConfig); err != nil {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to save host: %v", err)}},
-			IsError: true,
-		}, nil, nil
+	output += fmt.Sprintf("  终端: %dx%d，光标 (%d, %d)\n\n", last.Width, last.Height, last.CursorX, last.CursorY)
+	if format == replay.FormatFrames {
+		output += "```json\n" + screen + "\n```"
+	} else {
+		output += "```\n" + screen + "\n```"
 	}
 
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Host '%s' saved successfully.\nYou can now connect using: hostname=%s", name, name)}},
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSSHRemoveHost handles the ssh_remove_host tool
-func (s *Server) handleSSHRemoveHost(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
-	if s.hostManager == nil {
+// handleSSHListRecordings handles the ssh_list_recordings tool
+func (s *Server) handleSSHListRecordings(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	files, err := s.sessionManager.ListRecordings()
+	if err != nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Host manager is not available"}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("List recordings failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	name, _ := args["name"].(string)
-
-	if name == "" {
+	if len(files) == 0 {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: "Host name is required"}},
-			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: "No recordings found\nHint: Use ssh_record_start() to record a shell"}},
 		}, nil, nil
 	}
 
-	if err := s.hostManager.RemoveHost(name); err != nil {
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Failed to remove host: %v", err)}},
-			IsError: true,
-		}, nil, nil
+	output := fmt.Sprintf("🎬 Recordings (%d):\n\n", len(files))
+	for _, f := range files {
+		marker := ""
+		if f.Active {
+			marker = " (recording)"
+		}
+		output += fmt.Sprintf("- %s%s\n", f.Name, marker)
+		output += fmt.Sprintf("  路径: %s\n", f.Path)
+		output += fmt.Sprintf("  大小: %s\n", formatBytes(float64(f.Size)))
+		output += fmt.Sprintf("  修改时间: %s\n", f.ModTime.Format("2006-01-02 15:04:05"))
 	}
 
 	return &mcp.CallToolResult{
-		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Host '%s' removed successfully", name)}},
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
 	}, nil, nil
 }
 
-// handleSSHShellStatus handles the ssh_shell_status tool
-func (s *Server) handleSSHShellStatus(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+// handleSSHExpect handles the ssh_expect tool
+func (s *Server) handleSSHExpect(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
 	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+	input, _ := args["input"].(string)
+	timeoutVal, _ := args["timeout"].(float64)
+	matchScreen, _ := args["match_screen"].(bool)
+	maxMatchesVal, _ := args["max_matches"].(float64)
+
+	opts := &sshmcp.ExpectOptions{
+		Input:      input,
+		Timeout:    time.Duration(timeoutVal * float64(time.Second)),
+		Screen:     matchScreen,
+		MaxMatches: int(maxMatchesVal),
+	}
+
+	patternsVal, _ := args["patterns"].([]any)
+	for _, item := range patternsVal {
+		patternMap, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		pattern, _ := patternMap["pattern"].(string)
+		response, _ := patternMap["response"].(string)
+		specialChar, _ := patternMap["special_char"].(string)
+		continueVal, _ := patternMap["continue"].(bool)
+		opts.Patterns = append(opts.Patterns, sshmcp.ExpectPattern{
+			Pattern:     pattern,
+			Response:    response,
+			SpecialChar: specialChar,
+			Continue:    continueVal,
+		})
+	}
 
 	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
 	if err != nil {
@@ -1061,108 +2593,133 @@ func (s *Server) handleSSHShellStatus(ctx context.Context, req *mcp.CallToolRequ
 		}, nil, nil
 	}
 
-	session.RLock()
-	hasShell := session.ShellSession != nil
-	session.RUnlock()
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell() to start an interactive shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
-	if !hasShell {
+	result, err := shellSession.Expect(ctx, opts)
+	if result == nil {
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("No active shell session for session_id: %s\nHint: Use ssh_shell() to start an interactive shell first", sessionID)}},
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Expect failed: %v", err)}},
 			IsError: true,
 		}, nil, nil
 	}
 
-	status := session.ShellSession.GetStatus()
+	var output string
+	switch {
+	case err != nil:
+		output = fmt.Sprintf("❌ Expect failed after %s: %v\n", result.Elapsed.Round(time.Millisecond), err)
+	case result.TimedOut:
+		output = fmt.Sprintf("⏱️ Timed out after %s (%d match(es))\n", result.Elapsed.Round(time.Millisecond), len(result.Matches))
+	default:
+		output = fmt.Sprintf("✅ Matched in %s (%d match(es))\n", result.Elapsed.Round(time.Millisecond), len(result.Matches))
+	}
+	output += fmt.Sprintf("Shell: %s of session %s\n", shellSession.ID, sessionID)
 
-	// 计算缓冲区使用百分比
-	bufferPercent := 0.0
-	if status.BufferTotal > 0 {
-		bufferPercent = float64(status.BufferUsed) / float64(status.BufferTotal) * 100
+	for i, m := range result.Matches {
+		output += fmt.Sprintf("\n[%d] pattern #%d: %s", i+1, m.Index, m.Pattern)
+		if m.Responded {
+			output += " (responded)"
+		}
+		output += fmt.Sprintf("\n  Match: %q\n", m.Match)
+		if len(m.Groups) > 0 {
+			output += fmt.Sprintf("  Groups: %q\n", m.Groups)
+		}
+		if before := strings.TrimSpace(m.Before); before != "" {
+			output += "  Before:\n```\n" + tailText(before, expectOutputLimit) + "\n```\n"
+		}
 	}
 
-	// 计算距离上次保活的时间
-	lastKeepalive := "未记录"
-	if !status.LastKeepAlive.IsZero() {
-		lastKeepalive = fmt.Sprintf("%s 前", formatDuration(time.Since(status.LastKeepAlive)))
+	if result.TimedOut {
+		pending := strings.TrimSpace(result.Pending)
+		if pending == "" {
+			output += "\nNo unmatched output received.\n"
+		} else {
+			output += "\nUnmatched output:\n```\n" + tailText(pending, expectOutputLimit) + "\n```\n"
+		}
 	}
 
-	// 格式化输出（异步模式增强版）
-	output := "🔍 Shell 会话状态\n\n"
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+		IsError: err != nil || (result.TimedOut && len(result.Matches) == 0),
+	}, nil, nil
+}
 
-	// === 基本信息 ===
-	output += "📋 基本信息:\n"
-	output += fmt.Sprintf("  会话 ID: %s\n", sessionID)
-	if session.Alias != "" {
-		output += fmt.Sprintf("  会话别名: %s\n", session.Alias)
+// expectOutputLimit caps the text ssh_expect shows before a match or on timeout
+const expectOutputLimit = 4000
+
+// tailText returns the last max bytes of s, marking the omitted prefix
+func tailText(s string, max int) string {
+	if len(s) <= max {
+		return s
 	}
-	output += fmt.Sprintf("  状态: %s\n", getStatusEmoji(status.IsActive))
-	output += fmt.Sprintf("  当前目录: %s\n", status.CurrentDir)
-	output += fmt.Sprintf("  终端: %s (%dx%d)\n", status.TerminalType, status.Rows, status.Cols)
-	output += fmt.Sprintf("  模式: %s\n", status.Mode)
-	output += fmt.Sprintf("  ANSI 处理: %s\n", status.ANSIMode)
-	output += "\n"
+	cut := len(s) - max
+	for cut < len(s) && !utf8.RuneStart(s[cut]) {
+		cut++
+	}
+	return fmt.Sprintf("... (%d bytes omitted)\n%s", cut, s[cut:])
+}
 
-	// === 活动时间 ===
-	output += "⏱️ 活动时间:\n"
-	output += fmt.Sprintf("  最后读取: %s\n", formatTimeAgo(status.LastReadTime))
-	output += fmt.Sprintf("  最后写入: %s\n", formatTimeAgo(status.LastWriteTime))
-	output += fmt.Sprintf("  会话时长: %s\n", formatDuration(time.Since(session.CreatedAt)))
-	output += "\n"
+// handleSSHShellRun handles the ssh_shell_run tool
+func (s *Server) handleSSHShellRun(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+	sessionID, _ := args["session_id"].(string)
+	shellID, _ := args["shell_id"].(string)
+	command, _ := args["command"].(string)
+	timeoutVal, _ := args["timeout"].(float64)
 
-	// === 缓冲区状态 ===
-	output += "💾 后台缓冲区:\n"
-	output += fmt.Sprintf("  使用量: %d / %d 行 (%.1f%%)\n", status.BufferUsed, status.BufferTotal, bufferPercent)
-	if status.BufferUsed > 0 {
-		// 估算缓冲区大小（假设平均每行 100 字节）
-		estimatedSize := float64(status.BufferUsed) * 100 / 1024 / 1024
-		output += fmt.Sprintf("  估算大小: ~%.2f MB\n", estimatedSize)
+	session, err := s.sessionManager.GetSessionByIDOrAlias(sessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Session not found: %v\nHint: Use ssh_list_sessions() to see all active sessions", err)}},
+			IsError: true,
+		}, nil, nil
 	}
 
-	// 缓冲区健康度提示
-	if bufferPercent > 90 {
-		output += "  ⚠️ 警告: 缓冲区接近满载，建议尽快读取或清空\n"
-	} else if bufferPercent > 70 {
-		output += "  ⚡ 提示: 缓冲区使用较高，定期读取可避免数据丢失\n"
-	} else if status.BufferUsed == 0 {
-		output += "  ℹ️ 缓冲区为空，使用 ssh_write_input 发送命令后使用 ssh_read_output 读取\n"
-	} else {
-		output += "  ✅ 缓冲区状态正常\n"
+	shellSession, err := session.GetShell(shellID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%v\nHint: Use ssh_shell(shell_integration=true) to start a shell first, or ssh_list_shells() to see existing shells", err)}},
+			IsError: true,
+		}, nil, nil
 	}
-	output += "\n"
 
-	// === 保活状态 ===
-	output += "❤️ 保活机制:\n"
-	output += fmt.Sprintf("  TCP Keepalive: 启用 (30秒间隔)\n")
-	output += fmt.Sprintf("  SSH Keepalive: 启用 (30秒间隔)\n")
-	output += fmt.Sprintf("  应用层心跳: 启用 (60秒间隔)\n")
-	output += fmt.Sprintf("  上次成功: %s\n", lastKeepalive)
+	timeout := time.Duration(timeoutVal * float64(time.Second))
+	cmd, err := shellSession.RunCommand(ctx, command, timeout)
+	if cmd == nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Shell run failed: %v", err)}},
+			IsError: true,
+		}, nil, nil
+	}
 
-	// 保活健康度提示
-	if status.KeepAliveFails > 0 {
-		output += fmt.Sprintf("  ⚠️ 连续失败: %d 次\n", status.KeepAliveFails)
-		if status.KeepAliveFails >= 3 {
-			output += "  🚨 严重: 会话可能已断开，建议重新连接\n"
-		} else {
-			output += "  ⚡ 提示: 检测到网络不稳定，监控中...\n"
-		}
+	var output string
+	if err != nil {
+		output = fmt.Sprintf("⏳ %v (shell %s of session %s)\n", err, shellSession.ID, sessionID)
+		output += fmt.Sprintf("Command: %s\n", cmd.Command)
+		output += fmt.Sprintf("Running: %s\n", cmd.Duration.Round(time.Millisecond))
 	} else {
-		output += "  ✅ 保活状态正常\n"
+		output = fmt.Sprintf("Exit Code: %d\n", cmd.ExitCode)
+		output += fmt.Sprintf("Command: %s\n", cmd.Command)
+		output += fmt.Sprintf("Shell: %s of session %s\n", shellSession.ID, sessionID)
+		output += fmt.Sprintf("Execution Time: %s\n", cmd.Duration.Round(time.Millisecond))
 	}
-	output += "\n"
-
-	// === 推荐操作 ===
-	output += "🎯 推荐操作:\n"
-	if !status.IsActive {
-		output += "  ❌ 会话已断开，请使用 ssh_disconnect 断开后重新连接\n"
-	} else if status.BufferUsed > 0 {
-		output += fmt.Sprintf("  📖 读取输出: ssh_read_output(session_id=\"%s\", strategy=\"latest_lines\", limit=20)\n", sessionID)
+	if cmd.Truncated {
+		output += "Note: output truncated, only the last 1 MB is kept\n"
 	}
-	if status.LastWriteTime.IsZero() || time.Since(status.LastWriteTime) > 5*time.Minute {
-		output += fmt.Sprintf("  ⌨️ 发送命令: ssh_write_input(session_id=\"%s\", input=\"your_command\")\n", sessionID)
+	if cmd.Output != "" {
+		output += fmt.Sprintf("\nOUTPUT:\n%s\n", strings.TrimRight(cmd.Output, "\n"))
+	}
+	if err != nil {
+		output += fmt.Sprintf("\n💡 The command keeps running. Use ssh_expect or ssh_read_output(session_id=\"%s\", shell_id=\"%s\") to follow it, or ssh_write_input(special_char=\"ctrl+c\") to stop it.\n", sessionID, shellSession.ID)
 	}
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{&mcp.TextContent{Text: output}},
+		IsError: err != nil,
 	}, nil, nil
 }
 
@@ -1233,6 +2790,9 @@ func (s *Server) handleSSHHistory(ctx context.Context, req *mcp.CallToolRequest,
 		if sourceLabel == "" {
 			sourceLabel = "unknown"
 		}
+		if entry.ShellID != "" {
+			sourceLabel += ", shell: " + entry.ShellID
+		}
 		output += fmt.Sprintf("%d. [%s] %s [source: %s]\n", i+1, status, entry.Command, sourceLabel)
 		output += fmt.Sprintf("   Exit Code: %d\n", entry.ExitCode)
 		output += fmt.Sprintf("   Time: %s\n", entry.Timestamp.Format("2006-01-02 15:04:05"))
@@ -1244,6 +2804,37 @@ func (s *Server) handleSSHHistory(ctx context.Context, req *mcp.CallToolRequest,
 	}, nil, nil
 }
 
+// formatVerification formats the checksum verification part of a transfer result
+func formatVerification(result *sshmcp.FileTransferResult) string {
+	if !result.Verified {
+		return ""
+	}
+	output := fmt.Sprintf("  Verified: ✓ %s (%d file(s))\n", result.ChecksumAlgorithm, result.VerifiedFiles)
+	if result.Checksum != "" {
+		output += fmt.Sprintf("  Checksum: %s\n", result.Checksum)
+	}
+	return output
+}
+
+// formatArchiveTransfer formats file count, archive and fallback details of a transfer result
+func formatArchiveTransfer(result *sshmcp.FileTransferResult) string {
+	output := ""
+	if result.FilesTransferred > 0 {
+		output += fmt.Sprintf("  Files: %d\n", result.FilesTransferred)
+	}
+	if result.ArchiveFormat != "" {
+		output += fmt.Sprintf("  Archive: %s, %s on the wire", result.ArchiveFormat, formatBytes(float64(result.ArchiveBytes)))
+		if result.CompressionRatio > 0 {
+			output += fmt.Sprintf(" (ratio %.2fx)", result.CompressionRatio)
+		}
+		output += "\n"
+	}
+	if result.Fallback != "" {
+		output += fmt.Sprintf("  Note: %s\n", result.Fallback)
+	}
+	return output
+}
+
 // Helper functions for enhanced status display
 
 // getStatusEmoji returns a status indicator with emoji
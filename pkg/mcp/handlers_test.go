@@ -342,7 +342,9 @@ func TestHandleSFTPMkdir(t *testing.T) {
 	assert.NotNil(t, result.Content)
 
 	// Clean up
-	session.SFTPClient.Remove(testDir)
+	client, err := session.SFTP()
+	require.NoError(t, err)
+	client.Remove(testDir)
 }
 
 // TestHandleSFTPDelete tests sftp_delete handler
@@ -358,7 +360,9 @@ func TestHandleSFTPDelete(t *testing.T) {
 
 	// First create a file using SFTP
 	testFile := "/tmp/sshmcp_delete_test.txt"
-	f, err := session.SFTPClient.Create(testFile)
+	client, err := session.SFTP()
+	require.NoError(t, err)
+	f, err := client.Create(testFile)
 	require.NoError(t, err)
 	f.Write([]byte("test"))
 	f.Close()
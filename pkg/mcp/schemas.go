@@ -137,6 +137,10 @@ func sshShellSchema() map[string]any {
 			"type":        "string",
 			"description": "会话 ID 或别名",
 		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。同一会话可同时运行多个 Shell，用于区分它们，例如：build、logs。省略时自动生成（shell-1、shell-2…）；与已有 Shell 重名会报错",
+		},
 		"rows": map[string]any{
 			"type":        "integer",
 			"description": "终端行数，默认 40。建议值：40 行适合 htop/top，50 行适合 vim",
@@ -151,6 +155,33 @@ func sshShellSchema() map[string]any {
 			"type":        "string",
 			"description": "工作目录（可选）。启动 shell 前会自动执行 cd 命令切换到此目录。例如：/home/user/projects",
 		},
+		"shell_integration": map[string]any{
+			"type":        "boolean",
+			"description": "是否安装 Shell 集成钩子（OSC 133 提示符标记，支持 bash/zsh，其他 shell 使用哨兵标记）。启用后可用 ssh_shell_run 执行命令并获取输出和退出码，shell 中执行的命令会记录到 ssh_history（source=shell）。默认 false",
+			"default":     false,
+		},
+		"track_cwd": map[string]any{
+			"type":        "boolean",
+			"description": "是否安装工作目录钩子（bash/zsh 在每个提示符前发出 OSC 7，并报告 shell 进程号和远程 $HOME）。没有 OSC 7 时通过独立 exec 通道读取 /proc/<pid>/cwd。ssh_shell_status 的当前目录来自这里。默认 true",
+			"default":     true,
+		},
+		"ansi_mode": map[string]any{
+			"type": "string",
+			"description": `ssh_read_output 默认的 ANSI 处理方式（缓冲区始终保存原始输出，可在读取时单独指定）：
+- "raw"：保留 ANSI 序列、回车和空行（默认）
+- "strip"：输出纯文本，回车重绘的进度条只保留最后一次内容
+- "parse"：JSON 样式片段（文本 + 前景/背景色、粗体、下划线、反显）`,
+			"enum":    []string{"raw", "strip", "parse"},
+			"default": "raw",
+		},
+		"emulator": map[string]any{
+			"type": "string",
+			"description": `ssh_terminal_snapshot 使用的终端模拟器（可选，省略时使用 SSH_MCP_TERMINAL_EMULATOR，默认 vt10x）：
+- "vt10x"：ActiveState/vt10x
+- "vt100"：vito/vt100
+- "ansi"：基于 charmbracelet/x/ansi 的内置模拟器，支持备用屏幕、滚动区域、中文等宽字符、组合字符和真彩色`,
+			"enum": []string{"vt10x", "vt100", "ansi"},
+		},
 	}, []string{"session_id"})
 }
 
@@ -179,6 +210,41 @@ func sftpUploadSchema() map[string]any {
 			"description": "是否覆盖已存在文件，默认 false。设置为 true 时会覆盖远程同名文件，请谨慎使用",
 			"default":     false,
 		},
+		"verify": map[string]any{
+			"type":        "boolean",
+			"description": "是否在传输后进行端到端校验（默认 false）。开启后边传输边计算本地校验和，并在远程通过 sha256sum/shasum/openssl 计算校验和进行比对，不一致时传输失败",
+			"default":     false,
+		},
+		"checksum_algorithm": map[string]any{
+			"type":        "string",
+			"description": "校验算法（配合 verify 使用），默认 sha256",
+			"enum":        []string{"sha256", "sha1", "sha512", "md5"},
+			"default":     "sha256",
+		},
+		"keep_on_mismatch": map[string]any{
+			"type":        "boolean",
+			"description": "校验失败时是否保留已传输的（损坏的）文件，默认 false（自动删除）",
+			"default":     false,
+		},
+		"archive": map[string]any{
+			"type":        "string",
+			"description": "传输目录时打包为单个 tar 流（通过 SSH 管道传给远程 tar），大量小文件时比逐个 SFTP 传输快得多。gzip/zstd 会额外压缩；远程没有 tar 时自动回退到 SFTP，缺少 zstd/gzip 时自动降级。对单个文件无效",
+			"enum":        []string{"tar", "gzip", "zstd"},
+		},
+		"include": map[string]any{
+			"type":        "array",
+			"description": "传输目录时只包含匹配的文件（glob 模式，支持 **），例如 [\"*.go\", \"config/**\"]",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
+		"exclude": map[string]any{
+			"type":        "array",
+			"description": "传输目录时排除匹配的路径（gitignore 语法），例如 [\"node_modules/\", \"*.log\"]",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
 	}, []string{"session_id", "local_path", "remote_path"})
 }
 
@@ -207,9 +273,178 @@ func sftpDownloadSchema() map[string]any {
 			"description": "是否覆盖已存在文件，默认 false。设置为 true 时会覆盖远程同名文件，请谨慎使用",
 			"default":     false,
 		},
+		"verify": map[string]any{
+			"type":        "boolean",
+			"description": "是否在传输后进行端到端校验（默认 false）。开启后边传输边计算本地校验和，并在远程通过 sha256sum/shasum/openssl 计算校验和进行比对，不一致时传输失败",
+			"default":     false,
+		},
+		"checksum_algorithm": map[string]any{
+			"type":        "string",
+			"description": "校验算法（配合 verify 使用），默认 sha256",
+			"enum":        []string{"sha256", "sha1", "sha512", "md5"},
+			"default":     "sha256",
+		},
+		"keep_on_mismatch": map[string]any{
+			"type":        "boolean",
+			"description": "校验失败时是否保留已传输的（损坏的）文件，默认 false（自动删除）",
+			"default":     false,
+		},
+		"archive": map[string]any{
+			"type":        "string",
+			"description": "传输目录时打包为单个 tar 流（通过 SSH 管道传给远程 tar），大量小文件时比逐个 SFTP 传输快得多。gzip/zstd 会额外压缩；远程没有 tar 时自动回退到 SFTP，缺少 zstd/gzip 时自动降级。对单个文件无效",
+			"enum":        []string{"tar", "gzip", "zstd"},
+		},
+		"include": map[string]any{
+			"type":        "array",
+			"description": "传输目录时只包含匹配的文件（glob 模式，支持 **），例如 [\"*.go\", \"config/**\"]",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
+		"exclude": map[string]any{
+			"type":        "array",
+			"description": "传输目录时排除匹配的路径（gitignore 语法），例如 [\"node_modules/\", \"*.log\"]",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
 	}, []string{"session_id", "remote_path", "local_path"})
 }
 
+// sftpCopyBetweenSchema returns the input schema for sftp_copy_between
+func sftpCopyBetweenSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"source_session_id": map[string]any{
+			"type":        "string",
+			"description": "源会话 ID 或别名",
+		},
+		"source_path": map[string]any{
+			"type":        "string",
+			"description": "源主机上的文件或目录路径",
+		},
+		"dest_session_id": map[string]any{
+			"type":        "string",
+			"description": "目标会话 ID 或别名（可以与源会话相同）",
+		},
+		"dest_path": map[string]any{
+			"type":        "string",
+			"description": "目标主机上的路径。复制目录时，源目录的内容会放到该目录下",
+		},
+		"create_dirs": map[string]any{
+			"type":        "boolean",
+			"description": "是否创建目标父目录，默认 true",
+			"default":     true,
+		},
+		"overwrite": map[string]any{
+			"type":        "boolean",
+			"description": "是否覆盖目标主机上已存在的文件，默认 false",
+			"default":     false,
+		},
+		"verify": map[string]any{
+			"type":        "boolean",
+			"description": "复制后在目标主机计算校验和并与源数据比对（默认 false），不一致时复制失败",
+			"default":     false,
+		},
+		"checksum_algorithm": map[string]any{
+			"type":        "string",
+			"description": "校验算法（配合 verify 使用），默认 sha256",
+			"enum":        []string{"sha256", "sha1", "sha512", "md5"},
+			"default":     "sha256",
+		},
+		"keep_on_mismatch": map[string]any{
+			"type":        "boolean",
+			"description": "校验失败时是否保留目标文件，默认 false（自动删除）",
+			"default":     false,
+		},
+		"direct": map[string]any{
+			"type":        "boolean",
+			"description": "尝试在源主机上执行 rsync（两端都有时）或 scp 直接推送到目标主机，数据不经过 MCP 服务器。需要源主机能以密钥方式登录目标主机，失败时自动回退为中转。默认 false",
+			"default":     false,
+		},
+		"direct_host": map[string]any{
+			"type":        "string",
+			"description": "direct 模式下源主机访问目标主机使用的地址（例如内网 IP），默认使用目标会话的主机地址",
+		},
+		"accept_new_host_key": map[string]any{
+			"type":        "boolean",
+			"description": "direct 模式下是否让源主机信任并记住目标主机未知的主机密钥（StrictHostKeyChecking=accept-new）。默认 false：目标主机密钥必须已在源主机的 known_hosts 中，否则直接复制失败并回退为中转",
+			"default":     false,
+		},
+	}, []string{"source_session_id", "source_path", "dest_session_id", "dest_path"})
+}
+
+// sftpSyncSchema returns the input schema for sftp_sync
+func sftpSyncSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"local_path": map[string]any{
+			"type":        "string",
+			"description": "本地目录路径",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程目录路径",
+		},
+		"direction": map[string]any{
+			"type":        "string",
+			"description": "同步方向：push（本地 → 远程，默认）或 pull（远程 → 本地）",
+			"enum":        []string{"push", "pull"},
+			"default":     "push",
+		},
+		"compare": map[string]any{
+			"type":        "string",
+			"description": "文件比较方式：size_mtime（比较大小和修改时间，默认，快速）或 checksum（大小相同时比较校验和，准确但较慢）",
+			"enum":        []string{"size_mtime", "checksum"},
+			"default":     "size_mtime",
+		},
+		"checksum_algorithm": map[string]any{
+			"type":        "string",
+			"description": "校验算法（compare=checksum 时使用），默认 sha256",
+			"enum":        []string{"sha256", "sha1", "sha512", "md5"},
+			"default":     "sha256",
+		},
+		"delete": map[string]any{
+			"type":        "boolean",
+			"description": "是否删除目标端多余的文件（源端不存在的文件），默认 false。被排除的文件不会被删除",
+			"default":     false,
+		},
+		"include": map[string]any{
+			"type":        "array",
+			"description": "只同步匹配的文件（glob 模式，支持 **），例如 [\"*.go\", \"config/**\"]。留空表示全部文件",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
+		"exclude": map[string]any{
+			"type":        "array",
+			"description": "排除匹配的路径（gitignore 语法，支持 !、** 和以 / 结尾的目录模式），例如 [\"node_modules/\", \"*.log\"]",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
+		"ignore_files": map[string]any{
+			"type":        "array",
+			"description": "源目录树中 gitignore 风格的忽略文件名，例如 [\".gitignore\"]。各目录下的忽略文件只作用于该目录",
+			"items": map[string]any{
+				"type": "string",
+			},
+		},
+		"dry_run": map[string]any{
+			"type":        "boolean",
+			"description": "只列出计划执行的操作，不实际传输或删除，默认 false",
+			"default":     false,
+		},
+		"preserve": map[string]any{
+			"type":        "boolean",
+			"description": "是否保留文件权限和修改时间，默认 true",
+			"default":     true,
+		},
+	}, []string{"session_id", "local_path", "remote_path"})
+}
+
 // sftpListDirSchema returns the input schema for sftp_list_dir
 func sftpListDirSchema() map[string]any {
 	return getCommonJSONSchema(map[string]any{
@@ -273,6 +508,302 @@ func sftpDeleteSchema() map[string]any {
 	}, []string{"session_id", "remote_path"})
 }
 
+// sftpReadFileSchema returns the input schema for sftp_read_file
+func sftpReadFileSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件路径",
+		},
+		"offset": map[string]any{
+			"type":        "integer",
+			"description": "起始字节偏移，默认 0",
+			"default":     0,
+		},
+		"length": map[string]any{
+			"type":        "integer",
+			"description": "读取字节数，默认 0（读到文件末尾，受 max_bytes 限制）",
+			"default":     0,
+		},
+		"start_line": map[string]any{
+			"type":        "integer",
+			"description": "起始行号（从 1 开始）。设置后按行读取，忽略 offset/length",
+		},
+		"end_line": map[string]any{
+			"type":        "integer",
+			"description": "结束行号（包含），默认读到文件末尾",
+		},
+		"max_bytes": map[string]any{
+			"type":        "integer",
+			"description": "最多返回的字节数，默认 1048576（1MB），上限 16MB。超出时内容被截断",
+			"default":     1048576,
+		},
+		"encoding": map[string]any{
+			"type":        "string",
+			"description": "内容编码：auto（默认，文本以 UTF-8 返回，二进制以 base64 返回）、utf-8（强制按文本返回）、base64（强制 base64）",
+			"enum":        []string{"auto", "utf-8", "base64"},
+			"default":     "auto",
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpWriteFileSchema returns the input schema for sftp_write_file
+func sftpWriteFileSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件路径",
+		},
+		"content": map[string]any{
+			"type":        "string",
+			"description": "文件内容（文本）。与 content_base64 二选一",
+		},
+		"content_base64": map[string]any{
+			"type":        "string",
+			"description": "文件内容（base64 编码，用于二进制数据）。与 content 二选一",
+		},
+		"mode": map[string]any{
+			"type":        "string",
+			"description": "文件权限（八进制），例如 \"0644\"。默认保留原文件权限，新文件为 0644",
+		},
+		"create_dirs": map[string]any{
+			"type":        "boolean",
+			"description": "是否创建父目录，默认 false",
+			"default":     false,
+		},
+		"atomic": map[string]any{
+			"type":        "boolean",
+			"description": "是否原子写入（先写同目录临时文件再 rename），默认 true",
+			"default":     true,
+		},
+		"backup": map[string]any{
+			"type":        "boolean",
+			"description": "覆盖前是否备份原文件为 <path>.bak.<时间戳>，默认 false",
+			"default":     false,
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpEditFileSchema returns the input schema for sftp_edit_file
+func sftpEditFileSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件路径",
+		},
+		"edits": map[string]any{
+			"type":        "array",
+			"description": "按顺序应用的替换列表。与 patch 二选一",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"old_text": map[string]any{
+						"type":        "string",
+						"description": "要查找的文本（regex=true 时为正则表达式）",
+					},
+					"new_text": map[string]any{
+						"type":        "string",
+						"description": "替换后的文本（regex=true 时可使用 $1 等引用分组）",
+					},
+					"regex": map[string]any{
+						"type":        "boolean",
+						"description": "old_text 是否为正则表达式（Go RE2 语法），默认 false",
+						"default":     false,
+					},
+					"expected_count": map[string]any{
+						"type":        "integer",
+						"description": "期望的匹配次数，默认 1。实际次数不一致时整个编辑失败，文件不会被修改",
+						"default":     1,
+					},
+				},
+				"required": []string{"old_text", "new_text"},
+			},
+		},
+		"patch": map[string]any{
+			"type":        "string",
+			"description": "unified diff 补丁（diff -u / git diff 格式）。与 edits 二选一",
+		},
+		"expected_size": map[string]any{
+			"type":        "integer",
+			"description": "期望的文件大小（字节），例如 sftp_read_file 返回的 Size。不一致时失败",
+		},
+		"expected_mtime": map[string]any{
+			"type":        "string",
+			"description": "期望的修改时间（RFC3339 或 Unix 时间戳），不一致时失败",
+		},
+		"backup": map[string]any{
+			"type":        "boolean",
+			"description": "修改前是否备份原文件为 <path>.bak.<时间戳>，默认 true",
+			"default":     true,
+		},
+		"dry_run": map[string]any{
+			"type":        "boolean",
+			"description": "只返回 diff，不写入文件，默认 false",
+			"default":     false,
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpStatSchema returns the input schema for sftp_stat
+func sftpStatSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件或目录路径",
+		},
+		"follow_symlinks": map[string]any{
+			"type":        "boolean",
+			"description": "是否跟随符号链接（返回链接目标的信息），默认 false",
+			"default":     false,
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpChmodSchema returns the input schema for sftp_chmod
+func sftpChmodSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件或目录路径",
+		},
+		"mode": map[string]any{
+			"type":        "string",
+			"description": "权限：八进制（例如 \"0644\"、\"4755\"）或符号形式（例如 \"u+x\"、\"go-w\"、\"a=rX\"）",
+		},
+	}, []string{"session_id", "remote_path", "mode"})
+}
+
+// sftpChownSchema returns the input schema for sftp_chown
+func sftpChownSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件或目录路径",
+		},
+		"owner": map[string]any{
+			"type":        "string",
+			"description": "新的属主（用户名或 UID），留空表示不修改",
+		},
+		"group": map[string]any{
+			"type":        "string",
+			"description": "新的属组（组名或 GID），留空表示不修改",
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpRenameSchema returns the input schema for sftp_rename
+func sftpRenameSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"old_path": map[string]any{
+			"type":        "string",
+			"description": "原路径",
+		},
+		"new_path": map[string]any{
+			"type":        "string",
+			"description": "新路径",
+		},
+		"overwrite": map[string]any{
+			"type":        "boolean",
+			"description": "目标已存在时是否覆盖，默认 false。服务器支持 posix-rename 时为原子替换",
+			"default":     false,
+		},
+	}, []string{"session_id", "old_path", "new_path"})
+}
+
+// sftpSymlinkSchema returns the input schema for sftp_symlink
+func sftpSymlinkSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"target": map[string]any{
+			"type":        "string",
+			"description": "链接指向的目标路径（可以是相对路径）",
+		},
+		"link_path": map[string]any{
+			"type":        "string",
+			"description": "要创建的符号链接路径",
+		},
+	}, []string{"session_id", "target", "link_path"})
+}
+
+// sftpReadlinkSchema returns the input schema for sftp_readlink
+func sftpReadlinkSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "符号链接路径",
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpTruncateSchema returns the input schema for sftp_truncate
+func sftpTruncateSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "远程文件路径",
+		},
+		"size": map[string]any{
+			"type":        "integer",
+			"description": "截断后的文件大小（字节），默认 0（清空文件）。大于当前大小时以零字节填充",
+			"default":     0,
+		},
+	}, []string{"session_id", "remote_path"})
+}
+
+// sftpStatvfsSchema returns the input schema for sftp_statvfs
+func sftpStatvfsSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"remote_path": map[string]any{
+			"type":        "string",
+			"description": "文件系统中的任意路径，默认 /",
+			"default":     "/",
+		},
+	}, []string{"session_id"})
+}
+
 // sshWriteInputSchema returns the input schema for ssh_write_input
 func sshWriteInputSchema() map[string]any {
 	return getCommonJSONSchema(map[string]any{
@@ -280,14 +811,34 @@ func sshWriteInputSchema() map[string]any {
 			"type":        "string",
 			"description": "会话 ID 或别名",
 		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
 		"input": map[string]any{
 			"type":        "string",
-			"description": "要写入的输入内容（命令或文本）。如果要发送特殊控制字符，使用 special_char 参数",
+			"description": "要写入的输入内容（命令或文本）。包含换行时自动发送回车；程序启用括号粘贴时整段作为一次粘贴发送，末尾换行发送回车。如果要发送特殊按键，使用 special_char 或 keys 参数",
 		},
 		"special_char": map[string]any{
-			"type":        "string",
-			"description": "特殊控制字符：ctrl+c（中断）、ctrl+d（EOF）、ctrl+z（挂起）、ctrl+l（清屏）、enter（回车）、tab（制表符）、esc（退出）、up/down/left/right（方向键）。使用特殊字符时不要同时提供 input 参数",
-			"enum":        []string{"ctrl+c", "sigint", "ctrl+d", "eof", "ctrl+z", "sigtstp", "ctrl+l", "clear", "enter", "return", "tab", "esc", "up", "down", "left", "right"},
+			"type": "string",
+			"description": `特殊按键或以空格分隔的按键序列，例如 "ctrl+c"、"f10"、"ctrl+x ctrl+s"、"esc"。
+按键名：enter、tab、esc、space、backspace、up/down/left/right、home/end、pageup/pagedown、insert/delete、f1-f12、单个字符
+修饰键：ctrl+、alt+、shift+（也可写作 C-、M-、S-），可组合，如 ctrl+shift+up、alt+f、shift+tab、ctrl+]
+方向键会根据程序是否启用应用光标模式（vim、less 等）自动选择编码。使用特殊按键时不要同时提供 input 参数`,
+		},
+		"keys": map[string]any{
+			"type": "string",
+			"description": `文本与 <按键> 混合输入，例如 "<esc>:wq<enter>"、"<ctrl+a>d"、"ls -la<enter>"。
+尖括号内的按键名同 special_char；字面的 "<" 写作 <lt>（不构成按键的 "<"，如 "a < b" 或单个字符 "<b>"，按原样发送）。提供 keys 时忽略 input 和 special_char`,
+		},
+		"wait_quiet": map[string]any{
+			"type":        "number",
+			"description": "写入后等待输出稳定的秒数（可选），例如 0.5：连续这么长时间没有新输出后才返回，响应中报告等待时长和是否超时。省略或 0 表示立即返回",
+		},
+		"wait_timeout": map[string]any{
+			"type":        "number",
+			"description": "配合 wait_quiet 使用的最长等待秒数，默认 10，最大 300。持续输出的程序（如 top）会在超时后返回",
+			"default":     10,
 		},
 	}, []string{"session_id"})
 }
@@ -299,6 +850,10 @@ func sshReadOutputSchema() map[string]any {
 			"type": "string",
 			"description": "会话 ID 或别名",
 		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
 		"strategy": map[string]any{
 			"type": "string",
 			"description": `读取策略：
@@ -316,9 +871,25 @@ func sshReadOutputSchema() map[string]any {
 - latest_lines: 读取多少行（默认 20）
 - latest_bytes: 读取多少字节（默认 4096）
 
-建议：日常使用 20-50 行，查看大量输出时可增加到 100-200`,
+建议：日常使用 20-50 行，查看大量输出时可增加到 100-200
+- since_seq: 最多返回多少行（默认 500）`,
 			"default": 20,
 		},
+		"since_seq": map[string]any{
+			"type":    "integer",
+			"minimum": 0,
+			"description": `游标读取（可选）：返回序号 >= since_seq 的所有行，不影响其他读取方。
+每行输出都有单调递增的序号，响应中的 next_seq 即下次应传入的值。
+首次读取传 0；指定后忽略 strategy。若部分行已因缓冲区溢出被覆盖，响应会给出丢失行数`,
+		},
+		"ansi_mode": map[string]any{
+			"type": "string",
+			"description": `本次读取的 ANSI 处理方式（可选，默认使用 ssh_shell 的 ansi_mode）：
+- "raw"：原样返回（含颜色序列、回车）
+- "strip"：纯文本，适合阅读日志和编译输出
+- "parse"：JSON 样式片段，每行一个数组，如 [{"text":"error","fg":"red","bold":true}]`,
+			"enum": []string{"raw", "strip", "parse"},
+		},
 	}, []string{"session_id"})
 }
 
@@ -329,6 +900,10 @@ func sshResizePtySchema() map[string]any {
 			"type":        "string",
 			"description": "会话 ID 或别名",
 		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
 		"rows": map[string]any{
 			"type":        "integer",
 			"description": "终端行数",
@@ -347,16 +922,65 @@ func sshTerminalSnapshotSchema() map[string]any {
 			"type":        "string",
 			"description": "会话 ID 或别名",
 		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
 		"with_color": map[string]any{
 			"type":        "boolean",
 			"description": "是否包含 ANSI 颜色码（默认 false）",
 			"default":     false,
 		},
+		"format": map[string]any{
+			"type": "string",
+			"description": `快照格式：
+- "text"：屏幕文本（默认，with_color 控制是否带 ANSI 颜色码）
+- "spans"：JSON 样式片段，每行一个数组，片段含 text 和 fg/bg/bold/underline/reverse。
+  颜色为 "red"/"bright-red" 等名称、"256:N" 或 "#rrggbb"，默认颜色省略
+- "html"：自包含的 HTML <pre>（内联样式，含颜色、粗体、反显和光标）
+- "png"：PNG 图片（内置等宽字体渲染颜色、粗体、反显和光标），适合能显示图片的客户端`,
+			"enum":    []string{"text", "spans", "html", "png"},
+			"default": "text",
+		},
+		"scrollback_lines": map[string]any{
+			"type":        "integer",
+			"description": "同时返回滚出屏幕顶部的最近 N 行渲染历史（默认 0，最多保留 1000 行，不含 vim/less 等备用屏幕）",
+			"default":     0,
+			"minimum":     0,
+		},
+		"diff": map[string]any{
+			"type": "string",
+			"description": `差异模式（仅纯文本）：
+- "none"：返回完整屏幕（默认）
+- "rows"：只返回相对该读取方上次快照变化的行，每行带行号（0 起始）和变化的单元格数
+- "unified"：返回两次屏幕之间的 unified diff
+屏幕未变化时只返回 "Screen unchanged since seq N"；首次调用返回完整屏幕`,
+			"enum":    []string{"none", "rows", "unified"},
+			"default": "none",
+		},
+		"reader": map[string]any{
+			"type":        "string",
+			"description": "读取方名称（默认 \"default\"）。每个读取方各自保留上次快照作为 diff 基准，多个 agent 互不影响",
+		},
+		"since_seq": map[string]any{
+			"type":        "integer",
+			"minimum":     0,
+			"description": "与指定屏幕版本比较（可选，需配合 diff）。版本号见上次响应中的 Screen Seq；省略时与该读取方上次快照比较",
+		},
 		"include_cursor_info": map[string]any{
 			"type":        "boolean",
 			"description": "是否包含光标位置信息（默认 false）",
 			"default":     false,
 		},
+		"wait_quiet": map[string]any{
+			"type":        "number",
+			"description": "截取屏幕前等待输出稳定的秒数（可选），例如 0.5：连续这么长时间没有新输出后才截取，避免拿到绘制到一半的界面。省略或 0 表示立即截取",
+		},
+		"wait_timeout": map[string]any{
+			"type":        "number",
+			"description": "配合 wait_quiet 使用的最长等待秒数，默认 10，最大 300",
+			"default":     10,
+		},
 	}, []string{"session_id"})
 }
 
@@ -417,9 +1041,195 @@ func sshShellStatusSchema() map[string]any {
 			"type":        "string",
 			"description": "会话 ID 或别名",
 		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
+	}, []string{"session_id"})
+}
+
+// sshListShellsSchema returns the input schema for ssh_list_shells
+func sshListShellsSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+	}, []string{"session_id"})
+}
+
+// sshCloseShellSchema returns the input schema for ssh_close_shell
+func sshCloseShellSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "要关闭的 Shell ID。省略时关闭默认 Shell（最近创建的）",
+		},
+	}, []string{"session_id"})
+}
+
+// sshRecordStartSchema returns the input schema for ssh_record_start
+func sshRecordStartSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
+		"input": map[string]any{
+			"type":        "boolean",
+			"description": "是否同时记录写入 Shell 的输入（包括密码等敏感内容），默认 false",
+			"default":     false,
+		},
+	}, []string{"session_id"})
+}
+
+// sshRecordStopSchema returns the input schema for ssh_record_stop
+func sshRecordStopSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell",
+		},
 	}, []string{"session_id"})
 }
 
+// sshListRecordingsSchema returns the input schema for ssh_list_recordings
+func sshListRecordingsSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{}, []string{})
+}
+
+// sshReplaySnapshotSchema returns the input schema for ssh_replay_snapshot
+func sshReplaySnapshotSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"recording": map[string]any{
+			"type":        "string",
+			"description": "录制文件：录制目录中的文件名（见 ssh_list_recordings）或录制目录下的路径，不能读取录制目录以外的文件。支持 asciicast v2 文件，其他文件按原始终端输出处理",
+		},
+		"at": map[string]any{
+			"type":        "number",
+			"description": "快照时间点（秒）。省略时取录制结束时的屏幕",
+		},
+		"interval": map[string]any{
+			"type":        "number",
+			"description": "每隔多少秒生成一帧（可选）。指定后返回从开始到结束的帧序列，忽略 at",
+		},
+		"format": map[string]any{
+			"type":        "string",
+			"description": "输出格式：text（纯文本，默认）、color（带 ANSI 颜色码）、frames（JSON 帧列表，含时间、尺寸、光标和每行文本）",
+			"enum":        []string{"text", "color", "frames"},
+			"default":     "text",
+		},
+		"emulator": map[string]any{
+			"type":        "string",
+			"description": "终端模拟器：vt10x、vt100 或 ansi（内置模拟器，支持宽字符和真彩色）。省略时使用 SSH_MCP_TERMINAL_EMULATOR 或默认模拟器",
+			"enum":        []string{"vt10x", "vt100", "ansi"},
+		},
+		"width": map[string]any{
+			"type":        "integer",
+			"description": "覆盖终端宽度（原始输出文件默认 80）",
+		},
+		"height": map[string]any{
+			"type":        "integer",
+			"description": "覆盖终端高度（原始输出文件默认 24）",
+		},
+	}, []string{"recording"})
+}
+
+// sshExpectSchema returns the input schema for ssh_expect
+func sshExpectSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
+		"patterns": map[string]any{
+			"type":        "array",
+			"description": "要等待的模式列表（Go RE2 正则表达式），任意一个匹配即返回；多个同时匹配时取输出中最先出现的。每个模式可配置自动应答",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"pattern": map[string]any{
+						"type":        "string",
+						"description": "正则表达式，例如 \"[Pp]assword:\\s*$\"、\"\\(y/n\\)\"、\"\\$ $\"。可用 (?i) 忽略大小写，分组内容会返回",
+					},
+					"response": map[string]any{
+						"type":        "string",
+						"description": "匹配后自动发送的文本（可选），换行会按回车发送，例如 \"yes\\n\"",
+					},
+					"special_char": map[string]any{
+						"type":        "string",
+						"description": "匹配后自动发送的特殊按键或按键序列（可选，在 response 之后），取值同 ssh_write_input 的 special_char",
+					},
+					"continue": map[string]any{
+						"type":        "boolean",
+						"description": "应答后继续等待其他模式（类似 expect 的 exp_continue），默认 false",
+						"default":     false,
+					},
+				},
+				"required": []string{"pattern"},
+			},
+		},
+		"input": map[string]any{
+			"type":        "string",
+			"description": "开始等待前先发送的输入（可选），例如 \"mysql -u root -p\\n\"。发送前会丢弃尚未匹配的旧输出，避免误匹配",
+		},
+		"timeout": map[string]any{
+			"type":        "number",
+			"description": "最长等待秒数，默认 30，最大 600",
+			"default":     30,
+		},
+		"match_screen": map[string]any{
+			"type":        "boolean",
+			"description": "匹配终端渲染后的屏幕（适合 TUI 程序）而非输出流，默认 false。continue 模式下已应答的行在内容改变前不会再次匹配",
+			"default":     false,
+		},
+		"max_matches": map[string]any{
+			"type":        "integer",
+			"description": "使用 continue 时最多匹配次数，默认 20",
+			"default":     20,
+		},
+	}, []string{"session_id", "patterns"})
+}
+
+// sshShellRunSchema returns the input schema for ssh_shell_run
+func sshShellRunSchema() map[string]any {
+	return getCommonJSONSchema(map[string]any{
+		"session_id": map[string]any{
+			"type":        "string",
+			"description": "会话 ID 或别名",
+		},
+		"shell_id": map[string]any{
+			"type":        "string",
+			"description": "Shell ID（可选）。省略时使用该会话最近创建的 Shell，可通过 ssh_list_shells 查看",
+		},
+		"command": map[string]any{
+			"type":        "string",
+			"description": "要执行的单行命令，多个命令用 ; 或 && 连接",
+		},
+		"timeout": map[string]any{
+			"type":        "number",
+			"description": "等待命令完成的秒数，默认 60，最大 1800。超时后命令继续运行，返回已有输出",
+			"default":     60,
+		},
+	}, []string{"session_id", "command"})
+}
+
 // sshHistorySchema returns the input schema for ssh_history
 func sshHistorySchema() map[string]any {
 	return getCommonJSONSchema(map[string]any{
@@ -110,7 +110,18 @@ func (s *Server) registerTools() {
 1. ssh_shell() - 启动交互式会话（自动使用 raw 模式）
 2. ssh_write_input() - 发送命令（如 "htop"）
 3. ssh_terminal_snapshot() - 查看完整界面
-4. ssh_write_input(special_char="ctrl+c") - 退出程序`,
+4. ssh_write_input(special_char="ctrl+c") - 退出程序
+
+🐚 多 Shell：
+- 同一会话可通过不同 shell_id 同时运行多个 Shell（如 build、logs）
+- 其他 Shell 工具传入 shell_id 选择目标，省略时使用最近创建的 Shell
+- ssh_list_shells() 查看所有 Shell，ssh_close_shell() 关闭 Shell
+
+🖥️ 终端模拟器：
+- emulator="ansi" 使用内置模拟器，中文等宽字符、组合字符和真彩色显示更准确
+
+📂 当前目录：
+- 默认安装 OSC 7 钩子跟踪工作目录（bash/zsh），其他 shell 通过 /proc/<pid>/cwd 获取；track_cwd=false 关闭`,
 		InputSchema: sshShellSchema(),
 	}, s.handleSSHShell)
 
@@ -127,6 +138,38 @@ func (s *Server) registerTools() {
 		InputSchema: sftpDownloadSchema(),
 	}, s.handleSFTPDownload)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "sftp_sync",
+		Description: `同步本地目录和远程目录（类似 rsync，只传输有变化的文件）。
+
+✅ 适用场景：
+- 部署代码或配置目录（push）
+- 拉取远程日志、备份目录（pull）
+- 反复上传同一目录时，跳过未变化的文件
+
+⚡ 特性：
+- 按大小+修改时间（默认）或校验和比较文件
+- 可选删除目标端多余文件（delete=true）
+- 支持 include/exclude glob 和 .gitignore 风格的忽略文件
+- 保留文件权限和修改时间
+- dry_run=true 时只列出计划的操作
+
+💡 建议先使用 dry_run=true 预览，确认后再实际执行`,
+		InputSchema: sftpSyncSchema(),
+	}, s.handleSFTPSync)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "sftp_copy_between",
+		Description: `在两个会话之间直接复制文件或目录（例如把生产库的备份复制到测试环境）。
+
+⚡ 特性：
+- 默认由 MCP 服务器在两个 SFTP 连接之间流式中转，不落本地磁盘
+- 支持文件和目录（保留权限、修改时间和符号链接），报告进度
+- verify=true 时在目标主机计算校验和并与源数据比对
+- direct=true 时尝试让源主机通过 rsync/scp 直接推送到目标主机（需要源主机能免密登录目标主机），失败时自动回退为中转`,
+		InputSchema: sftpCopyBetweenSchema(),
+	}, s.handleSFTPCopyBetween)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "sftp_list_dir",
 		Description: "列出远程目录",
@@ -145,13 +188,140 @@ func (s *Server) registerTools() {
 		InputSchema: sftpDeleteSchema(),
 	}, s.handleSFTPDelete)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "sftp_read_file",
+		Description: `直接读取远程文件内容（无需先下载到本地）。
+
+✅ 适用场景：
+- 查看配置文件（/etc/nginx/nginx.conf 等）
+- 读取大文件的一部分（按字节范围或行范围）
+
+⚡ 特性：
+- 支持字节范围（offset/length）和行范围（start_line/end_line）
+- 自动识别 UTF-8 / UTF-16（BOM），二进制文件以 base64 返回
+- 默认最多返回 1MB（max_bytes 可调整，上限 16MB）`,
+		InputSchema: sftpReadFileSchema(),
+	}, s.handleSFTPReadFile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "sftp_write_file",
+		Description: `直接写入远程文件内容（无需本地文件）。
+
+⚡ 特性：
+- 支持文本内容（content）或 base64 内容（content_base64）
+- 默认原子写入：先写临时文件再 rename，避免出现写了一半的文件
+- 可选备份原文件（<path>.bak.<时间戳>）
+- 默认保留原文件权限
+
+⚠️ 会覆盖已存在的文件，修改重要配置时建议开启 backup`,
+		InputSchema: sftpWriteFileSchema(),
+	}, s.handleSFTPWriteFile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "sftp_edit_file",
+		Description: `直接编辑远程文件（一次调用完成读取、修改、写回）。
+
+✅ 两种编辑方式（二选一）：
+- edits：一个或多个精确字符串/正则替换，按顺序应用
+- patch：unified diff 补丁
+
+🛡️ 安全保证：
+- 匹配次数与 expected_count（默认 1）不一致时失败，不会误改
+- 通过大小和修改时间检测并发修改（可传入 expected_size/expected_mtime）
+- 原子写入，默认备份原文件
+- 返回修改后的 diff；dry_run=true 时只预览不写入`,
+		InputSchema: sftpEditFileSchema(),
+	}, s.handleSFTPEditFile)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_stat",
+		Description: "查看远程文件的详细信息（类型、大小、八进制和符号权限、属主/属组名称、符号链接目标、修改时间）",
+		InputSchema: sftpStatSchema(),
+	}, s.handleSFTPStat)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_chmod",
+		Description: "修改远程文件权限，支持八进制（0644）和符号形式（u+x,go-w）",
+		InputSchema: sftpChmodSchema(),
+	}, s.handleSFTPChmod)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_chown",
+		Description: "修改远程文件属主/属组，支持用户名/组名或数字 ID（通常需要 root 权限）",
+		InputSchema: sftpChownSchema(),
+	}, s.handleSFTPChown)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_rename",
+		Description: "重命名或移动远程文件/目录。overwrite=true 时覆盖已存在的目标（支持 posix-rename 时为原子操作）",
+		InputSchema: sftpRenameSchema(),
+	}, s.handleSFTPRename)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_symlink",
+		Description: "创建远程符号链接",
+		InputSchema: sftpSymlinkSchema(),
+	}, s.handleSFTPSymlink)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_readlink",
+		Description: "读取远程符号链接的目标",
+		InputSchema: sftpReadlinkSchema(),
+	}, s.handleSFTPReadlink)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_truncate",
+		Description: "截断或扩展远程文件到指定大小",
+		InputSchema: sftpTruncateSchema(),
+	}, s.handleSFTPTruncate)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "sftp_statvfs",
+		Description: "查看远程文件系统的磁盘空间（总量、已用、可用、inode）",
+		InputSchema: sftpStatvfsSchema(),
+	}, s.handleSFTPStatvfs)
+
 	// 会话交互工具
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "ssh_write_input",
-		Description: "向交互式会话写入输入",
+		Description: "向交互式会话写入输入：文本（input）、特殊按键序列（special_char，如 \"ctrl+x ctrl+s\"、\"f10\"）或文本与按键混合（keys，如 \"<esc>:wq<enter>\"）。程序启用括号粘贴（bracketed paste）时，多行 input 作为一次粘贴发送。设置 wait_quiet 时等待输出稳定后再返回",
 		InputSchema: sshWriteInputSchema(),
 	}, s.handleSSHWriteInput)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "ssh_shell_run",
+		Description: `在交互式 shell 中执行命令，等待完成后返回输出和退出码。
+
+⚠️ 需要使用 ssh_shell(shell_integration=true) 启动的 shell。
+
+✅ 适用场景：
+- 需要保留 shell 状态（cd、export、source、激活虚拟环境）的连续命令
+- 在 ssh_shell 中执行普通命令并获取准确的退出码，无需猜测 sleep
+
+❌ 不要使用场景：
+- 无状态的简单命令 → 用 ssh_exec
+- 交互式程序（vim/htop）→ 用 ssh_write_input + ssh_terminal_snapshot`,
+		InputSchema: sshShellRunSchema(),
+	}, s.handleSSHShellRun)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "ssh_expect",
+		Description: `等待 shell 输出匹配指定模式（类似 expect），可自动应答。
+
+✅ 使用场景：
+- 等待安装程序、mysql、ssh-keygen 等出现提示后再输入
+- 等待命令完成（匹配提示符或特定输出），替代猜测 sleep 再 ssh_read_output
+- 自动回答一连串提示（continue=true）
+
+💡 示例：
+- 发送命令并等待密码提示：input="mysql -u root -p\n", patterns=[{pattern:"[Pp]assword:"}]
+- 自动回答多个提示：patterns=[{pattern:"passphrase", response:"\n", continue:true}, {pattern:"\\$ $"}]
+
+📋 返回：匹配的模式、分组、匹配前的输出；超时时返回尚未匹配的输出。
+输出流匹配前会移除 ANSI 控制序列，已匹配的输出不会被再次匹配。`,
+		InputSchema: sshExpectSchema(),
+	}, s.handleSSHExpect)
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "ssh_read_output",
 		Description: `读取会话的大量文本输出（从输出缓冲区）。
@@ -175,6 +345,9 @@ func (s *Server) registerTools() {
 - strategy="latest_lines" + limit=50 → 获取最新 50 行
 - strategy="all_unread" → 读取所有未读数据
 - strategy="latest_bytes" + limit=4096 → 获取最新 4KB
+- since_seq=N → 从游标 N 增量读取（响应中的 next_seq 用于下次读取，多读取方互不影响）
+- ansi_mode="strip" / "raw" → 本次读取输出纯文本或保留颜色（缓冲区保存原始输出，含空行和回车）
+- ansi_mode="parse" → 返回 JSON 样式片段（每行一个数组，片段含 text 和 fg/bg/bold/underline/reverse）
 
 📊 容量：输出缓冲区可存储 10000 行历史记录`,
 		InputSchema: sshReadOutputSchema(),
@@ -220,17 +393,79 @@ func (s *Server) registerTools() {
 🎨 参数说明：
 - with_color=false - 纯文本快照（默认）
 - with_color=true - 包含 ANSI 颜色码
-- include_cursor_info=true - 显示光标位置和终端尺寸`,
+- format="spans" - 返回 JSON 样式片段（文本 + 前景/背景色、粗体、下划线、反显），可区分红色错误行和高亮菜单项
+- format="png" / "html" - 将屏幕渲染为 PNG 图片或自包含的 HTML <pre>（颜色、粗体、反显、光标），用于查看 TUI 的实际外观
+- scrollback_lines=N - 在屏幕内容之前附加最近 N 行已滚出屏幕的渲染历史（备用屏幕中的 vim/less 不计入）
+- diff="rows" / "unified" - 只返回相对上次快照变化的行（带行号和变化单元格数）或 unified diff，适合反复观察 top/htop 等仪表盘
+- reader / since_seq - 按读取方保留上次快照，或与指定的 Screen Seq 比较；屏幕未变化时只返回一行提示
+- include_cursor_info=true - 显示光标位置和终端尺寸
+- wait_quiet=0.5 - 先等待输出稳定（0.5 秒内无新输出，最长 wait_timeout 秒）再截取，代替 sleep 轮询
+
+🖥️ 终端模式：
+- 快照头部的 Terminal Modes 行列出程序设置的模式：alt-screen（全屏程序）、cursor-hidden、app-cursor、app-keypad、bracketed-paste、mouse=x10/normal/button/any，none 表示普通提示符
+- Window Title 行为程序通过 OSC 0/2 设置的窗口标题`,
 		InputSchema: sshTerminalSnapshotSchema(),
 	}, s.handleSSHTerminalSnapshot)
 
 	// Shell 状态查询工具
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "ssh_shell_status",
-		Description: "查询 shell 会话状态（是否活动、当前目录、是否有未读取输出等）",
+		Description: "查询 shell 会话状态（是否活动、当前目录、是否有未读取输出、终端模式和窗口标题等）",
 		InputSchema: sshShellStatusSchema(),
 	}, s.handleSSHShellStatus)
 
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "ssh_list_shells",
+		Description: "列出会话中的所有 Shell（shell_id、终端尺寸、缓冲区使用量，标记默认 Shell）",
+		InputSchema: sshListShellsSchema(),
+	}, s.handleSSHListShells)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "ssh_close_shell",
+		Description: "关闭会话中的指定 Shell，并停止其后台读取与保活；SSH 连接和其他 Shell 不受影响",
+		InputSchema: sshCloseShellSchema(),
+	}, s.handleSSHCloseShell)
+
+	// Shell 录制工具
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "ssh_record_start",
+		Description: `开始将 Shell 录制为 asciinema asciicast v2 文件（.cast），记录终端实际显示的内容。
+
+✅ 使用场景：
+- 执行有风险的操作前开始录制，出问题后可回放终端画面
+- 保留交互式程序（安装向导、TUI）的完整过程
+
+📋 录制内容：输出事件、终端尺寸变化（ssh_resize_pty），input=true 时还包括写入的输入。
+文件保存在配置的录制目录中，单个文件达到大小上限后停止写入，超出数量或保留时长的旧录制会被自动删除。
+可用 asciinema play <文件> 回放。`,
+		InputSchema: sshRecordStartSchema(),
+	}, s.handleSSHRecordStart)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "ssh_record_stop",
+		Description: "停止 Shell 的录制并返回录制文件路径、时长和大小；关闭 Shell 时录制也会自动停止",
+		InputSchema: sshRecordStopSchema(),
+	}, s.handleSSHRecordStop)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "ssh_list_recordings",
+		Description: "列出录制目录中的 asciicast 录制文件（最新在前，标记正在录制的文件）",
+		InputSchema: sshListRecordingsSchema(),
+	}, s.handleSSHListRecordings)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name: "ssh_replay_snapshot",
+		Description: `离线回放录制文件，获取任意时间点的终端屏幕（无需连接主机）。
+
+✅ 使用场景：
+- 排查 ssh_record_start 录制的会话：查看出错时刻终端上显示的内容
+- 按固定间隔（interval）生成帧序列，回顾整个操作过程
+
+📋 录制文件通过与 ssh_terminal_snapshot 相同的终端模拟器（vt10x/vt100/ansi）回放，
+支持 asciicast v2 文件和不带时间信息的原始终端输出日志。`,
+		InputSchema: sshReplaySnapshotSchema(),
+	}, s.handleSSHReplaySnapshot)
+
 	// 命令历史工具
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "ssh_history",
@@ -0,0 +1,412 @@
+// Package replay feeds recorded shell output (asciicast v2 files or raw byte
+// logs) through the terminal emulators of package sshmcp, producing screen
+// snapshots at any point in time without a live host.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cigar/sshmcp/pkg/sshmcp"
+)
+
+const (
+	// DefaultWidth is the terminal width used for raw logs
+	DefaultWidth = 80
+	// DefaultHeight is the terminal height used for raw logs
+	DefaultHeight = 24
+	// MaxFrames limits the number of frames produced by Frames
+	MaxFrames = 1000
+	// MaxRecordingBytes is the largest file Load reads (4x the default
+	// recording size limit)
+	MaxRecordingBytes = 256 * 1024 * 1024
+)
+
+// Event is one recorded event. Code is "o" (output), "i" (input),
+// "r" (resize, Data is "COLSxROWS") or "m" (marker).
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// Recording is a recorded terminal session
+type Recording struct {
+	Width    int
+	Height   int
+	Title    string
+	Events   []Event
+	Duration float64 // 最后一个事件的时间（秒）
+}
+
+// Options configures how a recording is loaded and replayed
+type Options struct {
+	Width    int                         // 覆盖录制中的终端宽度（原始日志默认 80）
+	Height   int                         // 覆盖录制中的终端高度（原始日志默认 24）
+	Emulator sshmcp.TerminalEmulatorType // 为空时使用 SSH_MCP_TERMINAL_EMULATOR 或默认模拟器
+}
+
+// ParseAsciicast parses an asciicast v2 stream
+func ParseAsciicast(r io.Reader) (*Recording, error) {
+	reader := bufio.NewReader(r)
+
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read asciicast header: %w", err)
+	}
+	var header struct {
+		Version int    `json:"version"`
+		Width   int    `json:"width"`
+		Height  int    `json:"height"`
+		Title   string `json:"title"`
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("parse asciicast header: %w", err)
+	}
+	if header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version %d (only v2 is supported)", header.Version)
+	}
+
+	rec := &Recording{Width: header.Width, Height: header.Height, Title: header.Title}
+	for lineNo := 2; ; lineNo++ {
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read asciicast event: %w", err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var fields []json.RawMessage
+		if err := json.Unmarshal(line, &fields); err != nil || len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: invalid asciicast event", lineNo)
+		}
+		var event Event
+		if err := json.Unmarshal(fields[0], &event.Time); err != nil {
+			return nil, fmt.Errorf("line %d: invalid event time: %w", lineNo, err)
+		}
+		if err := json.Unmarshal(fields[1], &event.Code); err != nil {
+			return nil, fmt.Errorf("line %d: invalid event code: %w", lineNo, err)
+		}
+		if err := json.Unmarshal(fields[2], &event.Data); err != nil {
+			return nil, fmt.Errorf("line %d: invalid event data: %w", lineNo, err)
+		}
+
+		rec.Events = append(rec.Events, event)
+		if event.Time > rec.Duration {
+			rec.Duration = event.Time
+		}
+	}
+	return rec, nil
+}
+
+// readLine reads one line without the trailing newline, however long it is
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return bytes.TrimRight(line, "\r\n"), err
+}
+
+// FromRaw wraps a raw byte log (no timing) as a recording with a single
+// output event at time 0
+func FromRaw(data []byte) *Recording {
+	return &Recording{
+		Width:  DefaultWidth,
+		Height: DefaultHeight,
+		Events: []Event{{Time: 0, Code: "o", Data: string(data)}},
+	}
+}
+
+// Load reads an asciicast v2 file, or treats any other file as a raw byte log.
+// Only regular files up to MaxRecordingBytes are accepted.
+func Load(path string) (*Recording, error) {
+	return load(path, MaxRecordingBytes)
+}
+
+// load implements Load with a configurable size limit
+func load(path string, maxBytes int64) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	defer f.Close()
+
+	// 拒绝设备、管道等特殊文件（如 /dev/zero 会无限读取）
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("read recording: %s is not a regular file", path)
+	}
+
+	// 文件可能在 Stat 之后继续增长，读取时同样限制大小
+	data, err := io.ReadAll(io.LimitReader(f, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("read recording: %s is larger than %d bytes", path, maxBytes)
+	}
+
+	// asciicast 文件以 JSON 头部开始，其他内容按原始输出处理
+	if isAsciicast(data) {
+		return ParseAsciicast(bytes.NewReader(data))
+	}
+	return FromRaw(data), nil
+}
+
+// isAsciicast reports whether data starts with an asciicast header line
+func isAsciicast(data []byte) bool {
+	first := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		first = data[:i]
+	}
+	var header struct {
+		Version *int `json:"version"`
+	}
+	return json.Unmarshal(first, &header) == nil && header.Version != nil
+}
+
+// Frame is the terminal screen at one point in time
+type Frame struct {
+	Time    float64  `json:"time"`
+	Width   int      `json:"width"`
+	Height  int      `json:"height"`
+	CursorX int      `json:"cursor_x"`
+	CursorY int      `json:"cursor_y"`
+	Lines   []string `json:"lines"` // 屏幕各行（去掉行尾空格）
+	Color   string   `json:"-"`     // 带 ANSI 颜色码的屏幕内容
+}
+
+// Text returns the plain screen content
+func (f Frame) Text() string {
+	return strings.Join(f.Lines, "\n")
+}
+
+// Player replays a recording through a terminal emulator
+type Player struct {
+	rec      *Recording
+	opts     Options
+	capturer *sshmcp.TerminalCapturer
+	next     int     // 下一个待回放的事件
+	time     float64 // 已回放到的时间点
+}
+
+// NewPlayer creates a player positioned at the start of the recording
+func NewPlayer(rec *Recording, opts Options) (*Player, error) {
+	p := &Player{rec: rec, opts: opts}
+	if err := p.reset(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// reset recreates the emulator at the initial terminal size
+func (p *Player) reset() error {
+	width, height := p.rec.Width, p.rec.Height
+	if p.opts.Width > 0 {
+		width = p.opts.Width
+	}
+	if p.opts.Height > 0 {
+		height = p.opts.Height
+	}
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if height <= 0 {
+		height = DefaultHeight
+	}
+
+	var capturer *sshmcp.TerminalCapturer
+	var err error
+	if p.opts.Emulator != "" {
+		capturer, err = sshmcp.NewTerminalCapturerWithType(width, height, p.opts.Emulator)
+	} else {
+		capturer, err = sshmcp.NewTerminalCapturer(width, height)
+	}
+	if err != nil {
+		return fmt.Errorf("create terminal emulator: %w", err)
+	}
+
+	if p.capturer != nil {
+		p.capturer.Close()
+	}
+	p.capturer = capturer
+	p.next = 0
+	p.time = 0
+	return nil
+}
+
+// Seek replays all events up to and including time t (seconds). Seeking
+// backwards replays the recording from the start.
+func (p *Player) Seek(t float64) error {
+	if t < p.time {
+		if err := p.reset(); err != nil {
+			return err
+		}
+	}
+
+	for p.next < len(p.rec.Events) && p.rec.Events[p.next].Time <= t {
+		event := p.rec.Events[p.next]
+		switch event.Code {
+		case "o":
+			p.capturer.Emulator.Write([]byte(event.Data))
+		case "r":
+			var cols, rows int
+			if _, err := fmt.Sscanf(event.Data, "%dx%d", &cols, &rows); err == nil && cols > 0 && rows > 0 {
+				p.capturer.Resize(cols, rows)
+			}
+		}
+		// 输入事件和标记不影响屏幕
+		p.next++
+	}
+	p.time = t
+	return nil
+}
+
+// Frame captures the current screen
+func (p *Player) Frame() Frame {
+	width, height := p.capturer.GetSize()
+	x, y := p.capturer.GetCursorPosition()
+	lines := strings.Split(p.capturer.GetScreenSnapshot(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return Frame{
+		Time:    p.time,
+		Width:   width,
+		Height:  height,
+		CursorX: x,
+		CursorY: y,
+		Lines:   lines,
+		Color:   p.capturer.GetScreenSnapshotWithColor(),
+	}
+}
+
+// Close releases the emulator
+func (p *Player) Close() error {
+	return p.capturer.Close()
+}
+
+// Snapshot returns the screen at time at (seconds); a negative time means
+// the end of the recording
+func Snapshot(rec *Recording, at float64, opts Options) (Frame, error) {
+	if at < 0 {
+		at = rec.Duration
+	}
+	p, err := NewPlayer(rec, opts)
+	if err != nil {
+		return Frame{}, err
+	}
+	defer p.Close()
+
+	if err := p.Seek(at); err != nil {
+		return Frame{}, err
+	}
+	return p.Frame(), nil
+}
+
+// Frames returns the screen every interval seconds from the start of the
+// recording, plus a final frame at its end
+func Frames(rec *Recording, interval float64, opts Options) ([]Frame, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive")
+	}
+	if count := int(rec.Duration/interval) + 2; count > MaxFrames {
+		return nil, fmt.Errorf("too many frames (%d), use a larger interval (max %d frames)", count, MaxFrames)
+	}
+
+	p, err := NewPlayer(rec, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+
+	var frames []Frame
+	for i := 0; ; i++ {
+		t := float64(i) * interval
+		if t > rec.Duration {
+			break
+		}
+		if err := p.Seek(t); err != nil {
+			return nil, err
+		}
+		frames = append(frames, p.Frame())
+	}
+	if len(frames) == 0 || frames[len(frames)-1].Time < rec.Duration {
+		if err := p.Seek(rec.Duration); err != nil {
+			return nil, err
+		}
+		frames = append(frames, p.Frame())
+	}
+	return frames, nil
+}
+
+// OutputFormat selects how frames are rendered
+type OutputFormat string
+
+const (
+	// FormatText renders plain screen text
+	FormatText OutputFormat = "text"
+	// FormatColor renders screen text with ANSI colour codes
+	FormatColor OutputFormat = "color"
+	// FormatFrames renders the frame list as JSON
+	FormatFrames OutputFormat = "frames"
+)
+
+// ParseOutputFormat parses an output format name (empty means text)
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch OutputFormat(strings.ToLower(strings.TrimSpace(s))) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatColor:
+		return FormatColor, nil
+	case FormatFrames:
+		return FormatFrames, nil
+	}
+	return "", fmt.Errorf("invalid format %q (use text, color or frames)", s)
+}
+
+// Render formats frames. A single text or colour frame is returned as is;
+// several are separated by a header line with their timestamp.
+func Render(frames []Frame, format OutputFormat) (string, error) {
+	if format == FormatFrames {
+		data, err := json.MarshalIndent(frames, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("encode frames: %w", err)
+		}
+		return string(data), nil
+	}
+
+	screen := func(f Frame) string {
+		if format == FormatColor {
+			return f.Color
+		}
+		return f.Text()
+	}
+	if len(frames) == 1 {
+		return screen(frames[0]), nil
+	}
+
+	var sb strings.Builder
+	for i, f := range frames {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		fmt.Fprintf(&sb, "── %.3fs ──\n", f.Time)
+		sb.WriteString(screen(f))
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,170 @@
+package replay
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cigar/sshmcp/pkg/sshmcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCast = `{"version":2,"width":20,"height":20,"timestamp":1700000000,"env":{"TERM":"xterm-256color"}}
+[0.1,"o","$ "]
+[0.5,"i","ls\r"]
+[0.6,"o","ls\r\nfile-a\r\n$ "]
+[2.0,"o","\u001b[2J\u001b[H\u001b[31mtop\u001b[0m"]
+[3.5,"r","30x30"]
+[3.6,"m","done"]
+`
+
+// TestParseAsciicast tests parsing the header and events
+func TestParseAsciicast(t *testing.T) {
+	rec, err := ParseAsciicast(strings.NewReader(testCast))
+	require.NoError(t, err)
+
+	assert.Equal(t, 20, rec.Width)
+	assert.Equal(t, 20, rec.Height)
+	assert.Equal(t, 3.6, rec.Duration)
+	require.Len(t, rec.Events, 6)
+	assert.Equal(t, Event{Time: 0.5, Code: "i", Data: "ls\r"}, rec.Events[1])
+	assert.Equal(t, "\x1b[2J\x1b[H\x1b[31mtop\x1b[0m", rec.Events[3].Data)
+
+	_, err = ParseAsciicast(strings.NewReader(`{"version":1,"width":80,"height":24,"stdout":[]}`))
+	assert.Error(t, err)
+	_, err = ParseAsciicast(strings.NewReader("{\"version\":2}\n[1,\"o\"]\n"))
+	assert.Error(t, err)
+}
+
+// TestSnapshot tests snapshots at different times with both emulators
+func TestSnapshot(t *testing.T) {
+	rec, err := ParseAsciicast(strings.NewReader(testCast))
+	require.NoError(t, err)
+
+	for _, emulator := range []sshmcp.TerminalEmulatorType{sshmcp.EmulatorTypeVT10x, sshmcp.EmulatorTypeVT100} {
+		t.Run(string(emulator), func(t *testing.T) {
+			opts := Options{Emulator: emulator}
+
+			frame, err := Snapshot(rec, 0, opts)
+			require.NoError(t, err)
+			assert.Empty(t, strings.TrimSpace(frame.Text()))
+
+			frame, err = Snapshot(rec, 1, opts)
+			require.NoError(t, err)
+			assert.Equal(t, "$ ls", strings.TrimSpace(frame.Lines[0]))
+			assert.Equal(t, "file-a", strings.TrimSpace(frame.Lines[1]))
+
+			frame, err = Snapshot(rec, -1, opts)
+			require.NoError(t, err)
+			assert.Equal(t, "top", strings.TrimSpace(frame.Lines[0]))
+			assert.NotContains(t, frame.Text(), "file-a")
+			assert.Equal(t, 30, frame.Width)
+			assert.Equal(t, 30, frame.Height)
+		})
+	}
+}
+
+// TestPlayer_SeekBackwards tests that seeking backwards replays from the start
+func TestPlayer_SeekBackwards(t *testing.T) {
+	rec, err := ParseAsciicast(strings.NewReader(testCast))
+	require.NoError(t, err)
+
+	p, err := NewPlayer(rec, Options{Emulator: sshmcp.EmulatorTypeVT10x})
+	require.NoError(t, err)
+	defer p.Close()
+
+	require.NoError(t, p.Seek(2.5))
+	assert.NotContains(t, p.Frame().Text(), "file-a")
+
+	require.NoError(t, p.Seek(1))
+	assert.Contains(t, p.Frame().Text(), "file-a")
+}
+
+// TestFrames tests frames at a fixed interval plus the final frame
+func TestFrames(t *testing.T) {
+	rec, err := ParseAsciicast(strings.NewReader(testCast))
+	require.NoError(t, err)
+
+	frames, err := Frames(rec, 1, Options{Emulator: sshmcp.EmulatorTypeVT10x})
+	require.NoError(t, err)
+
+	times := make([]float64, len(frames))
+	for i, f := range frames {
+		times[i] = f.Time
+	}
+	assert.Equal(t, []float64{0, 1, 2, 3, 3.6}, times)
+	assert.Contains(t, frames[1].Text(), "file-a")
+	assert.Contains(t, frames[2].Text(), "top")
+
+	_, err = Frames(rec, 0, Options{})
+	assert.Error(t, err)
+	_, err = Frames(rec, 0.001, Options{})
+	assert.Error(t, err)
+}
+
+// TestRender tests the text, colour and JSON frame list output
+func TestRender(t *testing.T) {
+	frames := []Frame{
+		{Time: 0, Width: 3, Height: 1, Lines: []string{"abc"}, Color: "\x1b[31mabc\x1b[0m"},
+		{Time: 1.5, Width: 3, Height: 1, Lines: []string{"xyz"}, Color: "xyz\x1b[0m"},
+	}
+
+	out, err := Render(frames[:1], FormatText)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", out)
+
+	out, err = Render(frames, FormatColor)
+	require.NoError(t, err)
+	assert.Equal(t, "── 0.000s ──\n\x1b[31mabc\x1b[0m\n\n── 1.500s ──\nxyz\x1b[0m\n", out)
+
+	out, err = Render(frames, FormatFrames)
+	require.NoError(t, err)
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out), &decoded))
+	require.Len(t, decoded, 2)
+	assert.Equal(t, 1.5, decoded[1]["time"])
+	assert.Equal(t, []any{"xyz"}, decoded[1]["lines"])
+	assert.NotContains(t, decoded[1], "color")
+
+	_, err = ParseOutputFormat("png")
+	assert.Error(t, err)
+}
+
+// TestLoad tests loading asciicast files and raw byte logs
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	castPath := filepath.Join(dir, "session.cast")
+	require.NoError(t, os.WriteFile(castPath, []byte(testCast), 0600))
+	rec, err := Load(castPath)
+	require.NoError(t, err)
+	assert.Len(t, rec.Events, 6)
+
+	rawPath := filepath.Join(dir, "session.log")
+	require.NoError(t, os.WriteFile(rawPath, []byte("hello\r\n\x1b[1mworld\x1b[0m"), 0600))
+	rec, err = Load(rawPath)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultWidth, rec.Width)
+	require.Len(t, rec.Events, 1)
+
+	frame, err := Snapshot(rec, -1, Options{Width: 20, Height: 20, Emulator: sshmcp.EmulatorTypeVT10x})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", strings.TrimSpace(frame.Lines[0]))
+	assert.Equal(t, "world", strings.TrimSpace(frame.Lines[1]))
+
+	_, err = Load(filepath.Join(dir, "missing.cast"))
+	assert.Error(t, err)
+
+	// 超过大小上限或不是普通文件时拒绝读取
+	_, err = load(rawPath, 8)
+	assert.ErrorContains(t, err, "larger than 8 bytes")
+	_, err = Load(dir)
+	assert.ErrorContains(t, err, "not a regular file")
+	if _, statErr := os.Stat("/dev/zero"); statErr == nil {
+		_, err = Load("/dev/zero")
+		assert.ErrorContains(t, err, "not a regular file")
+	}
+}
@@ -0,0 +1,956 @@
+package sshmcp
+
+import (
+	"image/color"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/text/unicode/norm"
+)
+
+// WideCharPadding 标记宽字符（CJK、emoji 等）占用的第二列，渲染时跳过
+const WideCharPadding rune = -1
+
+// ansiRuneWidth 计算字符宽度，不随本机 locale 变化（East Asian 歧义宽度字符按 1 列）
+var ansiRuneWidth = &runewidth.Condition{StrictEmojiNeutral: true}
+
+// decSpecialGraphics 是 DEC 特殊图形字符集（ESC ( 0）中 0x5f-0x7e 对应的字符
+var decSpecialGraphics = [32]rune{
+	' ', '◆', '▒', '␉', '␌', '␍', '␊', '°', '±', '␤', '␋', '┘', '┐', '┌', '└', '┼',
+	'⎺', '⎻', '─', '⎼', '⎽', '├', '┤', '┴', '┬', '│', '≤', '≥', 'π', '≠', '£', '·',
+}
+
+// ansiCell 是屏幕上的一个单元格
+type ansiCell struct {
+	r      rune
+	format Format
+}
+
+// ansiCursor 是 DECSC 保存的光标状态
+type ansiCursor struct {
+	x, y       int
+	pen        Format
+	originMode bool
+	charsets   [2]bool
+	charset    int
+}
+
+// ANSIEmulator 是基于 charmbracelet/x/ansi 解析器的内置终端模拟器
+// 支持备用屏幕、滚动区域、宽字符（CJK）和组合字符，滚出主屏幕顶部的行直接写入 scrollback
+type ANSIEmulator struct {
+	mu     sync.Mutex
+	parser *ansi.Parser
+
+	width, height int
+	primary       [][]ansiCell
+	alternate     [][]ansiCell
+	lines         [][]ansiCell // 当前屏幕（primary 或 alternate）
+	altScreen     bool
+
+	x, y        int
+	wrapPending bool // 已写到行尾，下一个字符先换行（DECAWM）
+	pen         Format
+	saved       ansiCursor
+	altSaved    ansiCursor // 1049 进入备用屏幕前保存的光标
+
+	top, bottom int // 滚动区域（0 起始，含两端）
+	tabs        []bool
+
+	autowrap   bool
+	originMode bool
+	insertMode bool
+	charsets   [2]bool // G0/G1 是否为 DEC 特殊图形字符集
+	charset    int     // 当前使用 G0 还是 G1（SI/SO）
+
+	lastX, lastY int  // 上一个字符所在单元格，用于附加组合字符
+	lastRune     rune // 用于 REP（CSI b）
+	hasLast      bool
+
+	modes      TerminalModes // 光标可见性、括号粘贴、鼠标模式、窗口标题等
+	scrollback *scrollback
+}
+
+// NewANSIEmulator 创建内置终端模拟器
+func NewANSIEmulator(width, height int) (*ANSIEmulator, error) {
+	e := &ANSIEmulator{scrollback: newScrollback(DefaultScrollbackLines)}
+	e.parser = ansi.NewParser()
+	e.parser.SetParamsSize(32)
+	e.parser.SetHandler(ansi.Handler{
+		Print:     e.print,
+		Execute:   e.execute,
+		HandleEsc: e.handleEsc,
+		HandleCsi: e.handleCsi,
+		HandleOsc: e.handleOsc,
+	})
+	e.setSize(width, height)
+	e.reset()
+	return e, nil
+}
+
+// setSize 设置尺寸（不能小于 1x1）
+func (e *ANSIEmulator) setSize(width, height int) {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	e.width, e.height = width, height
+}
+
+// reset 恢复初始状态（RIS），滚动历史保留
+func (e *ANSIEmulator) reset() {
+	e.primary = newANSIScreen(e.width, e.height)
+	e.alternate = newANSIScreen(e.width, e.height)
+	e.lines = e.primary
+	e.altScreen = false
+	e.x, e.y, e.wrapPending = 0, 0, false
+	e.pen = Format{}
+	e.autowrap = true
+	e.originMode, e.insertMode = false, false
+	e.charsets, e.charset = [2]bool{}, 0
+	e.hasLast = false
+	e.top, e.bottom = 0, e.height-1
+	e.resetTabs(0)
+	e.saved = e.cursorState()
+	e.altSaved = e.saved
+}
+
+// newANSIScreen 创建空白屏幕
+func newANSIScreen(width, height int) [][]ansiCell {
+	lines := make([][]ansiCell, height)
+	for y := range lines {
+		lines[y] = newANSIRow(width, Format{})
+	}
+	return lines
+}
+
+// newANSIRow 创建空白行
+func newANSIRow(width int, format Format) []ansiCell {
+	row := make([]ansiCell, width)
+	for x := range row {
+		row[x] = ansiCell{r: ' ', format: format}
+	}
+	return row
+}
+
+// resetTabs 从第 from 列起每 8 列设置一个制表位
+func (e *ANSIEmulator) resetTabs(from int) {
+	tabs := make([]bool, e.width)
+	copy(tabs, e.tabs[:minInt(from, len(e.tabs))])
+	for x := from; x < e.width; x++ {
+		tabs[x] = x > 0 && x%8 == 0
+	}
+	e.tabs = tabs
+}
+
+// minInt 返回两个整数中较小的一个
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// blank 返回擦除后的单元格（保留当前背景色）
+func (e *ANSIEmulator) blank() ansiCell {
+	return ansiCell{r: ' ', format: Format{Bg: e.pen.Bg}}
+}
+
+// cursorState 返回当前光标状态
+func (e *ANSIEmulator) cursorState() ansiCursor {
+	return ansiCursor{x: e.x, y: e.y, pen: e.pen, originMode: e.originMode, charsets: e.charsets, charset: e.charset}
+}
+
+// restoreCursorState 恢复保存的光标状态
+func (e *ANSIEmulator) restoreCursorState(c ansiCursor) {
+	e.x, e.y = c.x, c.y
+	e.pen = c.pen
+	e.originMode = c.originMode
+	e.charsets, e.charset = c.charsets, c.charset
+	e.clampCursor()
+	e.wrapPending = false
+}
+
+// clampCursor 把光标限制在屏幕内
+func (e *ANSIEmulator) clampCursor() {
+	if e.x >= e.width {
+		e.x = e.width - 1
+	}
+	if e.y >= e.height {
+		e.y = e.height - 1
+	}
+	if e.x < 0 {
+		e.x = 0
+	}
+	if e.y < 0 {
+		e.y = 0
+	}
+}
+
+// Write 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) Write(data []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, b := range data {
+		e.parser.Advance(b)
+	}
+	return len(data), nil
+}
+
+// print 在光标处写入字符
+func (e *ANSIEmulator) print(r rune) {
+	if e.charsets[e.charset] && r >= 0x5f && r <= 0x7e {
+		r = decSpecialGraphics[r-0x5f]
+	}
+
+	width := ansiRuneWidth.RuneWidth(r)
+	if width == 0 {
+		e.combine(r)
+		return
+	}
+
+	if e.wrapPending && e.autowrap {
+		e.x = 0
+		e.lineFeed()
+	}
+	e.wrapPending = false
+
+	// 行尾放不下宽字符时先换行
+	if width == 2 && e.x == e.width-1 {
+		if e.autowrap {
+			e.clearWide(e.y, e.x, e.x+1)
+			e.lines[e.y][e.x] = e.blank()
+			e.x = 0
+			e.lineFeed()
+		} else if e.width > 1 {
+			e.x = e.width - 2
+		}
+	}
+	if width > e.width {
+		return
+	}
+
+	row := e.lines[e.y]
+	if e.insertMode {
+		e.clearWide(e.y, e.x, e.width)
+		copy(row[e.x+width:], row[e.x:])
+	}
+	e.clearWide(e.y, e.x, e.x+width)
+	row[e.x] = ansiCell{r: r, format: e.pen}
+	if width == 2 {
+		row[e.x+1] = ansiCell{r: WideCharPadding, format: e.pen}
+	}
+	e.lastX, e.lastY, e.lastRune, e.hasLast = e.x, e.y, r, true
+
+	e.x += width
+	if e.x >= e.width {
+		e.x = e.width - 1
+		e.wrapPending = e.autowrap
+	}
+}
+
+// combine 把组合字符附加到上一个字符（能组合为预组字符时使用 NFC 形式）
+func (e *ANSIEmulator) combine(r rune) {
+	if !e.hasLast || e.lastY >= e.height || e.lastX >= e.width {
+		return
+	}
+	cell := &e.lines[e.lastY][e.lastX]
+	if cell.r == WideCharPadding || cell.r == ' ' {
+		return
+	}
+	composed := norm.NFC.String(string([]rune{cell.r, r}))
+	if c, size := utf8.DecodeRuneInString(composed); size == len(composed) {
+		cell.r = c
+		e.lastRune = c
+	}
+}
+
+// clearWide 擦除被 [x0, x1) 截断的宽字符的另一半
+func (e *ANSIEmulator) clearWide(y, x0, x1 int) {
+	row := e.lines[y]
+	if x0 > 0 && x0 < e.width && row[x0].r == WideCharPadding {
+		row[x0-1] = ansiCell{r: ' ', format: row[x0-1].format}
+		row[x0] = ansiCell{r: ' ', format: row[x0].format}
+	}
+	if x1 > 0 && x1 < e.width && row[x1].r == WideCharPadding {
+		row[x1-1] = ansiCell{r: ' ', format: row[x1-1].format}
+		row[x1] = ansiCell{r: ' ', format: row[x1].format}
+	}
+}
+
+// execute 处理 C0 控制字符
+func (e *ANSIEmulator) execute(b byte) {
+	switch b {
+	case '\b':
+		if e.x > 0 {
+			e.x--
+		}
+		e.wrapPending = false
+	case '\t':
+		e.tab(1)
+	case '\n', '\v', '\f':
+		e.lineFeed()
+	case '\r':
+		e.x = 0
+		e.wrapPending = false
+	case 0x0e: // SO
+		e.charset = 1
+	case 0x0f: // SI
+		e.charset = 0
+	}
+}
+
+// tab 移动到后面（n > 0）或前面（n < 0）第 |n| 个制表位
+func (e *ANSIEmulator) tab(n int) {
+	for ; n > 0; n-- {
+		x := e.x + 1
+		for x < e.width-1 && !e.tabs[x] {
+			x++
+		}
+		e.x = minInt(x, e.width-1)
+	}
+	for ; n < 0; n++ {
+		x := e.x - 1
+		for x > 0 && !e.tabs[x] {
+			x--
+		}
+		if x < 0 {
+			x = 0
+		}
+		e.x = x
+	}
+	e.wrapPending = false
+}
+
+// lineFeed 光标下移一行，在滚动区域底部时向上滚动
+func (e *ANSIEmulator) lineFeed() {
+	e.wrapPending = false
+	if e.y == e.bottom {
+		e.scrollUp(1)
+	} else if e.y < e.height-1 {
+		e.y++
+	}
+}
+
+// reverseIndex 光标上移一行，在滚动区域顶部时向下滚动
+func (e *ANSIEmulator) reverseIndex() {
+	e.wrapPending = false
+	if e.y == e.top {
+		e.scrollDown(1)
+	} else if e.y > 0 {
+		e.y--
+	}
+}
+
+// scrollUp 滚动区域内容上移 n 行；区域从主屏幕顶部开始时，滚出的行保存到 scrollback
+func (e *ANSIEmulator) scrollUp(n int) {
+	n = minInt(n, e.bottom-e.top+1)
+	if e.top == 0 && !e.altScreen {
+		for y := 0; y < n; y++ {
+			e.saveLine(e.lines[y])
+		}
+	}
+	e.shiftRows(e.top, e.bottom, n)
+}
+
+// scrollDown 滚动区域内容下移 n 行
+func (e *ANSIEmulator) scrollDown(n int) {
+	n = minInt(n, e.bottom-e.top+1)
+	e.shiftRows(e.top, e.bottom, -n)
+}
+
+// shiftRows 把 [top, bottom] 行上移 n 行（n < 0 时下移），空出的行填充空白
+func (e *ANSIEmulator) shiftRows(top, bottom, n int) {
+	if n > 0 {
+		copy(e.lines[top:bottom+1], e.lines[top+n:bottom+1])
+		for y := bottom - n + 1; y <= bottom; y++ {
+			e.lines[y] = newANSIRow(e.width, Format{Bg: e.pen.Bg})
+		}
+	} else if n < 0 {
+		n = -n
+		copy(e.lines[top+n:bottom+1], e.lines[top:bottom+1-n])
+		for y := top; y < top+n; y++ {
+			e.lines[y] = newANSIRow(e.width, Format{Bg: e.pen.Bg})
+		}
+	}
+}
+
+// saveLine 把一行写入滚动历史
+func (e *ANSIEmulator) saveLine(row []ansiCell) {
+	content := make([]rune, len(row))
+	format := make([]Format, len(row))
+	for x, cell := range row {
+		content[x], format[x] = cell.r, cell.format
+	}
+	e.scrollback.add(content, format)
+}
+
+// handleEsc 处理 ESC 序列
+func (e *ANSIEmulator) handleEsc(cmd ansi.Cmd) {
+	switch cmd.Intermediate() {
+	case '(', ')': // 指定 G0/G1 字符集
+		g := 0
+		if cmd.Intermediate() == ')' {
+			g = 1
+		}
+		e.charsets[g] = cmd.Final() == '0'
+		return
+	case '#':
+		if cmd.Final() == '8' { // DECALN
+			for y := range e.lines {
+				for x := range e.lines[y] {
+					e.lines[y][x] = ansiCell{r: 'E'}
+				}
+			}
+		}
+		return
+	case 0:
+	default:
+		return
+	}
+
+	// 小键盘模式（DECKPAM/DECKPNM）和 RIS 复位的终端模式
+	e.modes.handleEsc(cmd)
+
+	switch cmd.Final() {
+	case '7': // DECSC
+		e.saved = e.cursorState()
+	case '8': // DECRC
+		e.restoreCursorState(e.saved)
+	case 'D': // IND
+		e.lineFeed()
+	case 'E': // NEL
+		e.x = 0
+		e.lineFeed()
+	case 'M': // RI
+		e.reverseIndex()
+	case 'H': // HTS
+		e.tabs[e.x] = true
+	case 'c': // RIS
+		e.reset()
+	}
+}
+
+// handleCsi 处理 CSI 序列
+func (e *ANSIEmulator) handleCsi(cmd ansi.Cmd, params ansi.Params) {
+	if cmd.Intermediate() != 0 {
+		return
+	}
+	if cmd.Prefix() == '?' {
+		if cmd.Final() == 'h' || cmd.Final() == 'l' {
+			for _, p := range params {
+				e.setPrivateMode(p.Param(0), cmd.Final() == 'h')
+			}
+		}
+		return
+	}
+	if cmd.Prefix() != 0 {
+		return
+	}
+
+	// n 返回第 i 个参数，缺省或为 0 时使用 def
+	n := func(i, def int) int {
+		v, _, _ := params.Param(i, def)
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+
+	switch cmd.Final() {
+	case '@': // ICH
+		e.insertChars(n(0, 1))
+	case 'A': // CUU
+		e.moveRelative(0, -n(0, 1))
+	case 'B', 'e': // CUD / VPR
+		e.moveRelative(0, n(0, 1))
+	case 'C', 'a': // CUF / HPR
+		e.moveRelative(n(0, 1), 0)
+	case 'D': // CUB
+		e.moveRelative(-n(0, 1), 0)
+	case 'E': // CNL
+		e.moveRelative(0, n(0, 1))
+		e.x = 0
+	case 'F': // CPL
+		e.moveRelative(0, -n(0, 1))
+		e.x = 0
+	case 'G', '`': // CHA / HPA
+		e.x = n(0, 1) - 1
+		e.clampCursor()
+		e.wrapPending = false
+	case 'H', 'f': // CUP
+		e.moveTo(n(1, 1)-1, n(0, 1)-1)
+	case 'I': // CHT
+		e.tab(n(0, 1))
+	case 'J': // ED
+		mode, _, _ := params.Param(0, 0)
+		e.eraseDisplay(mode)
+	case 'K': // EL
+		mode, _, _ := params.Param(0, 0)
+		e.eraseLine(mode)
+	case 'L': // IL
+		e.insertLines(n(0, 1))
+	case 'M': // DL
+		e.deleteLines(n(0, 1))
+	case 'P': // DCH
+		e.deleteChars(n(0, 1))
+	case 'S': // SU
+		e.scrollUp(n(0, 1))
+	case 'T': // SD
+		e.scrollDown(n(0, 1))
+	case 'X': // ECH
+		e.eraseChars(n(0, 1))
+	case 'Z': // CBT
+		e.tab(-n(0, 1))
+	case 'b': // REP
+		if e.hasLast {
+			for i := n(0, 1); i > 0; i-- {
+				e.print(e.lastRune)
+			}
+		}
+	case 'd': // VPA
+		e.moveTo(e.x, n(0, 1)-1)
+	case 'g': // TBC
+		switch mode, _, _ := params.Param(0, 0); mode {
+		case 0:
+			e.tabs[e.x] = false
+		case 3:
+			e.tabs = make([]bool, e.width)
+		}
+	case 'h', 'l': // SM / RM
+		for _, p := range params {
+			if p.Param(0) == 4 { // IRM
+				e.insertMode = cmd.Final() == 'h'
+			}
+		}
+	case 'm': // SGR
+		e.setAttributes(params)
+	case 'r': // DECSTBM
+		top, bottom := n(0, 1)-1, n(1, e.height)-1
+		if bottom >= e.height {
+			bottom = e.height - 1
+		}
+		if top < bottom {
+			e.top, e.bottom = top, bottom
+			e.moveTo(0, 0)
+		}
+	case 's': // SCOSC
+		e.saved = e.cursorState()
+	case 'u': // SCORC
+		e.restoreCursorState(e.saved)
+	}
+}
+
+// handleOsc 处理 OSC 序列（窗口标题）
+func (e *ANSIEmulator) handleOsc(cmd int, data []byte) {
+	e.modes.handleOsc(cmd, data)
+}
+
+// setPrivateMode 处理 DEC 私有模式（CSI ? n h/l）
+func (e *ANSIEmulator) setPrivateMode(mode int, set bool) {
+	e.modes.setPrivateMode(mode, set)
+
+	switch mode {
+	case 6: // DECOM
+		e.originMode = set
+		e.moveTo(0, 0)
+	case 7: // DECAWM
+		e.autowrap = set
+		if !set {
+			e.wrapPending = false
+		}
+	case 47, 1047:
+		e.switchScreen(set, mode == 1047)
+	case 1048:
+		if set {
+			e.saved = e.cursorState()
+		} else {
+			e.restoreCursorState(e.saved)
+		}
+	case 1049:
+		if set {
+			if !e.altScreen {
+				e.altSaved = e.cursorState()
+			}
+			e.switchScreen(true, true)
+		} else {
+			e.switchScreen(false, false)
+			e.restoreCursorState(e.altSaved)
+		}
+	}
+}
+
+// switchScreen 切换主屏幕和备用屏幕；clear 时清空备用屏幕
+func (e *ANSIEmulator) switchScreen(alt, clear bool) {
+	if alt && clear {
+		e.alternate = newANSIScreen(e.width, e.height)
+	}
+	if alt == e.altScreen {
+		if alt {
+			e.lines = e.alternate
+		}
+		return
+	}
+	e.altScreen = alt
+	if alt {
+		e.lines = e.alternate
+	} else {
+		e.lines = e.primary
+	}
+	e.wrapPending = false
+}
+
+// moveTo 移动光标到 (x, y)，DECOM 时 y 相对于滚动区域
+func (e *ANSIEmulator) moveTo(x, y int) {
+	if e.originMode {
+		y += e.top
+		if y > e.bottom {
+			y = e.bottom
+		}
+	}
+	e.x, e.y = x, y
+	e.clampCursor()
+	e.wrapPending = false
+}
+
+// moveRelative 相对移动光标，纵向移动不越过滚动区域边界
+func (e *ANSIEmulator) moveRelative(dx, dy int) {
+	y := e.y + dy
+	if e.y >= e.top && e.y <= e.bottom {
+		if y < e.top {
+			y = e.top
+		}
+		if y > e.bottom {
+			y = e.bottom
+		}
+	}
+	e.x += dx
+	e.y = y
+	e.clampCursor()
+	e.wrapPending = false
+}
+
+// eraseDisplay 处理 ED：0 光标到屏幕末尾，1 屏幕开头到光标，2 整屏，3 清除滚动历史
+func (e *ANSIEmulator) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		e.eraseCells(e.y, e.x, e.width)
+		for y := e.y + 1; y < e.height; y++ {
+			e.eraseCells(y, 0, e.width)
+		}
+	case 1:
+		for y := 0; y < e.y; y++ {
+			e.eraseCells(y, 0, e.width)
+		}
+		e.eraseCells(e.y, 0, e.x+1)
+	case 2:
+		for y := 0; y < e.height; y++ {
+			e.eraseCells(y, 0, e.width)
+		}
+	case 3:
+		e.scrollback.clear()
+	}
+	e.wrapPending = false
+}
+
+// eraseLine 处理 EL：0 光标到行尾，1 行首到光标，2 整行
+func (e *ANSIEmulator) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		e.eraseCells(e.y, e.x, e.width)
+	case 1:
+		e.eraseCells(e.y, 0, e.x+1)
+	case 2:
+		e.eraseCells(e.y, 0, e.width)
+	}
+	e.wrapPending = false
+}
+
+// eraseCells 擦除第 y 行的 [x0, x1) 列
+func (e *ANSIEmulator) eraseCells(y, x0, x1 int) {
+	x1 = minInt(x1, e.width)
+	if x0 >= x1 {
+		return
+	}
+	e.clearWide(y, x0, x1)
+	for x := x0; x < x1; x++ {
+		e.lines[y][x] = e.blank()
+	}
+}
+
+// eraseChars 处理 ECH：从光标起擦除 n 个字符
+func (e *ANSIEmulator) eraseChars(n int) {
+	e.eraseCells(e.y, e.x, e.x+n)
+	e.wrapPending = false
+}
+
+// insertChars 处理 ICH：在光标处插入 n 个空白，右侧内容右移
+func (e *ANSIEmulator) insertChars(n int) {
+	row := e.lines[e.y]
+	n = minInt(n, e.width-e.x)
+	e.clearWide(e.y, e.x, e.width-n)
+	copy(row[e.x+n:], row[e.x:e.width-n])
+	for x := e.x; x < e.x+n; x++ {
+		row[x] = e.blank()
+	}
+	if ansiRuneWidth.RuneWidth(row[e.width-1].r) == 2 {
+		row[e.width-1] = e.blank()
+	}
+	e.wrapPending = false
+}
+
+// deleteChars 处理 DCH：删除光标处 n 个字符，右侧内容左移
+func (e *ANSIEmulator) deleteChars(n int) {
+	row := e.lines[e.y]
+	n = minInt(n, e.width-e.x)
+	e.clearWide(e.y, e.x, e.x+n)
+	copy(row[e.x:], row[e.x+n:])
+	for x := e.width - n; x < e.width; x++ {
+		row[x] = e.blank()
+	}
+	e.wrapPending = false
+}
+
+// insertLines 处理 IL：在光标行插入 n 个空行（仅在滚动区域内有效）
+func (e *ANSIEmulator) insertLines(n int) {
+	if e.y < e.top || e.y > e.bottom {
+		return
+	}
+	e.shiftRows(e.y, e.bottom, -minInt(n, e.bottom-e.y+1))
+	e.x, e.wrapPending = 0, false
+}
+
+// deleteLines 处理 DL：删除光标行起的 n 行（仅在滚动区域内有效）
+func (e *ANSIEmulator) deleteLines(n int) {
+	if e.y < e.top || e.y > e.bottom {
+		return
+	}
+	e.shiftRows(e.y, e.bottom, minInt(n, e.bottom-e.y+1))
+	e.x, e.wrapPending = 0, false
+}
+
+// setAttributes 处理 SGR
+func (e *ANSIEmulator) setAttributes(params ansi.Params) {
+	if len(params) == 0 {
+		e.pen = Format{}
+		return
+	}
+
+	for i := 0; i < len(params); i++ {
+		p := params[i].Param(0)
+		switch {
+		case p == 0:
+			e.pen = Format{}
+		case p == 1:
+			e.pen.Bold = true
+		case p == 2:
+			e.pen.Faint = true
+		case p == 3:
+			e.pen.Italic = true
+		case p == 4:
+			// 4:0 表示关闭下划线，其他子参数为下划线样式
+			e.pen.Underline = true
+			if params[i].HasMore() && i+1 < len(params) {
+				e.pen.Underline = params[i+1].Param(1) != 0
+			}
+		case p == 5 || p == 6:
+			e.pen.Blink = true
+		case p == 7:
+			e.pen.Reverse = true
+		case p == 22:
+			e.pen.Bold, e.pen.Faint = false, false
+		case p == 23:
+			e.pen.Italic = false
+		case p == 24:
+			e.pen.Underline = false
+		case p == 25:
+			e.pen.Blink = false
+		case p == 27:
+			e.pen.Reverse = false
+		case p >= 30 && p <= 37:
+			e.pen.Fg = BasicColor(p - 30)
+		case p == 39:
+			e.pen.Fg = Color{}
+		case p >= 40 && p <= 47:
+			e.pen.Bg = BasicColor(p - 40)
+		case p == 49:
+			e.pen.Bg = Color{}
+		case p >= 90 && p <= 97:
+			e.pen.Fg = BasicColor(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			e.pen.Bg = BasicColor(p - 100 + 8)
+		case p == 38 || p == 48 || p == 58:
+			var c color.Color
+			n := ansi.ReadStyleColor(params[i:], &c)
+			if n == 0 {
+				return
+			}
+			if c != nil && p != 58 {
+				if p == 38 {
+					e.pen.Fg = sgrColor(c)
+				} else {
+					e.pen.Bg = sgrColor(c)
+				}
+			}
+			i += n - 1
+			continue
+		}
+
+		// 跳过未处理参数的子参数
+		for params[i].HasMore() && i+1 < len(params) {
+			i++
+		}
+	}
+}
+
+// sgrColor 将 SGR 序列中读取的颜色转换为 Color
+func sgrColor(c color.Color) Color {
+	switch v := c.(type) {
+	case ansi.BasicColor:
+		return BasicColor(int(v))
+	case ansi.IndexedColor:
+		return IndexedColor(int(v))
+	}
+	r, g, b, _ := c.RGBA()
+	return RGBColor(uint8(r>>8), uint8(g>>8), uint8(b>>8))
+}
+
+// GetScreenContent 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) GetScreenContent() [][]rune {
+	content, _ := e.GetScreenContentWithFormat()
+	return content
+}
+
+// GetScreenContentWithFormat 实现 TerminalEmulator 接口
+// 宽字符的第二列为 WideCharPadding
+func (e *ANSIEmulator) GetScreenContentWithFormat() ([][]rune, [][]Format) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	content := make([][]rune, e.height)
+	format := make([][]Format, e.height)
+	for y, row := range e.lines {
+		content[y] = make([]rune, len(row))
+		format[y] = make([]Format, len(row))
+		for x, cell := range row {
+			content[y][x] = cell.r
+			format[y][x] = cell.format
+		}
+	}
+	return content, format
+}
+
+// GetScrollback 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) GetScrollback(n int) ([][]rune, [][]Format) {
+	return e.scrollback.get(n)
+}
+
+// scrolledLines 实现 scrollCounter 接口
+func (e *ANSIEmulator) scrolledLines() uint64 {
+	return e.scrollback.count()
+}
+
+// GetCursorPosition 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) GetCursorPosition() (int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.x, e.y
+}
+
+// GetSize 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) GetSize() (int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.width, e.height
+}
+
+// GetModes 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) GetModes() TerminalModes {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	modes := e.modes
+	modes.AltScreen = e.altScreen
+	return modes
+}
+
+// Resize 实现 TerminalEmulator 接口
+// 保留屏幕内容；高度缩小时光标上方滚出的行保存到 scrollback
+func (e *ANSIEmulator) Resize(width, height int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	oldWidth := e.width
+	e.setSize(width, height)
+	width, height = e.width, e.height
+
+	// 光标会落到屏幕外时，从顶部移出多余的行
+	shift := 0
+	if e.y >= height {
+		shift = e.y - height + 1
+	}
+	if !e.altScreen {
+		for y := 0; y < shift; y++ {
+			e.saveLine(e.primary[y])
+		}
+	}
+	e.primary = resizeANSIScreen(e.primary, width, height, shift)
+	altShift := 0
+	if e.altScreen {
+		altShift = shift
+	}
+	e.alternate = resizeANSIScreen(e.alternate, width, height, altShift)
+	if e.altScreen {
+		e.lines = e.alternate
+	} else {
+		e.lines = e.primary
+	}
+
+	e.y -= shift
+	e.top, e.bottom = 0, height-1
+	e.resetTabs(oldWidth)
+	e.clampCursor()
+	e.wrapPending = false
+	e.hasLast = false
+}
+
+// resizeANSIScreen 从第 shift 行起截取或补齐屏幕到新尺寸
+func resizeANSIScreen(lines [][]ansiCell, width, height, shift int) [][]ansiCell {
+	if shift > len(lines) {
+		shift = len(lines)
+	}
+	lines = lines[shift:]
+
+	result := make([][]ansiCell, height)
+	for y := range result {
+		if y >= len(lines) {
+			result[y] = newANSIRow(width, Format{})
+			continue
+		}
+		row := lines[y]
+		if len(row) > width {
+			row = row[:width]
+			// 截断的宽字符改为空白
+			if ansiRuneWidth.RuneWidth(row[width-1].r) == 2 {
+				row[width-1] = ansiCell{r: ' '}
+			}
+		} else {
+			for len(row) < width {
+				row = append(row, ansiCell{r: ' '})
+			}
+		}
+		result[y] = row
+	}
+	return result
+}
+
+// Close 实现 TerminalEmulator 接口
+func (e *ANSIEmulator) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package sshmcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ansiScreen returns the screen rows of the built-in emulator as trimmed strings
+func ansiScreen(t *testing.T, e *ANSIEmulator) []string {
+	t.Helper()
+	snapshot := renderPlainScreen(e.GetScreenContent())
+	lines := strings.Split(snapshot, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return lines
+}
+
+// newTestANSIEmulator creates a built-in emulator of the given size
+func newTestANSIEmulator(t *testing.T, width, height int) *ANSIEmulator {
+	t.Helper()
+	e, err := NewANSIEmulator(width, height)
+	require.NoError(t, err)
+	return e
+}
+
+// TestANSIEmulator_WideChars tests CJK characters taking two columns
+func TestANSIEmulator_WideChars(t *testing.T) {
+	e := newTestANSIEmulator(t, 7, 3)
+
+	e.Write([]byte("中文ab"))
+	x, _ := e.GetCursorPosition()
+	assert.Equal(t, 6, x)
+	content := e.GetScreenContent()
+	assert.Equal(t, []rune{'中', WideCharPadding, '文', WideCharPadding, 'a', 'b', ' '}, content[0])
+
+	// 行尾只剩一列时宽字符换到下一行
+	e.Write([]byte("c字"))
+	assert.Equal(t, []string{"中文abc", "字", ""}, ansiScreen(t, e))
+
+	// 覆盖宽字符的一半时另一半被擦除
+	e.Write([]byte("\x1b[1;2Hx"))
+	assert.Equal(t, " x文abc", ansiScreen(t, e)[0])
+}
+
+// TestANSIEmulator_CombiningMarks tests combining marks attached to the previous character
+func TestANSIEmulator_CombiningMarks(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 2)
+
+	e.Write([]byte("café!"))
+	assert.Equal(t, "café!", ansiScreen(t, e)[0])
+	x, _ := e.GetCursorPosition()
+	assert.Equal(t, 5, x)
+}
+
+// TestANSIEmulator_AltScreen tests switching to the alternate screen and back
+func TestANSIEmulator_AltScreen(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 3)
+
+	e.Write([]byte("$ vim\r\n"))
+	e.Write([]byte("\x1b[?1049h\x1b[Hfile\r\n~\r\n~\r\n~"))
+	assert.Equal(t, []string{"~", "~", "~"}, ansiScreen(t, e))
+
+	e.Write([]byte("\x1b[?1049l"))
+	assert.Equal(t, []string{"$ vim", "", ""}, ansiScreen(t, e))
+	x, y := e.GetCursorPosition()
+	assert.Equal(t, 0, x)
+	assert.Equal(t, 1, y)
+	assert.Empty(t, scrollbackText(e, 10))
+}
+
+// TestANSIEmulator_ScrollRegion tests scrolling inside a region
+func TestANSIEmulator_ScrollRegion(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 4)
+
+	e.Write([]byte("title\r\n\x1b[2;3r\x1b[2;1Ha\r\nb\r\nc\x1b[4;1Hstatus"))
+	assert.Equal(t, []string{"title", "b", "c", "status"}, ansiScreen(t, e))
+	assert.Empty(t, scrollbackText(e, 10))
+
+	// 反向索引在区域顶部向下滚动
+	e.Write([]byte("\x1b[2;1H\x1bMz"))
+	assert.Equal(t, []string{"title", "z", "b", "status"}, ansiScreen(t, e))
+
+	// 插入/删除行只影响区域内
+	e.Write([]byte("\x1b[2;1H\x1b[M"))
+	assert.Equal(t, []string{"title", "b", "", "status"}, ansiScreen(t, e))
+}
+
+// TestANSIEmulator_EditChars tests insert/delete/erase characters
+func TestANSIEmulator_EditChars(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 1)
+
+	e.Write([]byte("abcdef\x1b[1;3H\x1b[2@"))
+	assert.Equal(t, "ab  cdef", ansiScreen(t, e)[0])
+	e.Write([]byte("\x1b[3P"))
+	assert.Equal(t, "abdef", ansiScreen(t, e)[0])
+	e.Write([]byte("\x1b[2X"))
+	assert.Equal(t, "ab  f", ansiScreen(t, e)[0])
+	e.Write([]byte("\x1b[4hXY\x1b[4l"))
+	assert.Equal(t, "abXY  f", ansiScreen(t, e)[0])
+	e.Write([]byte("\x1b[K"))
+	assert.Equal(t, "abXY", ansiScreen(t, e)[0])
+}
+
+// TestANSIEmulator_LineDrawing tests the DEC special graphics charset
+func TestANSIEmulator_LineDrawing(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 1)
+
+	e.Write([]byte("\x1b(0lqk\x1b(Bq"))
+	assert.Equal(t, "┌─┐q", ansiScreen(t, e)[0])
+}
+
+// TestANSIEmulator_Attributes tests SGR attributes and colours
+func TestANSIEmulator_Attributes(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 1)
+
+	e.Write([]byte("\x1b[1;4;38;2;1;2;3;48;5;17ma\x1b[22;24;39mb\x1b[0;7mc"))
+	_, format := e.GetScreenContentWithFormat()
+	assert.Equal(t, Format{Bold: true, Underline: true, Fg: RGBColor(1, 2, 3), Bg: IndexedColor(17)}, format[0][0])
+	assert.Equal(t, Format{Bg: IndexedColor(17)}, format[0][1])
+	assert.Equal(t, Format{Reverse: true}, format[0][2])
+}
+
+// TestANSIEmulator_Resize tests keeping content and saving rows pushed off the top
+func TestANSIEmulator_Resize(t *testing.T) {
+	e := newTestANSIEmulator(t, 10, 4)
+
+	e.Write([]byte("1\r\n2\r\n3\r\n4"))
+	e.Resize(3, 2)
+	assert.Equal(t, []string{"3", "4"}, ansiScreen(t, e))
+	assert.Equal(t, []string{"1", "2"}, scrollbackText(e, 10))
+
+	e.Resize(5, 3)
+	assert.Equal(t, []string{"3", "4", ""}, ansiScreen(t, e))
+	x, y := e.GetCursorPosition()
+	assert.Equal(t, 1, x)
+	assert.Equal(t, 1, y)
+}
@@ -0,0 +1,283 @@
+package sshmcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// TextStyle is the SGR state of a piece of text. Colours are "" (terminal
+// default), a basic colour name ("red", "bright-red"), "256:N" for the
+// xterm 256-colour palette, or "#rrggbb" for true colour.
+type TextStyle struct {
+	Fg        string `json:"fg,omitempty"`
+	Bg        string `json:"bg,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+	Reverse   bool   `json:"reverse,omitempty"`
+}
+
+// StyledSpan is a run of text sharing one style
+type StyledSpan struct {
+	Text string `json:"text"`
+	TextStyle
+}
+
+// basicColorNames are the names of the 16 ANSI colours
+var basicColorNames = [16]string{
+	"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white",
+	"bright-black", "bright-red", "bright-green", "bright-yellow",
+	"bright-blue", "bright-magenta", "bright-cyan", "bright-white",
+}
+
+// paletteColorName names a colour from the 256-colour palette
+func paletteColorName(index int) string {
+	if index >= 0 && index < 16 {
+		return basicColorNames[index]
+	}
+	return fmt.Sprintf("256:%d", index)
+}
+
+// styledCell is one printed rune and its style
+type styledCell struct {
+	r     rune
+	style TextStyle
+}
+
+// styledText interprets raw output into lines of styled cells. Carriage
+// returns move back to the start of the current terminal row (cols wide,
+// 0 = unknown) and later text overwrites from there, so progress bars keep
+// only their last redraw and long lines wrapped by readline stay intact.
+type styledText struct {
+	cols  int
+	style TextStyle
+	lines [][]styledCell
+	cur   []styledCell
+	x     int
+}
+
+// parseStyledText splits raw output into lines of styled cells
+func parseStyledText(raw string, cols int) [][]styledCell {
+	st := &styledText{cols: cols}
+
+	parser := ansi.NewParser()
+	parser.SetParamsSize(32)
+	parser.SetDataSize(1024)
+	parser.SetHandler(ansi.Handler{
+		Print:   st.print,
+		Execute: st.execute,
+		HandleCsi: func(cmd ansi.Cmd, params ansi.Params) {
+			if cmd.Final() == 'm' && cmd.Prefix() == 0 && cmd.Intermediate() == 0 {
+				st.applySGR(params)
+			}
+		},
+	})
+	parser.Parse([]byte(raw))
+
+	return append(st.lines, st.cur)
+}
+
+func (st *styledText) print(r rune) {
+	cell := styledCell{r: r, style: st.style}
+	if st.x < len(st.cur) {
+		st.cur[st.x] = cell
+	} else {
+		st.cur = append(st.cur, cell)
+	}
+	st.x++
+}
+
+func (st *styledText) execute(b byte) {
+	switch b {
+	case '\n':
+		st.lines = append(st.lines, st.cur)
+		st.cur = nil
+		st.x = 0
+	case '\r':
+		// 回到当前终端行的行首（已折行时不会回到第一行）
+		rowStart := 0
+		if st.cols > 0 && st.x > 0 {
+			rowStart = (st.x - 1) / st.cols * st.cols
+		}
+		st.x = rowStart
+	case '\b':
+		if st.x > 0 {
+			st.x--
+		}
+	case '\t':
+		st.print('\t')
+	}
+}
+
+// applySGR updates the current style from SGR parameters
+func (st *styledText) applySGR(params ansi.Params) {
+	if len(params) == 0 {
+		st.style = TextStyle{}
+		return
+	}
+
+	for i := 0; i < len(params); i++ {
+		p := params[i].Param(0)
+		switch {
+		case p == 0:
+			st.style = TextStyle{}
+		case p == 1:
+			st.style.Bold = true
+		case p == 3:
+			st.style.Italic = true
+		case p == 4:
+			// 4:0 表示关闭下划线，其他子参数为下划线样式
+			st.style.Underline = true
+			if params[i].HasMore() && i+1 < len(params) {
+				st.style.Underline = params[i+1].Param(1) != 0
+			}
+		case p == 7:
+			st.style.Reverse = true
+		case p == 22:
+			st.style.Bold = false
+		case p == 23:
+			st.style.Italic = false
+		case p == 24:
+			st.style.Underline = false
+		case p == 27:
+			st.style.Reverse = false
+		case p >= 30 && p <= 37:
+			st.style.Fg = basicColorNames[p-30]
+		case p == 39:
+			st.style.Fg = ""
+		case p >= 40 && p <= 47:
+			st.style.Bg = basicColorNames[p-40]
+		case p == 49:
+			st.style.Bg = ""
+		case p >= 90 && p <= 97:
+			st.style.Fg = basicColorNames[p-90+8]
+		case p >= 100 && p <= 107:
+			st.style.Bg = basicColorNames[p-100+8]
+		case p == 38 || p == 48 || p == 58:
+			var c color.Color
+			n := ansi.ReadStyleColor(params[i:], &c)
+			if n == 0 {
+				return
+			}
+			if c != nil && p != 58 {
+				if p == 38 {
+					st.style.Fg = sgrColorName(c)
+				} else {
+					st.style.Bg = sgrColorName(c)
+				}
+			}
+			i += n - 1
+			continue
+		}
+
+		// 跳过未处理参数的子参数
+		for params[i].HasMore() && i+1 < len(params) {
+			i++
+		}
+	}
+}
+
+// sgrColorName names a colour read from an SGR sequence
+func sgrColorName(c color.Color) string {
+	switch v := c.(type) {
+	case ansi.BasicColor:
+		return paletteColorName(int(v))
+	case ansi.IndexedColor:
+		return paletteColorName(int(v))
+	}
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// cellsToSpans groups consecutive cells with the same style
+func cellsToSpans(cells []styledCell) []StyledSpan {
+	spans := []StyledSpan{}
+	var text strings.Builder
+	for i, cell := range cells {
+		if i > 0 && cell.style != cells[i-1].style {
+			spans = append(spans, StyledSpan{Text: text.String(), TextStyle: cells[i-1].style})
+			text.Reset()
+		}
+		text.WriteRune(cell.r)
+	}
+	if len(cells) > 0 {
+		spans = append(spans, StyledSpan{Text: text.String(), TextStyle: cells[len(cells)-1].style})
+	}
+	return spans
+}
+
+// cellsText returns the plain text of cells
+func cellsText(cells []styledCell) string {
+	runes := make([]rune, len(cells))
+	for i, cell := range cells {
+		runes[i] = cell.r
+	}
+	return string(runes)
+}
+
+// ParseStyledOutput parses raw shell output into lines of styled spans
+func ParseStyledOutput(raw string, cols int) [][]StyledSpan {
+	lines := parseStyledText(raw, cols)
+	result := make([][]StyledSpan, len(lines))
+	for i, cells := range lines {
+		result[i] = cellsToSpans(cells)
+	}
+	return result
+}
+
+// StyledJSON encodes styled lines as compact JSON, one line per row
+func StyledJSON(lines [][]StyledSpan) string {
+	var sb strings.Builder
+	sb.WriteString("[\n")
+	for i, line := range lines {
+		data, _ := json.Marshal(line)
+		sb.Write(data)
+		if i < len(lines)-1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// ScreenSpans converts emulator screen content into lines of styled spans.
+// Trailing blank cells of each row are dropped.
+func ScreenSpans(content [][]rune, format [][]Format) [][]StyledSpan {
+	result := make([][]StyledSpan, len(content))
+	for y, row := range content {
+		cells := make([]styledCell, 0, len(row))
+		for x, r := range row {
+			if r == WideCharPadding {
+				continue
+			}
+			if r == 0 {
+				r = ' '
+			}
+			cell := styledCell{r: r}
+			if y < len(format) && x < len(format[y]) {
+				f := format[y][x]
+				cell.style = TextStyle{
+					Fg:        f.Fg.Name(),
+					Bg:        f.Bg.Name(),
+					Bold:      f.Bold,
+					Italic:    f.Italic,
+					Underline: f.Underline,
+					Reverse:   f.Reverse,
+				}
+			}
+			cells = append(cells, cell)
+		}
+
+		end := len(cells)
+		for end > 0 && cells[end-1].r == ' ' && cells[end-1].style == (TextStyle{}) {
+			end--
+		}
+		result[y] = cellsToSpans(cells[:end])
+	}
+	return result
+}
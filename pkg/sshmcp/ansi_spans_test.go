@@ -0,0 +1,89 @@
+package sshmcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseStyledOutput_SGR tests colours and attributes parsed from SGR sequences
+func TestParseStyledOutput_SGR(t *testing.T) {
+	raw := "\x1b[1;31merror:\x1b[0m bad \x1b[4;7mflag\x1b[24;27m\n" +
+		"\x1b[38;5;208mo\x1b[38;2;1;2;3mt\x1b[48:2::255:0:16mc\x1b[39;49m \x1b[92;104mb\x1b[m"
+
+	lines := ParseStyledOutput(raw, 80)
+	require.Len(t, lines, 2)
+
+	assert.Equal(t, []StyledSpan{
+		{Text: "error:", TextStyle: TextStyle{Fg: "red", Bold: true}},
+		{Text: " bad "},
+		{Text: "flag", TextStyle: TextStyle{Underline: true, Reverse: true}},
+	}, lines[0])
+
+	assert.Equal(t, []StyledSpan{
+		{Text: "o", TextStyle: TextStyle{Fg: "256:208"}},
+		{Text: "t", TextStyle: TextStyle{Fg: "#010203"}},
+		{Text: "c", TextStyle: TextStyle{Fg: "#010203", Bg: "#ff0010"}},
+		{Text: " "},
+		{Text: "b", TextStyle: TextStyle{Fg: "bright-green", Bg: "bright-blue"}},
+	}, lines[1])
+}
+
+// TestParseStyledOutput_StyleAcrossLines tests that styles carry over newlines and redraws
+func TestParseStyledOutput_StyleAcrossLines(t *testing.T) {
+	lines := ParseStyledOutput("\x1b[32mok\nstill\x1b[0m\n50%\r\x1b[1m100%", 80)
+	require.Len(t, lines, 3)
+
+	assert.Equal(t, []StyledSpan{{Text: "still", TextStyle: TextStyle{Fg: "green"}}}, lines[1])
+	assert.Equal(t, []StyledSpan{{Text: "100%", TextStyle: TextStyle{Bold: true}}}, lines[2])
+	assert.Equal(t, []StyledSpan{}, ParseStyledOutput("", 80)[0])
+}
+
+// TestRenderOutput_Parse tests the JSON produced by ANSIParse
+func TestRenderOutput_Parse(t *testing.T) {
+	got := RenderOutput("\x1b[31mred\x1b[0m\n\nplain", ANSIParse, 80)
+	assert.Equal(t, "[\n"+
+		`[{"text":"red","fg":"red"}],`+"\n"+
+		"[],\n"+
+		`[{"text":"plain"}]`+"\n]", got)
+}
+
+// TestScreenSpans tests converting emulator cell formats
+func TestScreenSpans(t *testing.T) {
+	content := [][]rune{
+		{'a', 'b', ' ', 0},
+		{'x', 'y', 'z', ' '},
+	}
+	format := [][]Format{
+		{{Fg: BasicColor(1)}, {Fg: IndexedColor(123)}, {}, {}},
+		{{Fg: BasicColor(9), Bold: true}, {Fg: RGBColor(0xa0, 0xb0, 0xc0)}, {Bg: IndexedColor(17), Reverse: true}, {}},
+	}
+
+	spans := ScreenSpans(content, format)
+	require.Len(t, spans, 2)
+	assert.Equal(t, []StyledSpan{
+		{Text: "a", TextStyle: TextStyle{Fg: "red"}},
+		{Text: "b", TextStyle: TextStyle{Fg: "256:123"}},
+	}, spans[0])
+	assert.Equal(t, []StyledSpan{
+		{Text: "x", TextStyle: TextStyle{Fg: "bright-red", Bold: true}},
+		{Text: "y", TextStyle: TextStyle{Fg: "#a0b0c0"}},
+		{Text: "z", TextStyle: TextStyle{Bg: "256:17", Reverse: true}},
+	}, spans[1])
+}
+
+// TestTerminalCapturer_GetScreenSpans tests spans from the default emulator
+func TestTerminalCapturer_GetScreenSpans(t *testing.T) {
+	tc, err := NewTerminalCapturerWithType(20, 20, EmulatorTypeVT10x)
+	require.NoError(t, err)
+	tc.Emulator.Write([]byte("\x1b[31mFAIL\x1b[0m done\r\n"))
+
+	spans := tc.GetScreenSpans()
+	require.Len(t, spans, 20)
+	assert.Equal(t, []StyledSpan{
+		{Text: "FAIL", TextStyle: TextStyle{Fg: "red"}},
+		{Text: " done"},
+	}, spans[0])
+	assert.Empty(t, spans[1])
+}
@@ -0,0 +1,363 @@
+package sshmcp
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBufferLines is the default number of lines kept per shell
+	DefaultBufferLines = 10000
+	// DefaultBufferBytes is the default number of raw output bytes kept per shell
+	DefaultBufferBytes = 4 * 1024 * 1024
+)
+
+// outputChunk is one raw read from the shell output
+type outputChunk struct {
+	offset int64 // data[0] 在输出流中的绝对偏移
+	data   []byte
+	time   time.Time
+}
+
+// CircularBuffer is a thread-safe ring of raw shell output. Chunks are kept
+// exactly as received (with timestamps), bounded by both a line and a byte
+// capacity; ANSI handling is applied by readers via RenderOutput.
+//
+// Every complete line gets a monotonically increasing sequence number
+// (starting at 0), so readers can resume from a cursor without consuming
+// output for others. The unterminated last line has no sequence number yet.
+type CircularBuffer struct {
+	chunks   []outputChunk
+	maxLines int
+	maxBytes int
+	start    int64 // 保留的最早字节偏移
+	end      int64 // 下一个字节的偏移
+	// lineStarts[i] 是序号 firstSeq+i 的行起始偏移，最后一个元素是未完成行的起始偏移
+	lineStarts []int64
+	firstSeq   int64 // 保留的最早完整行序号（之前的行因溢出丢失）
+	nextSeq    int64 // 下一个完整行的序号
+	readSeq    int64 // ReadAllUnread 使用的全局已读游标
+	mu         sync.Mutex
+}
+
+// BufferRead is the result of a sequence-aware read. Lines are raw (without
+// the trailing newline); pass them through RenderOutput before display.
+type BufferRead struct {
+	Lines     []string    `json:"lines"`
+	Times     []time.Time `json:"times"`             // 每行完成（收到换行）的时间
+	Partial   string      `json:"partial,omitempty"` // 尚未收到换行的最后一行，不计入序号
+	FirstSeq  int64       `json:"first_seq"`         // Lines[0] 的序号
+	NextSeq   int64       `json:"next_seq"`          // 下次读取时传入的 since_seq
+	Dropped   int64       `json:"dropped"`           // since_seq 之后因缓冲区溢出而丢失的行数
+	Remaining int64       `json:"remaining"`         // 受 limit 限制尚未返回的行数
+}
+
+// NewCircularBuffer creates a buffer holding up to size lines and DefaultBufferBytes bytes
+func NewCircularBuffer(size int) *CircularBuffer {
+	return NewCircularBufferWithLimits(size, DefaultBufferBytes)
+}
+
+// NewCircularBufferWithLimits creates a buffer bounded by lines and raw bytes
+func NewCircularBufferWithLimits(maxLines, maxBytes int) *CircularBuffer {
+	if maxLines <= 0 {
+		maxLines = DefaultBufferLines
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultBufferBytes
+	}
+	return &CircularBuffer{
+		maxLines:   maxLines,
+		maxBytes:   maxBytes,
+		lineStarts: []int64{0},
+	}
+}
+
+// Write appends raw shell output. Data is copied and stored unmodified.
+func (cb *CircularBuffer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	data := append([]byte(nil), p...)
+	cb.chunks = append(cb.chunks, outputChunk{offset: cb.end, data: data, time: time.Now()})
+	for i, b := range data {
+		if b == '\n' {
+			cb.lineStarts = append(cb.lineStarts, cb.end+int64(i)+1)
+			cb.nextSeq++
+		}
+	}
+	cb.end += int64(len(data))
+	cb.evict()
+
+	return len(p), nil
+}
+
+// WriteLine appends one complete line
+func (cb *CircularBuffer) WriteLine(line string) {
+	cb.Write([]byte(line + "\n"))
+}
+
+// evict drops the oldest output until both capacities are respected (caller must hold cb.mu)
+func (cb *CircularBuffer) evict() {
+	for cb.nextSeq-cb.firstSeq > int64(cb.maxLines) {
+		cb.dropLine()
+	}
+	for cb.end-cb.start > int64(cb.maxBytes) {
+		if cb.nextSeq > cb.firstSeq {
+			// 按整行淘汰，避免保留被截断的行
+			cb.dropLine()
+			continue
+		}
+		// 只剩一个超长的未完成行，截掉其开头
+		cb.start = cb.end - int64(cb.maxBytes)
+		cb.lineStarts[0] = cb.start
+	}
+
+	for len(cb.chunks) > 0 {
+		c := &cb.chunks[0]
+		if c.offset+int64(len(c.data)) <= cb.start {
+			cb.chunks = cb.chunks[1:]
+			continue
+		}
+		if c.offset < cb.start {
+			c.data = c.data[cb.start-c.offset:]
+			c.offset = cb.start
+		}
+		break
+	}
+}
+
+// dropLine discards the oldest complete line (caller must hold cb.mu)
+func (cb *CircularBuffer) dropLine() {
+	cb.lineStarts = cb.lineStarts[1:]
+	cb.firstSeq++
+	cb.start = cb.lineStarts[0]
+}
+
+// chunkIndex returns the index of the chunk containing offset (caller must hold cb.mu)
+func (cb *CircularBuffer) chunkIndex(offset int64) int {
+	return sort.Search(len(cb.chunks), func(i int) bool {
+		return cb.chunks[i].offset+int64(len(cb.chunks[i].data)) > offset
+	})
+}
+
+// slice copies the retained bytes in [from, to) (caller must hold cb.mu)
+func (cb *CircularBuffer) slice(from, to int64) string {
+	if from < cb.start {
+		from = cb.start
+	}
+	if to <= from {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.Grow(int(to - from))
+	for i := cb.chunkIndex(from); i < len(cb.chunks) && cb.chunks[i].offset < to; i++ {
+		c := cb.chunks[i]
+		lo, hi := from-c.offset, to-c.offset
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > int64(len(c.data)) {
+			hi = int64(len(c.data))
+		}
+		sb.Write(c.data[lo:hi])
+	}
+	return sb.String()
+}
+
+// lineAt returns the raw line with the given sequence number and the time
+// its newline arrived (caller must hold cb.mu)
+func (cb *CircularBuffer) lineAt(seq int64) (string, time.Time) {
+	i := seq - cb.firstSeq
+	newline := cb.lineStarts[i+1] - 1
+	var at time.Time
+	if ci := cb.chunkIndex(newline); ci < len(cb.chunks) {
+		at = cb.chunks[ci].time
+	}
+	return cb.slice(cb.lineStarts[i], newline), at
+}
+
+// read collects lines [from, to) into a BufferRead (caller must hold cb.mu)
+func (cb *CircularBuffer) read(from, to int64) *BufferRead {
+	result := &BufferRead{
+		Lines:    make([]string, 0, to-from),
+		Times:    make([]time.Time, 0, to-from),
+		FirstSeq: from,
+		NextSeq:  to,
+	}
+	for seq := from; seq < to; seq++ {
+		line, at := cb.lineAt(seq)
+		result.Lines = append(result.Lines, line)
+		result.Times = append(result.Times, at)
+	}
+	result.Remaining = cb.nextSeq - to
+	if result.Remaining == 0 {
+		result.Partial = cb.slice(cb.lineStarts[len(cb.lineStarts)-1], cb.end)
+	}
+	return result
+}
+
+// ReadLatestLines reads the latest N complete lines from the buffer
+func (cb *CircularBuffer) ReadLatestLines(n int) []string {
+	return cb.ReadLatest(n).Lines
+}
+
+// ReadLatest reads the latest N complete lines together with their sequence
+// numbers and the unterminated last line
+func (cb *CircularBuffer) ReadLatest(n int) *BufferRead {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	count := cb.nextSeq - cb.firstSeq
+	if int64(n) > count {
+		n = int(count)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return cb.read(cb.nextSeq-int64(n), cb.nextSeq)
+}
+
+// ReadSince reads up to limit lines starting at sequence number since without
+// consuming them. limit <= 0 means no limit.
+func (cb *CircularBuffer) ReadSince(since int64, limit int) *BufferRead {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if since < 0 {
+		since = 0
+	}
+	if since > cb.nextSeq {
+		// 游标超过当前序号（例如来自其他 Shell），从当前位置开始
+		since = cb.nextSeq
+	}
+	var dropped int64
+	if since < cb.firstSeq {
+		dropped = cb.firstSeq - since
+		since = cb.firstSeq
+	}
+
+	end := cb.nextSeq
+	if limit > 0 && end-since > int64(limit) {
+		end = since + int64(limit)
+	}
+	result := cb.read(since, end)
+	result.Dropped = dropped
+	return result
+}
+
+// ReadAllUnread reads all complete lines not yet returned by ReadAllUnread.
+// Lines stay in the buffer, so cursor-based readers and ReadLatestLines still
+// see them.
+func (cb *CircularBuffer) ReadAllUnread() []string {
+	return cb.ReadUnread().Lines
+}
+
+// ReadUnread is ReadAllUnread with sequence numbers; NextSeq is taken under
+// the same lock, so a since_seq read from it continues exactly after the
+// returned lines
+func (cb *CircularBuffer) ReadUnread() *BufferRead {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	result := cb.read(cb.unreadStart(), cb.nextSeq)
+
+	// Mark as read by moving the cursor to the newest line
+	cb.readSeq = cb.nextSeq
+
+	return result
+}
+
+// ReadLatestBytes reads the latest N raw bytes, including the unterminated last line
+func (cb *CircularBuffer) ReadLatestBytes(n int) string {
+	data, _ := cb.ReadLatestBytesSeq(n)
+	return data
+}
+
+// ReadLatestBytesSeq is ReadLatestBytes together with the sequence number the
+// next complete line will get, read under the same lock
+func (cb *CircularBuffer) ReadLatestBytesSeq(n int) (string, int64) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.slice(cb.end-int64(n), cb.end), cb.nextSeq
+}
+
+// GetCount returns the number of lines not yet returned by ReadAllUnread
+func (cb *CircularBuffer) GetCount() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return int(cb.nextSeq - cb.unreadStart())
+}
+
+// unreadStart returns the first line not yet returned by ReadAllUnread (caller must hold cb.mu)
+func (cb *CircularBuffer) unreadStart() int64 {
+	if cb.readSeq < cb.firstSeq {
+		return cb.firstSeq
+	}
+	return cb.readSeq
+}
+
+// Len returns the number of complete lines currently retained
+func (cb *CircularBuffer) Len() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return int(cb.nextSeq - cb.firstSeq)
+}
+
+// ByteLen returns the number of raw bytes currently retained
+func (cb *CircularBuffer) ByteLen() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return int(cb.end - cb.start)
+}
+
+// NextSeq returns the sequence number the next complete line will get
+func (cb *CircularBuffer) NextSeq() int64 {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.nextSeq
+}
+
+// Dropped returns the number of lines evicted due to overflow
+func (cb *CircularBuffer) Dropped() int64 {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.firstSeq
+}
+
+// GetCapacity returns the line capacity
+func (cb *CircularBuffer) GetCapacity() int {
+	return cb.maxLines
+}
+
+// ByteCapacity returns the raw byte capacity
+func (cb *CircularBuffer) ByteCapacity() int {
+	return cb.maxBytes
+}
+
+// RenderOutput applies an ANSI mode to raw buffered output at read time.
+// cols is the terminal width, used to tell line wraps from carriage-return
+// redraws; 0 means unknown. ANSIParse returns the styled spans as JSON.
+func RenderOutput(raw string, mode ANSIMode, cols int) string {
+	switch mode {
+	case ANSIRaw:
+		return raw
+	case ANSIParse:
+		return StyledJSON(ParseStyledOutput(raw, cols))
+	}
+
+	lines := parseStyledText(raw, cols)
+	text := make([]string, len(lines))
+	for i, cells := range lines {
+		text[i] = cellsText(cells)
+	}
+	return strings.Join(text, "\n")
+}
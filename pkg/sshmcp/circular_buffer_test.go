@@ -1,7 +1,10 @@
 package sshmcp
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestCircularBuffer_BasicOperations tests basic write and read operations
@@ -10,7 +13,7 @@ func TestCircularBuffer_BasicOperations(t *testing.T) {
 
 	// Write 5 lines
 	for i := 1; i <= 5; i++ {
-		cb.Write("Line content")
+		cb.WriteLine("Line content")
 	}
 
 	if count := cb.GetCount(); count != 5 {
@@ -28,7 +31,7 @@ func TestCircularBuffer_Overflow(t *testing.T) {
 
 	// Write 10 lines (should overflow)
 	for i := 1; i <= 10; i++ {
-		cb.Write("Line content")
+		cb.WriteLine("Line content")
 	}
 
 	// Buffer should only keep 5 most recent lines
@@ -43,7 +46,7 @@ func TestCircularBuffer_ReadLatestLines(t *testing.T) {
 
 	// Write 5 lines
 	for i := 1; i <= 5; i++ {
-		cb.Write("Line content")
+		cb.WriteLine("Line content")
 	}
 
 	// Read latest 3 lines
@@ -71,7 +74,7 @@ func TestCircularBuffer_ReadLatestLines_OverflowRequest(t *testing.T) {
 
 	// Write only 3 lines
 	for i := 1; i <= 3; i++ {
-		cb.Write("Line content")
+		cb.WriteLine("Line content")
 	}
 
 	// Request 10 lines (should only return 3)
@@ -87,9 +90,9 @@ func TestCircularBuffer_ReadLatestBytes(t *testing.T) {
 	cb := NewCircularBuffer(10)
 
 	// Write lines with known length
-	cb.Write("12345") // 5 bytes
-	cb.Write("67890") // 5 bytes
-	cb.Write("abcde") // 5 bytes
+	cb.WriteLine("12345") // 5 bytes
+	cb.WriteLine("67890") // 5 bytes
+	cb.WriteLine("abcde") // 5 bytes
 
 	// Read latest 10 bytes
 	result := cb.ReadLatestBytes(10)
@@ -106,7 +109,7 @@ func TestCircularBuffer_ReadAllUnread(t *testing.T) {
 
 	// Write 5 lines
 	for i := 1; i <= 5; i++ {
-		cb.Write("Line content")
+		cb.WriteLine("Line content")
 	}
 
 	// Read all unread
@@ -122,31 +125,103 @@ func TestCircularBuffer_ReadAllUnread(t *testing.T) {
 	}
 }
 
-// TestCircularBuffer_HeartbeatFiltering tests that heartbeat data is filtered out
-func TestCircularBuffer_HeartbeatFiltering(t *testing.T) {
+// TestHeartbeatFilter tests that only echoes of sent heartbeats are filtered out
+func TestHeartbeatFilter(t *testing.T) {
+	var hf heartbeatFilter
+
+	// 未发送心跳时，程序输出的 ESC[s / ESC[u 原样保留
+	data := []byte("a\x1b[s\x1b[ub\n")
+	if got := string(hf.filter(data)); got != "a\x1b[s\x1b[ub\n" {
+		t.Errorf("Expected output to be kept, got %q", got)
+	}
+
+	hf.sent()
+	hf.sent()
+	data = []byte("x^[[s^[[uy\x1b[s\x1b[uz\x1b[s\x1b[u")
+	if got := string(hf.filter(data)); got != "xyz\x1b[s\x1b[u" {
+		t.Errorf("Expected one echo per heartbeat removed, got %q", got)
+	}
+	if string(data[:2]) != "x^" {
+		t.Errorf("Expected input slice to be left untouched, got %q", data)
+	}
+
+	// 超过窗口未回显的心跳不再过滤
+	hf.pending = append(hf.pending, time.Now().Add(-2*heartbeatEchoWindow))
+	if got := string(hf.filter([]byte("\x1b[s\x1b[u"))); got != "\x1b[s\x1b[u" {
+		t.Errorf("Expected expired heartbeat to be ignored, got %q", got)
+	}
+}
+
+// TestCircularBuffer_RawChunks tests that raw output is kept and split into lines
+func TestCircularBuffer_RawChunks(t *testing.T) {
 	cb := NewCircularBuffer(10)
+	cb.Write([]byte("\x1b[31mred\x1b[0m\r\n\r\n50%\r100"))
+	cb.Write([]byte("%\r\nPassword: "))
 
-	// Write normal data
-	cb.Write("Normal line 1")
-	cb.Write("Normal line 2")
+	read := cb.ReadLatest(10)
+	want := []string{"\x1b[31mred\x1b[0m\r", "\r", "50%\r100%\r"}
+	if fmt.Sprint(read.Lines) != fmt.Sprint(want) {
+		t.Errorf("Expected raw lines %q, got %q", want, read.Lines)
+	}
+	if read.Partial != "Password: " {
+		t.Errorf("Expected partial line, got %q", read.Partial)
+	}
+	if len(read.Times) != 3 || read.Times[2].IsZero() {
+		t.Errorf("Expected line timestamps, got %v", read.Times)
+	}
 
-	// Write heartbeat data (should be filtered)
-	cb.Write("\x1b[s\x1b[u") // ANSI save/restore cursor
-	cb.Write("\x00")         // NULL character
-	cb.Write("\x1b[s")       // ANSI save cursor
-	cb.Write("\x1b[u")       // ANSI restore cursor
+	if got := RenderOutput(strings.Join(read.Lines, "\n"), ANSIStrip, 80); got != "red\n\n100%" {
+		t.Errorf("Unexpected stripped output %q", got)
+	}
+	if got := RenderOutput(read.Lines[0], ANSIRaw, 80); got != read.Lines[0] {
+		t.Errorf("Expected raw output unchanged, got %q", got)
+	}
+	if got := cb.ReadLatestBytes(12); got != "\r\nPassword: " {
+		t.Errorf("Unexpected latest bytes %q", got)
+	}
+}
 
-	// Write more normal data
-	cb.Write("Normal line 3")
+// TestRenderOutput_CarriageReturn tests carriage-return handling when rendering plain text
+func TestRenderOutput_CarriageReturn(t *testing.T) {
+	tests := []struct {
+		line string
+		cols int
+		want string
+	}{
+		{"50%\r100%\r", 80, "100%"},
+		{"downloading\rdone", 80, "doneloading"},
+		{"\x1b[?2004l\rok", 80, "ok"},
+		// readline 折行后 \r 回到第二行行首，不应覆盖第一行
+		{"$ " + strings.Repeat("x", 9) + "\rxyz", 10, "$ xxxxxxxxxyz"},
+		{"$ " + strings.Repeat("x", 8) + " \ryz", 10, "$ xxxxxxxxyz"},
+		{"$ " + strings.Repeat("x", 8) + "\ryz", 0, "yzxxxxxxxx"},
+	}
+	for _, tt := range tests {
+		if got := RenderOutput(tt.line, ANSIStrip, tt.cols); got != tt.want {
+			t.Errorf("RenderOutput(%q, %d) = %q, want %q", tt.line, tt.cols, got, tt.want)
+		}
+	}
+}
+
+// TestCircularBuffer_ByteCapacity tests eviction by byte capacity
+func TestCircularBuffer_ByteCapacity(t *testing.T) {
+	cb := NewCircularBufferWithLimits(100, 9)
+	cb.Write([]byte("aaaa\nbbbb\ncc"))
+	cb.Write([]byte("cc\n"))
 
-	// Should only have 3 lines (heartbeats filtered)
-	if count := cb.GetCount(); count != 3 {
-		t.Errorf("Expected 3 lines after filtering heartbeats, got %d", count)
+	read := cb.ReadSince(0, 0)
+	if read.Dropped != 2 || len(read.Lines) != 1 || read.Lines[0] != "cccc" {
+		t.Errorf("Unexpected read after byte eviction: %+v", read)
+	}
+	if n := cb.ByteLen(); n != 5 {
+		t.Errorf("Expected 5 retained bytes, got %d", n)
 	}
 
-	lines := cb.ReadAllUnread()
-	if len(lines) != 3 {
-		t.Errorf("Expected 3 lines, got %d", len(lines))
+	// 超长的未完成行只保留末尾
+	cb.Write([]byte("0123456789abcdef"))
+	read = cb.ReadLatest(10)
+	if len(read.Lines) != 0 || read.Partial != "789abcdef" {
+		t.Errorf("Unexpected read of long partial line: %+v", read)
 	}
 }
 
@@ -159,7 +234,7 @@ func TestCircularBuffer_ConcurrentAccess(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func(id int) {
 			for j := 0; j < 100; j++ {
-				cb.Write("Line content")
+				cb.WriteLine("Line content")
 			}
 			done <- true
 		}(i)
@@ -196,7 +271,7 @@ func TestCircularBuffer_LineIntegrity(t *testing.T) {
 
 	// Write lines with unique content
 	for i := 0; i < 50; i++ {
-		cb.Write("Line content")
+		cb.WriteLine("Line content")
 	}
 
 	lines := cb.ReadLatestLines(50)
@@ -212,3 +287,104 @@ func TestCircularBuffer_LineIntegrity(t *testing.T) {
 		}
 	}
 }
+
+// TestCircularBuffer_ReadSince tests cursor reads with sequence numbers
+func TestCircularBuffer_ReadSince(t *testing.T) {
+	cb := NewCircularBuffer(5)
+
+	for i := 0; i < 3; i++ {
+		cb.WriteLine(fmt.Sprintf("line %d", i))
+	}
+
+	read := cb.ReadSince(0, 0)
+	if len(read.Lines) != 3 || read.FirstSeq != 0 || read.NextSeq != 3 || read.Dropped != 0 {
+		t.Fatalf("Unexpected first read: %+v", read)
+	}
+
+	// 另一个读取方仍能读到同样的内容
+	if again := cb.ReadSince(0, 0); len(again.Lines) != 3 {
+		t.Errorf("Expected cursor reads to be non-destructive, got %d lines", len(again.Lines))
+	}
+
+	// ReadAllUnread 不影响游标读取
+	cb.ReadAllUnread()
+	if again := cb.ReadSince(1, 0); len(again.Lines) != 2 || again.Lines[0] != "line 1" {
+		t.Errorf("Unexpected read after ReadAllUnread: %+v", again)
+	}
+
+	// 写入 4 行后 line 0-1 被覆盖
+	for i := 3; i < 7; i++ {
+		cb.WriteLine(fmt.Sprintf("line %d", i))
+	}
+	read = cb.ReadSince(read.NextSeq, 0)
+	if len(read.Lines) != 4 || read.Lines[0] != "line 3" || read.NextSeq != 7 || read.Dropped != 0 {
+		t.Errorf("Unexpected incremental read: %+v", read)
+	}
+
+	read = cb.ReadSince(0, 2)
+	if read.Dropped != 2 || read.FirstSeq != 2 || read.NextSeq != 4 || read.Remaining != 3 {
+		t.Errorf("Unexpected read with overflow and limit: %+v", read)
+	}
+	if read.Lines[0] != "line 2" || read.Lines[1] != "line 3" {
+		t.Errorf("Unexpected lines: %v", read.Lines)
+	}
+
+	// 超过当前序号的游标从当前位置开始
+	if read = cb.ReadSince(100, 0); len(read.Lines) != 0 || read.NextSeq != 7 {
+		t.Errorf("Unexpected read past end: %+v", read)
+	}
+
+	if dropped := cb.Dropped(); dropped != 2 {
+		t.Errorf("Expected 2 dropped lines, got %d", dropped)
+	}
+}
+
+// TestCircularBuffer_ReadLatest tests that latest reads report sequence numbers
+func TestCircularBuffer_ReadLatest(t *testing.T) {
+	cb := NewCircularBuffer(3)
+	for i := 0; i < 5; i++ {
+		cb.WriteLine(fmt.Sprintf("line %d", i))
+	}
+
+	read := cb.ReadLatest(2)
+	if len(read.Lines) != 2 || read.FirstSeq != 3 || read.NextSeq != 5 || read.Lines[1] != "line 4" {
+		t.Errorf("Unexpected latest read: %+v", read)
+	}
+
+	// ReadAllUnread 后仍可读取最新行
+	cb.ReadAllUnread()
+	if lines := cb.ReadLatestLines(10); len(lines) != 3 {
+		t.Errorf("Expected 3 retained lines, got %d", len(lines))
+	}
+	if count := cb.GetCount(); count != 0 {
+		t.Errorf("Expected no unread lines, got %d", count)
+	}
+}
+
+// TestCircularBuffer_ReadUnreadSeq tests that unread and byte reads return the
+// cursor matching the returned content
+func TestCircularBuffer_ReadUnreadSeq(t *testing.T) {
+	cb := NewCircularBuffer(10)
+	cb.WriteLine("line 0")
+	cb.WriteLine("line 1")
+
+	read := cb.ReadUnread()
+	if len(read.Lines) != 2 || read.FirstSeq != 0 || read.NextSeq != 2 {
+		t.Fatalf("Unexpected unread read: %+v", read)
+	}
+
+	// 之后写入的行通过返回的游标读取，不会漏掉
+	cb.WriteLine("line 2")
+	if next := cb.ReadSince(read.NextSeq, 0); len(next.Lines) != 1 || next.Lines[0] != "line 2" {
+		t.Errorf("Unexpected read after unread cursor: %+v", next)
+	}
+	if read = cb.ReadUnread(); len(read.Lines) != 1 || read.FirstSeq != 2 || read.NextSeq != 3 {
+		t.Errorf("Unexpected second unread read: %+v", read)
+	}
+
+	cb.Write([]byte("line 3\nprompt$ "))
+	data, next := cb.ReadLatestBytesSeq(8)
+	if data != "prompt$ " || next != 4 {
+		t.Errorf("Unexpected byte read: %q next=%d", data, next)
+	}
+}
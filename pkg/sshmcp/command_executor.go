@@ -54,6 +54,17 @@ func (s *Session) addToHistory(command string, exitCode int, executionTime time.
 	}
 }
 
+// addShellHistory records a command finished in an interactive shell (caller must hold s.mu)
+func (s *Session) addShellHistory(shellID string, cmd ShellCommand) {
+	if cmd.Command == "" {
+		return
+	}
+	s.addToHistory(cmd.Command, cmd.ExitCode, cmd.Duration, "shell")
+	entry := &s.CommandHistory[len(s.CommandHistory)-1]
+	entry.ShellID = shellID
+	entry.Timestamp = cmd.FinishedAt
+}
+
 // recordCommandResult records command execution result to history
 func (s *Session) recordCommandResult(command string, result *CommandResult) {
 	executionTime, _ := time.ParseDuration(result.ExecutionTime)
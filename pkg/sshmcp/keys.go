@@ -0,0 +1,275 @@
+package sshmcp
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keyModifiers is a set of xterm key modifiers
+type keyModifiers struct {
+	shift, alt, ctrl bool
+}
+
+// param returns the xterm modifier parameter (1 + shift + 2*alt + 4*ctrl)
+func (m keyModifiers) param() int {
+	p := 1
+	if m.shift {
+		p++
+	}
+	if m.alt {
+		p += 2
+	}
+	if m.ctrl {
+		p += 4
+	}
+	return p
+}
+
+// modifierNames maps modifier prefixes to the modifier they set
+var modifierNames = map[string]func(*keyModifiers){
+	"ctrl":    func(m *keyModifiers) { m.ctrl = true },
+	"control": func(m *keyModifiers) { m.ctrl = true },
+	"c":       func(m *keyModifiers) { m.ctrl = true },
+	"alt":     func(m *keyModifiers) { m.alt = true },
+	"meta":    func(m *keyModifiers) { m.alt = true },
+	"m":       func(m *keyModifiers) { m.alt = true },
+	"shift":   func(m *keyModifiers) { m.shift = true },
+	"s":       func(m *keyModifiers) { m.shift = true },
+}
+
+// cursorKeys are keys that switch between CSI and SS3 in application cursor mode
+var cursorKeys = map[string]byte{
+	"up": 'A', "down": 'B', "right": 'C', "left": 'D', "home": 'H', "end": 'F',
+}
+
+// tildeKeys are keys encoded as CSI <n> ~
+var tildeKeys = map[string]int{
+	"insert": 2, "delete": 3, "pageup": 5, "pagedown": 6,
+	"f5": 15, "f6": 17, "f7": 18, "f8": 19, "f9": 20, "f10": 21, "f11": 23, "f12": 24,
+}
+
+// ss3FunctionKeys are F1-F4, encoded as SS3 P..S
+var ss3FunctionKeys = map[string]byte{"f1": 'P', "f2": 'Q', "f3": 'R', "f4": 'S'}
+
+// keyAliases maps alternative key names to their canonical names
+var keyAliases = map[string]string{
+	"return": "enter", "cr": "enter", "escape": "esc", "bs": "backspace",
+	"del": "delete", "ins": "insert", "pgup": "pageup", "page_up": "pageup",
+	"pgdn": "pagedown", "pgdown": "pagedown", "page_down": "pagedown",
+	"spc": "space", "lt": "<", "gt": ">",
+	// 兼容旧的 special_char 名称
+	"sigint": "ctrl+c", "eof": "ctrl+d", "sigtstp": "ctrl+z", "clear": "ctrl+l",
+}
+
+// ctrlSymbols maps symbols to their control codes
+var ctrlSymbols = map[rune]byte{
+	'@': 0x00, ' ': 0x00, '2': 0x00, '[': 0x1b, '3': 0x1b, '\\': 0x1c, '4': 0x1c,
+	']': 0x1d, '5': 0x1d, '^': 0x1e, '6': 0x1e, '_': 0x1f, '7': 0x1f, '/': 0x1f,
+	'?': 0x7f, '8': 0x7f,
+}
+
+// EncodeKey returns the bytes a terminal sends for one key, e.g. "enter",
+// "ctrl+x", "alt+f", "shift+tab", "ctrl+up", "f5", "C-a" or a single
+// character. appCursor selects application cursor mode (DECCKM) encodings.
+func EncodeKey(name string, appCursor bool) ([]byte, error) {
+	key := strings.TrimSpace(name)
+	if key == "" {
+		return nil, fmt.Errorf("empty key name")
+	}
+	if alias, ok := keyAliases[strings.ToLower(key)]; ok {
+		key = alias
+	}
+
+	// 解析修饰键前缀，如 ctrl+ / alt- / C-
+	var mods keyModifiers
+	for {
+		i := strings.IndexAny(key, "+-")
+		if i <= 0 || i == len(key)-1 {
+			break
+		}
+		set, ok := modifierNames[strings.ToLower(key[:i])]
+		if !ok {
+			break
+		}
+		set(&mods)
+		key = key[i+1:]
+	}
+
+	// 单个字符按字面发送
+	if r, size := utf8.DecodeRuneInString(key); size == len(key) {
+		return encodeCharKey(r, mods, name)
+	}
+
+	key = strings.ToLower(key)
+	if alias, ok := keyAliases[key]; ok {
+		key = alias
+		if r, size := utf8.DecodeRuneInString(key); size == len(key) {
+			return encodeCharKey(r, mods, name)
+		}
+	}
+	return encodeNamedKey(key, mods, appCursor, name)
+}
+
+// encodeCharKey encodes a printable character with modifiers
+func encodeCharKey(r rune, mods keyModifiers, name string) ([]byte, error) {
+	var out []byte
+	switch {
+	case mods.ctrl:
+		lower := unicode.ToLower(r)
+		if lower >= 'a' && lower <= 'z' {
+			out = []byte{byte(lower) & 0x1f}
+		} else if code, ok := ctrlSymbols[r]; ok {
+			out = []byte{code}
+		} else {
+			return nil, fmt.Errorf("unsupported key %q: no control code for %q", name, r)
+		}
+	case mods.shift:
+		out = []byte(string(unicode.ToUpper(r)))
+	default:
+		out = []byte(string(r))
+	}
+	if mods.alt {
+		// Alt 以 ESC 前缀发送（meta sends escape）
+		out = append([]byte{0x1b}, out...)
+	}
+	return out, nil
+}
+
+// encodeNamedKey encodes a named key such as "enter", "up" or "f5"
+func encodeNamedKey(key string, mods keyModifiers, appCursor bool, name string) ([]byte, error) {
+	modified := mods.shift || mods.alt || mods.ctrl
+
+	if final, ok := cursorKeys[key]; ok {
+		switch {
+		case modified:
+			return []byte(fmt.Sprintf("\x1b[1;%d%c", mods.param(), final)), nil
+		case appCursor:
+			return []byte{0x1b, 'O', final}, nil
+		default:
+			return []byte{0x1b, '[', final}, nil
+		}
+	}
+	if n, ok := tildeKeys[key]; ok {
+		if modified {
+			return []byte(fmt.Sprintf("\x1b[%d;%d~", n, mods.param())), nil
+		}
+		return []byte(fmt.Sprintf("\x1b[%d~", n)), nil
+	}
+	if final, ok := ss3FunctionKeys[key]; ok {
+		if modified {
+			return []byte(fmt.Sprintf("\x1b[1;%d%c", mods.param(), final)), nil
+		}
+		return []byte{0x1b, 'O', final}, nil
+	}
+
+	var out []byte
+	switch key {
+	case "enter":
+		out = []byte{'\r'}
+	case "tab":
+		if mods.shift {
+			return []byte("\x1b[Z"), nil
+		}
+		out = []byte{'\t'}
+	case "esc":
+		out = []byte{0x1b}
+	case "space":
+		if mods.ctrl {
+			out = []byte{0x00}
+		} else {
+			out = []byte{' '}
+		}
+	case "backspace":
+		if mods.ctrl {
+			out = []byte{0x08}
+		} else {
+			out = []byte{0x7f}
+		}
+	default:
+		return nil, fmt.Errorf("unknown key %q", name)
+	}
+	if mods.alt {
+		out = append([]byte{0x1b}, out...)
+	}
+	return out, nil
+}
+
+// ParseKeySequence encodes whitespace-separated keys, e.g. "ctrl+x ctrl+s"
+// or "esc : w q enter". Each key may also be written as <key>.
+func ParseKeySequence(seq string, appCursor bool) ([]byte, error) {
+	fields := strings.Fields(seq)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+
+	var out []byte
+	for _, field := range fields {
+		if len(field) > 2 && strings.HasPrefix(field, "<") && strings.HasSuffix(field, ">") {
+			field = field[1 : len(field)-1]
+		}
+		data, err := EncodeKey(field, appCursor)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// ParseKeyInput encodes literal text mixed with <key> tokens, e.g.
+// "<esc>:wq<enter>" or "git commit<enter>". Use <lt> for a literal "<".
+// A "<" that does not start a key token (e.g. "a < b" or "<b>") is sent as is.
+func ParseKeyInput(text string, appCursor bool) ([]byte, error) {
+	var out []byte
+	for len(text) > 0 {
+		start := strings.IndexByte(text, '<')
+		if start < 0 {
+			out = append(out, text...)
+			break
+		}
+		out = append(out, text[:start]...)
+		text = text[start:]
+
+		end := strings.IndexByte(text, '>')
+		token := ""
+		if end > 1 {
+			token = text[1:end]
+		}
+		if !isKeyToken(token) {
+			out = append(out, '<')
+			text = text[1:]
+			continue
+		}
+
+		data, err := EncodeKey(token, appCursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w (use <lt> for a literal '<')", err)
+		}
+		out = append(out, data...)
+		text = text[end+1:]
+	}
+	return out, nil
+}
+
+// isKeyToken reports whether the text between < and > is a key name or a
+// modifier combination; single characters such as <b> are not key tokens
+func isKeyToken(token string) bool {
+	if utf8.RuneCountInString(token) < 2 || len(token) > 24 {
+		return false
+	}
+	// 带修饰键前缀的组合键，如 C-x、ctrl+[
+	if i := strings.IndexAny(token, "+-"); i > 0 && i < len(token)-1 {
+		if _, ok := modifierNames[strings.ToLower(token[:i])]; ok {
+			return true
+		}
+	}
+	// 其余只接受按键名形式的单词，如 enter、f5、page_up
+	for _, r := range token {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package sshmcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncodeKey tests key names, aliases and modifiers
+func TestEncodeKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		// 兼容旧的 special_char 名称
+		{"ctrl+c", "\x03"},
+		{"sigint", "\x03"},
+		{"eof", "\x04"},
+		{"sigtstp", "\x1a"},
+		{"clear", "\x0c"},
+		{"enter", "\r"},
+		{"return", "\r"},
+		{"tab", "\t"},
+		{"esc", "\x1b"},
+		{"up", "\x1b[A"},
+		{"left", "\x1b[D"},
+
+		// 字符与 ctrl/alt/shift
+		{"a", "a"},
+		{"A", "A"},
+		{"ctrl+x", "\x18"},
+		{"CTRL+X", "\x18"},
+		{"ctrl-a", "\x01"},
+		{"C-a", "\x01"},
+		{"ctrl+]", "\x1d"},
+		{"ctrl+@", "\x00"},
+		{"ctrl+?", "\x7f"},
+		{"alt+f", "\x1bf"},
+		{"M-x", "\x1bx"},
+		{"shift+a", "A"},
+		{"alt+shift+f", "\x1bF"},
+		{"ctrl+alt+d", "\x1b\x04"},
+		{"ctrl+-", "unsupported"},
+		{"lt", "<"},
+		{"ctrl+space", "\x00"},
+
+		// 命名按键
+		{"backspace", "\x7f"},
+		{"ctrl+backspace", "\x08"},
+		{"alt+backspace", "\x1b\x7f"},
+		{"alt+enter", "\x1b\r"},
+		{"alt+return", "\x1b\r"},
+		{"shift+tab", "\x1b[Z"},
+		{"S-Tab", "\x1b[Z"},
+		{"home", "\x1b[H"},
+		{"end", "\x1b[F"},
+		{"pgup", "\x1b[5~"},
+		{"PageDown", "\x1b[6~"},
+		{"insert", "\x1b[2~"},
+		{"del", "\x1b[3~"},
+		{"F1", "\x1bOP"},
+		{"f4", "\x1bOS"},
+		{"f5", "\x1b[15~"},
+		{"f12", "\x1b[24~"},
+		{"ctrl+up", "\x1b[1;5A"},
+		{"shift+right", "\x1b[1;2C"},
+		{"ctrl+shift+left", "\x1b[1;6D"},
+		{"alt+f1", "\x1b[1;3P"},
+		{"ctrl+delete", "\x1b[3;5~"},
+		{"shift+f5", "\x1b[15;2~"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := EncodeKey(tt.key, false)
+			if tt.want == "unsupported" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	for _, key := range []string{"", "foo", "f13", "ctrl+é", "hyper+a"} {
+		_, err := EncodeKey(key, false)
+		assert.Error(t, err, key)
+	}
+}
+
+// TestEncodeKey_ApplicationCursor tests DECCKM cursor key encodings
+func TestEncodeKey_ApplicationCursor(t *testing.T) {
+	for key, want := range map[string]string{
+		"up": "\x1bOA", "down": "\x1bOB", "right": "\x1bOC", "left": "\x1bOD",
+		"home": "\x1bOH", "end": "\x1bOF",
+		// 带修饰键和非方向键不受影响
+		"ctrl+up": "\x1b[1;5A", "pgup": "\x1b[5~", "f1": "\x1bOP",
+	} {
+		got, err := EncodeKey(key, true)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got), key)
+	}
+}
+
+// TestParseKeySequence tests whitespace-separated key sequences
+func TestParseKeySequence(t *testing.T) {
+	got, err := ParseKeySequence("ctrl+x ctrl+s", false)
+	require.NoError(t, err)
+	assert.Equal(t, "\x18\x13", string(got))
+
+	got, err = ParseKeySequence("<esc> : w q <enter>", false)
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b:wq\r", string(got))
+
+	got, err = ParseKeySequence("down down enter", true)
+	require.NoError(t, err)
+	assert.Equal(t, "\x1bOB\x1bOB\r", string(got))
+
+	_, err = ParseKeySequence("ctrl+x save", false)
+	assert.Error(t, err)
+	_, err = ParseKeySequence("  ", false)
+	assert.Error(t, err)
+}
+
+// TestParseKeyInput tests literal text mixed with <key> tokens
+func TestParseKeyInput(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"<esc>:wq<enter>", "\x1b:wq\r"},
+		{"ls -la<enter>", "ls -la\r"},
+		{"<ctrl+a>d", "\x01d"},
+		{"<C-x><C-s>", "\x18\x13"},
+		{"echo <lt>tag<gt><enter>", "echo <tag>\r"},
+		{"if [ $a < $b ]; then", "if [ $a < $b ]; then"},
+		{"cat <<EOF", "cat <<EOF"},
+		{"a <> b", "a <> b"},
+		{"plain", "plain"},
+		{"<up>", "\x1bOA"},
+		{"<x>", "<x>"},
+		{"echo '<b>bold</b>'", "echo '<b>bold</b>'"},
+		{"<!-- note -->", "<!-- note -->"},
+		{"<C-[>", "\x1b"},
+		{"<page_up>", "\x1b[5~"},
+	}
+	for _, tt := range tests {
+		got, err := ParseKeyInput(tt.input, tt.input == "<up>")
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, string(got), tt.input)
+	}
+
+	_, err := ParseKeyInput("<entr>", false)
+	assert.ErrorContains(t, err, "<lt>")
+}
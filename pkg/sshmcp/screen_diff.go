@@ -0,0 +1,269 @@
+package sshmcp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxScreenVersions is the number of recent screen versions kept per shell,
+// i.e. how far back since_seq can reach
+const maxScreenVersions = 32
+
+// DefaultScreenReader is the reader name used when none is given
+const DefaultScreenReader = "default"
+
+// RowChange is one screen row that differs between two snapshots
+type RowChange struct {
+	Row   int    `json:"row"`   // 行号（0 起始）
+	Cells int    `json:"cells"` // 变化的单元格数
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ScreenDiff describes how the screen changed since a reader's previous
+// snapshot (or since a given screen version)
+type ScreenDiff struct {
+	Seq       uint64      // 当前屏幕版本
+	BaseSeq   uint64      // 比较基准版本，0 表示没有可用基准
+	Unchanged bool        // 屏幕自 BaseSeq 以来未变化
+	Full      bool        // 基准不可用，Lines 为完整屏幕
+	OldLines  []string    // 基准屏幕各行（去掉行尾空格）
+	Lines     []string    // 当前屏幕各行（去掉行尾空格）
+	Changes   []RowChange // 变化的行
+}
+
+// ChangedCells returns the total number of changed cells
+func (d *ScreenDiff) ChangedCells() int {
+	total := 0
+	for _, c := range d.Changes {
+		total += c.Cells
+	}
+	return total
+}
+
+// Unified returns the change as a unified diff of the two screens
+func (d *ScreenDiff) Unified() string {
+	if d.Full || d.Unchanged {
+		return ""
+	}
+	return unifiedDiff(
+		fmt.Sprintf("screen@%d", d.BaseSeq), fmt.Sprintf("screen@%d", d.Seq),
+		strings.Join(d.OldLines, "\n")+"\n", strings.Join(d.Lines, "\n")+"\n", 1)
+}
+
+// screenVersion is one distinct screen content
+type screenVersion struct {
+	seq   uint64
+	lines []string
+}
+
+// screenVersions numbers distinct screen contents and remembers which
+// version each reader saw last
+type screenVersions struct {
+	mu       sync.Mutex
+	seq      uint64
+	versions []screenVersion // 最近的屏幕版本（从旧到新）
+	readers  map[string]uint64
+}
+
+// newScreenVersions creates an empty version history
+func newScreenVersions() *screenVersions {
+	return &screenVersions{readers: make(map[string]uint64)}
+}
+
+// observe records the current screen, returning its version; the version
+// only changes when the content does
+func (sv *screenVersions) observe(lines []string) uint64 {
+	if n := len(sv.versions); n > 0 && equalLines(sv.versions[n-1].lines, lines) {
+		return sv.seq
+	}
+	sv.seq++
+	sv.versions = append(sv.versions, screenVersion{seq: sv.seq, lines: lines})
+	if len(sv.versions) > maxScreenVersions {
+		sv.versions = sv.versions[len(sv.versions)-maxScreenVersions:]
+	}
+	return sv.seq
+}
+
+// find returns the lines of version seq, if still kept
+func (sv *screenVersions) find(seq uint64) ([]string, bool) {
+	for _, v := range sv.versions {
+		if v.seq == seq {
+			return v.lines, true
+		}
+	}
+	return nil, false
+}
+
+// Record stores the screen as the reader's latest snapshot and returns its version
+func (sv *screenVersions) Record(reader string, lines []string) uint64 {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	seq := sv.observe(lines)
+	sv.readers[reader] = seq
+	return seq
+}
+
+// Diff compares the screen with sinceSeq, or with the reader's previous
+// snapshot when sinceSeq is 0, and stores the screen for the reader
+func (sv *screenVersions) Diff(reader string, sinceSeq uint64, lines []string) ScreenDiff {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	base := sinceSeq
+	if base == 0 {
+		base = sv.readers[reader]
+	}
+	seq := sv.observe(lines)
+	sv.readers[reader] = seq
+
+	diff := ScreenDiff{Seq: seq, Lines: lines}
+	oldLines, ok := sv.find(base)
+	if base == 0 || !ok {
+		diff.Full = true
+		return diff
+	}
+
+	diff.BaseSeq = base
+	diff.OldLines = oldLines
+	if base == seq {
+		diff.Unchanged = true
+		return diff
+	}
+	diff.Changes = diffRows(oldLines, lines)
+	return diff
+}
+
+// diffRows compares two screens row by row
+func diffRows(oldLines, newLines []string) []RowChange {
+	rows := len(oldLines)
+	if len(newLines) > rows {
+		rows = len(newLines)
+	}
+
+	var changes []RowChange
+	for y := 0; y < rows; y++ {
+		var oldLine, newLine string
+		if y < len(oldLines) {
+			oldLine = oldLines[y]
+		}
+		if y < len(newLines) {
+			newLine = newLines[y]
+		}
+		if oldLine == newLine {
+			continue
+		}
+		changes = append(changes, RowChange{Row: y, Cells: changedCells(oldLine, newLine), Old: oldLine, New: newLine})
+	}
+	return changes
+}
+
+// changedCells counts the columns whose character differs
+func changedCells(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	n := len(ra)
+	if len(rb) > n {
+		n = len(rb)
+	}
+
+	count := 0
+	for x := 0; x < n; x++ {
+		ca, cb := ' ', ' '
+		if x < len(ra) {
+			ca = ra[x]
+		}
+		if x < len(rb) {
+			cb = rb[x]
+		}
+		if ca != cb {
+			count++
+		}
+	}
+	return count
+}
+
+// equalLines compares two screens
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// screenLines splits a plain snapshot into rows without trailing spaces
+func screenLines(snapshot string) []string {
+	lines := strings.Split(snapshot, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return lines
+}
+
+// ScreenCapture is a copy of the screen taken under one lock; every snapshot
+// format rendered from it, and the diff base recorded from it, show the same
+// screen
+type ScreenCapture struct {
+	content          [][]rune
+	format           [][]Format
+	Width, Height    int
+	CursorX, CursorY int
+	scrolled         uint64 // 截取时累计滚出屏幕顶部的行数
+}
+
+// Plain renders the capture as plain text
+func (c ScreenCapture) Plain() string {
+	return renderPlainScreen(c.content)
+}
+
+// Color renders the capture as text with ANSI colour codes
+func (c ScreenCapture) Color() string {
+	return renderColorScreen(c.content, c.format)
+}
+
+// Spans returns the capture as lines of styled spans
+func (c ScreenCapture) Spans() [][]StyledSpan {
+	return ScreenSpans(c.content, c.format)
+}
+
+// Picture returns the capture for rendering as PNG or HTML
+func (c ScreenCapture) Picture() ScreenPicture {
+	return ScreenPicture{
+		Lines:   c.Spans(),
+		Width:   c.Width,
+		Height:  c.Height,
+		CursorX: c.CursorX,
+		CursorY: c.CursorY,
+		Cursor:  true,
+	}
+}
+
+// CaptureTerminal copies the current screen for rendering and recording
+func (ss *SSHShellSession) CaptureTerminal() ScreenCapture {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return ScreenCapture{}
+	}
+
+	return ss.TerminalCapturer.Capture()
+}
+
+// RecordTerminalSnapshot stores the captured screen as the reader's latest
+// snapshot and returns its version number
+func (ss *SSHShellSession) RecordTerminalSnapshot(reader string, capture ScreenCapture) uint64 {
+	return ss.screens.Record(reader, screenLines(capture.Plain()))
+}
+
+// DiffTerminalSnapshot compares the current screen with version sinceSeq, or
+// with the reader's previous snapshot when sinceSeq is 0
+func (ss *SSHShellSession) DiffTerminalSnapshot(reader string, sinceSeq uint64) ScreenDiff {
+	return ss.screens.Diff(reader, sinceSeq, screenLines(ss.GetTerminalSnapshot()))
+}
@@ -0,0 +1,106 @@
+package sshmcp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScreenVersions_Diff tests per-reader diffs, the unchanged fast path and cell counts
+func TestScreenVersions_Diff(t *testing.T) {
+	sv := newScreenVersions()
+	screen1 := []string{"top - 10:00:01", "Tasks: 90", "  PID USER   %CPU"}
+	screen2 := []string{"top - 10:00:04", "Tasks: 90", "  PID USER   %CPU", "  123 root    9.0"}
+
+	// 首次调用没有基准，返回完整屏幕
+	diff := sv.Diff("a", 0, screen1)
+	assert.True(t, diff.Full)
+	assert.Equal(t, uint64(1), diff.Seq)
+	assert.Equal(t, screen1, diff.Lines)
+
+	// 屏幕未变化
+	diff = sv.Diff("a", 0, screen1)
+	assert.True(t, diff.Unchanged)
+	assert.Equal(t, uint64(1), diff.Seq)
+	assert.Equal(t, uint64(1), diff.BaseSeq)
+
+	diff = sv.Diff("a", 0, screen2)
+	require.False(t, diff.Full)
+	assert.Equal(t, uint64(2), diff.Seq)
+	assert.Equal(t, uint64(1), diff.BaseSeq)
+	assert.Equal(t, []RowChange{
+		{Row: 0, Cells: 1, Old: "top - 10:00:01", New: "top - 10:00:04"},
+		{Row: 3, Cells: 10, Old: "", New: "  123 root    9.0"},
+	}, diff.Changes)
+	assert.Equal(t, 11, diff.ChangedCells())
+
+	unified := diff.Unified()
+	assert.Contains(t, unified, "--- screen@1\n+++ screen@2\n")
+	assert.Contains(t, unified, "-top - 10:00:01\n+top - 10:00:04\n")
+	assert.Contains(t, unified, "+  123 root    9.0\n")
+
+	// 另一个读取方有自己的基准
+	diff = sv.Diff("b", 0, screen2)
+	assert.True(t, diff.Full)
+	assert.Equal(t, uint64(2), diff.Seq)
+
+	// since_seq 指定基准
+	diff = sv.Diff("b", 1, screen2)
+	assert.Equal(t, uint64(1), diff.BaseSeq)
+	assert.Len(t, diff.Changes, 2)
+	diff = sv.Diff("b", 2, screen2)
+	assert.True(t, diff.Unchanged)
+
+	// 回到旧内容也是新版本
+	assert.Equal(t, uint64(3), sv.Record("a", screen1))
+}
+
+// TestScreenVersions_Expired tests diffing against a version that is no longer kept
+func TestScreenVersions_Expired(t *testing.T) {
+	sv := newScreenVersions()
+	for i := 0; i < maxScreenVersions+5; i++ {
+		sv.Record("a", []string{fmt.Sprintf("frame %d", i)})
+	}
+
+	diff := sv.Diff("a", 1, []string{"now"})
+	assert.True(t, diff.Full)
+	assert.Equal(t, uint64(maxScreenVersions+6), diff.Seq)
+
+	diff = sv.Diff("a", 0, []string{"later"})
+	require.False(t, diff.Full)
+	assert.Equal(t, []RowChange{{Row: 0, Cells: 5, Old: "now", New: "later"}}, diff.Changes)
+}
+
+// TestChangedCells tests counting changed columns
+func TestChangedCells(t *testing.T) {
+	assert.Equal(t, 0, changedCells("abc", "abc"))
+	assert.Equal(t, 1, changedCells("abc", "abd"))
+	assert.Equal(t, 2, changedCells("abc", "a"))
+	assert.Equal(t, 1, changedCells("日本", "日文"))
+}
+
+// TestTerminalCapturer_Capture tests that a capture is a stable copy rendered
+// the same way as the live snapshots
+func TestTerminalCapturer_Capture(t *testing.T) {
+	for _, emulatorType := range []TerminalEmulatorType{EmulatorTypeVT10x, EmulatorTypeVT100} {
+		t.Run(string(emulatorType), func(t *testing.T) {
+			capturer, err := NewTerminalCapturerWithType(10, 3, emulatorType)
+			require.NoError(t, err)
+			defer capturer.Close()
+
+			capturer.Emulator.Write([]byte("\x1b[32mok\x1b[0m\r\n$ "))
+			capture := capturer.Capture()
+			assert.Equal(t, capturer.GetScreenSnapshot(), capture.Plain())
+			assert.Equal(t, capturer.GetScreenSnapshotWithColor(), capture.Color())
+			assert.Equal(t, capturer.GetScreenSpans(), capture.Spans())
+			assert.Equal(t, 2, capture.CursorX)
+			assert.Equal(t, 1, capture.CursorY)
+
+			// 之后的输出不影响已截取的屏幕
+			capturer.Emulator.Write([]byte("\x1b[H\x1b[2Jchanged"))
+			assert.Equal(t, []string{"ok", "$", ""}, screenLines(capture.Plain()))
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package sshmcp
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// screenFontSize is the font size (in pixels) used for PNG snapshots
+	screenFontSize = 14
+	// screenPadding is the border around the screen in PNG snapshots
+	screenPadding = 6
+)
+
+var (
+	// defaultScreenFg and defaultScreenBg are the terminal default colours
+	defaultScreenFg = color.RGBA{0xe5, 0xe5, 0xe5, 0xff}
+	defaultScreenBg = color.RGBA{0x00, 0x00, 0x00, 0xff}
+
+	// basicScreenColors are the 16 ANSI colours (xterm defaults)
+	basicScreenColors = [16]color.RGBA{
+		{0x00, 0x00, 0x00, 0xff}, {0xcd, 0x00, 0x00, 0xff}, {0x00, 0xcd, 0x00, 0xff}, {0xcd, 0xcd, 0x00, 0xff},
+		{0x00, 0x00, 0xee, 0xff}, {0xcd, 0x00, 0xcd, 0xff}, {0x00, 0xcd, 0xcd, 0xff}, {0xe5, 0xe5, 0xe5, 0xff},
+		{0x7f, 0x7f, 0x7f, 0xff}, {0xff, 0x00, 0x00, 0xff}, {0x00, 0xff, 0x00, 0xff}, {0xff, 0xff, 0x00, 0xff},
+		{0x5c, 0x5c, 0xff, 0xff}, {0xff, 0x00, 0xff, 0xff}, {0x00, 0xff, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff},
+	}
+)
+
+// ScreenPicture is everything needed to draw a terminal screen: styled rows,
+// terminal size and cursor position
+type ScreenPicture struct {
+	Lines   [][]StyledSpan
+	Width   int
+	Height  int
+	CursorX int
+	CursorY int
+	Cursor  bool // 是否绘制光标
+}
+
+// paletteRGB returns the RGB value of an xterm 256-colour palette index
+func paletteRGB(index int) color.RGBA {
+	switch {
+	case index < 16:
+		return basicScreenColors[index]
+	case index < 232:
+		// 6x6x6 颜色立方
+		levels := [6]uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+		i := index - 16
+		return color.RGBA{levels[i/36], levels[(i/6)%6], levels[i%6], 0xff}
+	default:
+		// 24 级灰度
+		v := uint8(8 + (index-232)*10)
+		return color.RGBA{v, v, v, 0xff}
+	}
+}
+
+// styleColorRGB resolves a TextStyle colour name ("" means def)
+func styleColorRGB(name string, def color.RGBA) color.RGBA {
+	switch {
+	case name == "":
+		return def
+	case strings.HasPrefix(name, "#") && len(name) == 7:
+		v, err := strconv.ParseUint(name[1:], 16, 32)
+		if err != nil {
+			return def
+		}
+		return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+	case strings.HasPrefix(name, "256:"):
+		index, err := strconv.Atoi(name[4:])
+		if err != nil || index < 0 || index > 255 {
+			return def
+		}
+		return paletteRGB(index)
+	}
+	for i, basic := range basicColorNames {
+		if basic == name {
+			return basicScreenColors[i]
+		}
+	}
+	return def
+}
+
+// cellColors returns the foreground and background colour of a style,
+// applying reverse video
+func cellColors(style TextStyle) (fg, bg color.RGBA) {
+	fg = styleColorRGB(style.Fg, defaultScreenFg)
+	bg = styleColorRGB(style.Bg, defaultScreenBg)
+	if style.Reverse {
+		fg, bg = bg, fg
+	}
+	return fg, bg
+}
+
+// cssColor formats a colour for an inline style
+func cssColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// HTML renders the screen as a self-contained <pre> block with inline styles
+func (p ScreenPicture) HTML() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<pre style="background:%s;color:%s;font-family:'DejaVu Sans Mono',Menlo,Consolas,monospace;line-height:1.2;padding:%dpx;display:inline-block;margin:0">`,
+		cssColor(defaultScreenBg), cssColor(defaultScreenFg), screenPadding)
+
+	for y := 0; y < p.Height; y++ {
+		cells := p.rowCells(y)
+		for x := 0; x < len(cells); {
+			// 合并样式相同的相邻单元格，光标所在单元格单独输出
+			end := x + 1
+			for end < len(cells) && cells[end].style == cells[x].style && !p.isCursor(end, y) && !p.isCursor(x, y) {
+				end++
+			}
+
+			style := cells[x].style
+			if p.isCursor(x, y) {
+				style.Reverse = !style.Reverse
+			}
+			var text strings.Builder
+			for _, cell := range cells[x:end] {
+				if cell.r != WideCharPadding {
+					text.WriteRune(cell.r)
+				}
+			}
+			writeHTMLSpan(&sb, text.String(), style)
+			x = end
+		}
+		if y < p.Height-1 {
+			sb.WriteByte('\n')
+		}
+	}
+	sb.WriteString("</pre>")
+	return sb.String()
+}
+
+// writeHTMLSpan writes text, wrapped in a styled <span> unless it uses the default style
+func writeHTMLSpan(sb *strings.Builder, text string, style TextStyle) {
+	text = html.EscapeString(text)
+	if style == (TextStyle{}) {
+		sb.WriteString(text)
+		return
+	}
+
+	fg, bg := cellColors(style)
+	var css []string
+	if fg != defaultScreenFg {
+		css = append(css, "color:"+cssColor(fg))
+	}
+	if bg != defaultScreenBg {
+		css = append(css, "background:"+cssColor(bg))
+	}
+	if style.Bold {
+		css = append(css, "font-weight:bold")
+	}
+	if style.Italic {
+		css = append(css, "font-style:italic")
+	}
+	if style.Underline {
+		css = append(css, "text-decoration:underline")
+	}
+	if len(css) == 0 {
+		sb.WriteString(text)
+		return
+	}
+	fmt.Fprintf(sb, `<span style="%s">%s</span>`, strings.Join(css, ";"), text)
+}
+
+// isCursor reports whether the cursor is drawn at cell (x, y)
+func (p ScreenPicture) isCursor(x, y int) bool {
+	return p.Cursor && x == p.CursorX && y == p.CursorY
+}
+
+// rowCells returns row y as Width cells, padding with default blanks; wide
+// characters are followed by a WideCharPadding cell
+func (p ScreenPicture) rowCells(y int) []styledCell {
+	cells := make([]styledCell, 0, p.Width)
+	if y < len(p.Lines) {
+		for _, span := range p.Lines[y] {
+			for _, r := range span.Text {
+				cells = append(cells, styledCell{r: r, style: span.TextStyle})
+				// 宽字符占两列
+				if ansiRuneWidth.RuneWidth(r) == 2 {
+					cells = append(cells, styledCell{r: WideCharPadding, style: span.TextStyle})
+				}
+			}
+		}
+	}
+	for len(cells) < p.Width {
+		cells = append(cells, styledCell{r: ' '})
+	}
+	return cells
+}
+
+// screenFonts are the parsed regular and bold fonts used for PNG snapshots.
+// Faces hold per-glyph caches and are not safe for concurrent use, so each
+// PNG call creates its own
+var screenFonts struct {
+	once          sync.Once
+	regular, bold *opentype.Font
+	err           error
+}
+
+// newScreenFaces parses the bundled Go Mono fonts once and returns new faces
+// for them; the caller must close both faces
+func newScreenFaces() (regular, bold font.Face, err error) {
+	screenFonts.once.Do(func() {
+		if screenFonts.regular, screenFonts.err = opentype.Parse(gomono.TTF); screenFonts.err != nil {
+			return
+		}
+		screenFonts.bold, screenFonts.err = opentype.Parse(gomonobold.TTF)
+	})
+	if screenFonts.err != nil {
+		return nil, nil, screenFonts.err
+	}
+
+	opts := &opentype.FaceOptions{Size: screenFontSize, DPI: 72, Hinting: font.HintingFull}
+	if regular, err = opentype.NewFace(screenFonts.regular, opts); err != nil {
+		return nil, nil, err
+	}
+	if bold, err = opentype.NewFace(screenFonts.bold, opts); err != nil {
+		regular.Close()
+		return nil, nil, err
+	}
+	return regular, bold, nil
+}
+
+// PNG renders the screen as a PNG image using the bundled Go Mono font
+func (p ScreenPicture) PNG() ([]byte, error) {
+	regular, bold, err := newScreenFaces()
+	if err != nil {
+		return nil, fmt.Errorf("load font: %w", err)
+	}
+	defer regular.Close()
+	defer bold.Close()
+	if p.Width <= 0 || p.Height <= 0 {
+		return nil, fmt.Errorf("invalid screen size %dx%d", p.Width, p.Height)
+	}
+
+	// 单元格尺寸取自字体度量（等宽字体）
+	metrics := regular.Metrics()
+	advance, _ := regular.GlyphAdvance('M')
+	cellW := advance.Ceil()
+	cellH := (metrics.Ascent + metrics.Descent).Ceil()
+	ascent := metrics.Ascent.Ceil()
+
+	img := image.NewRGBA(image.Rect(0, 0, p.Width*cellW+2*screenPadding, p.Height*cellH+2*screenPadding))
+	draw.Draw(img, img.Bounds(), image.NewUniform(defaultScreenBg), image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img}
+	for y := 0; y < p.Height; y++ {
+		top := screenPadding + y*cellH
+		for x, cell := range p.rowCells(y) {
+			if x >= p.Width {
+				break
+			}
+			left := screenPadding + x*cellW
+			fg, bg := cellColors(cell.style)
+			if p.isCursor(x, y) {
+				fg, bg = bg, fg
+			}
+
+			rect := image.Rect(left, top, left+cellW, top+cellH)
+			if bg != defaultScreenBg {
+				draw.Draw(img, rect, image.NewUniform(bg), image.Point{}, draw.Src)
+			}
+			if cell.style.Underline {
+				line := image.Rect(left, top+ascent+1, left+cellW, top+ascent+2)
+				draw.Draw(img, line, image.NewUniform(fg), image.Point{}, draw.Src)
+			}
+			if cell.r == ' ' || cell.r == 0 || cell.r == WideCharPadding {
+				continue
+			}
+
+			drawer.Src = image.NewUniform(fg)
+			drawer.Face = regular
+			if cell.style.Bold {
+				drawer.Face = bold
+			}
+			drawer.Dot = fixed.P(left, top+ascent)
+			drawer.DrawString(string(cell.r))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// GetScreenPicture captures the styled screen, size and cursor in one step
+func (tc *TerminalCapturer) GetScreenPicture() ScreenPicture {
+	return tc.Capture().Picture()
+}
+
+// GetTerminalPicture returns the current screen for rendering as PNG or HTML
+func (ss *SSHShellSession) GetTerminalPicture() ScreenPicture {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return ScreenPicture{}
+	}
+
+	return ss.TerminalCapturer.GetScreenPicture()
+}
@@ -0,0 +1,139 @@
+package sshmcp
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStyleColorRGB tests resolving colour names to RGB
+func TestStyleColorRGB(t *testing.T) {
+	def := color.RGBA{1, 2, 3, 0xff}
+	assert.Equal(t, def, styleColorRGB("", def))
+	assert.Equal(t, color.RGBA{0xcd, 0x00, 0x00, 0xff}, styleColorRGB("red", def))
+	assert.Equal(t, color.RGBA{0xff, 0xff, 0xff, 0xff}, styleColorRGB("bright-white", def))
+	assert.Equal(t, color.RGBA{0x87, 0xaf, 0xd7, 0xff}, styleColorRGB("256:110", def))
+	assert.Equal(t, color.RGBA{0x80, 0x80, 0x80, 0xff}, styleColorRGB("256:244", def))
+	assert.Equal(t, color.RGBA{0x12, 0x34, 0x56, 0xff}, styleColorRGB("#123456", def))
+	assert.Equal(t, def, styleColorRGB("256:999", def))
+	assert.Equal(t, def, styleColorRGB("#zzzzzz", def))
+}
+
+// testPicture returns a 6x2 screen with a red word, reverse video and the cursor
+func testPicture() ScreenPicture {
+	return ScreenPicture{
+		Lines: [][]StyledSpan{
+			{{Text: "ab", TextStyle: TextStyle{Fg: "red", Bold: true}}, {Text: "<&"}},
+			{{Text: "XY", TextStyle: TextStyle{Reverse: true}}},
+		},
+		Width:   6,
+		Height:  2,
+		CursorX: 4,
+		CursorY: 1,
+		Cursor:  true,
+	}
+}
+
+// TestScreenPicture_HTML tests the self-contained HTML rendering
+func TestScreenPicture_HTML(t *testing.T) {
+	out := testPicture().HTML()
+
+	assert.True(t, strings.HasPrefix(out, `<pre style="background:#000000;color:#e5e5e5;`))
+	assert.True(t, strings.HasSuffix(out, "</pre>"))
+	assert.Contains(t, out, `<span style="color:#cd0000;font-weight:bold">ab</span>&lt;&amp;  `)
+	assert.Contains(t, out, `<span style="color:#000000;background:#e5e5e5">XY</span>  `)
+	// 光标单元格反显
+	assert.Contains(t, out, `<span style="color:#000000;background:#e5e5e5"> </span> </pre>`)
+	assert.Equal(t, 1, strings.Count(out, "\n"))
+}
+
+// TestScreenPicture_PNG tests the PNG rendering size and colours
+func TestScreenPicture_PNG(t *testing.T) {
+	data, err := testPicture().PNG()
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	regular, bold, err := newScreenFaces()
+	require.NoError(t, err)
+	defer regular.Close()
+	defer bold.Close()
+	advance, _ := regular.GlyphAdvance('M')
+	cellW := advance.Ceil()
+	cellH := (regular.Metrics().Ascent + regular.Metrics().Descent).Ceil()
+
+	bounds := img.Bounds()
+	assert.Equal(t, 6*cellW+2*screenPadding, bounds.Dx())
+	assert.Equal(t, 2*cellH+2*screenPadding, bounds.Dy())
+
+	// 背景、反显单元格和光标的左上角像素
+	at := func(x, y int) color.RGBA {
+		r, g, b, a := img.At(screenPadding+x*cellW, screenPadding+y*cellH).RGBA()
+		return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+	}
+	assert.Equal(t, defaultScreenBg, at(5, 0))
+	assert.Equal(t, defaultScreenFg, at(0, 1))
+	assert.Equal(t, defaultScreenFg, at(4, 1))
+
+	// 文字使用红色绘制
+	red := false
+	for y := screenPadding; y < screenPadding+cellH; y++ {
+		for x := screenPadding; x < screenPadding+2*cellW; x++ {
+			if r, g, _, _ := img.At(x, y).RGBA(); r>>8 > 0x80 && g>>8 < 0x40 {
+				red = true
+			}
+		}
+	}
+	assert.True(t, red)
+
+	_, err = ScreenPicture{}.PNG()
+	assert.Error(t, err)
+}
+
+// TestScreenPicture_PNGConcurrent tests rendering from several goroutines at once
+func TestScreenPicture_PNGConcurrent(t *testing.T) {
+	want, err := testPicture().PNG()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = testPicture().PNG()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, got := range results {
+		assert.Equal(t, want, got)
+	}
+}
+
+// TestTerminalCapturer_GetScreenPicture tests capturing the screen for rendering
+func TestTerminalCapturer_GetScreenPicture(t *testing.T) {
+	capturer, err := NewTerminalCapturerWithType(10, 3, EmulatorTypeVT10x)
+	require.NoError(t, err)
+	defer capturer.Close()
+
+	capturer.Emulator.Write([]byte("\x1b[32mok\x1b[0m \x1b[7mR\x1b[0m\r\n$ "))
+	p := capturer.GetScreenPicture()
+
+	assert.Equal(t, 10, p.Width)
+	assert.Equal(t, 3, p.Height)
+	assert.Equal(t, 2, p.CursorX)
+	assert.Equal(t, 1, p.CursorY)
+	assert.Contains(t, p.HTML(), `<span style="color:#00cd00">ok</span>`)
+
+	// vt10x 的反显单元格还原为 Reverse 标志
+	require.Len(t, p.Lines[0], 3)
+	assert.Equal(t, StyledSpan{Text: "R", TextStyle: TextStyle{Reverse: true}}, p.Lines[0][2])
+}
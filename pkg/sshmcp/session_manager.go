@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/pkg/sftp"
 	"github.com/rs/zerolog"
 )
 
@@ -23,6 +22,9 @@ type ManagerConfig struct {
 	// 清理配置
 	CleanupInterval time.Duration
 
+	// Shell 录制配置
+	Recording RecordingConfig
+
 	// 日志
 	Logger *zerolog.Logger
 }
@@ -35,6 +37,7 @@ func DefaultManagerConfig(logger *zerolog.Logger) ManagerConfig {
 		SessionTimeout:     30 * time.Minute,
 		IdleTimeout:        10 * time.Minute,
 		CleanupInterval:    1 * time.Minute,
+		Recording:          DefaultRecordingConfig(),
 		Logger:             logger,
 	}
 }
@@ -119,12 +122,7 @@ func (sm *SessionManager) CreateSession(host string, port int, username string,
 		return nil, fmt.Errorf("create SSH client: %w", err)
 	}
 
-	// 创建 SFTP 客户端
-	sftpClient, err := sftp.NewClient(client)
-	if err != nil {
-		client.Close()
-		return nil, fmt.Errorf("create SFTP client: %w", err)
-	}
+	// SFTP 客户端在首次文件操作时创建，部分设备（路由器、加固主机）没有 sftp 子系统
 
 	// 创建会话配置
 	config := &SessionConfig{
@@ -134,6 +132,7 @@ func (sm *SessionManager) CreateSession(host string, port int, username string,
 		MaxRetries:       3,
 		MaxIdleTime:      sm.config.IdleTimeout,
 		AutoReconnect:    false,
+		Recording:        &sm.config.Recording,
 	}
 
 	session := &Session{
@@ -144,7 +143,6 @@ func (sm *SessionManager) CreateSession(host string, port int, username string,
 		Username:    username,
 		State:       SessionStateActive,
 		SSHClient:   client,
-		SFTPClient:  sftpClient,
 		CreatedAt:   time.Now(),
 		LastUsedAt:  time.Now(),
 		ExpiresAt:   time.Now().Add(sm.config.SessionTimeout),
@@ -209,14 +207,12 @@ func (sm *SessionManager) RemoveSession(sessionID string) error {
 		}
 	}
 
-	// 关闭 Shell 会话
-	if session.ShellSession != nil {
-		if err := session.ShellSession.Close(); err != nil {
-			sm.config.Logger.Error().
-				Str("session_id", sessionID).
-				Err(err).
-				Msg("Failed to close shell session")
-		}
+	// 关闭所有 Shell 会话
+	for _, err := range session.closeAllShells() {
+		sm.config.Logger.Error().
+			Str("session_id", sessionID).
+			Err(err).
+			Msg("Failed to close shell session")
 	}
 
 	// 关闭 SSH 连接
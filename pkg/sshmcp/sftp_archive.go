@@ -0,0 +1,807 @@
+package sshmcp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Archive formats for directory transfers
+const (
+	ArchiveTar  = "tar"  // 不压缩
+	ArchiveGzip = "gzip" // tar + gzip
+	ArchiveZstd = "zstd" // tar + zstd（需要本地和远程都安装 zstd 命令）
+)
+
+// archiveTools records which archive tools are available on the remote host
+type archiveTools struct {
+	Tar  bool
+	Gzip bool
+	Zstd bool
+}
+
+// archiveEntry is a local file or directory selected for an archive upload
+type archiveEntry struct {
+	Rel  string // "/" 分隔的相对路径
+	Path string // 本地路径
+	Info os.FileInfo
+}
+
+// countingWriter counts bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader counts bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// normalizeArchiveFormat maps user-facing aliases to an archive format
+func normalizeArchiveFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "tar":
+		return ArchiveTar, nil
+	case "gzip", "gz", "tgz", "tar.gz":
+		return ArchiveGzip, nil
+	case "zstd", "zst", "tar.zst":
+		return ArchiveZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s (supported: tar, gzip, zstd)", format)
+	}
+}
+
+// chooseArchiveFormat picks the best available format for the request. It returns "" when
+// archive mode cannot be used at all, and a note whenever the request was not met exactly.
+func chooseArchiveFormat(requested string, remote archiveTools, localZstd bool) (string, string) {
+	if !remote.Tar {
+		return "", "tar is not available on the remote host, used SFTP"
+	}
+
+	var notes []string
+	format := requested
+	if format == ArchiveZstd && !(remote.Zstd && localZstd) {
+		where := "remote host"
+		if remote.Zstd {
+			where = "local host"
+		}
+		notes = append(notes, fmt.Sprintf("zstd is not available on the %s", where))
+		format = ArchiveGzip
+	}
+	if format == ArchiveGzip && !remote.Gzip {
+		notes = append(notes, "gzip is not available on the remote host")
+		format = ArchiveTar
+	}
+
+	note := ""
+	if len(notes) > 0 {
+		note = strings.Join(notes, "; ") + ", used " + format
+	}
+	return format, note
+}
+
+// probeArchiveTools checks which archive tools exist on the remote host
+func (s *Session) probeArchiveTools() archiveTools {
+	var tools archiveTools
+	result, err := s.ExecuteCommand("for t in tar gzip zstd; do command -v $t >/dev/null 2>&1 && echo $t; done", 10*time.Second)
+	if err != nil {
+		return tools
+	}
+	for _, line := range strings.Fields(result.Stdout) {
+		switch line {
+		case "tar":
+			tools.Tar = true
+		case "gzip":
+			tools.Gzip = true
+		case "zstd":
+			tools.Zstd = true
+		}
+	}
+	return tools
+}
+
+// selectArchiveFormat validates the requested format and picks what the hosts support
+func (s *Session) selectArchiveFormat(requested string) (string, string, error) {
+	format, err := normalizeArchiveFormat(requested)
+	if err != nil {
+		return "", "", err
+	}
+	_, lookErr := exec.LookPath("zstd")
+	chosen, note := chooseArchiveFormat(format, s.probeArchiveTools(), lookErr == nil)
+	return chosen, note, nil
+}
+
+// remoteExtractCommand returns the shell command that unpacks an archive from stdin into dir
+func remoteExtractCommand(format, dir string) string {
+	extract := "tar -xf - -C " + shellQuote(dir)
+	switch format {
+	case ArchiveGzip:
+		extract = "gzip -dc | " + extract
+	case ArchiveZstd:
+		extract = "zstd -dqc | " + extract
+	}
+	return "mkdir -p " + shellQuote(dir) + " && " + extract
+}
+
+// remoteCreateCommand returns the shell command that writes an archive of dir to stdout.
+// With a file list, names are read from stdin.
+func remoteCreateCommand(format, dir string, fromList bool) string {
+	create := "tar -cf - -C " + shellQuote(dir) + " ."
+	if fromList {
+		create = "tar -cf - -C " + shellQuote(dir) + " -T -"
+	}
+	switch format {
+	case ArchiveGzip:
+		create += " | gzip -c"
+	case ArchiveZstd:
+		create += " | zstd -qc"
+	}
+	return create
+}
+
+// uploadArchive uploads a directory as a single tar stream, falling back to SFTP if needed
+func (s *Session) uploadArchive(localPath, remotePath string, opts *TransferOptions) (*FileTransferResult, error) {
+	format, note, err := s.selectArchiveFormat(opts.Archive)
+	if err != nil {
+		return &FileTransferResult{Error: err}, err
+	}
+	if format == "" {
+		fallbackOpts := *opts
+		fallbackOpts.Archive = ""
+		result, err := s.UploadFileWithOptions(localPath, remotePath, &fallbackOpts)
+		if result != nil {
+			result.Fallback = note
+		}
+		return result, err
+	}
+
+	var files []transferredFile
+
+	s.mu.Lock()
+	s.LastUsedAt = time.Now()
+	result, err := s.streamUploadArchive(localPath, remotePath, format, opts, &files)
+	s.mu.Unlock()
+
+	if result != nil {
+		result.Fallback = note
+	}
+	if err != nil || !opts.Verify {
+		return result, err
+	}
+
+	if err := s.verifyTransferredFiles(files, opts, "upload"); err != nil {
+		result.Status = "failed"
+		result.Error = err
+		return result, err
+	}
+	markVerified(result, files, opts)
+
+	return result, nil
+}
+
+// downloadArchive downloads a directory as a single tar stream, falling back to SFTP if needed
+func (s *Session) downloadArchive(remotePath, localPath string, opts *TransferOptions) (*FileTransferResult, error) {
+	format, note, err := s.selectArchiveFormat(opts.Archive)
+	if err != nil {
+		return &FileTransferResult{Error: err}, err
+	}
+	if format == "" {
+		fallbackOpts := *opts
+		fallbackOpts.Archive = ""
+		result, err := s.DownloadFileWithOptions(remotePath, localPath, &fallbackOpts)
+		if result != nil {
+			result.Fallback = note
+		}
+		return result, err
+	}
+
+	var files []transferredFile
+
+	s.mu.Lock()
+	s.LastUsedAt = time.Now()
+	result, err := s.streamDownloadArchive(remotePath, localPath, format, opts, &files)
+	s.mu.Unlock()
+
+	if result != nil {
+		result.Fallback = note
+	}
+	if err != nil || !opts.Verify {
+		return result, err
+	}
+
+	if err := s.verifyTransferredFiles(files, opts, "download"); err != nil {
+		result.Status = "failed"
+		result.Error = err
+		return result, err
+	}
+	markVerified(result, files, opts)
+
+	return result, nil
+}
+
+// collectArchiveEntries walks a local directory and returns the entries selected by the filter
+func collectArchiveEntries(localPath string, filter *syncFilter) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	err := filepath.Walk(localPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if filter.excluded(rel, true) {
+				return filepath.SkipDir
+			}
+			// 设置了 include 时目录由其中的文件隐式创建
+			if len(filter.includes) == 0 {
+				entries = append(entries, archiveEntry{Rel: rel, Path: p, Info: info})
+			}
+			return nil
+		}
+
+		if filter.selected(rel) {
+			entries = append(entries, archiveEntry{Rel: rel, Path: p, Info: info})
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// checkRemoteConflicts fails if any selected file already exists remotely (caller must hold s.mu)
+func (s *Session) checkRemoteConflicts(remotePath string, entries []archiveEntry) error {
+	if s.ensureSFTP() != nil {
+		return s.checkRemoteConflictsExec(remotePath, entries)
+	}
+	if _, err := s.SFTPClient.Stat(remotePath); err != nil {
+		return nil // 目标目录不存在，不会有冲突
+	}
+
+	existing := map[string]bool{}
+	walker := s.SFTPClient.Walk(remotePath)
+	for walker.Step() {
+		if walker.Err() != nil || walker.Stat().IsDir() {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remotePath), "/")
+		existing[rel] = true
+	}
+
+	for _, entry := range entries {
+		if !entry.Info.IsDir() && existing[entry.Rel] {
+			return fmt.Errorf("remote file already exists: %s (use overwrite=true to overwrite)", path.Join(remotePath, entry.Rel))
+		}
+	}
+	return nil
+}
+
+// checkRemoteConflictsExec is checkRemoteConflicts for hosts without SFTP (caller must hold s.mu)
+func (s *Session) checkRemoteConflictsExec(remotePath string, entries []archiveEntry) error {
+	var rels []string
+	for _, entry := range entries {
+		if !entry.Info.IsDir() {
+			rels = append(rels, entry.Rel)
+		}
+	}
+	existing, err := s.remoteExistingPaths(remotePath, rels)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("remote file already exists: %s (use overwrite=true to overwrite)", path.Join(remotePath, existing[0]))
+	}
+	return nil
+}
+
+// streamUploadArchive streams a tar of the local tree into tar -x on the remote host (caller must hold s.mu)
+func (s *Session) streamUploadArchive(localPath, remotePath, format string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+	remotePath = path.Clean(remotePath)
+
+	entries, err := collectArchiveEntries(localPath, newSyncFilter(opts.Include, opts.Exclude))
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("walk local directory: %w", err)}, err
+	}
+	if !opts.Overwrite {
+		if err := s.checkRemoteConflicts(remotePath, entries); err != nil {
+			return &FileTransferResult{Error: err}, err
+		}
+	}
+
+	session, err := s.SSHClient.NewSession()
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("create SSH session: %w", err)}, err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("open stdin: %w", err)}, err
+	}
+	if err := session.Start(remoteExtractCommand(format, remotePath)); err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("start remote tar: %w", err)}, err
+	}
+
+	wire := &countingWriter{w: stdin}
+	contentBytes, fileCount, writeErr := writeArchive(wire, format, localPath, remotePath, entries, opts, files)
+	stdin.Close()
+	waitErr := session.Wait()
+
+	if writeErr != nil || waitErr != nil {
+		err := writeErr
+		if err == nil {
+			err = waitErr
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		err = fmt.Errorf("archive upload: %w", err)
+		return &FileTransferResult{Error: err}, err
+	}
+
+	return archiveTransferResult(localPath, "upload", format, contentBytes, wire.n, fileCount, time.Since(startTime)), nil
+}
+
+// writeArchive writes the entries as a (compressed) tar stream and returns content bytes and file count
+func writeArchive(w io.Writer, format, localPath, remotePath string, entries []archiveEntry, opts *TransferOptions, files *[]transferredFile) (int64, int, error) {
+	compressed, closeCompressor, err := newArchiveCompressor(w, format)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tw := tar.NewWriter(compressed)
+	var contentBytes int64
+	var fileCount int
+
+	writeErr := func() error {
+		for _, entry := range entries {
+			n, err := writeArchiveEntry(tw, entry, path.Join(remotePath, entry.Rel), opts, files)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Rel, err)
+			}
+			if entry.Info.Mode().IsRegular() {
+				contentBytes += n
+				fileCount++
+			}
+		}
+		return tw.Close()
+	}()
+
+	if closeErr := closeCompressor(); writeErr == nil {
+		writeErr = closeErr
+	}
+	return contentBytes, fileCount, writeErr
+}
+
+// writeArchiveEntry writes a single tar entry, hashing file content when verification is enabled
+func writeArchiveEntry(tw *tar.Writer, entry archiveEntry, remoteFile string, opts *TransferOptions, files *[]transferredFile) (int64, error) {
+	link := ""
+	if entry.Info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(entry.Path)
+		if err != nil {
+			return 0, err
+		}
+		link = target
+	}
+
+	header, err := tar.FileInfoHeader(entry.Info, link)
+	if err != nil {
+		return 0, err
+	}
+	header.Name = entry.Rel
+	if entry.Info.IsDir() {
+		header.Name += "/"
+	}
+	// 与 SFTP 上传一致：由远程用户决定属主，不携带本地的 uid/gid
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+	header.Format = tar.FormatPAX
+
+	if err := tw.WriteHeader(header); err != nil {
+		return 0, err
+	}
+	if !entry.Info.Mode().IsRegular() {
+		return 0, nil
+	}
+
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var dest io.Writer = tw
+	var hasher hash.Hash
+	if opts.Verify {
+		hasher, _ = newChecksumHash(opts.ChecksumAlgorithm)
+		dest = io.MultiWriter(tw, hasher)
+	}
+	n, err := io.Copy(dest, f)
+	if err != nil {
+		return n, err
+	}
+
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  entry.Path,
+			RemotePath: remoteFile,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+	return n, nil
+}
+
+// newArchiveCompressor wraps w with the compressor for format; the returned close function
+// flushes the compressor without closing w
+func newArchiveCompressor(w io.Writer, format string) (io.Writer, func() error, error) {
+	switch format {
+	case ArchiveGzip:
+		gz := gzip.NewWriter(w)
+		return gz, gz.Close, nil
+	case ArchiveZstd:
+		cmd := exec.Command("zstd", "-qc")
+		cmd.Stdout = w
+		in, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, nil, fmt.Errorf("start local zstd: %w", err)
+		}
+		return in, func() error {
+			in.Close()
+			return cmd.Wait()
+		}, nil
+	default:
+		return w, func() error { return nil }, nil
+	}
+}
+
+// newArchiveDecompressor wraps r with the decompressor for format; the returned close
+// function discards any unread output and waits for the decompressor to exit
+func newArchiveDecompressor(r io.Reader, format string) (io.Reader, func() error, error) {
+	switch format {
+	case ArchiveGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gz, gz.Close, nil
+	case ArchiveZstd:
+		cmd := exec.Command("zstd", "-dqc")
+		cmd.Stdin = r
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, nil, fmt.Errorf("start local zstd: %w", err)
+		}
+		return out, func() error {
+			// tar 读取结束（或出错）时 zstd 可能仍有输出，不读完会阻塞 Wait
+			io.Copy(io.Discard, out)
+			return cmd.Wait()
+		}, nil
+	default:
+		return r, func() error { return nil }, nil
+	}
+}
+
+// streamDownloadArchive streams tar -c output from the remote host and extracts it locally (caller must hold s.mu)
+func (s *Session) streamDownloadArchive(remotePath, localPath, format string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+	remotePath = path.Clean(remotePath)
+
+	// 有过滤条件时先通过 SFTP 列出要打包的文件
+	filter := newSyncFilter(opts.Include, opts.Exclude)
+	var names []string
+	fromList := len(filter.includes) > 0 || len(filter.rules) > 0
+	if fromList {
+		if err := s.ensureSFTP(); err != nil {
+			err = fmt.Errorf("include/exclude filters need SFTP to list files: %w", err)
+			return &FileTransferResult{Error: err}, err
+		}
+		tree, err := s.listRemoteSyncTree(remotePath)
+		if err != nil {
+			return &FileTransferResult{Error: err}, err
+		}
+		for rel, entry := range tree {
+			if !entry.IsDir && filter.selected(rel) && !strings.Contains(rel, "\n") {
+				names = append(names, "./"+rel)
+			}
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			if err := os.MkdirAll(localPath, 0755); err != nil {
+				return &FileTransferResult{Error: err}, err
+			}
+			return archiveTransferResult(remotePath, "download", format, 0, 0, 0, time.Since(startTime)), nil
+		}
+	}
+
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("create local directory: %w", err)}, err
+	}
+
+	session, err := s.SSHClient.NewSession()
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("create SSH session: %w", err)}, err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	if fromList {
+		session.Stdin = strings.NewReader(strings.Join(names, "\n") + "\n")
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("open stdout: %w", err)}, err
+	}
+	if err := session.Start(remoteCreateCommand(format, remotePath, fromList)); err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("start remote tar: %w", err)}, err
+	}
+
+	wire := &countingReader{r: stdout}
+	contentBytes, fileCount, readErr := extractArchive(wire, format, localPath, remotePath, opts, files)
+	if readErr != nil {
+		// 读取失败时丢弃剩余输出，让远程命令结束
+		io.Copy(io.Discard, stdout)
+	}
+	waitErr := session.Wait()
+
+	if readErr != nil || waitErr != nil {
+		err := readErr
+		if err == nil {
+			err = waitErr
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		err = fmt.Errorf("archive download: %w", err)
+		return &FileTransferResult{Error: err}, err
+	}
+
+	return archiveTransferResult(remotePath, "download", format, contentBytes, wire.n, fileCount, time.Since(startTime)), nil
+}
+
+// extractArchive unpacks a (compressed) tar stream into localPath and returns content bytes and file count
+func extractArchive(r io.Reader, format, localPath, remotePath string, opts *TransferOptions, files *[]transferredFile) (int64, int, error) {
+	decompressed, closeDecompressor, err := newArchiveDecompressor(r, format)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	root, err := filepath.Abs(localPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirTimes []dirTime
+	var contentBytes int64
+	var fileCount int
+
+	readErr := func() error {
+		tr := tar.NewReader(decompressed)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			rel, err := safeArchivePath(header.Name)
+			if err != nil {
+				return err
+			}
+			if rel == "" {
+				continue
+			}
+			target := filepath.Join(root, filepath.FromSlash(rel))
+			if err := checkInsideRoot(root, filepath.Dir(target)); err != nil {
+				return err
+			}
+
+			switch header.Typeflag {
+			case tar.TypeDir:
+				if err := os.MkdirAll(target, 0755); err != nil {
+					return err
+				}
+				if err := os.Chmod(target, header.FileInfo().Mode().Perm()|0700); err != nil {
+					return err
+				}
+				dirTimes = append(dirTimes, dirTime{target, header.ModTime})
+
+			case tar.TypeReg:
+				n, err := extractArchiveFile(tr, header, target, opts, path.Join(remotePath, rel), files)
+				if err != nil {
+					return fmt.Errorf("%s: %w", rel, err)
+				}
+				contentBytes += n
+				fileCount++
+
+			case tar.TypeSymlink:
+				if _, err := os.Lstat(target); err == nil {
+					if !opts.Overwrite {
+						return fmt.Errorf("local file already exists: %s (use overwrite=true to overwrite)", target)
+					}
+					if err := os.Remove(target); err != nil {
+						return err
+					}
+				}
+				if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+					return err
+				}
+				if err := os.Symlink(header.Linkname, target); err != nil {
+					return err
+				}
+			}
+		}
+	}()
+
+	if closeErr := closeDecompressor(); readErr == nil {
+		readErr = closeErr
+	}
+	if readErr != nil {
+		return contentBytes, fileCount, readErr
+	}
+
+	// 目录的修改时间会因写入文件而改变，最后再统一设置
+	for i := len(dirTimes) - 1; i >= 0; i-- {
+		os.Chtimes(dirTimes[i].path, dirTimes[i].mtime, dirTimes[i].mtime)
+	}
+
+	return contentBytes, fileCount, nil
+}
+
+// extractArchiveFile writes a regular file from the tar stream
+func extractArchiveFile(r io.Reader, header *tar.Header, target string, opts *TransferOptions, remoteFile string, files *[]transferredFile) (int64, error) {
+	if info, err := os.Lstat(target); err == nil {
+		if !opts.Overwrite {
+			return 0, fmt.Errorf("local file already exists: %s (use overwrite=true to overwrite)", target)
+		}
+		// 不通过已存在的符号链接写入
+		if info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	var dest io.Writer = f
+	var hasher hash.Hash
+	if opts.Verify {
+		hasher, _ = newChecksumHash(opts.ChecksumAlgorithm)
+		dest = io.MultiWriter(f, hasher)
+	}
+	n, err := io.Copy(dest, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	os.Chmod(target, header.FileInfo().Mode().Perm())
+	os.Chtimes(target, header.ModTime, header.ModTime)
+
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  target,
+			RemotePath: remoteFile,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+	return n, nil
+}
+
+// safeArchivePath cleans a tar entry name and rejects absolute paths and parent references
+func safeArchivePath(name string) (string, error) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if cleaned == "." || cleaned == "" {
+		return "", nil
+	}
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	return cleaned, nil
+}
+
+// checkInsideRoot ensures dir (after resolving symlinks of existing parents) stays inside root
+func checkInsideRoot(root, dir string) error {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	// 找到已存在的最深父目录并解析符号链接
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("archive entry escapes destination directory: %s", dir)
+	}
+	return nil
+}
+
+// archiveTransferResult builds the result of an archive transfer
+func archiveTransferResult(filePath, operation, format string, contentBytes, archiveBytes int64, fileCount int, duration time.Duration) *FileTransferResult {
+	result := &FileTransferResult{
+		Status:           "success",
+		BytesTransferred: contentBytes,
+		Duration:         duration.String(),
+		FileSize:         contentBytes,
+		Progress:         100.0,
+		FilePath:         filePath,
+		Operation:        operation,
+		FilesTransferred: fileCount,
+		ArchiveFormat:    format,
+		ArchiveBytes:     archiveBytes,
+	}
+	if archiveBytes > 0 {
+		result.CompressionRatio = float64(contentBytes) / float64(archiveBytes)
+	}
+	if duration.Seconds() > 0 {
+		result.Speed = formatBytes(float64(archiveBytes)/duration.Seconds()) + "/s"
+	}
+	return result
+}
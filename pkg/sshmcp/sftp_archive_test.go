@@ -0,0 +1,160 @@
+package sshmcp
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChooseArchiveFormat tests format selection and degradation
+func TestChooseArchiveFormat(t *testing.T) {
+	all := archiveTools{Tar: true, Gzip: true, Zstd: true}
+
+	format, note := chooseArchiveFormat(ArchiveZstd, all, true)
+	assert.Equal(t, ArchiveZstd, format)
+	assert.Empty(t, note)
+
+	format, note = chooseArchiveFormat(ArchiveZstd, all, false)
+	assert.Equal(t, ArchiveGzip, format)
+	assert.Contains(t, note, "local host")
+
+	format, note = chooseArchiveFormat(ArchiveZstd, archiveTools{Tar: true}, true)
+	assert.Equal(t, ArchiveTar, format)
+	assert.Contains(t, note, "remote host")
+
+	format, note = chooseArchiveFormat(ArchiveGzip, archiveTools{Gzip: true}, true)
+	assert.Empty(t, format)
+	assert.Contains(t, note, "SFTP")
+
+	_, err := normalizeArchiveFormat("rar")
+	assert.Error(t, err)
+	format, err = normalizeArchiveFormat("tar.gz")
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveGzip, format)
+}
+
+// TestSafeArchivePath tests rejection of absolute and parent paths
+func TestSafeArchivePath(t *testing.T) {
+	rel, err := safeArchivePath("./a/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "a/b.txt", rel)
+
+	rel, err = safeArchivePath("./")
+	require.NoError(t, err)
+	assert.Empty(t, rel)
+
+	for _, name := range []string{"/etc/passwd", "../x", "a/../../x", ".."} {
+		_, err := safeArchivePath(name)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestArchiveRoundTrip tests writing and extracting a filtered archive
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub", "empty"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "node_modules"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), bytes.Repeat([]byte("hello "), 1000), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "b.sh"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "node_modules", "x.js"), []byte("x"), 0644))
+	require.NoError(t, os.Symlink("a.txt", filepath.Join(src, "link")))
+
+	for _, format := range []string{ArchiveTar, ArchiveGzip} {
+		t.Run(format, func(t *testing.T) {
+			entries, err := collectArchiveEntries(src, newSyncFilter(nil, []string{"node_modules/"}))
+			require.NoError(t, err)
+
+			opts := &TransferOptions{Verify: true}
+			var buf bytes.Buffer
+			var sent []transferredFile
+			content, count, err := writeArchive(&buf, format, src, "/remote", entries, opts, &sent)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.Equal(t, int64(6010), content)
+			assert.Len(t, sent, 2)
+
+			dst := t.TempDir()
+			var received []transferredFile
+			content, count, err = extractArchive(&buf, format, dst, "/remote", opts, &received)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.Equal(t, int64(6010), content)
+			require.Len(t, received, 2)
+			assert.Equal(t, sent[0].Checksum, received[0].Checksum)
+
+			info, err := os.Stat(filepath.Join(dst, "sub", "b.sh"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+			assert.DirExists(t, filepath.Join(dst, "sub", "empty"))
+			assert.NoDirExists(t, filepath.Join(dst, "node_modules"))
+
+			target, err := os.Readlink(filepath.Join(dst, "link"))
+			require.NoError(t, err)
+			assert.Equal(t, "a.txt", target)
+
+			// 已存在的文件在未设置 overwrite 时不会被覆盖
+			var again bytes.Buffer
+			_, _, err = writeArchive(&again, format, src, "/remote", entries, &TransferOptions{}, &sent)
+			require.NoError(t, err)
+			_, _, err = extractArchive(&again, format, dst, "/remote", &TransferOptions{}, &received)
+			assert.ErrorContains(t, err, "already exists")
+		})
+	}
+}
+
+// TestExtractArchiveRejectsEscapes tests that entries cannot escape the destination
+func TestExtractArchiveRejectsEscapes(t *testing.T) {
+	outside := t.TempDir()
+	dst := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(dst, "out")))
+
+	for _, name := range []string{"../evil.txt", "out/evil.txt"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 4, Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte("evil"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+
+		_, _, err = extractArchive(&buf, ArchiveTar, dst, "/remote", &TransferOptions{}, nil)
+		assert.Error(t, err, name)
+	}
+	assert.NoFileExists(t, filepath.Join(outside, "evil.txt"))
+}
+
+// TestExtractArchiveZstdEarlyError tests that a failed zstd extraction does not
+// hang waiting for the decompressor while it still has output
+func TestExtractArchiveZstdEarlyError(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd not available")
+	}
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.bin"), bytes.Repeat([]byte("x"), 4*1024*1024), 0644))
+	entries, err := collectArchiveEntries(src, newSyncFilter(nil, nil))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, _, err = writeArchive(&buf, ArchiveZstd, src, "/remote", entries, &TransferOptions{}, nil)
+	require.NoError(t, err)
+
+	// 目标文件已存在，读取第一个条目后即失败，zstd 还有大量未读输出
+	dst := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "a.bin"), []byte("old"), 0644))
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := extractArchive(&buf, ArchiveZstd, dst, "/remote", &TransferOptions{}, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "already exists")
+	case <-time.After(10 * time.Second):
+		t.Fatal("extractArchive hung after an early error")
+	}
+}
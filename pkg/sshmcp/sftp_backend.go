@@ -0,0 +1,997 @@
+package sshmcp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// File transfer backends reported in FileTransferResult.Backend
+const (
+	FileBackendSFTP = "sftp" // SFTP 子系统
+	FileBackendSCP  = "scp"  // 通过 exec 运行远程 scp -t/-f（SCP 协议）
+	FileBackendExec = "exec" // 通过 exec 运行 cat/ls 等命令
+)
+
+// ensureSFTP creates the SFTP client on first use; a failure is cached so that hosts without
+// the sftp subsystem are not probed on every operation (caller must hold s.mu)
+func (s *Session) ensureSFTP() error {
+	if s.SFTPClient != nil {
+		return nil
+	}
+	if s.sftpErr != nil {
+		return s.sftpErr
+	}
+	if s.SSHClient == nil {
+		return fmt.Errorf("SSH client is not connected")
+	}
+
+	client, err := sftp.NewClient(s.SSHClient)
+	if err != nil {
+		s.sftpErr = fmt.Errorf("SFTP subsystem unavailable: %w", err)
+		return s.sftpErr
+	}
+	s.SFTPClient = client
+	return nil
+}
+
+// SFTP returns the session's SFTP client, opening it on first use. The
+// SFTPClient field stays nil until a file operation needs it, so API
+// consumers should use this instead of reading the field directly.
+func (s *Session) SFTP() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureSFTP(); err != nil {
+		return nil, err
+	}
+	return s.SFTPClient, nil
+}
+
+// SFTPError returns why SFTP is unavailable, or nil if it is available or not yet tried
+func (s *Session) SFTPError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sftpErr
+}
+
+// runRemote runs a command on a new exec channel. It does not touch session state and may be
+// called while holding s.mu. Non-zero exit codes are returned as errors including stderr.
+func (s *Session) runRemote(command string, stdin io.Reader, stdout io.Writer) error {
+	session, err := s.SSHClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+
+	if err := session.Run(command); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// runRemoteOutput runs a command and returns its stdout (caller may hold s.mu)
+func (s *Session) runRemoteOutput(command string) (string, error) {
+	var stdout bytes.Buffer
+	err := s.runRemote(command, nil, &stdout)
+	return stdout.String(), err
+}
+
+// fallbackBackend picks scp when the remote host has it and plain exec otherwise (caller must hold s.mu)
+func (s *Session) fallbackBackend() string {
+	if _, err := s.runRemoteOutput("command -v scp >/dev/null 2>&1"); err == nil {
+		return FileBackendSCP
+	}
+	return FileBackendExec
+}
+
+// remotePathType returns "dir", "file" or "" (missing) using exec (caller may hold s.mu)
+func (s *Session) remotePathType(remotePath string) (string, error) {
+	q := shellQuote(remotePath)
+	out, err := s.runRemoteOutput(fmt.Sprintf("if [ -d %s ]; then echo dir; elif [ -e %s ]; then echo file; fi", q, q))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// remoteExistingPaths returns the relative paths under dir that already exist on the remote host (caller may hold s.mu)
+func (s *Session) remoteExistingPaths(dir string, rels []string) ([]string, error) {
+	if len(rels) == 0 {
+		return nil, nil
+	}
+	script := "cd " + shellQuote(dir) + " 2>/dev/null || exit 0; " +
+		`while IFS= read -r f; do if [ -e "$f" ] || [ -L "$f" ]; then printf '%s\n' "$f"; fi; done`
+
+	var stdout bytes.Buffer
+	if err := s.runRemote(script, strings.NewReader(strings.Join(rels, "\n")+"\n"), &stdout); err != nil {
+		return nil, fmt.Errorf("check remote files: %w", err)
+	}
+	// 按行拆分，保留文件名中的空格
+	var existing []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line != "" {
+			existing = append(existing, line)
+		}
+	}
+	return existing, nil
+}
+
+// uploadPathFallback uploads a file or directory without SFTP (caller must hold s.mu)
+func (s *Session) uploadPathFallback(localPath, remotePath string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+	remotePath = path.Clean(remotePath)
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("stat local file: %w", err)}, err
+	}
+
+	// 与 SFTP 上传相同：目录内容放到 remotePath 下，单个文件写到 remotePath
+	var entries []archiveEntry
+	if info.IsDir() {
+		entries, err = collectArchiveEntries(localPath, newSyncFilter(opts.Include, opts.Exclude))
+		if err != nil {
+			return &FileTransferResult{Error: fmt.Errorf("walk local directory: %w", err)}, err
+		}
+	} else {
+		entries = []archiveEntry{{Rel: path.Base(remotePath), Path: localPath, Info: info}}
+		remotePath = path.Dir(remotePath)
+	}
+
+	if !opts.Overwrite {
+		var rels []string
+		for _, entry := range entries {
+			if !entry.Info.IsDir() {
+				rels = append(rels, entry.Rel)
+			}
+		}
+		existing, err := s.remoteExistingPaths(remotePath, rels)
+		if err != nil {
+			return &FileTransferResult{Error: err}, err
+		}
+		if len(existing) > 0 {
+			err := fmt.Errorf("remote file already exists: %s (use overwrite=true to overwrite)", path.Join(remotePath, existing[0]))
+			return &FileTransferResult{Error: err}, err
+		}
+	}
+	if info.IsDir() || opts.CreateDirs {
+		if err := s.runRemote("mkdir -p "+shellQuote(remotePath), nil, nil); err != nil {
+			err = fmt.Errorf("create remote directory: %w", err)
+			return &FileTransferResult{Error: err}, err
+		}
+	}
+
+	backend := s.fallbackBackend()
+	var bytesTransferred int64
+	var fileCount int
+	if backend == FileBackendSCP {
+		bytesTransferred, fileCount, err = s.scpUpload(remotePath, entries, opts, files)
+	} else {
+		bytesTransferred, fileCount, err = s.execUpload(remotePath, entries, opts, files)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s upload: %w", backend, err)
+		return &FileTransferResult{Error: err, Backend: backend}, err
+	}
+
+	result := fallbackTransferResult(localPath, "upload", backend, bytesTransferred, time.Since(startTime))
+	if info.IsDir() {
+		result.FilesTransferred = fileCount
+	} else {
+		result.FileSize = info.Size()
+	}
+	return result, nil
+}
+
+// downloadPathFallback downloads a file or directory without SFTP (caller must hold s.mu)
+func (s *Session) downloadPathFallback(remotePath, localPath string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+	remotePath = path.Clean(remotePath)
+
+	kind, err := s.remotePathType(remotePath)
+	if err != nil {
+		return &FileTransferResult{Error: fmt.Errorf("stat remote file: %w", err)}, err
+	}
+	if kind == "" {
+		err := fmt.Errorf("stat remote file: %s does not exist", remotePath)
+		return &FileTransferResult{Error: err}, err
+	}
+
+	if kind == "file" {
+		if _, err := os.Stat(localPath); err == nil && !opts.Overwrite {
+			err := fmt.Errorf("local file already exists: %s (use overwrite=true to overwrite)", localPath)
+			return &FileTransferResult{Error: err}, err
+		}
+		if opts.CreateDirs {
+			if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+				return &FileTransferResult{Error: fmt.Errorf("create local directory: %w", err)}, err
+			}
+		}
+	}
+
+	backend := s.fallbackBackend()
+	var bytesTransferred int64
+	var fileCount int
+	if backend == FileBackendSCP {
+		bytesTransferred, fileCount, err = s.scpDownload(remotePath, localPath, kind == "dir", opts, files)
+	} else {
+		bytesTransferred, fileCount, err = s.execDownload(remotePath, localPath, kind == "dir", opts, files)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s download: %w", backend, err)
+		return &FileTransferResult{Error: err, Backend: backend}, err
+	}
+
+	result := fallbackTransferResult(remotePath, "download", backend, bytesTransferred, time.Since(startTime))
+	if kind == "dir" {
+		result.FilesTransferred = fileCount
+	} else {
+		result.FileSize = bytesTransferred
+	}
+	return result, nil
+}
+
+// fallbackTransferResult builds the result of a transfer done without SFTP
+func fallbackTransferResult(filePath, operation, backend string, bytesTransferred int64, duration time.Duration) *FileTransferResult {
+	result := &FileTransferResult{
+		Status:           "success",
+		BytesTransferred: bytesTransferred,
+		Duration:         duration.String(),
+		Progress:         100.0,
+		FilePath:         filePath,
+		Operation:        operation,
+		Backend:          backend,
+	}
+	if duration.Seconds() > 0 {
+		result.Speed = formatBytes(float64(bytesTransferred)/duration.Seconds()) + "/s"
+	}
+	return result
+}
+
+// hashingReader returns r, teeing into a new hash when verification is enabled
+func hashingReader(r io.Reader, opts *TransferOptions) (io.Reader, hash.Hash) {
+	if !opts.Verify {
+		return r, nil
+	}
+	hasher, _ := newChecksumHash(opts.ChecksumAlgorithm)
+	return io.TeeReader(r, hasher), hasher
+}
+
+// scpTree is a directory of entries to send with the SCP protocol
+type scpTree struct {
+	dirs  map[string]bool     // 需要创建的目录（相对路径）
+	files map[string][]string // 目录 -> 其中的文件和子目录名
+}
+
+// buildSCPTree arranges entries into directories; parents of selected files are always included
+func buildSCPTree(entries []archiveEntry) *scpTree {
+	tree := &scpTree{dirs: map[string]bool{"": true}, files: map[string][]string{}}
+	var addDir func(rel string)
+	addDir = func(rel string) {
+		if tree.dirs[rel] {
+			return
+		}
+		tree.dirs[rel] = true
+		parent := path.Dir(rel)
+		if parent == "." {
+			parent = ""
+		}
+		addDir(parent)
+		tree.files[parent] = append(tree.files[parent], path.Base(rel))
+	}
+
+	for _, entry := range entries {
+		if entry.Info.IsDir() {
+			addDir(entry.Rel)
+			continue
+		}
+		parent := path.Dir(entry.Rel)
+		if parent == "." {
+			parent = ""
+		}
+		addDir(parent)
+		tree.files[parent] = append(tree.files[parent], path.Base(entry.Rel))
+	}
+	for dir := range tree.files {
+		sort.Strings(tree.files[dir])
+	}
+	return tree
+}
+
+// scpUpload sends entries to "scp -t" on the remote host (caller must hold s.mu)
+func (s *Session) scpUpload(remoteDir string, entries []archiveEntry, opts *TransferOptions, files *[]transferredFile) (int64, int, error) {
+	byRel := make(map[string]archiveEntry, len(entries))
+	for _, entry := range entries {
+		byRel[entry.Rel] = entry
+	}
+	tree := buildSCPTree(entries)
+
+	session, err := s.SSHClient.NewSession()
+	if err != nil {
+		return 0, 0, fmt.Errorf("create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := session.Start("scp -r -p -t " + shellQuote(remoteDir)); err != nil {
+		return 0, 0, fmt.Errorf("start remote scp: %w", err)
+	}
+
+	conn := &scpConn{w: stdin, r: bufio.NewReader(stdout)}
+	var total int64
+	var count int
+
+	var send func(dir string) error
+	send = func(dir string) error {
+		for _, name := range tree.files[dir] {
+			rel := path.Join(dir, name)
+			if strings.ContainsAny(name, "\n\r") {
+				return fmt.Errorf("file name not supported by scp: %q", rel)
+			}
+
+			if tree.dirs[rel] {
+				mode := os.FileMode(0755)
+				if entry, ok := byRel[rel]; ok {
+					mode = entry.Info.Mode().Perm()
+				}
+				if err := conn.command(fmt.Sprintf("D%04o 0 %s\n", mode, name)); err != nil {
+					return err
+				}
+				if err := send(rel); err != nil {
+					return err
+				}
+				if err := conn.command("E\n"); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// 与 SFTP 上传一致：符号链接上传其指向的内容
+			entry := byRel[rel]
+			info, err := os.Stat(entry.Path)
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			n, err := conn.sendFile(entry.Path, name, info, opts, path.Join(remoteDir, rel), files)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rel, err)
+			}
+			total += n
+			count++
+		}
+		return nil
+	}
+
+	sendErr := send("")
+	stdin.Close()
+	waitErr := session.Wait()
+	if sendErr == nil {
+		sendErr = waitErr
+	}
+	if sendErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			sendErr = fmt.Errorf("%w: %s", sendErr, msg)
+		}
+		return total, count, sendErr
+	}
+	return total, count, nil
+}
+
+// scpConn speaks the SCP protocol over the stdin/stdout of a remote scp process
+type scpConn struct {
+	w io.Writer
+	r *bufio.Reader
+}
+
+// readAck reads the status byte sent by the peer after each command
+func (c *scpConn) readAck() error {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("read scp response: %w", err)
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := c.r.ReadString('\n')
+	return fmt.Errorf("remote scp: %s", strings.TrimSpace(msg))
+}
+
+// command sends a protocol line and waits for the acknowledgement
+func (c *scpConn) command(line string) error {
+	if _, err := io.WriteString(c.w, line); err != nil {
+		return err
+	}
+	return c.readAck()
+}
+
+// sendFile sends a T (times) and C (file) record followed by the file content
+func (c *scpConn) sendFile(localPath, name string, info os.FileInfo, opts *TransferOptions, remoteFile string, files *[]transferredFile) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	mtime := info.ModTime().Unix()
+	if err := c.command(fmt.Sprintf("T%d 0 %d 0\n", mtime, mtime)); err != nil {
+		return 0, err
+	}
+	if err := c.command(fmt.Sprintf("C%04o %d %s\n", info.Mode().Perm(), info.Size(), name)); err != nil {
+		return 0, err
+	}
+
+	source, hasher := hashingReader(io.LimitReader(f, info.Size()), opts)
+	n, err := io.Copy(c.w, source)
+	if err != nil {
+		return n, err
+	}
+	if n != info.Size() {
+		return n, fmt.Errorf("file changed during transfer: sent %d of %d bytes", n, info.Size())
+	}
+	if err := c.command("\x00"); err != nil {
+		return n, err
+	}
+
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  localPath,
+			RemotePath: remoteFile,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+	return n, nil
+}
+
+// scpDownload receives a file or directory from "scp -f" on the remote host (caller must hold s.mu)
+func (s *Session) scpDownload(remotePath, localPath string, isDir bool, opts *TransferOptions, files *[]transferredFile) (int64, int, error) {
+	filter := newSyncFilter(opts.Include, opts.Exclude)
+	lazyDirs := len(filter.includes) > 0
+
+	session, err := s.SSHClient.NewSession()
+	if err != nil {
+		return 0, 0, fmt.Errorf("create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := session.Start("scp -r -p -f " + shellQuote(remotePath)); err != nil {
+		return 0, 0, fmt.Errorf("start remote scp: %w", err)
+	}
+
+	conn := &scpConn{w: stdin, r: bufio.NewReader(stdout)}
+	var total int64
+	var count int
+
+	receiveErr := func() error {
+		// stack[0] 为 remotePath 本身对应的本地目录；skipDepth > 0 表示正在跳过被排除的目录
+		var stack []string
+		skipDepth := 0
+		var mtime time.Time
+
+		if err := conn.ack(); err != nil {
+			return err
+		}
+		for {
+			line, err := conn.r.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("read scp record: %w", err)
+			}
+			if line[0] == 1 || line[0] == 2 {
+				return fmt.Errorf("remote scp: %s", strings.TrimSpace(line[1:]))
+			}
+			record := strings.TrimSuffix(line, "\n")
+
+			switch record[0] {
+			case 'T':
+				fields := strings.Fields(record[1:])
+				if len(fields) >= 1 {
+					if sec, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+						mtime = time.Unix(sec, 0)
+					}
+				}
+
+			case 'D':
+				mode, _, name, err := parseSCPRecord(record)
+				if err != nil {
+					return err
+				}
+				if skipDepth > 0 {
+					skipDepth++
+					break
+				}
+				target := localPath
+				if len(stack) > 0 {
+					target = filepath.Join(stack[len(stack)-1], name)
+					rel, _ := filepath.Rel(localPath, target)
+					if filter.excluded(filepath.ToSlash(rel), true) {
+						skipDepth = 1
+						break
+					}
+				}
+				if !lazyDirs || len(stack) == 0 {
+					if err := os.MkdirAll(target, 0755); err != nil {
+						return err
+					}
+					os.Chmod(target, mode.Perm()|0700)
+				}
+				stack = append(stack, target)
+
+			case 'E':
+				if skipDepth > 0 {
+					skipDepth--
+				} else if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+
+			case 'C':
+				mode, size, name, err := parseSCPRecord(record)
+				if err != nil {
+					return err
+				}
+				target := localPath
+				if len(stack) > 0 {
+					target = filepath.Join(stack[len(stack)-1], name)
+				}
+				rel, _ := filepath.Rel(localPath, target)
+				skip := skipDepth > 0 || (isDir && !filter.selected(filepath.ToSlash(rel)))
+
+				if err := conn.ack(); err != nil {
+					return err
+				}
+				var n int64
+				if skip {
+					_, err = io.CopyN(io.Discard, conn.r, size)
+				} else {
+					n, err = receiveSCPFile(conn.r, target, size, mode, mtime, opts, path.Join(remotePath, filepath.ToSlash(rel)), files)
+					total += n
+					count++
+				}
+				if err != nil {
+					return err
+				}
+				if err := conn.readAck(); err != nil {
+					return err
+				}
+				mtime = time.Time{}
+
+			default:
+				return fmt.Errorf("unexpected scp record: %q", record)
+			}
+
+			if err := conn.ack(); err != nil {
+				return err
+			}
+		}
+	}()
+
+	stdin.Close()
+	if receiveErr != nil {
+		io.Copy(io.Discard, stdout)
+	}
+	waitErr := session.Wait()
+	if receiveErr == nil {
+		receiveErr = waitErr
+	}
+	if receiveErr != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			receiveErr = fmt.Errorf("%w: %s", receiveErr, msg)
+		}
+		return total, count, receiveErr
+	}
+	return total, count, nil
+}
+
+// ack sends a success status byte to the peer
+func (c *scpConn) ack() error {
+	_, err := c.w.Write([]byte{0})
+	return err
+}
+
+// parseSCPRecord parses a "C0644 123 name" or "D0755 0 name" record
+func parseSCPRecord(record string) (os.FileMode, int64, string, error) {
+	parts := strings.SplitN(record[1:], " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid scp record: %q", record)
+	}
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid scp record: %q", record)
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("invalid scp record: %q", record)
+	}
+	name := parts[2]
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return 0, 0, "", fmt.Errorf("unsafe file name in scp record: %q", name)
+	}
+	return os.FileMode(mode), size, name, nil
+}
+
+// receiveSCPFile writes size bytes from r to target
+func receiveSCPFile(r io.Reader, target string, size int64, mode os.FileMode, mtime time.Time, opts *TransferOptions, remoteFile string, files *[]transferredFile) (int64, error) {
+	if _, err := os.Stat(target); err == nil && !opts.Overwrite {
+		return 0, fmt.Errorf("local file already exists: %s (use overwrite=true to overwrite)", target)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return 0, err
+	}
+	source, hasher := hashingReader(io.LimitReader(r, size), opts)
+	n, err := io.Copy(f, source)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if !mtime.IsZero() {
+		os.Chtimes(target, mtime, mtime)
+	}
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  target,
+			RemotePath: remoteFile,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+	return n, nil
+}
+
+// execUpload writes each file with "cat >" over its own exec channel (caller must hold s.mu)
+func (s *Session) execUpload(remoteDir string, entries []archiveEntry, opts *TransferOptions, files *[]transferredFile) (int64, int, error) {
+	tree := buildSCPTree(entries)
+	var dirs []string
+	for dir := range tree.dirs {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) > 0 {
+		sort.Strings(dirs)
+		script := "cd " + shellQuote(remoteDir) + ` && while IFS= read -r d; do mkdir -p "$d" || exit 1; done`
+		if err := s.runRemote(script, strings.NewReader(strings.Join(dirs, "\n")+"\n"), nil); err != nil {
+			return 0, 0, fmt.Errorf("create remote directories: %w", err)
+		}
+	}
+
+	var total int64
+	var count int
+	for _, entry := range entries {
+		if entry.Info.IsDir() {
+			continue
+		}
+		f, err := os.Open(entry.Path)
+		if err != nil {
+			return total, count, err
+		}
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			f.Close()
+			continue
+		}
+
+		remoteFile := path.Join(remoteDir, entry.Rel)
+		counter := &countingReader{r: f}
+		source, hasher := hashingReader(counter, opts)
+		err = s.runRemote("cat > "+shellQuote(remoteFile), source, nil)
+		f.Close()
+		if err != nil {
+			return total, count, fmt.Errorf("%s: %w", entry.Rel, err)
+		}
+		total += counter.n
+		count++
+
+		if hasher != nil {
+			*files = append(*files, transferredFile{
+				LocalPath:  entry.Path,
+				RemotePath: remoteFile,
+				Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+			})
+		}
+	}
+	return total, count, nil
+}
+
+// execDownload reads each file with "cat" over its own exec channel (caller must hold s.mu)
+func (s *Session) execDownload(remotePath, localPath string, isDir bool, opts *TransferOptions, files *[]transferredFile) (int64, int, error) {
+	if !isDir {
+		n, err := s.execDownloadFile(remotePath, localPath, opts, files)
+		return n, 1, err
+	}
+
+	filter := newSyncFilter(opts.Include, opts.Exclude)
+	lazyDirs := len(filter.includes) > 0
+
+	listing, err := s.runRemoteOutput("cd " + shellQuote(remotePath) + " && find . -type d && echo && find . -type f")
+	if err != nil {
+		return 0, 0, fmt.Errorf("list remote directory: %w", err)
+	}
+	dirList, fileList, _ := strings.Cut(listing, "\n\n")
+
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return 0, 0, err
+	}
+	if !lazyDirs {
+		for _, line := range strings.Split(dirList, "\n") {
+			rel := strings.TrimPrefix(line, "./")
+			if line == "" || line == "." || filter.excluded(rel, true) {
+				continue
+			}
+			if _, err := safeArchivePath(rel); err != nil {
+				return 0, 0, err
+			}
+			if err := os.MkdirAll(filepath.Join(localPath, filepath.FromSlash(rel)), 0755); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	var total int64
+	var count int
+	for _, line := range strings.Split(fileList, "\n") {
+		rel := strings.TrimPrefix(line, "./")
+		if line == "" || !filter.selected(rel) {
+			continue
+		}
+		if _, err := safeArchivePath(rel); err != nil {
+			return total, count, err
+		}
+		n, err := s.execDownloadFile(path.Join(remotePath, rel), filepath.Join(localPath, filepath.FromSlash(rel)), opts, files)
+		if err != nil {
+			return total, count, fmt.Errorf("%s: %w", rel, err)
+		}
+		total += n
+		count++
+	}
+	return total, count, nil
+}
+
+// execDownloadFile downloads a single file with "cat" (caller must hold s.mu)
+func (s *Session) execDownloadFile(remoteFile, localFile string, opts *TransferOptions, files *[]transferredFile) (int64, error) {
+	if _, err := os.Stat(localFile); err == nil && !opts.Overwrite {
+		return 0, fmt.Errorf("local file already exists: %s (use overwrite=true to overwrite)", localFile)
+	}
+	if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(localFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	counter := &countingWriter{w: f}
+	var dest io.Writer = counter
+	var hasher hash.Hash
+	if opts.Verify {
+		hasher, _ = newChecksumHash(opts.ChecksumAlgorithm)
+		dest = io.MultiWriter(counter, hasher)
+	}
+
+	err = s.runRemote("cat "+shellQuote(remoteFile), nil, dest)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return counter.n, err
+	}
+
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  localFile,
+			RemotePath: remoteFile,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+	return counter.n, nil
+}
+
+// listDirectoryExec lists a remote directory by parsing "ls -lan" output (caller may hold s.mu)
+func (s *Session) listDirectoryExec(remotePath string, recursive bool) ([]FileInfo, error) {
+	flags := "-lan"
+	if recursive {
+		flags = "-lanR"
+	}
+	out, err := s.runRemoteOutput("LC_ALL=C ls " + flags + " " + shellQuote(remotePath))
+	if err != nil {
+		return nil, fmt.Errorf("read remote directory: %w", err)
+	}
+	return parseLsOutput(out, time.Now()), nil
+}
+
+// parseLsOutput parses "ls -lan" (optionally -R) output into file infos
+func parseLsOutput(output string, now time.Time) []FileInfo {
+	var files []FileInfo
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "total ") || strings.HasSuffix(line, ":") && !strings.Contains(line, " ") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 8 || len(fields[0]) < 10 {
+			continue
+		}
+		mode, ok := parseLsMode(fields[0])
+		if !ok {
+			continue
+		}
+
+		// 设备文件的大小列为 "主设备号, 次设备号"
+		idx := 4
+		if strings.HasSuffix(fields[idx], ",") {
+			idx++
+		}
+		if len(fields) < idx+5 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[idx], 10, 64)
+		modified := parseLsTime(fields[idx+1], fields[idx+2], fields[idx+3], now)
+
+		// 文件名可能包含空格：取第 idx+4 个字段之后的原始文本
+		name := lsFieldRest(line, idx+4)
+		if mode&os.ModeSymlink != 0 {
+			if i := strings.Index(name, " -> "); i >= 0 {
+				name = name[:i]
+			}
+		}
+		if name == "." || name == ".." {
+			continue
+		}
+
+		files = append(files, FileInfo{
+			Name:     name,
+			Type:     fileTypeFromMode(mode),
+			Size:     size,
+			Mode:     mode.String(),
+			Modified: modified,
+		})
+	}
+	return files
+}
+
+// lsFieldRest returns the text of line starting at the n-th whitespace-separated field
+func lsFieldRest(line string, n int) string {
+	rest := line
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return ""
+		}
+		rest = rest[end:]
+	}
+	// 只去掉一个分隔空格，保留文件名开头的空格
+	return strings.TrimPrefix(strings.TrimLeft(rest, "\t"), " ")
+}
+
+// parseLsMode parses a mode string such as "drwxr-sr-x" or "lrwxrwxrwx"
+func parseLsMode(s string) (os.FileMode, bool) {
+	var mode os.FileMode
+	switch s[0] {
+	case '-':
+	case 'd':
+		mode |= os.ModeDir
+	case 'l':
+		mode |= os.ModeSymlink
+	case 'c':
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 'b':
+		mode |= os.ModeDevice
+	case 'p':
+		mode |= os.ModeNamedPipe
+	case 's':
+		mode |= os.ModeSocket
+	default:
+		return 0, false
+	}
+
+	perms := s[1:10]
+	for i, c := range perms {
+		bit := os.FileMode(1) << uint(8-i)
+		switch c {
+		case 'r', 'w', 'x':
+			mode |= bit
+		case 's':
+			mode |= bit
+			fallthrough
+		case 'S':
+			if i == 2 {
+				mode |= os.ModeSetuid
+			} else if i == 5 {
+				mode |= os.ModeSetgid
+			}
+		case 't':
+			mode |= bit
+			fallthrough
+		case 'T':
+			mode |= os.ModeSticky
+		case '-':
+		default:
+			return 0, false
+		}
+	}
+	return mode, true
+}
+
+// parseLsTime parses the "Jan 2 15:04" or "Jan 2 2006" date columns of ls output
+func parseLsTime(month, day, clockOrYear string, now time.Time) time.Time {
+	if strings.Contains(clockOrYear, ":") {
+		t, err := time.ParseInLocation("Jan 2 2006 15:04", fmt.Sprintf("%s %s %d %s", month, day, now.Year(), clockOrYear), now.Location())
+		if err != nil {
+			return time.Time{}
+		}
+		// ls 对半年内的文件只显示时间；日期在未来说明是去年的
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t
+	}
+	t, err := time.ParseInLocation("Jan 2 2006", fmt.Sprintf("%s %s %s", month, day, clockOrYear), now.Location())
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// fileTypeFromMode returns the file type as a string
+func fileTypeFromMode(mode os.FileMode) string {
+	if mode.IsDir() {
+		return "directory"
+	}
+	if mode&os.ModeSymlink != 0 {
+		return "symlink"
+	}
+	return "file"
+}
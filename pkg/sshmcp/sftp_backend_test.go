@@ -0,0 +1,78 @@
+package sshmcp
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseLsOutput tests parsing of ls -lan output used when SFTP is unavailable
+func TestParseLsOutput(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	output := "total 16\n" +
+		"drwxr-xr-x  3 0 0 4096 Mar  9 08:15 .\n" +
+		"drwxr-xr-x 10 0 0 4096 Jan  1  2023 ..\n" +
+		"-rw-r--r--  1 0 0  123 Dec 31 23:59 old.txt\n" +
+		"-rwsr-xr-x  1 0 0  999 Mar  9 08:15 with space.sh\n" +
+		"lrwxrwxrwx  1 0 0    7 Mar  9 08:15 link -> old.txt\n" +
+		"crw-rw-rw-  1 0 0 1, 3 Mar  9 08:15 null\n" +
+		"drwxrwxrwt  2 0 0 4096 Jun  5  2022 tmp\n" +
+		"\n" +
+		"./tmp:\n" +
+		"total 0\n"
+
+	files := parseLsOutput(output, now)
+	require.Len(t, files, 5)
+
+	assert.Equal(t, "old.txt", files[0].Name)
+	assert.Equal(t, int64(123), files[0].Size)
+	assert.Equal(t, time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC), files[0].Modified)
+
+	assert.Equal(t, "with space.sh", files[1].Name)
+	assert.Equal(t, (os.ModeSetuid | 0755).String(), files[1].Mode)
+
+	assert.Equal(t, "link", files[2].Name)
+	assert.Equal(t, "symlink", files[2].Type)
+
+	assert.Equal(t, "null", files[3].Name)
+	assert.Equal(t, "file", files[3].Type)
+
+	assert.Equal(t, "tmp", files[4].Name)
+	assert.Equal(t, "directory", files[4].Type)
+	assert.Equal(t, (os.ModeDir | os.ModeSticky | 0777).String(), files[4].Mode)
+	assert.Equal(t, time.Date(2022, 6, 5, 0, 0, 0, 0, time.UTC), files[4].Modified)
+}
+
+// TestParseSCPRecord tests parsing and validation of SCP C/D records
+func TestParseSCPRecord(t *testing.T) {
+	mode, size, name, err := parseSCPRecord("C0644 1234 file name.txt")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), mode)
+	assert.Equal(t, int64(1234), size)
+	assert.Equal(t, "file name.txt", name)
+
+	for _, record := range []string{"C0644 12", "Cxyz 1 a", "C0644 -1 a", "D0755 0 ..", "C0644 1 ../x", "D0755 0 a/b"} {
+		_, _, _, err := parseSCPRecord(record)
+		assert.Error(t, err, record)
+	}
+}
+
+// TestBuildSCPTree tests that parents of selected files are sent as directories
+func TestBuildSCPTree(t *testing.T) {
+	entries := []archiveEntry{
+		{Rel: "a.txt", Info: fakeFileInfo{name: "a.txt"}},
+		{Rel: "x/y/z.txt", Info: fakeFileInfo{name: "z.txt"}},
+		{Rel: "empty", Info: fakeFileInfo{name: "empty", mode: os.ModeDir | 0755}},
+	}
+	tree := buildSCPTree(entries)
+
+	assert.Equal(t, []string{"a.txt", "empty", "x"}, tree.files[""])
+	assert.Equal(t, []string{"y"}, tree.files["x"])
+	assert.Equal(t, []string{"z.txt"}, tree.files["x/y"])
+	assert.True(t, tree.dirs["x/y"])
+	assert.True(t, tree.dirs["empty"])
+	assert.False(t, tree.dirs["a.txt"])
+}
@@ -0,0 +1,160 @@
+package sshmcp
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultChecksumAlgorithm is the algorithm used when none is specified
+const DefaultChecksumAlgorithm = "sha256"
+
+// checksumToolCommands lists the remote commands that can compute each algorithm, in order of preference
+var checksumToolCommands = map[string][]string{
+	"sha256": {"sha256sum", "shasum -a 256", "openssl dgst -sha256 -r"},
+	"sha1":   {"sha1sum", "shasum -a 1", "openssl dgst -sha1 -r"},
+	"sha512": {"sha512sum", "shasum -a 512", "openssl dgst -sha512 -r"},
+	"md5":    {"md5sum", "openssl dgst -md5 -r"},
+}
+
+// checksumHexPattern matches the leading hex digest in checksum tool output
+var checksumHexPattern = regexp.MustCompile(`^[0-9a-fA-F]+`)
+
+// normalizeChecksumAlgorithm returns the canonical algorithm name
+func normalizeChecksumAlgorithm(algorithm string) string {
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	algorithm = strings.ReplaceAll(algorithm, "-", "")
+	if algorithm == "" {
+		return DefaultChecksumAlgorithm
+	}
+	return algorithm
+}
+
+// newChecksumHash creates a hash for the given algorithm
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch normalizeChecksumAlgorithm(algorithm) {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s (supported: sha256, sha1, sha512, md5)", algorithm)
+	}
+}
+
+// shellQuote quotes a string for safe use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteChecksumCommand builds a shell command that hashes remotePath with the first available tool
+func remoteChecksumCommand(algorithm, remotePath string) (string, error) {
+	tools, ok := checksumToolCommands[normalizeChecksumAlgorithm(algorithm)]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm: %s", algorithm)
+	}
+
+	var cmd strings.Builder
+	for i, tool := range tools {
+		binary := strings.Fields(tool)[0]
+		if i == 0 {
+			cmd.WriteString("if ")
+		} else {
+			cmd.WriteString("elif ")
+		}
+		// 从标准输入读取：输出中不带文件名，sha256sum 不会因文件名含 \ 或换行而转义输出
+		fmt.Fprintf(&cmd, "command -v %s >/dev/null 2>&1; then %s < %s; ", binary, tool, shellQuote(remotePath))
+	}
+	cmd.WriteString("else echo 'no checksum tool available' >&2; exit 127; fi")
+
+	return cmd.String(), nil
+}
+
+// parseChecksumOutput extracts the hex digest from sha256sum/shasum/openssl output.
+// GNU tools prefix the line with "\" when they escape the file name.
+func parseChecksumOutput(output string) (string, error) {
+	digest := checksumHexPattern.FindString(strings.TrimPrefix(strings.TrimSpace(output), `\`))
+	if digest == "" {
+		return "", fmt.Errorf("unexpected checksum output: %q", strings.TrimSpace(output))
+	}
+	return strings.ToLower(digest), nil
+}
+
+// RemoteChecksum computes the checksum of a remote file using sha256sum, shasum or openssl
+func (s *Session) RemoteChecksum(remotePath, algorithm string) (string, error) {
+	cmd, err := remoteChecksumCommand(algorithm, remotePath)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := s.ExecuteCommand(cmd, 5*time.Minute)
+	if err != nil {
+		return "", fmt.Errorf("compute remote checksum: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("compute remote checksum (exit %d): %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+
+	return parseChecksumOutput(result.Stdout)
+}
+
+// verifyTransferredFiles compares local checksums with remote ones and handles mismatches
+func (s *Session) verifyTransferredFiles(files []transferredFile, opts *TransferOptions, operation string) error {
+	algorithm := normalizeChecksumAlgorithm(opts.ChecksumAlgorithm)
+
+	for _, file := range files {
+		remoteSum, err := s.RemoteChecksum(file.RemotePath, algorithm)
+		if err != nil {
+			return err
+		}
+		if remoteSum == file.Checksum {
+			continue
+		}
+
+		// 校验失败：根据配置决定是否删除损坏的目标文件
+		mismatchErr := fmt.Errorf("checksum mismatch for %s (%s): local %s, remote %s", file.RemotePath, algorithm, file.Checksum, remoteSum)
+		if opts.KeepOnMismatch {
+			return mismatchErr
+		}
+
+		var removeErr error
+		if operation == "upload" {
+			s.mu.Lock()
+			if s.ensureSFTP() == nil {
+				removeErr = s.SFTPClient.Remove(file.RemotePath)
+			} else {
+				removeErr = s.runRemote("rm -f "+shellQuote(file.RemotePath), nil, nil)
+			}
+			s.mu.Unlock()
+		} else {
+			removeErr = os.Remove(file.LocalPath)
+		}
+		if removeErr != nil {
+			return fmt.Errorf("%w (failed to delete bad copy: %v)", mismatchErr, removeErr)
+		}
+		return fmt.Errorf("%w (bad copy deleted)", mismatchErr)
+	}
+
+	return nil
+}
+
+// markVerified records successful verification on the transfer result
+func markVerified(result *FileTransferResult, files []transferredFile, opts *TransferOptions) {
+	result.Verified = true
+	result.VerifiedFiles = len(files)
+	result.ChecksumAlgorithm = normalizeChecksumAlgorithm(opts.ChecksumAlgorithm)
+	if len(files) == 1 {
+		result.Checksum = files[0].Checksum
+	}
+}
@@ -0,0 +1,81 @@
+package sshmcp
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewChecksumHash tests algorithm selection
+func TestNewChecksumHash(t *testing.T) {
+	for _, algo := range []string{"", "sha256", "SHA-256", "sha1", "sha512", "md5"} {
+		h, err := newChecksumHash(algo)
+		require.NoError(t, err, algo)
+		assert.NotNil(t, h)
+	}
+
+	_, err := newChecksumHash("crc32")
+	assert.Error(t, err)
+}
+
+// TestParseChecksumOutput tests parsing of sha256sum/shasum/openssl output formats
+func TestParseChecksumOutput(t *testing.T) {
+	const digest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	for _, output := range []string{
+		digest + "  /tmp/hello.txt\n",      // sha256sum / shasum
+		digest + " */tmp/hello.txt\n",      // openssl dgst -r
+		"  " + digest + "  /tmp/hello.txt", // leading whitespace
+		`\` + digest + `  /tmp/a\\b.txt`,   // escaped file name
+		digest + "  -\n",                   // stdin
+		digest + " *stdin\n",               // openssl dgst -r from stdin
+	} {
+		got, err := parseChecksumOutput(output)
+		require.NoError(t, err)
+		assert.Equal(t, digest, got)
+	}
+
+	_, err := parseChecksumOutput("sha256sum: /tmp/missing: No such file or directory")
+	assert.Error(t, err)
+}
+
+// TestShellQuote tests quoting of paths with special characters
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "'/etc/nginx.conf'", shellQuote("/etc/nginx.conf"))
+	assert.Equal(t, `'it'\''s here'`, shellQuote("it's here"))
+}
+
+// TestRemoteChecksumCommand runs the generated command in a local shell
+func TestRemoteChecksumCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	path := filepath.Join(t.TempDir(), "it's a\\file\n.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+
+	for _, algo := range []string{"sha256", "md5"} {
+		cmd, err := remoteChecksumCommand(algo, path)
+		require.NoError(t, err)
+
+		out, err := exec.Command("sh", "-c", cmd).Output()
+		if err != nil {
+			t.Skipf("no %s tool available locally: %v", algo, err)
+		}
+
+		got, err := parseChecksumOutput(string(out))
+		require.NoError(t, err)
+
+		h, _ := newChecksumHash(algo)
+		h.Write([]byte("hello"))
+		assert.Equal(t, fmt.Sprintf("%x", h.Sum(nil)), got)
+	}
+
+	_, err := remoteChecksumCommand("crc32", path)
+	assert.Error(t, err)
+}
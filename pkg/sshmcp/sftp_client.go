@@ -2,6 +2,7 @@ package sshmcp
 
 import (
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -24,15 +25,73 @@ func formatBytes(bytes float64) string {
 	return fmt.Sprintf("%.1f %cB", bytes/float64(div), "KMGTPE"[exp])
 }
 
+// transferredFile records a transferred file and its local checksum for later verification
+type transferredFile struct {
+	LocalPath  string
+	RemotePath string
+	Checksum   string
+}
+
 // UploadFile uploads a file to the remote host
 func (s *Session) UploadFile(localPath, remotePath string, createDirs, overwrite bool) (*FileTransferResult, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.UploadFileWithOptions(localPath, remotePath, &TransferOptions{
+		CreateDirs: createDirs,
+		Overwrite:  overwrite,
+	})
+}
 
+// UploadFileWithOptions uploads a file or directory to the remote host with custom options
+func (s *Session) UploadFileWithOptions(localPath, remotePath string, opts *TransferOptions) (*FileTransferResult, error) {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	if opts.Verify {
+		if _, err := newChecksumHash(opts.ChecksumAlgorithm); err != nil {
+			return &FileTransferResult{Error: err}, err
+		}
+	}
+
+	// 目录可以打包为单个 tar 流传输
+	if opts.Archive != "" {
+		if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+			return s.uploadArchive(localPath, remotePath, opts)
+		}
+	}
+
+	var files []transferredFile
+
+	s.mu.Lock()
 	s.LastUsedAt = time.Now()
+	var result *FileTransferResult
+	var err error
+	if s.ensureSFTP() != nil {
+		// SFTP 不可用时通过 scp 或 cat 传输
+		result, err = s.uploadPathFallback(localPath, remotePath, opts, &files)
+	} else {
+		result, err = s.uploadPath(localPath, remotePath, opts, &files)
+		if err == nil {
+			result.Backend = FileBackendSFTP
+		}
+	}
+	s.mu.Unlock()
 
-	startTime := time.Now()
+	if err != nil || !opts.Verify {
+		return result, err
+	}
+
+	// 校验需要执行远程命令，必须在释放会话锁之后进行
+	if err := s.verifyTransferredFiles(files, opts, "upload"); err != nil {
+		result.Status = "failed"
+		result.Error = err
+		return result, err
+	}
+	markVerified(result, files, opts)
 
+	return result, nil
+}
+
+// uploadPath uploads a file or directory (caller must hold s.mu)
+func (s *Session) uploadPath(localPath, remotePath string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
 	// 检查本地文件
 	fileInfo, err := os.Stat(localPath)
 	if err != nil {
@@ -41,14 +100,21 @@ func (s *Session) UploadFile(localPath, remotePath string, createDirs, overwrite
 
 	// 如果是目录，递归上传
 	if fileInfo.IsDir() {
-		return s.uploadDirectory(localPath, remotePath, createDirs, overwrite)
+		return s.uploadDirectory(localPath, remotePath, opts, files)
 	}
 
+	return s.uploadSingleFile(localPath, remotePath, fileInfo, opts.CreateDirs, opts, files)
+}
+
+// uploadSingleFile uploads a regular file (caller must hold s.mu)
+func (s *Session) uploadSingleFile(localPath, remotePath string, fileInfo os.FileInfo, createDirs bool, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+
 	// 检查远程文件是否存在
 	remoteFileExists := false
 	if fi, err := s.SFTPClient.Stat(remotePath); err == nil {
 		remoteFileExists = true
-		if !overwrite && fi != nil {
+		if !opts.Overwrite && fi != nil {
 			return &FileTransferResult{
 				Error: fmt.Errorf("remote file already exists: %s (use overwrite=true to overwrite)", remotePath),
 			}, fmt.Errorf("file exists")
@@ -72,7 +138,7 @@ func (s *Session) UploadFile(localPath, remotePath string, createDirs, overwrite
 
 	// 创建远程文件
 	var remoteFile *sftp.File
-	if remoteFileExists && overwrite {
+	if remoteFileExists && opts.Overwrite {
 		remoteFile, err = s.SFTPClient.OpenFile(remotePath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE)
 	} else {
 		remoteFile, err = s.SFTPClient.Create(remotePath)
@@ -82,12 +148,26 @@ func (s *Session) UploadFile(localPath, remotePath string, createDirs, overwrite
 	}
 	defer remoteFile.Close()
 
-	// 复制文件内容
-	bytesTransferred, err := io.Copy(remoteFile, localFile)
+	// 复制文件内容（开启校验时边传输边计算本地校验和）
+	var source io.Reader = localFile
+	var hasher hash.Hash
+	if opts.Verify {
+		hasher, _ = newChecksumHash(opts.ChecksumAlgorithm)
+		source = io.TeeReader(localFile, hasher)
+	}
+	bytesTransferred, err := io.Copy(remoteFile, source)
 	if err != nil {
 		return &FileTransferResult{Error: fmt.Errorf("copy file content: %w", err)}, err
 	}
 
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  localPath,
+			RemotePath: remotePath,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+
 	duration := time.Since(startTime)
 
 	// 计算传输速度
@@ -112,11 +192,16 @@ func (s *Session) UploadFile(localPath, remotePath string, createDirs, overwrite
 	}, nil
 }
 
-// uploadDirectory uploads a directory recursively
-func (s *Session) uploadDirectory(localPath, remotePath string, createDirs, overwrite bool) (*FileTransferResult, error) {
+// uploadDirectory uploads a directory recursively (caller must hold s.mu)
+func (s *Session) uploadDirectory(localPath, remotePath string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
 	var totalBytes int64
+	var fileCount int
 	startTime := time.Now()
 
+	// 设置了 include 时只创建包含被选中文件的目录
+	filter := newSyncFilter(opts.Include, opts.Exclude)
+	lazyDirs := len(filter.includes) > 0
+
 	// 遍历本地目录
 	err := filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -132,6 +217,12 @@ func (s *Session) uploadDirectory(localPath, remotePath string, createDirs, over
 		remoteFilePath := filepath.Join(remotePath, relPath)
 
 		if info.IsDir() {
+			if relPath != "." && filter.excluded(filepath.ToSlash(relPath), true) {
+				return filepath.SkipDir
+			}
+			if lazyDirs {
+				return nil
+			}
 			// 创建远程目录
 			if err := s.SFTPClient.MkdirAll(remoteFilePath); err != nil {
 				return fmt.Errorf("create remote directory %s: %w", remoteFilePath, err)
@@ -139,12 +230,17 @@ func (s *Session) uploadDirectory(localPath, remotePath string, createDirs, over
 			return nil
 		}
 
+		if !filter.selected(filepath.ToSlash(relPath)) {
+			return nil
+		}
+
 		// 上传文件
-		result, err := s.UploadFile(path, remoteFilePath, false, overwrite)
+		result, err := s.uploadSingleFile(path, remoteFilePath, info, lazyDirs, opts, files)
 		if err != nil {
 			return err
 		}
 		totalBytes += result.BytesTransferred
+		fileCount++
 
 		return nil
 	})
@@ -159,18 +255,80 @@ func (s *Session) uploadDirectory(localPath, remotePath string, createDirs, over
 		Status:           "success",
 		BytesTransferred: totalBytes,
 		Duration:         duration.String(),
+		FilePath:         localPath,
+		Operation:        "upload",
+		FilesTransferred: fileCount,
 	}, nil
 }
 
 // DownloadFile downloads a file from the remote host
 func (s *Session) DownloadFile(remotePath, localPath string, createDirs, overwrite bool) (*FileTransferResult, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.DownloadFileWithOptions(remotePath, localPath, &TransferOptions{
+		CreateDirs: createDirs,
+		Overwrite:  overwrite,
+	})
+}
 
+// DownloadFileWithOptions downloads a file or directory from the remote host with custom options
+func (s *Session) DownloadFileWithOptions(remotePath, localPath string, opts *TransferOptions) (*FileTransferResult, error) {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+	if opts.Verify {
+		if _, err := newChecksumHash(opts.ChecksumAlgorithm); err != nil {
+			return &FileTransferResult{Error: err}, err
+		}
+	}
+
+	if opts.Archive != "" {
+		s.mu.Lock()
+		isDir := false
+		if s.ensureSFTP() == nil {
+			info, err := s.SFTPClient.Stat(remotePath)
+			isDir = err == nil && info.IsDir()
+		} else {
+			kind, err := s.remotePathType(remotePath)
+			isDir = err == nil && kind == "dir"
+		}
+		s.mu.Unlock()
+		if isDir {
+			return s.downloadArchive(remotePath, localPath, opts)
+		}
+	}
+
+	var files []transferredFile
+
+	s.mu.Lock()
 	s.LastUsedAt = time.Now()
+	var result *FileTransferResult
+	var err error
+	if s.ensureSFTP() != nil {
+		result, err = s.downloadPathFallback(remotePath, localPath, opts, &files)
+	} else {
+		result, err = s.downloadPath(remotePath, localPath, opts, &files)
+		if err == nil {
+			result.Backend = FileBackendSFTP
+		}
+	}
+	s.mu.Unlock()
 
-	startTime := time.Now()
+	if err != nil || !opts.Verify {
+		return result, err
+	}
+
+	// 校验需要执行远程命令，必须在释放会话锁之后进行
+	if err := s.verifyTransferredFiles(files, opts, "download"); err != nil {
+		result.Status = "failed"
+		result.Error = err
+		return result, err
+	}
+	markVerified(result, files, opts)
 
+	return result, nil
+}
+
+// downloadPath downloads a file or directory (caller must hold s.mu)
+func (s *Session) downloadPath(remotePath, localPath string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
 	// 检查远程文件
 	fileInfo, err := s.SFTPClient.Stat(remotePath)
 	if err != nil {
@@ -179,14 +337,21 @@ func (s *Session) DownloadFile(remotePath, localPath string, createDirs, overwri
 
 	// 如果是目录，递归下载
 	if fileInfo.IsDir() {
-		return s.downloadDirectory(remotePath, localPath, createDirs, overwrite)
+		return s.downloadDirectory(remotePath, localPath, opts, files)
 	}
 
+	return s.downloadSingleFile(remotePath, localPath, fileInfo, opts.CreateDirs, opts, files)
+}
+
+// downloadSingleFile downloads a regular file (caller must hold s.mu)
+func (s *Session) downloadSingleFile(remotePath, localPath string, fileInfo os.FileInfo, createDirs bool, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+
 	// 检查本地文件是否存在
 	localFileExists := false
 	if _, err := os.Stat(localPath); err == nil {
 		localFileExists = true
-		if !overwrite {
+		if !opts.Overwrite {
 			return &FileTransferResult{
 				Error: fmt.Errorf("local file already exists: %s (use overwrite=true to overwrite)", localPath),
 			}, fmt.Errorf("file exists")
@@ -210,7 +375,7 @@ func (s *Session) DownloadFile(remotePath, localPath string, createDirs, overwri
 
 	// 创建本地文件
 	var localFile *os.File
-	if localFileExists && overwrite {
+	if localFileExists && opts.Overwrite {
 		localFile, err = os.OpenFile(localPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	} else {
 		localFile, err = os.Create(localPath)
@@ -220,12 +385,26 @@ func (s *Session) DownloadFile(remotePath, localPath string, createDirs, overwri
 	}
 	defer localFile.Close()
 
-	// 复制文件内容
-	bytesTransferred, err := io.Copy(localFile, remoteFile)
+	// 复制文件内容（开启校验时边传输边计算本地校验和）
+	var dest io.Writer = localFile
+	var hasher hash.Hash
+	if opts.Verify {
+		hasher, _ = newChecksumHash(opts.ChecksumAlgorithm)
+		dest = io.MultiWriter(localFile, hasher)
+	}
+	bytesTransferred, err := io.Copy(dest, remoteFile)
 	if err != nil {
 		return &FileTransferResult{Error: fmt.Errorf("copy file content: %w", err)}, err
 	}
 
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  localPath,
+			RemotePath: remotePath,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+
 	duration := time.Since(startTime)
 
 	// 计算传输速度
@@ -250,11 +429,16 @@ func (s *Session) DownloadFile(remotePath, localPath string, createDirs, overwri
 	}, nil
 }
 
-// downloadDirectory downloads a directory recursively
-func (s *Session) downloadDirectory(remotePath, localPath string, createDirs, overwrite bool) (*FileTransferResult, error) {
+// downloadDirectory downloads a directory recursively (caller must hold s.mu)
+func (s *Session) downloadDirectory(remotePath, localPath string, opts *TransferOptions, files *[]transferredFile) (*FileTransferResult, error) {
 	var totalBytes int64
+	var fileCount int
 	startTime := time.Now()
 
+	// 设置了 include 时只创建包含被选中文件的目录
+	filter := newSyncFilter(opts.Include, opts.Exclude)
+	lazyDirs := len(filter.includes) > 0
+
 	// 遍历远程目录
 	walker := s.SFTPClient.Walk(remotePath)
 	for walker.Step() {
@@ -274,6 +458,13 @@ func (s *Session) downloadDirectory(remotePath, localPath string, createDirs, ov
 		localFilePath := filepath.Join(localPath, relPath)
 
 		if info.IsDir() {
+			if relPath != "." && filter.excluded(filepath.ToSlash(relPath), true) {
+				walker.SkipDir()
+				continue
+			}
+			if lazyDirs {
+				continue
+			}
 			// 创建本地目录
 			if err := os.MkdirAll(localFilePath, 0755); err != nil {
 				return &FileTransferResult{Error: fmt.Errorf("create local directory %s: %w", localFilePath, err)}, err
@@ -281,12 +472,17 @@ func (s *Session) downloadDirectory(remotePath, localPath string, createDirs, ov
 			continue
 		}
 
+		if !filter.selected(filepath.ToSlash(relPath)) {
+			continue
+		}
+
 		// 下载文件
-		result, err := s.DownloadFile(path, localFilePath, false, overwrite)
+		result, err := s.downloadSingleFile(path, localFilePath, info, lazyDirs, opts, files)
 		if err != nil {
 			return &FileTransferResult{Error: err}, err
 		}
 		totalBytes += result.BytesTransferred
+		fileCount++
 	}
 
 	duration := time.Since(startTime)
@@ -295,6 +491,9 @@ func (s *Session) downloadDirectory(remotePath, localPath string, createDirs, ov
 		Status:           "success",
 		BytesTransferred: totalBytes,
 		Duration:         duration.String(),
+		FilePath:         remotePath,
+		Operation:        "download",
+		FilesTransferred: fileCount,
 	}, nil
 }
 
@@ -305,6 +504,10 @@ func (s *Session) ListDirectory(remotePath string, recursive bool) ([]FileInfo,
 
 	s.LastUsedAt = time.Now()
 
+	if s.ensureSFTP() != nil {
+		return s.listDirectoryExec(remotePath, recursive)
+	}
+
 	var files []FileInfo
 
 	if recursive {
@@ -356,13 +559,7 @@ func (s *Session) ListDirectory(remotePath string, recursive bool) ([]FileInfo,
 
 // getFileType returns the file type as a string
 func getFileType(info os.FileInfo) string {
-	if info.IsDir() {
-		return "directory"
-	}
-	if info.Mode()&os.ModeSymlink != 0 {
-		return "symlink"
-	}
-	return "file"
+	return fileTypeFromMode(info.Mode())
 }
 
 // MakeDirectory creates a remote directory
@@ -371,6 +568,9 @@ func (s *Session) MakeDirectory(remotePath string, recursive bool, mode os.FileM
 	defer s.mu.Unlock()
 
 	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return err
+	}
 
 	if recursive {
 		return s.SFTPClient.MkdirAll(remotePath)
@@ -385,6 +585,9 @@ func (s *Session) RemoveFile(remotePath string, recursive bool) error {
 	defer s.mu.Unlock()
 
 	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return err
+	}
 
 	// 检查文件类型
 	info, err := s.SFTPClient.Stat(remotePath)
@@ -410,6 +613,9 @@ func (s *Session) GetFileInfo(remotePath string) (*FileInfo, error) {
 	defer s.mu.Unlock()
 
 	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return nil, err
+	}
 
 	info, err := s.SFTPClient.Stat(remotePath)
 	if err != nil {
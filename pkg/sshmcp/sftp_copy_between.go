@@ -0,0 +1,452 @@
+package sshmcp
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirectCopyTimeout limits how long a direct rsync/scp between two hosts may run
+const DirectCopyTimeout = 2 * time.Hour
+
+// Copy methods reported in FileTransferResult.Method
+const (
+	CopyMethodStream = "stream" // 经 MCP 服务器中转
+	CopyMethodRsync  = "rsync"
+	CopyMethodScp    = "scp"
+)
+
+// CopyOptions configures CopyBetweenSessions
+type CopyOptions struct {
+	TransferOptions
+
+	// Direct 让源主机通过 rsync（或 scp）直接推送到目标主机，需要源主机能以非交互方式
+	// （密钥/agent）登录目标主机；失败时回退为经本机中转
+	Direct     bool
+	DirectHost string // 源主机访问目标主机使用的地址，默认为目标会话的主机地址
+
+	// AcceptNewHostKey 让源主机信任并记住目标主机未知的主机密钥（StrictHostKeyChecking=accept-new）。
+	// 默认只接受源主机 known_hosts 中已有的密钥，未知时直接复制失败并回退为中转
+	AcceptNewHostKey bool
+
+	// Progress 在中转复制过程中被调用，报告已复制字节数和总字节数
+	Progress func(copied, total int64)
+}
+
+// copyEntry is a file, directory or symlink to copy between sessions
+type copyEntry struct {
+	Rel  string // "/" 分隔的相对路径，单个文件时为空
+	Info os.FileInfo
+}
+
+// CopyBetweenSessions copies a file or directory from one session to another.
+// Data is streamed through this process unless a direct copy is requested and succeeds.
+func CopyBetweenSessions(src *Session, srcPath string, dst *Session, dstPath string, opts *CopyOptions) (*FileTransferResult, error) {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	if opts.Verify {
+		if _, err := newChecksumHash(opts.ChecksumAlgorithm); err != nil {
+			return &FileTransferResult{Error: err}, err
+		}
+	}
+	srcPath, dstPath = path.Clean(srcPath), path.Clean(dstPath)
+	if src == dst && srcPath == dstPath {
+		err := fmt.Errorf("source and destination are the same path")
+		return &FileTransferResult{Error: err}, err
+	}
+
+	unlock := lockSessionPair(src, dst)
+	entries, total, err := planSessionCopy(src, srcPath, dst, dstPath, opts)
+	unlock()
+	if err != nil {
+		return &FileTransferResult{Error: err}, err
+	}
+
+	var result *FileTransferResult
+	fallback := ""
+	if opts.Direct {
+		// 直接复制需要执行远程命令，不能持有会话锁
+		result, err = directSessionCopy(src, srcPath, dst, dstPath, opts, entries, total)
+		if err != nil {
+			fallback = fmt.Sprintf("direct copy failed (%v), streamed through the MCP server", err)
+			result = nil
+		}
+	}
+
+	var files []transferredFile
+	if result == nil {
+		unlock := lockSessionPair(src, dst)
+		result, err = streamSessionCopy(src, srcPath, dst, dstPath, opts, entries, total, &files)
+		unlock()
+		if err != nil {
+			return &FileTransferResult{Error: err, Fallback: fallback}, err
+		}
+		result.Fallback = fallback
+	} else if opts.Verify {
+		// 直接复制时由源主机计算校验和
+		for _, entry := range entries {
+			if !entry.Info.Mode().IsRegular() {
+				continue
+			}
+			sum, err := src.RemoteChecksum(path.Join(srcPath, entry.Rel), opts.ChecksumAlgorithm)
+			if err != nil {
+				result.Status = "failed"
+				result.Error = err
+				return result, err
+			}
+			files = append(files, transferredFile{
+				LocalPath:  path.Join(srcPath, entry.Rel),
+				RemotePath: path.Join(dstPath, entry.Rel),
+				Checksum:   sum,
+			})
+		}
+	}
+
+	if !opts.Verify {
+		return result, nil
+	}
+
+	// 目标文件的校验和在目标主机上计算，不一致时按 keep_on_mismatch 删除
+	if err := dst.verifyTransferredFiles(files, &opts.TransferOptions, "upload"); err != nil {
+		result.Status = "failed"
+		result.Error = err
+		return result, err
+	}
+	markVerified(result, files, &opts.TransferOptions)
+
+	return result, nil
+}
+
+// lockSessionPair locks one or two sessions in a consistent order and returns the unlock function
+func lockSessionPair(a, b *Session) func() {
+	if a == b {
+		a.mu.Lock()
+		return a.mu.Unlock
+	}
+	// 按会话 ID 排序加锁，避免两个方向同时复制时死锁
+	if b.ID < a.ID {
+		a, b = b, a
+	}
+	a.mu.Lock()
+	b.mu.Lock()
+	return func() {
+		b.mu.Unlock()
+		a.mu.Unlock()
+	}
+}
+
+// planSessionCopy lists the source entries and checks the destination for conflicts (caller must hold both locks)
+func planSessionCopy(src *Session, srcPath string, dst *Session, dstPath string, opts *CopyOptions) ([]copyEntry, int64, error) {
+	src.LastUsedAt = time.Now()
+	dst.LastUsedAt = time.Now()
+	if err := src.ensureSFTP(); err != nil {
+		return nil, 0, fmt.Errorf("source: %w", err)
+	}
+	if err := dst.ensureSFTP(); err != nil {
+		return nil, 0, fmt.Errorf("destination: %w", err)
+	}
+
+	info, err := src.SFTPClient.Stat(srcPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat source: %w", err)
+	}
+
+	var entries []copyEntry
+	if info.IsDir() {
+		walker := src.SFTPClient.Walk(srcPath)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				return nil, 0, fmt.Errorf("walk source directory: %w", err)
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), srcPath), "/")
+			entries = append(entries, copyEntry{Rel: rel, Info: walker.Stat()})
+		}
+	} else {
+		entries = []copyEntry{{Info: info}}
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if entry.Info.Mode().IsRegular() {
+			total += entry.Info.Size()
+		}
+		if opts.Overwrite || entry.Info.IsDir() {
+			continue
+		}
+		target := path.Join(dstPath, entry.Rel)
+		if _, err := dst.SFTPClient.Lstat(target); err == nil {
+			return nil, 0, fmt.Errorf("destination file already exists: %s (use overwrite=true to overwrite)", target)
+		}
+	}
+
+	return entries, total, nil
+}
+
+// streamSessionCopy copies entries from src to dst through this process (caller must hold both locks)
+func streamSessionCopy(src *Session, srcPath string, dst *Session, dstPath string, opts *CopyOptions, entries []copyEntry, total int64, files *[]transferredFile) (*FileTransferResult, error) {
+	startTime := time.Now()
+	var copied int64
+	var fileCount int
+
+	if opts.CreateDirs {
+		if err := dst.SFTPClient.MkdirAll(path.Dir(dstPath)); err != nil {
+			return nil, fmt.Errorf("create destination directory: %w", err)
+		}
+	}
+
+	for _, entry := range entries {
+		source := path.Join(srcPath, entry.Rel)
+		target := path.Join(dstPath, entry.Rel)
+
+		switch {
+		case entry.Info.IsDir():
+			if err := dst.SFTPClient.MkdirAll(target); err != nil {
+				return nil, fmt.Errorf("create destination directory %s: %w", target, err)
+			}
+			dst.SFTPClient.Chmod(target, entry.Info.Mode().Perm())
+
+		case entry.Info.Mode()&os.ModeSymlink != 0:
+			link, err := src.SFTPClient.ReadLink(source)
+			if err != nil {
+				return nil, fmt.Errorf("read symlink %s: %w", source, err)
+			}
+			if _, err := dst.SFTPClient.Lstat(target); err == nil {
+				dst.SFTPClient.Remove(target)
+			}
+			if err := dst.SFTPClient.Symlink(link, target); err != nil {
+				return nil, fmt.Errorf("create symlink %s: %w", target, err)
+			}
+
+		case entry.Info.Mode().IsRegular():
+			n, err := copySessionFile(src, source, dst, target, entry.Info, opts, files, func(n int64) {
+				if opts.Progress != nil {
+					opts.Progress(copied+n, total)
+				}
+			})
+			copied += n
+			if err != nil {
+				return nil, fmt.Errorf("copy %s: %w", source, err)
+			}
+			fileCount++
+		}
+	}
+
+	duration := time.Since(startTime)
+	result := &FileTransferResult{
+		Status:           "success",
+		BytesTransferred: copied,
+		Duration:         duration.String(),
+		FileSize:         total,
+		Progress:         100.0,
+		FilePath:         srcPath,
+		Operation:        "copy",
+		FilesTransferred: fileCount,
+		Method:           CopyMethodStream,
+	}
+	if duration.Seconds() > 0 {
+		result.Speed = formatBytes(float64(copied)/duration.Seconds()) + "/s"
+	}
+	return result, nil
+}
+
+// progressWriter reports the number of bytes written so far
+type progressWriter struct {
+	w        io.Writer
+	n        int64
+	progress func(int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	p.progress(p.n)
+	return n, err
+}
+
+// copySessionFile streams a single regular file between sessions (caller must hold both locks)
+func copySessionFile(src *Session, source string, dst *Session, target string, info os.FileInfo, opts *CopyOptions, files *[]transferredFile, progress func(int64)) (int64, error) {
+	in, err := src.SFTPClient.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := dst.SFTPClient.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	pw := &progressWriter{w: out, progress: progress}
+	var dest io.Writer = pw
+	var hasher hash.Hash
+	if opts.Verify {
+		hasher, _ = newChecksumHash(opts.ChecksumAlgorithm)
+		dest = io.MultiWriter(pw, hasher)
+	}
+
+	n, err := io.Copy(dest, in)
+	if err != nil {
+		return n, err
+	}
+
+	dst.SFTPClient.Chmod(target, info.Mode().Perm())
+	dst.SFTPClient.Chtimes(target, info.ModTime(), info.ModTime())
+
+	if hasher != nil {
+		*files = append(*files, transferredFile{
+			LocalPath:  source,
+			RemotePath: target,
+			Checksum:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		})
+	}
+	return n, nil
+}
+
+// directSessionCopy runs rsync (or scp) on the source host to push directly to the destination host
+func directSessionCopy(src *Session, srcPath string, dst *Session, dstPath string, opts *CopyOptions, entries []copyEntry, total int64) (*FileTransferResult, error) {
+	startTime := time.Now()
+
+	host := opts.DirectHost
+	if host == "" {
+		host = dst.Host
+	}
+	isDir := len(entries) > 0 && entries[0].Rel == "" && entries[0].Info.IsDir()
+
+	method := CopyMethodScp
+	if hasRemoteCommand(src, "rsync") && hasRemoteCommand(dst, "rsync") {
+		method = CopyMethodRsync
+	}
+
+	// 先创建目标目录，rsync/scp 都不会创建缺失的父目录
+	mkdirTarget := path.Dir(dstPath)
+	if isDir {
+		mkdirTarget = dstPath
+	}
+	if opts.CreateDirs || isDir {
+		dst.mu.Lock()
+		err := dst.SFTPClient.MkdirAll(mkdirTarget)
+		dst.mu.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("create destination directory: %w", err)
+		}
+	}
+
+	command := directCopyCommand(method, srcPath, isDir, dst.Username, host, dst.Port, dstPath, opts.AcceptNewHostKey)
+	cmdResult, err := src.ExecuteCommand(command, DirectCopyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if cmdResult.ExitCode != 0 {
+		msg := strings.TrimSpace(cmdResult.Stderr)
+		if msg == "" {
+			msg = strings.TrimSpace(cmdResult.Stdout)
+		}
+		return nil, fmt.Errorf("%s exited with %d: %s", method, cmdResult.ExitCode, previewText(msg, 300))
+	}
+
+	fileCount := 0
+	for _, entry := range entries {
+		if entry.Info.Mode().IsRegular() {
+			fileCount++
+		}
+	}
+
+	duration := time.Since(startTime)
+	result := &FileTransferResult{
+		Status:           "success",
+		BytesTransferred: total,
+		Duration:         duration.String(),
+		FileSize:         total,
+		Progress:         100.0,
+		FilePath:         srcPath,
+		Operation:        "copy",
+		FilesTransferred: fileCount,
+		Method:           method,
+	}
+	if duration.Seconds() > 0 {
+		result.Speed = formatBytes(float64(total)/duration.Seconds()) + "/s"
+	}
+	if opts.Progress != nil {
+		opts.Progress(total, total)
+	}
+	return result, nil
+}
+
+// directCopyCommand builds the rsync/scp command run on the source host.
+// BatchMode makes ssh fail instead of prompting when no key is available.
+// The destination's host key must already be in the source host's
+// known_hosts unless acceptNewHostKey is set: trusting an unknown key on
+// first use would let whoever answers at that address receive the data.
+// The destination path must not be parsed by the destination's shell:
+// rsync sends it with --protect-args, and scp gets a quoted path over the
+// legacy protocol when it contains shell metacharacters.
+func directCopyCommand(method, srcPath string, isDir bool, user, host string, port int, dstPath string, acceptNewHostKey bool) string {
+	hostKeyChecking := "yes"
+	if acceptNewHostKey {
+		hostKeyChecking = "accept-new"
+	}
+	sshOpts := "-o BatchMode=yes -o StrictHostKeyChecking=" + hostKeyChecking + " -o ConnectTimeout=10"
+	destination := user + "@" + formatSCPHost(host) + ":"
+
+	if method == CopyMethodRsync {
+		source := srcPath
+		if isDir {
+			source += "/" // 复制目录内容而不是目录本身
+		}
+		rsh := "ssh -p " + strconv.Itoa(port) + " " + sshOpts
+		return fmt.Sprintf("rsync -a -s -e %s %s %s", shellQuote(rsh), shellQuote(source), shellQuote(destination+dstPath))
+	}
+
+	source := srcPath
+	flags := ""
+	if isDir {
+		source += "/."
+		flags = "-r "
+	}
+	remotePath := dstPath
+	if !isPlainShellWord(dstPath) {
+		// 旧版 scp 协议由目标主机的 shell 解析远程路径，需要加引号；新版默认的
+		// SFTP 协议按字面使用路径，引号会成为文件名的一部分，因此强制使用旧协议
+		remotePath = shellQuote(dstPath)
+		flags += "-O "
+	}
+	return fmt.Sprintf("scp %s-p -P %d %s %s %s", flags, port, sshOpts, shellQuote(source), shellQuote(destination+remotePath))
+}
+
+// isPlainShellWord reports whether s contains no characters a POSIX shell
+// would interpret, so it reads the same with or without quoting
+func isPlainShellWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("/._-+,:@%=", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// formatSCPHost wraps IPv6 addresses in brackets for scp/rsync targets
+func formatSCPHost(host string) string {
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// hasRemoteCommand reports whether a command is available on the session's host
+func hasRemoteCommand(s *Session, name string) bool {
+	result, err := s.ExecuteCommand("command -v "+shellQuote(name)+" >/dev/null 2>&1", 10*time.Second)
+	return err == nil && result.ExitCode == 0
+}
@@ -0,0 +1,44 @@
+package sshmcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDirectCopyCommand tests the rsync/scp commands used for direct copies
+func TestDirectCopyCommand(t *testing.T) {
+	cmd := directCopyCommand(CopyMethodRsync, "/data/dump", true, "deploy", "10.0.0.5", 22, "/backup/dump", false)
+	assert.Equal(t, "rsync -a -s -e 'ssh -p 22 -o BatchMode=yes -o StrictHostKeyChecking=yes -o ConnectTimeout=10' '/data/dump/' 'deploy@10.0.0.5:/backup/dump'", cmd)
+
+	// 只有显式开启时才信任未知的主机密钥
+	cmd = directCopyCommand(CopyMethodScp, "/data/db.sql", false, "root", "fe80::1", 2222, "/tmp/db.sql", true)
+	assert.Equal(t, "scp -p -P 2222 -o BatchMode=yes -o StrictHostKeyChecking=accept-new -o ConnectTimeout=10 '/data/db.sql' 'root@[fe80::1]:/tmp/db.sql'", cmd)
+
+	cmd = directCopyCommand(CopyMethodScp, "/data/dir", true, "root", "host", 22, "/dst", false)
+	assert.Contains(t, cmd, "scp -r -p")
+	assert.Contains(t, cmd, "'/data/dir/.'")
+
+	// 目标路径不能被目标主机的 shell 解析
+	cmd = directCopyCommand(CopyMethodRsync, "/data/a", false, "root", "host", 22, "/tmp/x; rm -rf ~", false)
+	assert.Equal(t, "rsync -a -s -e 'ssh -p 22 -o BatchMode=yes -o StrictHostKeyChecking=yes -o ConnectTimeout=10' '/data/a' 'root@host:/tmp/x; rm -rf ~'", cmd)
+	cmd = directCopyCommand(CopyMethodScp, "/data/a", false, "root", "host", 22, "/tmp/$(id) x", false)
+	assert.Equal(t, `scp -O -p -P 22 -o BatchMode=yes -o StrictHostKeyChecking=yes -o ConnectTimeout=10 '/data/a' 'root@host:'\''/tmp/$(id) x'\'''`, cmd)
+}
+
+// TestLockSessionPair tests that locking the same session twice does not deadlock
+func TestLockSessionPair(t *testing.T) {
+	a := &Session{ID: "b"}
+	b := &Session{ID: "a"}
+
+	unlock := lockSessionPair(a, a)
+	unlock()
+
+	unlock = lockSessionPair(a, b)
+	unlock()
+	unlock = lockSessionPair(b, a)
+	unlock()
+
+	assert.True(t, a.mu.TryLock())
+	assert.True(t, b.mu.TryLock())
+}
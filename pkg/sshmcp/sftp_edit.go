@@ -0,0 +1,197 @@
+package sshmcp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FileEdit is a single search-and-replace edit
+type FileEdit struct {
+	OldText       string `json:"old_text"`
+	NewText       string `json:"new_text"`
+	Regex         bool   `json:"regex"`          // OldText 为正则表达式，NewText 可使用 $1 等引用分组
+	ExpectedCount int    `json:"expected_count"` // 期望匹配次数，默认 1；匹配次数不一致时失败
+}
+
+// EditFileOptions configures EditRemoteFile; exactly one of Edits and Patch must be set
+type EditFileOptions struct {
+	Edits []FileEdit // 依次应用的替换
+	Patch string     // unified diff 补丁
+
+	// 并发修改检测：文件与之前读取时不一致则失败
+	ExpectedSize    *int64    // 期望的文件大小，nil 表示不检查
+	ExpectedModTime time.Time // 期望的修改时间，零值表示不检查
+
+	Backup bool // 修改前将原文件复制为 <path>.bak.<时间戳>
+	DryRun bool // 只返回 diff，不写入
+}
+
+// EditFileResult represents the result of editing a remote file
+type EditFileResult struct {
+	Path         string    `json:"path"`
+	Changed      bool      `json:"changed"`
+	DryRun       bool      `json:"dry_run"`
+	Replacements int       `json:"replacements,omitempty"`
+	HunksApplied int       `json:"hunks_applied,omitempty"`
+	Diff         string    `json:"diff"`
+	BackupPath   string    `json:"backup_path,omitempty"`
+	Size         int64     `json:"size"`
+	Modified     time.Time `json:"modified"`
+}
+
+// EditRemoteFile applies search-and-replace edits or a unified diff to a remote file
+func (s *Session) EditRemoteFile(remotePath string, opts *EditFileOptions) (*EditFileResult, error) {
+	if opts == nil || (len(opts.Edits) == 0) == (opts.Patch == "") {
+		return nil, fmt.Errorf("exactly one of edits or patch must be provided")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return nil, err
+	}
+
+	info, err := s.SFTPClient.Stat(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("stat remote file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", remotePath)
+	}
+	if info.Size() > MaxWriteFileBytes {
+		return nil, fmt.Errorf("file too large to edit: %s (max %s)",
+			formatBytes(float64(info.Size())), formatBytes(MaxWriteFileBytes))
+	}
+	if err := checkUnmodified(info, opts.ExpectedSize, opts.ExpectedModTime); err != nil {
+		return nil, err
+	}
+
+	f, err := s.SFTPClient.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("open remote file: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read remote file: %w", err)
+	}
+	if isBinaryContent(data) {
+		return nil, fmt.Errorf("%s looks like a binary file, refusing to edit", remotePath)
+	}
+
+	result := &EditFileResult{
+		Path:     remotePath,
+		DryRun:   opts.DryRun,
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+	}
+
+	oldText := string(data)
+	var newText string
+	if opts.Patch != "" {
+		newText, result.HunksApplied, err = applyUnifiedPatch(oldText, opts.Patch)
+	} else {
+		newText, result.Replacements, err = applyFileEdits(oldText, opts.Edits)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Changed = newText != oldText
+	result.Diff = unifiedDiff("a"+remotePath, "b"+remotePath, oldText, newText, 3)
+	if !result.Changed || opts.DryRun {
+		return result, nil
+	}
+
+	// 写入前再次检查，防止读取后文件被其他进程修改
+	current, err := s.SFTPClient.Stat(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("stat remote file: %w", err)
+	}
+	size := info.Size()
+	if err := checkUnmodified(current, &size, info.ModTime()); err != nil {
+		return nil, err
+	}
+
+	// replaceRemoteFile 会解析符号链接，原子替换链接指向的文件而不是链接本身
+	written, err := s.replaceRemoteFile(remotePath, []byte(newText), current, &WriteFileOptions{
+		Atomic: true,
+		Backup: opts.Backup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.BackupPath = written.BackupPath
+	result.Size = written.BytesWritten
+
+	if updated, err := s.SFTPClient.Stat(remotePath); err == nil {
+		result.Modified = updated.ModTime()
+	}
+
+	return result, nil
+}
+
+// checkUnmodified returns an error if info does not match the expected size and mtime
+func checkUnmodified(info os.FileInfo, expectedSize *int64, expectedModTime time.Time) error {
+	if expectedSize != nil && info.Size() != *expectedSize {
+		return fmt.Errorf("file has changed since it was read: size is %d, expected %d", info.Size(), *expectedSize)
+	}
+	// SFTP 只支持秒级时间戳
+	if !expectedModTime.IsZero() && info.ModTime().Unix() != expectedModTime.Unix() {
+		return fmt.Errorf("file has changed since it was read: mtime is %s, expected %s",
+			info.ModTime().Format(time.RFC3339), expectedModTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// applyFileEdits applies edits in order and returns the new text and the total number of replacements
+func applyFileEdits(text string, edits []FileEdit) (string, int, error) {
+	total := 0
+	for i, edit := range edits {
+		if edit.OldText == "" {
+			return "", 0, fmt.Errorf("edit %d: old_text must not be empty", i+1)
+		}
+		expected := edit.ExpectedCount
+		if expected <= 0 {
+			expected = 1
+		}
+
+		var count int
+		if edit.Regex {
+			re, err := regexp.Compile(edit.OldText)
+			if err != nil {
+				return "", 0, fmt.Errorf("edit %d: invalid regex: %w", i+1, err)
+			}
+			count = len(re.FindAllStringIndex(text, -1))
+			if count == expected {
+				text = re.ReplaceAllString(text, edit.NewText)
+			}
+		} else {
+			count = strings.Count(text, edit.OldText)
+			if count == expected {
+				text = strings.ReplaceAll(text, edit.OldText, edit.NewText)
+			}
+		}
+
+		if count != expected {
+			return "", 0, fmt.Errorf("edit %d: expected %d occurrence(s) of %q, found %d",
+				i+1, expected, previewText(edit.OldText, 80), count)
+		}
+		total += count
+	}
+	return text, total, nil
+}
+
+// previewText shortens text for error messages
+func previewText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return text[:limit] + "..."
+}
@@ -0,0 +1,502 @@
+package sshmcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	// DefaultReadFileMaxBytes is the default cap on bytes returned by ReadRemoteFile
+	DefaultReadFileMaxBytes = 1 << 20 // 1MB
+	// MaxReadFileBytes is the hard cap on bytes returned by ReadRemoteFile
+	MaxReadFileBytes = 16 << 20 // 16MB
+	// MaxWriteFileBytes is the hard cap on bytes accepted by WriteRemoteFile
+	MaxWriteFileBytes = 16 << 20 // 16MB
+
+	// binarySniffLen is the number of leading bytes inspected for NUL bytes (same heuristic as git)
+	binarySniffLen = 8000
+	// maxSymlinkHops limits how many symlinks resolveRemoteSymlink follows (same as Linux MAXSYMLINKS)
+	maxSymlinkHops = 40
+)
+
+// Content encodings reported by ReadRemoteFile
+const (
+	ContentEncodingUTF8    = "utf-8"
+	ContentEncodingUTF16LE = "utf-16le"
+	ContentEncodingUTF16BE = "utf-16be"
+	ContentEncodingBase64  = "base64"
+)
+
+// ReadFileOptions configures ReadRemoteFile
+type ReadFileOptions struct {
+	// 字节范围
+	Offset int64 // 起始字节偏移
+	Length int64 // 读取字节数，0 表示读到文件末尾
+
+	// 行范围（设置 StartLine 后忽略 Offset/Length）
+	StartLine int // 起始行号，从 1 开始
+	EndLine   int // 结束行号（包含），0 表示读到文件末尾
+
+	MaxBytes int64  // 最多返回的字节数，默认 DefaultReadFileMaxBytes
+	Encoding string // auto（默认，自动识别文本/二进制）、utf-8（强制文本）、base64（强制 base64）
+}
+
+// FileContentResult represents the content read from a remote file
+type FileContentResult struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Mode      string    `json:"mode"`
+	Modified  time.Time `json:"modified"`
+	Offset    int64     `json:"offset"`
+	BytesRead int64     `json:"bytes_read"`
+	StartLine int       `json:"start_line,omitempty"`
+	EndLine   int       `json:"end_line,omitempty"`
+	Encoding  string    `json:"encoding"` // utf-8、utf-16le、utf-16be 或 base64
+	Binary    bool      `json:"binary"`
+	Truncated bool      `json:"truncated"` // 因 MaxBytes 被截断
+	Content   string    `json:"content"`
+}
+
+// WriteFileOptions configures WriteRemoteFile
+type WriteFileOptions struct {
+	Mode       os.FileMode // 文件权限，0 表示保留原文件权限（新文件为 0644）
+	CreateDirs bool        // 是否创建父目录
+	Atomic     bool        // 先写入同目录临时文件再 rename，避免读者看到写了一半的文件
+	Backup     bool        // 覆盖前将原文件复制为 <path>.bak.<时间戳>
+}
+
+// WriteFileResult represents the result of writing a remote file
+type WriteFileResult struct {
+	Path         string `json:"path"`
+	BytesWritten int64  `json:"bytes_written"`
+	Mode         string `json:"mode"`
+	Created      bool   `json:"created"`
+	Atomic       bool   `json:"atomic"`
+	BackupPath   string `json:"backup_path,omitempty"`
+}
+
+// ReadRemoteFile reads a byte or line range of a remote file without a local copy
+func (s *Session) ReadRemoteFile(remotePath string, opts *ReadFileOptions) (*FileContentResult, error) {
+	if opts == nil {
+		opts = &ReadFileOptions{}
+	}
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultReadFileMaxBytes
+	}
+	if maxBytes > MaxReadFileBytes {
+		maxBytes = MaxReadFileBytes
+	}
+	if opts.Offset < 0 || opts.Length < 0 {
+		return nil, fmt.Errorf("offset and length must not be negative")
+	}
+	if opts.StartLine < 0 || opts.EndLine < 0 || (opts.EndLine > 0 && opts.EndLine < opts.StartLine) {
+		return nil, fmt.Errorf("invalid line range %d-%d", opts.StartLine, opts.EndLine)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return nil, err
+	}
+
+	info, err := s.SFTPClient.Stat(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("stat remote file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", remotePath)
+	}
+
+	f, err := s.SFTPClient.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("open remote file: %w", err)
+	}
+	defer f.Close()
+
+	result := &FileContentResult{
+		Path:     remotePath,
+		Size:     info.Size(),
+		Mode:     info.Mode().String(),
+		Modified: info.ModTime(),
+	}
+
+	var data []byte
+	if opts.StartLine > 0 {
+		data, err = readLineRange(f, opts.StartLine, opts.EndLine, maxBytes, result)
+	} else {
+		data, err = readByteRange(f, opts.Offset, opts.Length, maxBytes, result)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read remote file: %w", err)
+	}
+
+	decodeFileContent(data, opts.Encoding, result)
+	return result, nil
+}
+
+// readByteRange reads up to maxBytes from offset and fills the range fields of result
+func readByteRange(r io.ReadSeeker, offset, length, maxBytes int64, result *FileContentResult) ([]byte, error) {
+	if offset > result.Size {
+		offset = result.Size
+	}
+	want := result.Size - offset
+	if length > 0 && length < want {
+		want = length
+	}
+	if want > maxBytes {
+		want = maxBytes
+		result.Truncated = true
+	}
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, want)
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	result.Offset = offset
+	return data[:n], nil
+}
+
+// readLineRange reads lines startLine..endLine (1-based, inclusive) and fills the range fields of result
+func readLineRange(r io.Reader, startLine, endLine int, maxBytes int64, result *FileContentResult) ([]byte, error) {
+	reader := bufio.NewReader(r)
+	var buf bytes.Buffer
+	var offset int64
+	line := 0
+
+	for endLine == 0 || line < endLine {
+		text, err := reader.ReadBytes('\n')
+		if len(text) > 0 {
+			line++
+			if line < startLine {
+				offset += int64(len(text))
+			} else {
+				if int64(buf.Len()+len(text)) > maxBytes {
+					// 按行截断；第一行就超限时返回该行的前 maxBytes 字节
+					if buf.Len() == 0 {
+						buf.Write(text[:maxBytes])
+						result.EndLine = line
+					}
+					result.Truncated = true
+					break
+				}
+				buf.Write(text)
+				result.EndLine = line
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Offset = offset
+	if buf.Len() > 0 {
+		result.StartLine = startLine
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeFileContent detects the encoding of data and stores the decoded content in result.
+// Text is returned as UTF-8 (UTF-16 with a BOM is converted); anything else falls back to base64.
+func decodeFileContent(data []byte, encoding string, result *FileContentResult) {
+	result.BytesRead = int64(len(data))
+	atStart := result.Offset == 0
+	readEnd := result.Offset + int64(len(data))
+
+	switch strings.ToLower(encoding) {
+	case ContentEncodingBase64:
+		result.Encoding = ContentEncodingBase64
+		result.Binary = isBinaryContent(data)
+		result.Content = base64.StdEncoding.EncodeToString(data)
+		return
+	case "utf8", ContentEncodingUTF8:
+		result.Encoding = ContentEncodingUTF8
+		result.Content = strings.ToValidUTF8(string(data), string(utf8.RuneError))
+		return
+	}
+
+	if atStart {
+		switch {
+		case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+			data = data[3:]
+		case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+			result.Encoding = ContentEncodingUTF16LE
+			result.Content = decodeUTF16(data[2:], false)
+			return
+		case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+			result.Encoding = ContentEncodingUTF16BE
+			result.Content = decodeUTF16(data[2:], true)
+			return
+		}
+	}
+
+	if !isBinaryContent(data) {
+		// 范围读取可能在多字节字符中间截断，去掉首尾不完整的字符
+		start, end := 0, len(data)
+		if !atStart || readEnd < result.Size {
+			start, end = trimPartialRunes(data)
+		}
+		if utf8.Valid(data[start:end]) {
+			result.Offset += int64(start)
+			result.BytesRead -= int64(start + len(data) - end)
+			result.Encoding = ContentEncodingUTF8
+			result.Content = string(data[start:end])
+			return
+		}
+	}
+
+	result.Encoding = ContentEncodingBase64
+	result.Binary = true
+	result.Content = base64.StdEncoding.EncodeToString(data)
+}
+
+// isBinaryContent reports whether data looks binary (contains a NUL byte near the start)
+func isBinaryContent(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// trimPartialRunes returns bounds excluding an incomplete UTF-8 sequence at either end of data
+func trimPartialRunes(data []byte) (int, int) {
+	start, end := 0, len(data)
+
+	// 开头的续字节（10xxxxxx）属于前一个字符
+	for start < end && start < utf8.UTFMax-1 && !utf8.RuneStart(data[start]) {
+		start++
+	}
+
+	// 末尾不完整的多字节字符
+	for i := end - 1; i >= start && i >= end-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:end]) {
+				end = i
+			}
+			break
+		}
+	}
+
+	return start, end
+}
+
+// decodeUTF16 converts UTF-16 bytes (without BOM) to a UTF-8 string
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		if bigEndian {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		} else {
+			units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// WriteRemoteFile writes content to a remote file without a local copy
+func (s *Session) WriteRemoteFile(remotePath string, data []byte, opts *WriteFileOptions) (*WriteFileResult, error) {
+	if opts == nil {
+		opts = &WriteFileOptions{}
+	}
+	if len(data) > MaxWriteFileBytes {
+		return nil, fmt.Errorf("content too large: %s (max %s), use sftp_upload instead",
+			formatBytes(float64(len(data))), formatBytes(MaxWriteFileBytes))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.SFTPClient.Stat(remotePath)
+	switch {
+	case err == nil && existing.IsDir():
+		return nil, fmt.Errorf("%s is a directory", remotePath)
+	case err != nil && !os.IsNotExist(err):
+		return nil, fmt.Errorf("stat remote file: %w", err)
+	case err != nil:
+		existing = nil
+	}
+
+	return s.replaceRemoteFile(remotePath, data, existing, opts)
+}
+
+// replaceRemoteFile writes data to remotePath, where existing is the current file info or nil
+// if the file does not exist (caller must hold s.mu)
+func (s *Session) replaceRemoteFile(remotePath string, data []byte, existing os.FileInfo, opts *WriteFileOptions) (*WriteFileResult, error) {
+	result := &WriteFileResult{Path: remotePath, Atomic: opts.Atomic, Created: existing == nil}
+
+	// 路径是符号链接时写入链接指向的文件，原子替换不能把链接本身换成普通文件
+	realPath, err := s.resolveRemoteSymlink(remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Dir(realPath)
+	if opts.CreateDirs && result.Created {
+		if err := s.SFTPClient.MkdirAll(dir); err != nil {
+			return nil, fmt.Errorf("create remote directory: %w", err)
+		}
+	}
+
+	mode := opts.Mode.Perm()
+	if opts.Mode == 0 {
+		mode = 0644
+		if existing != nil {
+			mode = existing.Mode().Perm()
+		}
+	}
+
+	if opts.Backup && existing != nil {
+		backupPath := fmt.Sprintf("%s.bak.%s", remotePath, time.Now().Format("20060102-150405"))
+		if err := s.copyRemoteFile(remotePath, backupPath, existing.Mode().Perm()); err != nil {
+			return nil, fmt.Errorf("backup remote file: %w", err)
+		}
+		result.BackupPath = backupPath
+	}
+
+	target := realPath
+	if opts.Atomic {
+		target = path.Join(dir, fmt.Sprintf(".%s.tmp-%d", path.Base(realPath), time.Now().UnixNano()))
+	}
+
+	n, err := s.writeRemoteFileContent(target, data, mode)
+	if err != nil {
+		if opts.Atomic {
+			s.SFTPClient.Remove(target)
+		}
+		return nil, err
+	}
+
+	if opts.Atomic {
+		// 尽量保留原文件的属主（仅当有权限时成功）
+		if existing != nil {
+			if stat, ok := existing.Sys().(*sftp.FileStat); ok {
+				s.SFTPClient.Chown(target, int(stat.UID), int(stat.GID))
+			}
+		}
+		if err := s.renameRemoteFile(target, realPath); err != nil {
+			s.SFTPClient.Remove(target)
+			return nil, fmt.Errorf("rename temp file: %w", err)
+		}
+	}
+
+	result.BytesWritten = n
+	result.Mode = mode.String()
+	return result, nil
+}
+
+// resolveRemoteSymlink follows symlinks at remotePath and returns the path of the file
+// they point to, or remotePath itself if it is not a symlink (caller must hold s.mu)
+func (s *Session) resolveRemoteSymlink(remotePath string) (string, error) {
+	for i := 0; i < maxSymlinkHops; i++ {
+		info, err := s.SFTPClient.Lstat(remotePath)
+		if os.IsNotExist(err) {
+			return remotePath, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("stat remote file: %w", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return remotePath, nil
+		}
+
+		// 逐级读取链接：并非所有服务器的 realpath 都会解析链接，悬空链接也会让它失败
+		link, err := s.SFTPClient.ReadLink(remotePath)
+		if err != nil {
+			return "", fmt.Errorf("read symlink: %w", err)
+		}
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(remotePath), link)
+		}
+		remotePath = link
+	}
+	return "", fmt.Errorf("too many levels of symbolic links: %s", remotePath)
+}
+
+// writeRemoteFileContent creates or truncates a remote file and writes data (caller must hold s.mu)
+func (s *Session) writeRemoteFileContent(remotePath string, data []byte, mode os.FileMode) (int64, error) {
+	f, err := s.SFTPClient.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, fmt.Errorf("open remote file: %w", err)
+	}
+
+	n, err := f.Write(data)
+	if err != nil {
+		f.Close()
+		return 0, fmt.Errorf("write remote file: %w", err)
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return 0, fmt.Errorf("chmod remote file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("close remote file: %w", err)
+	}
+
+	return int64(n), nil
+}
+
+// copyRemoteFile copies a remote file to another remote path (caller must hold s.mu)
+func (s *Session) copyRemoteFile(srcPath, dstPath string, mode os.FileMode) error {
+	src, err := s.SFTPClient.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := s.SFTPClient.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Chmod(mode); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// renameRemoteFile renames a file, replacing the target if it exists (caller must hold s.mu).
+// Uses the posix-rename extension when available; plain SFTP rename fails if the target exists.
+func (s *Session) renameRemoteFile(oldPath, newPath string) error {
+	if _, ok := s.SFTPClient.HasExtension("posix-rename@openssh.com"); ok {
+		return s.SFTPClient.PosixRename(oldPath, newPath)
+	}
+
+	if err := s.SFTPClient.Rename(oldPath, newPath); err == nil {
+		return nil
+	}
+	if err := s.SFTPClient.Remove(newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.SFTPClient.Rename(oldPath, newPath)
+}
@@ -0,0 +1,208 @@
+package sshmcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDecodeFileContent_Text tests plain UTF-8 and BOM handling
+func TestDecodeFileContent_Text(t *testing.T) {
+	result := &FileContentResult{Size: 12}
+	decodeFileContent([]byte("hello 世界"), "", result)
+	assert.Equal(t, ContentEncodingUTF8, result.Encoding)
+	assert.Equal(t, "hello 世界", result.Content)
+	assert.False(t, result.Binary)
+
+	result = &FileContentResult{Size: 6}
+	decodeFileContent([]byte("\xEF\xBB\xBFabc"), "", result)
+	assert.Equal(t, ContentEncodingUTF8, result.Encoding)
+	assert.Equal(t, "abc", result.Content)
+	assert.Equal(t, int64(6), result.BytesRead)
+}
+
+// TestDecodeFileContent_UTF16 tests UTF-16 files with a BOM
+func TestDecodeFileContent_UTF16(t *testing.T) {
+	result := &FileContentResult{Size: 6}
+	decodeFileContent([]byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "", result)
+	assert.Equal(t, ContentEncodingUTF16LE, result.Encoding)
+	assert.Equal(t, "hi", result.Content)
+
+	result = &FileContentResult{Size: 6}
+	decodeFileContent([]byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "", result)
+	assert.Equal(t, ContentEncodingUTF16BE, result.Encoding)
+	assert.Equal(t, "hi", result.Content)
+}
+
+// TestDecodeFileContent_Binary tests the base64 fallback
+func TestDecodeFileContent_Binary(t *testing.T) {
+	data := []byte{0x7F, 'E', 'L', 'F', 0, 1, 2}
+	result := &FileContentResult{Size: int64(len(data))}
+	decodeFileContent(data, "", result)
+	assert.Equal(t, ContentEncodingBase64, result.Encoding)
+	assert.True(t, result.Binary)
+
+	decoded, err := base64.StdEncoding.DecodeString(result.Content)
+	require.NoError(t, err)
+	assert.Equal(t, data, decoded)
+
+	// 非 UTF-8 文本（如 Latin-1）同样回退为 base64
+	result = &FileContentResult{Size: 4}
+	decodeFileContent([]byte("caf\xE9"), "", result)
+	assert.Equal(t, ContentEncodingBase64, result.Encoding)
+
+	// 强制 utf-8 时替换非法字节
+	result = &FileContentResult{Size: 4}
+	decodeFileContent([]byte("caf\xE9"), "utf-8", result)
+	assert.Equal(t, "caf�", result.Content)
+}
+
+// TestDecodeFileContent_PartialRunes tests ranged reads that split a multi-byte character
+func TestDecodeFileContent_PartialRunes(t *testing.T) {
+	full := []byte("ab世界cd") // 世、界 各 3 字节
+
+	// 从 "世" 的第 2 个字节开始，到 "界" 的第 2 个字节结束
+	result := &FileContentResult{Size: int64(len(full)), Offset: 3}
+	decodeFileContent(full[3:7], "", result)
+	assert.Equal(t, ContentEncodingUTF8, result.Encoding)
+	assert.Equal(t, "", result.Content)
+	assert.Equal(t, int64(5), result.Offset)
+	assert.Equal(t, int64(0), result.BytesRead)
+
+	result = &FileContentResult{Size: int64(len(full)), Offset: 1}
+	decodeFileContent(full[1:6], "", result)
+	assert.Equal(t, "b世", result.Content)
+	assert.Equal(t, int64(1), result.Offset)
+	assert.Equal(t, int64(4), result.BytesRead)
+}
+
+// TestReadByteRange tests byte range reads and truncation
+func TestReadByteRange(t *testing.T) {
+	r := bytes.NewReader([]byte("0123456789"))
+
+	result := &FileContentResult{Size: 10}
+	data, err := readByteRange(r, 2, 3, 100, result)
+	require.NoError(t, err)
+	assert.Equal(t, "234", string(data))
+	assert.False(t, result.Truncated)
+
+	result = &FileContentResult{Size: 10}
+	data, err = readByteRange(r, 4, 0, 4, result)
+	require.NoError(t, err)
+	assert.Equal(t, "4567", string(data))
+	assert.True(t, result.Truncated)
+
+	result = &FileContentResult{Size: 10}
+	data, err = readByteRange(r, 50, 0, 100, result)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	assert.Equal(t, int64(10), result.Offset)
+}
+
+// TestReadLineRange tests line range reads
+func TestReadLineRange(t *testing.T) {
+	content := "one\ntwo\nthree\nfour\nfive"
+
+	result := &FileContentResult{}
+	data, err := readLineRange(strings.NewReader(content), 2, 4, 100, result)
+	require.NoError(t, err)
+	assert.Equal(t, "two\nthree\nfour\n", string(data))
+	assert.Equal(t, 2, result.StartLine)
+	assert.Equal(t, 4, result.EndLine)
+	assert.Equal(t, int64(4), result.Offset)
+
+	// 到文件末尾（最后一行没有换行符）
+	result = &FileContentResult{}
+	data, err = readLineRange(strings.NewReader(content), 4, 0, 100, result)
+	require.NoError(t, err)
+	assert.Equal(t, "four\nfive", string(data))
+	assert.Equal(t, 5, result.EndLine)
+
+	// 按行截断
+	result = &FileContentResult{}
+	data, err = readLineRange(strings.NewReader(content), 1, 0, 9, result)
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", string(data))
+	assert.Equal(t, 2, result.EndLine)
+	assert.True(t, result.Truncated)
+
+	// 起始行超出文件
+	result = &FileContentResult{}
+	data, err = readLineRange(strings.NewReader(content), 10, 0, 100, result)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	assert.Equal(t, 0, result.StartLine)
+}
+
+// newLocalSFTPSession returns a session whose SFTP client talks to an in-process
+// server on the local filesystem
+func newLocalSFTPSession(t *testing.T) *Session {
+	t.Helper()
+
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverR, serverW})
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientR, clientW)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	return &Session{SFTPClient: client}
+}
+
+// TestWriteRemoteFile_Symlink tests that writes through a symlink keep the link
+func TestWriteRemoteFile_Symlink(t *testing.T) {
+	s := newLocalSFTPSession(t)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.conf")
+	link := filepath.Join(dir, "link.conf")
+	require.NoError(t, os.WriteFile(target, []byte("old\n"), 0600))
+	require.NoError(t, os.Symlink("real.conf", link))
+
+	for _, atomic := range []bool{true, false} {
+		content := []byte("new " + map[bool]string{true: "atomic", false: "direct"}[atomic] + "\n")
+		result, err := s.WriteRemoteFile(link, content, &WriteFileOptions{Atomic: atomic})
+		require.NoError(t, err)
+		assert.Equal(t, link, result.Path)
+		assert.False(t, result.Created)
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink, "link was replaced")
+		data, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		info, err = os.Stat(target)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// 悬空链接：创建链接指向的文件
+	dangling := filepath.Join(dir, "dangling.conf")
+	require.NoError(t, os.Symlink("missing.conf", dangling))
+	result, err := s.WriteRemoteFile(dangling, []byte("created\n"), &WriteFileOptions{Atomic: true})
+	require.NoError(t, err)
+	assert.True(t, result.Created)
+	data, err := os.ReadFile(filepath.Join(dir, "missing.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "created\n", string(data))
+	info, err := os.Lstat(dangling)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+}
@@ -0,0 +1,597 @@
+package sshmcp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// RemoteFileStat represents detailed information about a remote file
+type RemoteFileStat struct {
+	Path       string    `json:"path"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`       // 符号形式，例如 -rwxr-xr-x
+	ModeOctal  string    `json:"mode_octal"` // 八进制形式，例如 0755（含 setuid/setgid/sticky 位）
+	UID        uint32    `json:"uid"`
+	GID        uint32    `json:"gid"`
+	Owner      string    `json:"owner,omitempty"`
+	Group      string    `json:"group,omitempty"`
+	LinkTarget string    `json:"link_target,omitempty"`
+	Modified   time.Time `json:"modified"`
+	Accessed   time.Time `json:"accessed"`
+}
+
+// DiskUsage represents filesystem space information
+type DiskUsage struct {
+	Path           string  `json:"path"`
+	TotalBytes     uint64  `json:"total_bytes"`
+	UsedBytes      uint64  `json:"used_bytes"`
+	FreeBytes      uint64  `json:"free_bytes"`      // 包括仅 root 可用的保留空间
+	AvailableBytes uint64  `json:"available_bytes"` // 普通用户可用空间
+	UsedPercent    float64 `json:"used_percent"`
+	TotalInodes    uint64  `json:"total_inodes,omitempty"`
+	FreeInodes     uint64  `json:"free_inodes,omitempty"`
+	BlockSize      uint64  `json:"block_size,omitempty"`
+	Source         string  `json:"source"` // statvfs（SFTP 扩展）或 df（命令回退）
+}
+
+// idEntry is a name/id pair from /etc/passwd or /etc/group
+type idEntry struct {
+	Name string
+	ID   uint32
+}
+
+// StatRemoteFile returns detailed information about a remote file.
+// Without followLinks, symlinks are reported themselves (with their target).
+func (s *Session) StatRemoteFile(remotePath string, followLinks bool) (*RemoteFileStat, error) {
+	s.mu.Lock()
+	s.LastUsedAt = time.Now()
+
+	if err := s.ensureSFTP(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	info, err := s.SFTPClient.Lstat(remotePath)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("stat remote file: %w", err)
+	}
+
+	result := &RemoteFileStat{Path: remotePath}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if target, err := s.SFTPClient.ReadLink(remotePath); err == nil {
+			result.LinkTarget = target
+		}
+		if followLinks {
+			if info, err = s.SFTPClient.Stat(remotePath); err != nil {
+				s.mu.Unlock()
+				return nil, fmt.Errorf("stat symlink target: %w", err)
+			}
+		}
+	}
+
+	result.Name = info.Name()
+	result.Type = getFileType(info)
+	result.Size = info.Size()
+	result.Mode = info.Mode().String()
+	result.ModeOctal = FormatModeOctal(info.Mode())
+	result.Modified = info.ModTime()
+	result.Accessed = info.ModTime()
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		result.UID = stat.UID
+		result.GID = stat.GID
+		result.Accessed = time.Unix(int64(stat.Atime), 0)
+	}
+
+	users, _ := s.readRemoteIDFile("/etc/passwd")
+	groups, _ := s.readRemoteIDFile("/etc/group")
+	s.mu.Unlock()
+
+	result.Owner = lookupIDName(users, result.UID)
+	if result.Owner == "" {
+		result.Owner = s.getentName("passwd", strconv.FormatUint(uint64(result.UID), 10))
+	}
+	result.Group = lookupIDName(groups, result.GID)
+	if result.Group == "" {
+		result.Group = s.getentName("group", strconv.FormatUint(uint64(result.GID), 10))
+	}
+
+	return result, nil
+}
+
+// ChmodRemoteFile changes the mode of a remote file. The mode may be octal ("0755") or
+// symbolic like chmod(1) ("u+x,go-w"); it returns the resulting mode.
+func (s *Session) ChmodRemoteFile(remotePath, modeSpec string) (os.FileMode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return 0, err
+	}
+
+	info, err := s.SFTPClient.Stat(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("stat remote file: %w", err)
+	}
+
+	mode, err := parseChmodMode(modeSpec, info.Mode(), info.IsDir())
+	if err != nil {
+		return 0, err
+	}
+	if err := s.SFTPClient.Chmod(remotePath, mode); err != nil {
+		return 0, fmt.Errorf("chmod: %w", err)
+	}
+
+	return mode, nil
+}
+
+// ChownRemoteFile changes the owner and/or group of a remote file. Owner and group may be
+// names or numeric IDs; an empty value keeps the current one. Returns the resulting uid and gid.
+func (s *Session) ChownRemoteFile(remotePath, owner, group string) (uint32, uint32, error) {
+	if owner == "" && group == "" {
+		return 0, 0, fmt.Errorf("owner or group must be provided")
+	}
+
+	uid, err := s.resolveRemoteID("passwd", owner)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := s.resolveRemoteID("group", group)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return 0, 0, err
+	}
+
+	// SFTP 的 chown 必须同时指定 uid 和 gid，未指定的保持不变
+	if owner == "" || group == "" {
+		info, err := s.SFTPClient.Stat(remotePath)
+		if err != nil {
+			return 0, 0, fmt.Errorf("stat remote file: %w", err)
+		}
+		stat, ok := info.Sys().(*sftp.FileStat)
+		if !ok {
+			return 0, 0, fmt.Errorf("server did not report file ownership")
+		}
+		if owner == "" {
+			uid = stat.UID
+		}
+		if group == "" {
+			gid = stat.GID
+		}
+	}
+
+	if err := s.SFTPClient.Chown(remotePath, int(uid), int(gid)); err != nil {
+		return 0, 0, fmt.Errorf("chown: %w", err)
+	}
+
+	return uid, gid, nil
+}
+
+// RenameRemoteFile renames or moves a remote file. With overwrite, an existing target is
+// replaced atomically when the server supports POSIX rename.
+func (s *Session) RenameRemoteFile(oldPath, newPath string, overwrite bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return err
+	}
+
+	if _, err := s.SFTPClient.Lstat(oldPath); err != nil {
+		return fmt.Errorf("stat source: %w", err)
+	}
+
+	if overwrite {
+		if err := s.renameRemoteFile(oldPath, newPath); err != nil {
+			return fmt.Errorf("rename: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := s.SFTPClient.Lstat(newPath); err == nil {
+		return fmt.Errorf("target already exists: %s (set overwrite to replace it)", newPath)
+	}
+	if err := s.SFTPClient.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// SymlinkRemote creates a symbolic link at linkPath pointing to target
+func (s *Session) SymlinkRemote(target, linkPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return err
+	}
+
+	if err := s.SFTPClient.Symlink(target, linkPath); err != nil {
+		return fmt.Errorf("symlink: %w", err)
+	}
+	return nil
+}
+
+// ReadLinkRemote returns the target of a symbolic link and the fully resolved path
+// (resolved is empty if the target does not exist)
+func (s *Session) ReadLinkRemote(linkPath string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return "", "", err
+	}
+
+	target, err := s.SFTPClient.ReadLink(linkPath)
+	if err != nil {
+		return "", "", fmt.Errorf("readlink: %w", err)
+	}
+
+	// 部分服务器的 realpath 不解析符号链接，先按链接所在目录拼接相对目标
+	resolved := ""
+	if _, err := s.SFTPClient.Stat(linkPath); err == nil {
+		full := target
+		if !path.IsAbs(full) {
+			full = path.Join(path.Dir(linkPath), target)
+		}
+		resolved, _ = s.SFTPClient.RealPath(full)
+	}
+
+	return target, resolved, nil
+}
+
+// TruncateRemoteFile sets the size of a remote file, extending it with zero bytes if needed
+func (s *Session) TruncateRemoteFile(remotePath string, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("size must not be negative")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastUsedAt = time.Now()
+	if err := s.ensureSFTP(); err != nil {
+		return err
+	}
+
+	if err := s.SFTPClient.Truncate(remotePath, size); err != nil {
+		return fmt.Errorf("truncate: %w", err)
+	}
+	return nil
+}
+
+// StatVFSRemote returns filesystem space information for the filesystem containing remotePath.
+// Uses the statvfs@openssh.com extension, falling back to df when the server lacks it.
+func (s *Session) StatVFSRemote(remotePath string) (*DiskUsage, error) {
+	s.mu.Lock()
+	s.LastUsedAt = time.Now()
+	// 没有 SFTP 时直接使用 df
+	supported := false
+	if s.ensureSFTP() == nil {
+		_, supported = s.SFTPClient.HasExtension("statvfs@openssh.com")
+	}
+	var vfs *sftp.StatVFS
+	var err error
+	if supported {
+		vfs, err = s.SFTPClient.StatVFS(remotePath)
+	}
+	s.mu.Unlock()
+
+	if supported {
+		if err != nil {
+			return nil, fmt.Errorf("statvfs: %w", err)
+		}
+		return diskUsageFromStatVFS(remotePath, vfs), nil
+	}
+
+	result, err := s.ExecuteCommand("df -Pk "+shellQuote(remotePath), 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("run df: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("df (exit %d): %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return parseDfOutput(remotePath, result.Stdout)
+}
+
+// diskUsageFromStatVFS converts a statvfs reply to DiskUsage
+func diskUsageFromStatVFS(remotePath string, vfs *sftp.StatVFS) *DiskUsage {
+	usage := &DiskUsage{
+		Path:           remotePath,
+		TotalBytes:     vfs.TotalSpace(),
+		FreeBytes:      vfs.FreeSpace(),
+		AvailableBytes: vfs.Bavail * vfs.Frsize,
+		TotalInodes:    vfs.Files,
+		FreeInodes:     vfs.Ffree,
+		BlockSize:      vfs.Frsize,
+		Source:         "statvfs",
+	}
+	usage.UsedBytes = usage.TotalBytes - usage.FreeBytes
+	usage.UsedPercent = usedPercent(usage.UsedBytes, usage.AvailableBytes)
+	return usage
+}
+
+// parseDfOutput parses POSIX "df -Pk" output
+func parseDfOutput(remotePath, output string) (*DiskUsage, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("unexpected df output: %q", output)
+	}
+
+	// 文件系统名称可能包含空格，从行尾取数值列
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("unexpected df output: %q", output)
+	}
+	n := len(fields)
+	var values [3]uint64
+	for i, field := range fields[n-5 : n-2] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected df output: %q", output)
+		}
+		values[i] = v * 1024
+	}
+
+	usage := &DiskUsage{
+		Path:           remotePath,
+		TotalBytes:     values[0],
+		UsedBytes:      values[1],
+		AvailableBytes: values[2],
+		FreeBytes:      values[0] - values[1],
+		Source:         "df",
+	}
+	usage.UsedPercent = usedPercent(usage.UsedBytes, usage.AvailableBytes)
+	return usage, nil
+}
+
+// usedPercent computes usage the way df does: used / (used + available)
+func usedPercent(used, available uint64) float64 {
+	if used+available == 0 {
+		return 0
+	}
+	return float64(used) * 100 / float64(used+available)
+}
+
+// FormatModeOctal formats a file mode as octal, including setuid, setgid and sticky bits
+func FormatModeOctal(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// fileModeFromOctal converts unix permission bits (including setuid/setgid/sticky) to os.FileMode
+func fileModeFromOctal(bits uint32) os.FileMode {
+	mode := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// parseChmodMode parses an octal or symbolic chmod mode relative to the current mode.
+// Symbolic clauses follow chmod(1): [ugoa]*[+-=][rwxXst]*, separated by commas.
+func parseChmodMode(spec string, current os.FileMode, isDir bool) (os.FileMode, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, fmt.Errorf("mode must not be empty")
+	}
+
+	if bits, err := strconv.ParseUint(spec, 8, 32); err == nil {
+		if bits > 07777 {
+			return 0, fmt.Errorf("invalid mode %q: out of range", spec)
+		}
+		return fileModeFromOctal(uint32(bits)), nil
+	}
+
+	mode := current & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	for _, clause := range strings.Split(spec, ",") {
+		i := 0
+		var who os.FileMode
+		var whoSpecial os.FileMode
+		for ; i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0; i++ {
+			switch clause[i] {
+			case 'u':
+				who |= 0700
+				whoSpecial |= os.ModeSetuid
+			case 'g':
+				who |= 0070
+				whoSpecial |= os.ModeSetgid
+			case 'o':
+				who |= 0007
+				whoSpecial |= os.ModeSticky
+			case 'a':
+				who |= 0777
+				whoSpecial |= os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+			}
+		}
+		if who == 0 {
+			who = 0777
+			whoSpecial = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+		}
+		if i >= len(clause) || strings.IndexByte("+-=", clause[i]) < 0 {
+			return 0, fmt.Errorf("invalid mode %q: expected octal (e.g. 0755) or symbolic (e.g. u+x,go-w)", spec)
+		}
+
+		for i < len(clause) {
+			op := clause[i]
+			if strings.IndexByte("+-=", op) < 0 {
+				return 0, fmt.Errorf("invalid mode %q: unexpected %q", spec, op)
+			}
+			i++
+
+			var perm, special os.FileMode
+			for ; i < len(clause) && strings.IndexByte("+-=", clause[i]) < 0; i++ {
+				switch clause[i] {
+				case 'r':
+					perm |= 0444
+				case 'w':
+					perm |= 0222
+				case 'x':
+					perm |= 0111
+				case 'X':
+					if isDir || mode&0111 != 0 {
+						perm |= 0111
+					}
+				case 's':
+					special |= os.ModeSetuid | os.ModeSetgid
+				case 't':
+					special |= os.ModeSticky
+				default:
+					return 0, fmt.Errorf("invalid mode %q: unknown permission %q", spec, clause[i])
+				}
+			}
+
+			perm &= who
+			special &= whoSpecial
+			switch op {
+			case '+':
+				mode |= perm | special
+			case '-':
+				mode &^= perm | special
+			case '=':
+				mode = mode&^(who|whoSpecial) | perm | special
+			}
+		}
+	}
+
+	return mode, nil
+}
+
+// readRemoteIDFile reads /etc/passwd or /etc/group over SFTP (caller must hold s.mu)
+func (s *Session) readRemoteIDFile(remotePath string) ([]idEntry, error) {
+	if err := s.ensureSFTP(); err != nil {
+		return nil, err
+	}
+	f, err := s.SFTPClient.Open(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseIDFile(string(data)), nil
+}
+
+// parseIDFile parses name:password:id:... lines from /etc/passwd or /etc/group
+func parseIDFile(content string) []idEntry {
+	var entries []idEntry
+	for _, line := range strings.Split(content, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, idEntry{Name: fields[0], ID: uint32(id)})
+	}
+	return entries
+}
+
+// lookupIDName returns the name for an id, or "" if unknown
+func lookupIDName(entries []idEntry, id uint32) string {
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry.Name
+		}
+	}
+	return ""
+}
+
+// lookupIDByName returns the id for a name
+func lookupIDByName(entries []idEntry, name string) (uint32, bool) {
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry.ID, true
+		}
+	}
+	return 0, false
+}
+
+// getentName resolves a uid/gid or name via getent (covers LDAP/NIS users); returns "" on failure
+func (s *Session) getentName(database, key string) string {
+	entries := s.getentEntries(database, key)
+	if len(entries) == 0 {
+		return ""
+	}
+	return entries[0].Name
+}
+
+// getentEntries runs getent for a single key and parses the result
+func (s *Session) getentEntries(database, key string) []idEntry {
+	result, err := s.ExecuteCommand(fmt.Sprintf("getent %s %s", database, shellQuote(key)), 10*time.Second)
+	if err != nil || result.ExitCode != 0 {
+		return nil
+	}
+	return parseIDFile(result.Stdout)
+}
+
+// resolveRemoteID resolves a user or group name (or numeric id) to an id; "" resolves to 0
+func (s *Session) resolveRemoteID(database, value string) (uint32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if id, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+
+	file := "/etc/passwd"
+	kind := "user"
+	if database == "group" {
+		file = "/etc/group"
+		kind = "group"
+	}
+
+	s.mu.Lock()
+	entries, _ := s.readRemoteIDFile(file)
+	s.mu.Unlock()
+
+	if id, ok := lookupIDByName(entries, value); ok {
+		return id, nil
+	}
+	if id, ok := lookupIDByName(s.getentEntries(database, value), value); ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("unknown %s: %s", kind, value)
+}
@@ -0,0 +1,92 @@
+package sshmcp
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFormatModeOctal tests octal formatting including special bits
+func TestFormatModeOctal(t *testing.T) {
+	assert.Equal(t, "0644", FormatModeOctal(0644))
+	assert.Equal(t, "0755", FormatModeOctal(os.ModeDir|0755))
+	assert.Equal(t, "4755", FormatModeOctal(os.ModeSetuid|0755))
+	assert.Equal(t, "1777", FormatModeOctal(os.ModeDir|os.ModeSticky|0777))
+	assert.Equal(t, os.ModeSetgid|0750, fileModeFromOctal(02750))
+}
+
+// TestParseChmodMode tests octal and symbolic chmod modes
+func TestParseChmodMode(t *testing.T) {
+	tests := []struct {
+		spec    string
+		current os.FileMode
+		isDir   bool
+		want    os.FileMode
+	}{
+		{"0600", 0644, false, 0600},
+		{"755", 0644, false, 0755},
+		{"4755", 0644, false, os.ModeSetuid | 0755},
+		{"u+x", 0644, false, 0744},
+		{"+x", 0644, false, 0755},
+		{"go-w", 0666, false, 0644},
+		{"a=r", 0755, false, 0444},
+		{"u=rwx,g=rx,o=", 0600, false, 0750},
+		{"a+X", 0644, false, 0644},
+		{"a+X", 0644, true, 0755},
+		{"a+X", 0744, false, 0755},
+		{"u+s", 0755, false, os.ModeSetuid | 0755},
+		{"+t", 0777, true, os.ModeSticky | 0777},
+		{"u+rw-x", 0700, false, 0600},
+	}
+
+	for _, tt := range tests {
+		got, err := parseChmodMode(tt.spec, tt.current, tt.isDir)
+		require.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.want, got, "%s on %04o", tt.spec, tt.current)
+	}
+
+	for _, spec := range []string{"", "99999", "u", "u+q", "z+x", "0800"} {
+		_, err := parseChmodMode(spec, 0644, false)
+		assert.Error(t, err, spec)
+	}
+}
+
+// TestParseIDFile tests parsing of /etc/passwd and /etc/group
+func TestParseIDFile(t *testing.T) {
+	passwd := "root:x:0:0:root:/root:/bin/bash\n# comment\nwww-data:x:33:33::/var/www:/usr/sbin/nologin\nbroken\n"
+	entries := parseIDFile(passwd)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "www-data", lookupIDName(entries, 33))
+	assert.Equal(t, "", lookupIDName(entries, 1000))
+
+	id, ok := lookupIDByName(entries, "root")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(0), id)
+
+	groups := parseIDFile("wheel:x:10:alice,bob\n")
+	assert.Equal(t, "wheel", lookupIDName(groups, 10))
+}
+
+// TestParseDfOutput tests parsing of df -Pk output
+func TestParseDfOutput(t *testing.T) {
+	output := "Filesystem     1024-blocks    Used Available Capacity Mounted on\n" +
+		"/dev/sda1         1000000  250000    700000      27% /\n"
+
+	usage, err := parseDfOutput("/", output)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000000*1024), usage.TotalBytes)
+	assert.Equal(t, uint64(250000*1024), usage.UsedBytes)
+	assert.Equal(t, uint64(700000*1024), usage.AvailableBytes)
+	assert.InDelta(t, 26.3, usage.UsedPercent, 0.1)
+	assert.Equal(t, "df", usage.Source)
+
+	// 文件系统名称包含空格
+	_, err = parseDfOutput("/mnt", "Filesystem 1024-blocks Used Available Capacity Mounted on\nmy share 100 50 50 50% /mnt\n")
+	assert.NoError(t, err)
+
+	_, err = parseDfOutput("/", "df: /missing: No such file or directory\n")
+	assert.Error(t, err)
+}
@@ -0,0 +1,621 @@
+package sshmcp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncDirection is the direction of a directory sync
+type SyncDirection string
+
+const (
+	// SyncPush 本地 → 远程
+	SyncPush SyncDirection = "push"
+	// SyncPull 远程 → 本地
+	SyncPull SyncDirection = "pull"
+)
+
+// SyncCompareMode determines how files are compared
+type SyncCompareMode string
+
+const (
+	// SyncCompareSizeMtime 比较文件大小和修改时间（快速，默认）
+	SyncCompareSizeMtime SyncCompareMode = "size_mtime"
+	// SyncCompareChecksum 大小相同时比较校验和（准确，较慢）
+	SyncCompareChecksum SyncCompareMode = "checksum"
+)
+
+// SyncOptions configures a directory sync
+type SyncOptions struct {
+	Direction         SyncDirection
+	Compare           SyncCompareMode
+	ChecksumAlgorithm string // Compare=checksum 时使用，默认 sha256
+
+	Delete      bool     // 删除目标端多余的文件
+	Include     []string // 只同步匹配的文件（glob，支持 **）
+	Exclude     []string // 排除匹配的路径（gitignore 语法）
+	IgnoreFiles []string // 源目录树中的忽略文件名，如 .gitignore
+
+	DryRun   bool // 只列出计划的操作，不实际执行
+	Preserve bool // 保留文件权限和修改时间
+}
+
+// SyncAction is a single planned or executed sync operation
+type SyncAction struct {
+	Action string `json:"action"` // mkdir, create, update, delete
+	Path   string `json:"path"`   // 相对路径（"/" 分隔）
+	Size   int64  `json:"size,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// SyncResult represents the result of a directory sync
+type SyncResult struct {
+	Direction        SyncDirection `json:"direction"`
+	DryRun           bool          `json:"dry_run"`
+	Actions          []SyncAction  `json:"actions"`
+	DirsCreated      int           `json:"dirs_created"`
+	Created          int           `json:"created"`
+	Updated          int           `json:"updated"`
+	Deleted          int           `json:"deleted"`
+	Unchanged        int           `json:"unchanged"`
+	Excluded         int           `json:"excluded"`
+	Skipped          int           `json:"skipped"` // 符号链接等不支持的文件类型
+	BytesTransferred int64         `json:"bytes_transferred"`
+	Duration         string        `json:"duration"`
+}
+
+// syncEntry describes a file or directory in a sync tree
+type syncEntry struct {
+	IsDir bool
+	Info  os.FileInfo
+}
+
+// syncTree maps slash-separated relative paths to entries
+type syncTree map[string]syncEntry
+
+// syncDiffFunc reports whether a file differs between source and destination, with a reason
+type syncDiffFunc func(rel string, src, dst os.FileInfo) (bool, string, error)
+
+// SyncDirectory synchronises a local and a remote directory tree, transferring only changed files
+func (s *Session) SyncDirectory(localPath, remotePath string, opts *SyncOptions) (*SyncResult, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	if opts.Direction == "" {
+		opts.Direction = SyncPush
+	}
+	if opts.Direction != SyncPush && opts.Direction != SyncPull {
+		return nil, fmt.Errorf("invalid sync direction: %s (valid: push, pull)", opts.Direction)
+	}
+	if opts.Compare == "" {
+		opts.Compare = SyncCompareSizeMtime
+	}
+	if opts.Compare != SyncCompareSizeMtime && opts.Compare != SyncCompareChecksum {
+		return nil, fmt.Errorf("invalid compare mode: %s (valid: size_mtime, checksum)", opts.Compare)
+	}
+	if opts.Compare == SyncCompareChecksum {
+		if _, err := newChecksumHash(opts.ChecksumAlgorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	localPath = filepath.Clean(localPath)
+	remotePath = path.Clean(remotePath)
+	startTime := time.Now()
+
+	// 第一阶段：列出两端目录树并加载忽略文件
+	s.mu.Lock()
+	s.LastUsedAt = time.Now()
+	localTree, remoteTree, filter, err := s.loadSyncTrees(localPath, remotePath, opts)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	srcTree, dstTree := localTree, remoteTree
+	if opts.Direction == SyncPull {
+		srcTree, dstTree = remoteTree, localTree
+	}
+
+	// 第二阶段：比较并生成计划（校验和比较需要执行远程命令，不能持有会话锁）
+	differ := s.syncDiffer(localPath, remotePath, opts)
+	result, err := planSync(srcTree, dstTree, filter, opts.Delete, differ)
+	if err != nil {
+		return nil, err
+	}
+	result.Direction = opts.Direction
+	result.DryRun = opts.DryRun
+
+	if dstTree == nil {
+		result.Actions = append([]SyncAction{{Action: "mkdir", Path: ".", Reason: "destination does not exist"}}, result.Actions...)
+	}
+
+	if opts.DryRun {
+		result.Duration = time.Since(startTime).String()
+		return result, nil
+	}
+
+	// 第三阶段：执行计划
+	s.mu.Lock()
+	err = s.executeSyncPlan(localPath, remotePath, srcTree, result, opts)
+	s.mu.Unlock()
+
+	result.Duration = time.Since(startTime).String()
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// loadSyncTrees lists both trees and builds the filter (caller must hold s.mu)
+func (s *Session) loadSyncTrees(localPath, remotePath string, opts *SyncOptions) (syncTree, syncTree, *syncFilter, error) {
+	if err := s.ensureSFTP(); err != nil {
+		return nil, nil, nil, err
+	}
+	localTree, err := listLocalSyncTree(localPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remoteTree, err := s.listRemoteSyncTree(remotePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	srcTree, srcRoot := localTree, localPath
+	if opts.Direction == SyncPull {
+		srcTree, srcRoot = remoteTree, remotePath
+	}
+	if srcTree == nil {
+		return nil, nil, nil, fmt.Errorf("source directory does not exist: %s", srcRoot)
+	}
+
+	filter := newSyncFilter(opts.Include, opts.Exclude)
+	for _, name := range opts.IgnoreFiles {
+		for _, rel := range sortedSyncPaths(srcTree) {
+			entry := srcTree[rel]
+			if entry.IsDir || path.Base(rel) != name {
+				continue
+			}
+
+			content, err := s.readSyncSourceFile(opts.Direction, localPath, remotePath, rel)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("read ignore file %s: %w", rel, err)
+			}
+			base := path.Dir(rel)
+			if base == "." {
+				base = ""
+			}
+			filter.addIgnoreFile(content, base)
+		}
+	}
+
+	return localTree, remoteTree, filter, nil
+}
+
+// readSyncSourceFile reads a small file from the source side (caller must hold s.mu)
+func (s *Session) readSyncSourceFile(direction SyncDirection, localPath, remotePath, rel string) (string, error) {
+	if direction == SyncPush {
+		data, err := os.ReadFile(filepath.Join(localPath, filepath.FromSlash(rel)))
+		return string(data), err
+	}
+
+	f, err := s.SFTPClient.Open(path.Join(remotePath, rel))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	return string(data), err
+}
+
+// listLocalSyncTree walks a local directory; returns nil if it does not exist
+func listLocalSyncTree(root string) (syncTree, error) {
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat local directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", root)
+	}
+
+	tree := syncTree{}
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		tree[filepath.ToSlash(rel)] = syncEntry{IsDir: info.IsDir(), Info: info}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk local directory: %w", err)
+	}
+
+	return tree, nil
+}
+
+// listRemoteSyncTree walks a remote directory; returns nil if it does not exist (caller must hold s.mu)
+func (s *Session) listRemoteSyncTree(root string) (syncTree, error) {
+	info, err := s.SFTPClient.Stat(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat remote directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", root)
+	}
+
+	tree := syncTree{}
+	walker := s.SFTPClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, fmt.Errorf("walk remote directory: %w", err)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		if rel == "" {
+			continue
+		}
+		info := walker.Stat()
+		tree[rel] = syncEntry{IsDir: info.IsDir(), Info: info}
+	}
+
+	return tree, nil
+}
+
+// syncDiffer returns the comparison function for the configured compare mode
+func (s *Session) syncDiffer(localPath, remotePath string, opts *SyncOptions) syncDiffFunc {
+	return func(rel string, src, dst os.FileInfo) (bool, string, error) {
+		if src.Size() != dst.Size() {
+			return true, "size changed", nil
+		}
+
+		if opts.Compare == SyncCompareSizeMtime {
+			// SFTP 只支持秒级时间戳
+			if src.ModTime().Unix() != dst.ModTime().Unix() {
+				return true, "mtime changed", nil
+			}
+			return false, "", nil
+		}
+
+		localSum, err := localFileChecksum(filepath.Join(localPath, filepath.FromSlash(rel)), opts.ChecksumAlgorithm)
+		if err != nil {
+			return false, "", err
+		}
+		remoteSum, err := s.RemoteChecksum(path.Join(remotePath, rel), opts.ChecksumAlgorithm)
+		if err != nil {
+			return false, "", err
+		}
+		if localSum != remoteSum {
+			return true, "checksum changed", nil
+		}
+		return false, "", nil
+	}
+}
+
+// localFileChecksum computes the checksum of a local file
+func localFileChecksum(localPath, algorithm string) (string, error) {
+	hasher, err := newChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// sortedSyncPaths returns the paths of a tree in lexical order (parents before children)
+func sortedSyncPaths(tree syncTree) []string {
+	paths := make([]string, 0, len(tree))
+	for rel := range tree {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// planSync compares source and destination trees and returns the ordered list of actions.
+// Actions are ordered: type-change deletes, mkdirs, file transfers, then extraneous deletes (deepest first).
+func planSync(src, dst syncTree, filter *syncFilter, deleteExtraneous bool, differ syncDiffFunc) (*SyncResult, error) {
+	result := &SyncResult{}
+	var replaced, mkdirs, transfers, deletes []SyncAction
+
+	// 需要创建的目录：未设置 include 时为全部目录，否则只创建包含被选中文件的目录
+	neededDirs := map[string]bool{}
+
+	for _, rel := range sortedSyncPaths(src) {
+		entry := src[rel]
+
+		if filter.excluded(rel, entry.IsDir) {
+			result.Excluded++
+			continue
+		}
+
+		if entry.IsDir {
+			if len(filter.includes) == 0 {
+				neededDirs[rel] = true
+			}
+			continue
+		}
+
+		if !entry.Info.Mode().IsRegular() {
+			result.Skipped++
+			continue
+		}
+		if !filter.included(rel) {
+			result.Excluded++
+			continue
+		}
+
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			neededDirs[dir] = true
+		}
+
+		existing, exists := dst[rel]
+		switch {
+		case !exists:
+			transfers = append(transfers, SyncAction{Action: "create", Path: rel, Size: entry.Info.Size(), Reason: "new file"})
+		case existing.IsDir || !existing.Info.Mode().IsRegular():
+			replaced = append(replaced, SyncAction{Action: "delete", Path: rel, Reason: "type changed"})
+			transfers = append(transfers, SyncAction{Action: "create", Path: rel, Size: entry.Info.Size(), Reason: "type changed"})
+		default:
+			changed, reason, err := differ(rel, entry.Info, existing.Info)
+			if err != nil {
+				return nil, fmt.Errorf("compare %s: %w", rel, err)
+			}
+			if !changed {
+				result.Unchanged++
+				continue
+			}
+			transfers = append(transfers, SyncAction{Action: "update", Path: rel, Size: entry.Info.Size(), Reason: reason})
+		}
+	}
+
+	dirs := make([]string, 0, len(neededDirs))
+	for dir := range neededDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		existing, exists := dst[dir]
+		if exists && existing.IsDir {
+			continue
+		}
+		if exists {
+			replaced = append(replaced, SyncAction{Action: "delete", Path: dir, Reason: "type changed"})
+		}
+		mkdirs = append(mkdirs, SyncAction{Action: "mkdir", Path: dir})
+	}
+
+	if deleteExtraneous {
+		replacedPaths := map[string]bool{}
+		for _, action := range replaced {
+			replacedPaths[action.Path] = true
+		}
+		deletes = planSyncDeletes(src, dst, filter, replacedPaths)
+	}
+
+	result.Actions = append(result.Actions, replaced...)
+	result.Actions = append(result.Actions, mkdirs...)
+	result.Actions = append(result.Actions, transfers...)
+	result.Actions = append(result.Actions, deletes...)
+
+	return result, nil
+}
+
+// planSyncDeletes lists destination entries missing from the source, deepest first.
+// Excluded or non-included paths are protected, and so are the directories containing them.
+// Entries below a replaced path are skipped since the replacement already removes them.
+func planSyncDeletes(src, dst syncTree, filter *syncFilter, replaced map[string]bool) []SyncAction {
+	var extraneous []string
+	for rel := range dst {
+		if _, exists := src[rel]; exists || underSyncPath(rel, replaced) {
+			continue
+		}
+		extraneous = append(extraneous, rel)
+	}
+
+	sort.Slice(extraneous, func(i, j int) bool {
+		di, dj := strings.Count(extraneous[i], "/"), strings.Count(extraneous[j], "/")
+		if di != dj {
+			return di > dj
+		}
+		return extraneous[i] < extraneous[j]
+	})
+
+	kept := map[string]bool{}
+	keepParents := func(rel string) {
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			kept[dir] = true
+		}
+	}
+
+	var deletes []SyncAction
+	for _, rel := range extraneous {
+		entry := dst[rel]
+		deletable := !filter.excluded(rel, entry.IsDir)
+		if entry.IsDir {
+			deletable = deletable && !kept[rel]
+		} else {
+			deletable = deletable && filter.included(rel)
+		}
+
+		if !deletable {
+			keepParents(rel)
+			continue
+		}
+		deletes = append(deletes, SyncAction{Action: "delete", Path: rel, Reason: "not in source"})
+	}
+
+	return deletes
+}
+
+// underSyncPath reports whether rel is below one of the given directories
+func underSyncPath(rel string, dirs map[string]bool) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// executeSyncPlan performs the planned actions (caller must hold s.mu)
+func (s *Session) executeSyncPlan(localPath, remotePath string, srcTree syncTree, result *SyncResult, opts *SyncOptions) error {
+	push := opts.Direction == SyncPush
+	dstPath := func(rel string) string {
+		if push {
+			return path.Join(remotePath, rel)
+		}
+		return filepath.Join(localPath, filepath.FromSlash(rel))
+	}
+
+	// 确保目标根目录存在
+	if push {
+		if err := s.SFTPClient.MkdirAll(remotePath); err != nil {
+			return fmt.Errorf("create remote directory: %w", err)
+		}
+	} else if err := os.MkdirAll(localPath, 0755); err != nil {
+		return fmt.Errorf("create local directory: %w", err)
+	}
+
+	var createdDirs []string
+	transferOpts := &TransferOptions{Overwrite: true}
+	var files []transferredFile
+
+	for _, action := range result.Actions {
+		if action.Path == "." {
+			continue
+		}
+		target := dstPath(action.Path)
+
+		switch action.Action {
+		case "delete":
+			var err error
+			if push {
+				if action.Reason == "type changed" {
+					err = s.SFTPClient.RemoveAll(target)
+				} else if info, statErr := s.SFTPClient.Lstat(target); statErr == nil && info.IsDir() {
+					err = s.SFTPClient.RemoveDirectory(target)
+				} else {
+					err = s.SFTPClient.Remove(target)
+				}
+			} else if action.Reason == "type changed" {
+				err = os.RemoveAll(target)
+			} else {
+				err = os.Remove(target)
+			}
+			if err != nil {
+				return fmt.Errorf("delete %s: %w", action.Path, err)
+			}
+			result.Deleted++
+
+		case "mkdir":
+			mode := os.FileMode(0755)
+			if entry, ok := srcTree[action.Path]; ok && opts.Preserve {
+				mode = entry.Info.Mode().Perm()
+			}
+			var err error
+			if push {
+				if err = s.SFTPClient.MkdirAll(target); err == nil && opts.Preserve {
+					err = s.SFTPClient.Chmod(target, mode)
+				}
+			} else {
+				if err = os.MkdirAll(target, 0755); err == nil && opts.Preserve {
+					err = os.Chmod(target, mode)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("mkdir %s: %w", action.Path, err)
+			}
+			createdDirs = append(createdDirs, action.Path)
+			result.DirsCreated++
+
+		case "create", "update":
+			info := srcTree[action.Path].Info
+			var transfer *FileTransferResult
+			var err error
+			if push {
+				localFile := filepath.Join(localPath, filepath.FromSlash(action.Path))
+				transfer, err = s.uploadSingleFile(localFile, target, info, false, transferOpts, &files)
+			} else {
+				remoteFile := path.Join(remotePath, action.Path)
+				transfer, err = s.downloadSingleFile(remoteFile, target, info, false, transferOpts, &files)
+			}
+			if err != nil {
+				return fmt.Errorf("transfer %s: %w", action.Path, err)
+			}
+			if opts.Preserve {
+				if err := s.preserveSyncAttributes(push, target, info); err != nil {
+					return fmt.Errorf("preserve attributes of %s: %w", action.Path, err)
+				}
+			}
+			result.BytesTransferred += transfer.BytesTransferred
+			if action.Action == "create" {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+	}
+
+	// 目录的修改时间会因写入文件而改变，最后再统一设置
+	if opts.Preserve {
+		for i := len(createdDirs) - 1; i >= 0; i-- {
+			rel := createdDirs[i]
+			if entry, ok := srcTree[rel]; ok {
+				if err := s.preserveSyncTimes(push, dstPath(rel), entry.Info.ModTime()); err != nil {
+					return fmt.Errorf("preserve mtime of %s: %w", rel, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// preserveSyncAttributes copies the permission bits and mtime of info to target (caller must hold s.mu)
+func (s *Session) preserveSyncAttributes(push bool, target string, info os.FileInfo) error {
+	if push {
+		if err := s.SFTPClient.Chmod(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+	} else if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return s.preserveSyncTimes(push, target, info.ModTime())
+}
+
+// preserveSyncTimes sets the mtime (and atime) of target (caller must hold s.mu)
+func (s *Session) preserveSyncTimes(push bool, target string, mtime time.Time) error {
+	if push {
+		return s.SFTPClient.Chtimes(target, mtime, mtime)
+	}
+	return os.Chtimes(target, mtime, mtime)
+}
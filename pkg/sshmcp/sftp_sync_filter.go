@@ -0,0 +1,177 @@
+package sshmcp
+
+import (
+	"path"
+	"strings"
+)
+
+// syncRule is a single gitignore-style pattern
+type syncRule struct {
+	pattern  string // 去掉 "!" 前缀和 "/" 后缀后的模式
+	negate   bool   // "!" 开头：重新包含
+	dirOnly  bool   // "/" 结尾：仅匹配目录
+	anchored bool   // 含有 "/"：相对于 base 目录匹配完整路径
+	base     string // 规则所在目录（相对路径，根目录为空）
+}
+
+// newSyncRule parses a gitignore-style pattern line, returning false for blank lines and comments
+func newSyncRule(line, base string) (syncRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return syncRule{}, false
+	}
+
+	rule := syncRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return syncRule{}, false
+	}
+	rule.pattern = line
+
+	return rule, true
+}
+
+// parseIgnoreRules parses the content of a .gitignore-style file located in base
+func parseIgnoreRules(content, base string) []syncRule {
+	var rules []syncRule
+	for _, line := range strings.Split(content, "\n") {
+		if rule, ok := newSyncRule(line, base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matches reports whether the rule matches a slash-separated relative path
+func (r syncRule) matches(rel string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, r.base+"/")
+	}
+
+	if r.anchored {
+		return matchGlobPath(r.pattern, rel)
+	}
+	return matchGlobPath(r.pattern, path.Base(rel))
+}
+
+// matchGlobPath matches a slash-separated path against a glob that may contain "**"
+func matchGlobPath(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchGlobSegments matches path segments, where "**" matches zero or more segments
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// syncFilter decides which paths take part in a sync
+type syncFilter struct {
+	includes []syncRule // 非空时，只有匹配的文件参与同步
+	rules    []syncRule // 排除规则（--exclude 与忽略文件），后出现的规则优先
+}
+
+// newSyncFilter creates a filter from include and exclude glob lists
+func newSyncFilter(include, exclude []string) *syncFilter {
+	f := &syncFilter{}
+	for _, pattern := range include {
+		if rule, ok := newSyncRule(pattern, ""); ok {
+			f.includes = append(f.includes, rule)
+		}
+	}
+	for _, pattern := range exclude {
+		if rule, ok := newSyncRule(pattern, ""); ok {
+			f.rules = append(f.rules, rule)
+		}
+	}
+	return f
+}
+
+// addIgnoreFile adds rules from a .gitignore-style file located in base
+func (f *syncFilter) addIgnoreFile(content, base string) {
+	f.rules = append(f.rules, parseIgnoreRules(content, base)...)
+}
+
+// excluded reports whether a path, or any of its parent directories, is excluded
+func (f *syncFilter) excluded(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if f.matchRules(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return f.matchRules(rel, isDir)
+}
+
+// matchRules applies exclude rules in order; the last matching rule wins
+func (f *syncFilter) matchRules(rel string, isDir bool) bool {
+	excluded := false
+	for _, rule := range f.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(rel) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// included reports whether a file matches the include list (always true when the list is empty)
+func (f *syncFilter) included(rel string) bool {
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, rule := range f.includes {
+		if rule.matches(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// selected reports whether a file takes part in the sync
+func (f *syncFilter) selected(rel string) bool {
+	return !f.excluded(rel, false) && f.included(rel)
+}
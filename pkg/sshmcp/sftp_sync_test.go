@@ -0,0 +1,253 @@
+package sshmcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFileInfo is a minimal os.FileInfo for planner tests
+type fakeFileInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (f fakeFileInfo) Name() string       { return f.name }
+func (f fakeFileInfo) Size() int64        { return f.size }
+func (f fakeFileInfo) Mode() os.FileMode  { return f.mode }
+func (f fakeFileInfo) ModTime() time.Time { return f.mtime }
+func (f fakeFileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f fakeFileInfo) Sys() any           { return nil }
+
+// fakeSyncTree builds a tree from paths; a trailing "/" marks a directory, "@" a symlink
+func fakeSyncTree(paths map[string]int64) syncTree {
+	tree := syncTree{}
+	for p, size := range paths {
+		mode := os.FileMode(0644)
+		switch {
+		case p[len(p)-1] == '/':
+			p = p[:len(p)-1]
+			mode = os.ModeDir | 0755
+		case p[len(p)-1] == '@':
+			p = p[:len(p)-1]
+			mode = os.ModeSymlink | 0777
+		}
+		tree[p] = syncEntry{IsDir: mode.IsDir(), Info: fakeFileInfo{name: filepath.Base(p), size: size, mode: mode}}
+	}
+	return tree
+}
+
+// sizeDiffer compares files by size only
+func sizeDiffer(rel string, src, dst os.FileInfo) (bool, string, error) {
+	if src.Size() != dst.Size() {
+		return true, "size changed", nil
+	}
+	return false, "", nil
+}
+
+// actionList flattens actions into "action path" strings
+func actionList(result *SyncResult) []string {
+	var list []string
+	for _, a := range result.Actions {
+		list = append(list, a.Action+" "+a.Path)
+	}
+	return list
+}
+
+// TestMatchGlobPath tests glob matching with "**"
+func TestMatchGlobPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "main.txt", false},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"**/testdata", "a/b/testdata", true},
+		{"**/testdata", "testdata", true},
+		{"build/**", "build/x/y", true},
+		{"build/**", "other/x", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchGlobPath(tt.pattern, tt.name), "%s ~ %s", tt.pattern, tt.name)
+	}
+}
+
+// TestSyncFilter_Exclude tests gitignore-style exclude semantics
+func TestSyncFilter_Exclude(t *testing.T) {
+	f := newSyncFilter(nil, []string{"*.log", "node_modules/", "/build", "!keep.log"})
+
+	assert.True(t, f.excluded("app.log", false))
+	assert.True(t, f.excluded("logs/app.log", false))
+	assert.False(t, f.excluded("keep.log", false), "negation re-includes")
+	assert.True(t, f.excluded("node_modules", true))
+	assert.True(t, f.excluded("web/node_modules/react/index.js", false), "excluded parent directory")
+	assert.False(t, f.excluded("node_modules", false), "dir-only pattern does not match files")
+	assert.True(t, f.excluded("build/out.bin", false))
+	assert.False(t, f.excluded("src/build/out.bin", false), "anchored pattern only matches at root")
+	assert.False(t, f.excluded("main.go", false))
+}
+
+// TestSyncFilter_IgnoreFile tests that ignore file rules are scoped to their directory
+func TestSyncFilter_IgnoreFile(t *testing.T) {
+	f := newSyncFilter(nil, nil)
+	f.addIgnoreFile("# comment\n\n*.tmp\n/local.conf\n", "sub")
+
+	assert.True(t, f.excluded("sub/a.tmp", false))
+	assert.True(t, f.excluded("sub/deep/a.tmp", false))
+	assert.False(t, f.excluded("a.tmp", false), "rules do not apply outside their directory")
+	assert.True(t, f.excluded("sub/local.conf", false))
+	assert.False(t, f.excluded("sub/deep/local.conf", false))
+}
+
+// TestSyncFilter_Include tests include lists
+func TestSyncFilter_Include(t *testing.T) {
+	f := newSyncFilter([]string{"*.go", "config/**"}, []string{"*_test.go"})
+
+	assert.True(t, f.selected("main.go"))
+	assert.True(t, f.selected("pkg/util.go"))
+	assert.True(t, f.selected("config/app/settings.yaml"))
+	assert.False(t, f.selected("README.md"))
+	assert.False(t, f.selected("pkg/util_test.go"), "exclude wins over include")
+
+	assert.True(t, newSyncFilter(nil, nil).selected("anything"))
+}
+
+// TestPlanSync_Basic tests create, update, unchanged and mkdir planning
+func TestPlanSync_Basic(t *testing.T) {
+	src := fakeSyncTree(map[string]int64{
+		"a.txt":       1,
+		"b.txt":       2,
+		"c.txt":       3,
+		"sub/":        0,
+		"sub/d.txt":   4,
+		"link@":       0,
+		"empty/":      0,
+		"empty/deep/": 0,
+	})
+	dst := fakeSyncTree(map[string]int64{
+		"a.txt":     1,
+		"b.txt":     20,
+		"extra.txt": 5,
+	})
+
+	result, err := planSync(src, dst, newSyncFilter(nil, nil), false, sizeDiffer)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"mkdir empty",
+		"mkdir empty/deep",
+		"mkdir sub",
+		"update b.txt",
+		"create c.txt",
+		"create sub/d.txt",
+	}, actionList(result))
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Equal(t, 1, result.Skipped)
+}
+
+// TestPlanSync_Delete tests extraneous deletes and their ordering
+func TestPlanSync_Delete(t *testing.T) {
+	src := fakeSyncTree(map[string]int64{"a.txt": 1})
+	dst := fakeSyncTree(map[string]int64{
+		"a.txt":         1,
+		"old/":          0,
+		"old/x.txt":     1,
+		"old/deep/":     0,
+		"old/deep/y.go": 1,
+		"debug.log":     1,
+	})
+
+	result, err := planSync(src, dst, newSyncFilter(nil, []string{"*.log"}), true, sizeDiffer)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"delete old/deep/y.go",
+		"delete old/deep",
+		"delete old/x.txt",
+		"delete old",
+	}, actionList(result), "excluded debug.log is protected")
+}
+
+// TestPlanSync_DeleteProtectsExcludedChildren tests that directories holding excluded files are kept
+func TestPlanSync_DeleteProtectsExcludedChildren(t *testing.T) {
+	src := fakeSyncTree(map[string]int64{"a.txt": 1})
+	dst := fakeSyncTree(map[string]int64{
+		"a.txt":         1,
+		"cache/":        0,
+		"cache/x.txt":   1,
+		"cache/app.log": 1,
+	})
+
+	result, err := planSync(src, dst, newSyncFilter(nil, []string{"*.log"}), true, sizeDiffer)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"delete cache/x.txt"}, actionList(result))
+}
+
+// TestPlanSync_TypeChanged tests replacing a directory with a file and vice versa
+func TestPlanSync_TypeChanged(t *testing.T) {
+	src := fakeSyncTree(map[string]int64{
+		"x":     1,
+		"y/":    0,
+		"y/z.c": 1,
+	})
+	dst := fakeSyncTree(map[string]int64{
+		"x/":      0,
+		"x/inner": 1,
+		"y":       1,
+	})
+
+	result, err := planSync(src, dst, newSyncFilter(nil, nil), true, sizeDiffer)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete x",
+		"delete y",
+		"mkdir y",
+		"create x",
+		"create y/z.c",
+	}, actionList(result), "entries below replaced paths are not deleted separately")
+}
+
+// TestPlanSync_Include tests that only directories holding included files are created
+func TestPlanSync_Include(t *testing.T) {
+	src := fakeSyncTree(map[string]int64{
+		"docs/":        0,
+		"docs/a.md":    1,
+		"src/":         0,
+		"src/main.go":  1,
+		"src/util.txt": 1,
+	})
+
+	result, err := planSync(src, nil, newSyncFilter([]string{"*.go"}, nil), false, sizeDiffer)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mkdir src", "create src/main.go"}, actionList(result))
+	assert.Equal(t, 2, result.Excluded)
+}
+
+// TestListLocalSyncTree tests walking a local directory
+func TestListLocalSyncTree(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a", "b", "f.txt"), []byte("hi"), 0644))
+
+	tree, err := listLocalSyncTree(root)
+	require.NoError(t, err)
+	assert.Len(t, tree, 3)
+	assert.True(t, tree["a/b"].IsDir)
+	assert.Equal(t, int64(2), tree["a/b/f.txt"].Info.Size())
+
+	tree, err = listLocalSyncTree(filepath.Join(root, "missing"))
+	require.NoError(t, err)
+	assert.Nil(t, tree)
+}
@@ -0,0 +1,295 @@
+package sshmcp
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Sources of the working directory reported by CurrentDir
+const (
+	CwdSourceOSC7   = "osc7"   // 提示符钩子发出的 OSC 7
+	CwdSourceProc   = "proc"   // 通过独立 exec 通道读取 /proc/<pid>/cwd
+	CwdSourcePrompt = "prompt" // 从提示符文本推断
+)
+
+const (
+	// osc7 reports the working directory as a file:// URL
+	osc7 = 7
+	// cwdExecTimeout bounds the side exec used for /proc and $HOME lookups
+	cwdExecTimeout = 3 * time.Second
+	// cwdProcCacheTTL is how long a /proc lookup result is reused
+	cwdProcCacheTTL = 2 * time.Second
+	// cwdProcFailureTTL is how long a failed /proc lookup (no /proc, timeout)
+	// suppresses further lookups
+	cwdProcFailureTTL = time.Minute
+)
+
+// cwdHookScript reports the shell pid and remote $HOME once, and installs a
+// prompt hook that emits OSC 7 before every prompt in bash and zsh. The hook
+// runs first and keeps $?, so the directory is already updated when the OSC
+// 133 D marker reports the exit status, which is why zsh prepends to
+// precmd_functions instead of using add-zsh-hook (it appends). The zsh array
+// syntax is wrapped in eval so that, like shellIntegrationScript, the script
+// stays valid POSIX sh syntax; other shells only report the pid and fall back
+// to /proc. The hook percent-encodes $PWD byte by byte (LC_ALL=C) like other
+// OSC 7 emitters, so parseOSC7 can always decode it.
+const cwdHookScript = ` if [ -z "$__sshmcp_cwd" ]; then __sshmcp_cwd=1; ` +
+	`printf '\033]6973;sshmcp;shell;pid=%s;home=%s\007' "$$" "$HOME"; ` +
+	`if [ -n "$BASH_VERSION$ZSH_VERSION" ]; then ` +
+	`__sshmcp_osc7() { local s=$? LC_ALL=C p=$PWD u= c; while [ -n "$p" ]; do c=${p%"${p#?}"}; p=${p#?}; ` +
+	`case $c in [A-Za-z0-9/._~-]) u=$u$c;; *) u=$u$(printf '%%%02X' "'$c");; esac; done; ` +
+	`printf '\033]7;file://%s%s\007' "${HOSTNAME:-$HOST}" "$u"; return $s; }; ` +
+	`if [ -n "$BASH_VERSION" ]; then PROMPT_COMMAND="__sshmcp_osc7${PROMPT_COMMAND:+;$PROMPT_COMMAND}"; ` +
+	`else eval 'precmd_functions=(__sshmcp_osc7 $precmd_functions)'; fi; ` +
+	`fi; fi`
+
+// cwdTracker parses OSC 7 and the hook's pid/home report from shell output
+type cwdTracker struct {
+	mu        sync.Mutex
+	parser    *ansi.Parser
+	cwd       string // 最近一次 OSC 7 报告的目录
+	pid       int    // 钩子报告的 shell 进程号
+	home      string // 远程用户的 $HOME
+	homeTried bool   // 已通过 exec 查询过 $HOME（无论成功与否）
+
+	// 最近一次读取 /proc/<pid>/cwd 的结果，空表示失败
+	procDir string
+	procAt  time.Time
+}
+
+func newCwdTracker() *cwdTracker {
+	t := &cwdTracker{parser: ansi.NewParser()}
+	t.parser.SetParamsSize(32)
+	t.parser.SetDataSize(4096)
+	t.parser.SetHandler(ansi.Handler{HandleOsc: t.handleOsc})
+	return t
+}
+
+// Write feeds raw shell output into the tracker
+func (t *cwdTracker) Write(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.parser.Parse(data)
+}
+
+// handleOsc processes OSC 7 and the hook report (caller must hold t.mu)
+func (t *cwdTracker) handleOsc(cmd int, data []byte) {
+	switch cmd {
+	case osc7:
+		if dir, ok := parseOSC7(string(data)); ok {
+			t.cwd = dir
+		}
+	case oscIntegration:
+		report, ok := strings.CutPrefix(string(data), "6973;sshmcp;shell;pid=")
+		if !ok {
+			return
+		}
+		// $HOME 放在最后，可能包含分号
+		pid, home, _ := strings.Cut(report, ";home=")
+		if n, err := strconv.Atoi(pid); err == nil && n > 0 {
+			t.pid = n
+		}
+		if strings.HasPrefix(home, "/") {
+			t.home = home
+		}
+	}
+}
+
+// state returns the OSC 7 directory, the shell pid and the remote home
+func (t *cwdTracker) state() (string, int, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cwd, t.pid, t.home
+}
+
+// setHome records the result of looking up the remote home over a side
+// exec; a failed lookup ("") is not retried
+func (t *cwdTracker) setHome(home string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.homeTried = true
+	if t.home == "" {
+		t.home = home
+	}
+}
+
+// homeLookup returns the remote home and whether looking it up again is pointless
+func (t *cwdTracker) homeLookup() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.home, t.home != "" || t.homeTried
+}
+
+// setProc records the result of a /proc lookup ("" when it failed)
+func (t *cwdTracker) setProc(dir string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.procDir, t.procAt = dir, time.Now()
+}
+
+// cachedProc returns the last /proc lookup result and whether it is still
+// fresh; failures are kept longer since they rarely change
+func (t *cwdTracker) cachedProc() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.procAt.IsZero() {
+		return "", false
+	}
+	ttl := cwdProcCacheTTL
+	if t.procDir == "" {
+		ttl = cwdProcFailureTTL
+	}
+	return t.procDir, time.Since(t.procAt) < ttl
+}
+
+// parseOSC7 extracts the path from an OSC 7 payload such as
+// "7;file://host/home/me/my%20dir"
+func parseOSC7(data string) (string, bool) {
+	_, uri, ok := strings.Cut(data, ";")
+	if !ok {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(uri, "file://")
+	if !ok {
+		if rest, ok = strings.CutPrefix(uri, "kitty-shell-cwd://"); !ok {
+			return "", false
+		}
+	}
+
+	// 跳过主机名
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return "", false
+	}
+	dir := rest[i:]
+	// 路径按标准百分号编码（包括 cwdHookScript）；解码失败时按原样使用
+	if decoded, err := url.PathUnescape(dir); err == nil {
+		dir = decoded
+	}
+	return dir, true
+}
+
+// expandHome expands a leading ~ in a prompt path using the remote home
+func expandHome(dir, home string) string {
+	if home == "" {
+		return dir
+	}
+	if dir == "~" {
+		return home
+	}
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		return strings.TrimSuffix(home, "/") + "/" + rest
+	}
+	return dir
+}
+
+// CurrentDir returns the shell's working directory and where it came from:
+// the last OSC 7 report, else /proc/<pid>/cwd of the shell read over a
+// separate exec channel, else the directory shown in the prompt with ~
+// expanded to the remote home. It returns "" when none is available.
+// Lookups over SSH may block for up to cwdExecTimeout; their results, found
+// or not, are cached.
+func (ss *SSHShellSession) CurrentDir() (string, string) {
+	if ss.cwd == nil {
+		return ss.cachedCurrentDir()
+	}
+	cwd, pid, _ := ss.cwd.state()
+	if cwd != "" {
+		return cwd, CwdSourceOSC7
+	}
+
+	if pid > 0 {
+		dir, fresh := ss.cwd.cachedProc()
+		if !fresh {
+			out, err := ss.sideExec(fmt.Sprintf("readlink /proc/%d/cwd", pid))
+			dir = strings.TrimRight(out, "\r\n")
+			if err != nil || !strings.HasPrefix(dir, "/") {
+				dir = ""
+			}
+			ss.cwd.setProc(dir)
+		}
+		if dir != "" {
+			return dir, CwdSourceProc
+		}
+	}
+
+	if _, done := ss.cwd.homeLookup(); !done && strings.HasPrefix(ss.promptDir(), "~") {
+		ss.lookupRemoteHome()
+	}
+	return ss.cachedCurrentDir()
+}
+
+// cachedCurrentDir is CurrentDir without any SSH lookups: the OSC 7 report,
+// else the last successful /proc result, else the prompt directory with ~
+// expanded if the remote home is already known
+func (ss *SSHShellSession) cachedCurrentDir() (string, string) {
+	var home string
+	if ss.cwd != nil {
+		cwd, _, h := ss.cwd.state()
+		if cwd != "" {
+			return cwd, CwdSourceOSC7
+		}
+		if dir, _ := ss.cwd.cachedProc(); dir != "" {
+			return dir, CwdSourceProc
+		}
+		home = h
+	}
+
+	dir := ss.promptDir()
+	if dir == "" {
+		return "", ""
+	}
+	return expandHome(dir, home), CwdSourcePrompt
+}
+
+// promptDir returns the directory last seen in the prompt
+func (ss *SSHShellSession) promptDir() string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.currentDir
+}
+
+// lookupRemoteHome looks up the remote user's $HOME over a side exec once
+func (ss *SSHShellSession) lookupRemoteHome() {
+	out, err := ss.sideExec(`printf '%s' "$HOME"`)
+	if err != nil || !strings.HasPrefix(out, "/") {
+		out = ""
+	}
+	ss.cwd.setHome(out)
+}
+
+// sideExec runs a command on a new channel of the shell's SSH connection,
+// without touching the shell or the session's command history
+func (ss *SSHShellSession) sideExec(command string) (string, error) {
+	if ss.client == nil {
+		return "", fmt.Errorf("SSH client is not available")
+	}
+	session, err := ss.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := session.Output(command)
+		done <- result{out, err}
+	}()
+
+	select {
+	case r := <-done:
+		return string(r.out), r.err
+	case <-time.After(cwdExecTimeout):
+		return "", fmt.Errorf("command timed out after %s", cwdExecTimeout)
+	}
+}
@@ -0,0 +1,182 @@
+package sshmcp
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseOSC7 tests extracting the path from OSC 7 payloads
+func TestParseOSC7(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+		ok   bool
+	}{
+		{"7;file://host/home/me", "/home/me", true},
+		{"7;file:///tmp", "/tmp", true},
+		{"7;file://host/home/me/my%20dir", "/home/me/my dir", true},
+		{"7;file://host/srv/100%", "/srv/100%", true},
+		{"7;kitty-shell-cwd://host/opt", "/opt", true},
+		{"7;file://host", "", false},
+		{"7;http://host/x", "", false},
+		{"7", "", false},
+	}
+	for _, tt := range tests {
+		dir, ok := parseOSC7(tt.data)
+		assert.Equal(t, tt.ok, ok, tt.data)
+		assert.Equal(t, tt.want, dir, tt.data)
+	}
+}
+
+// TestCwdTracker tests OSC 7 and the hook report split across writes
+func TestCwdTracker(t *testing.T) {
+	tracker := newCwdTracker()
+	tracker.Write([]byte("\x1b]6973;sshmcp;shell;pid=4242;home=/home/deploy\x07"))
+	// Shell 集成的报告不影响目录跟踪
+	tracker.Write([]byte("\x1b]6973;sshmcp;integration=bash\x07\x1b]7;file://web-1/var/"))
+	cwd, pid, home := tracker.state()
+	assert.Equal(t, "", cwd)
+	assert.Equal(t, 4242, pid)
+	assert.Equal(t, "/home/deploy", home)
+
+	tracker.Write([]byte("log\x07deploy@web-1:/var/log$ "))
+	cwd, _, _ = tracker.state()
+	assert.Equal(t, "/var/log", cwd)
+
+	// 查询到的 $HOME 不覆盖钩子报告的值
+	tracker.setHome("/root")
+	_, _, home = tracker.state()
+	assert.Equal(t, "/home/deploy", home)
+}
+
+// TestExtractCurrentDir tests guessing the directory from prompts
+func TestExtractCurrentDir(t *testing.T) {
+	assert.Equal(t, "~/src", extractCurrentDir("ls\nfoo\ndeploy@web-1:~/src$ "))
+	assert.Equal(t, "/etc", extractCurrentDir("[root@centos /etc]# "))
+	assert.Equal(t, "~", extractCurrentDir("~$"))
+	assert.Equal(t, "", extractCurrentDir("no prompt here"))
+
+	assert.Equal(t, "/home/deploy", expandHome("~", "/home/deploy"))
+	assert.Equal(t, "/home/deploy/src", expandHome("~/src", "/home/deploy/"))
+	assert.Equal(t, "~other", expandHome("~other", "/home/deploy"))
+	assert.Equal(t, "~/src", expandHome("~/src", ""))
+}
+
+// TestCurrentDir_Sources tests the OSC 7, /proc and prompt fallbacks
+func TestCurrentDir_Sources(t *testing.T) {
+	ss := &SSHShellSession{cwd: newCwdTracker()}
+	dir, source := ss.CurrentDir()
+	assert.Equal(t, "", dir)
+	assert.Equal(t, "", source)
+
+	// 没有 SSH 连接时无法读取 /proc，使用提示符并按远程 $HOME 展开
+	ss.cwd.Write([]byte("\x1b]6973;sshmcp;shell;pid=99;home=/home/deploy\x07"))
+	ss.currentDir = "~/src"
+	dir, source = ss.CurrentDir()
+	assert.Equal(t, "/home/deploy/src", dir)
+	assert.Equal(t, CwdSourcePrompt, source)
+
+	ss.cwd.Write([]byte("\x1b]7;file://web-1/srv/app\x1b\\"))
+	dir, source = ss.CurrentDir()
+	assert.Equal(t, "/srv/app", dir)
+	assert.Equal(t, CwdSourceOSC7, source)
+}
+
+// TestCurrentDir_Cache tests that /proc and $HOME lookups are cached, and
+// that GetStatus never performs them
+func TestCurrentDir_Cache(t *testing.T) {
+	ss := &SSHShellSession{cwd: newCwdTracker()}
+	ss.cwd.Write([]byte("\x1b]6973;sshmcp;shell;pid=99;home=\x07"))
+	ss.currentDir = "~/src"
+
+	// 无缓存时 GetStatus 使用的版本不查询
+	_, fresh := ss.cwd.cachedProc()
+	assert.False(t, fresh)
+	dir, source := ss.cachedCurrentDir()
+	assert.Equal(t, "~/src", dir)
+	assert.Equal(t, CwdSourcePrompt, source)
+	_, fresh = ss.cwd.cachedProc()
+	assert.False(t, fresh)
+	_, tried := ss.cwd.homeLookup()
+	assert.False(t, tried)
+
+	// 查询失败的结果同样缓存，不会每次重试
+	dir, _ = ss.CurrentDir()
+	assert.Equal(t, "~/src", dir)
+	procDir, fresh := ss.cwd.cachedProc()
+	assert.Equal(t, "", procDir)
+	assert.True(t, fresh)
+	_, tried = ss.cwd.homeLookup()
+	assert.True(t, tried)
+
+	// 成功的结果在 GetStatus 中直接使用
+	ss.cwd.setProc("/opt/app")
+	dir, source = ss.cachedCurrentDir()
+	assert.Equal(t, "/opt/app", dir)
+	assert.Equal(t, CwdSourceProc, source)
+}
+
+// TestPromptHookScripts_Syntax tests that the hooks typed into the shell parse
+// in POSIX sh as well as bash, alone and joined into one line
+func TestPromptHookScripts_Syntax(t *testing.T) {
+	scripts := map[string]string{
+		"integration": shellIntegrationScript,
+		"cwd":         cwdHookScript,
+		"both":        shellIntegrationScript + ";" + cwdHookScript,
+	}
+	for _, shell := range []string{"sh", "dash", "bash", "zsh"} {
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			continue
+		}
+		for name, script := range scripts {
+			out, err := exec.Command(path, "-n", "-c", script).CombinedOutput()
+			assert.NoError(t, err, "%s %s: %s", shell, name, out)
+		}
+	}
+}
+
+// TestCwdHookScript_OSC7 tests that the bash hook reports directories with
+// spaces, percent signs and non-ASCII characters unchanged
+func TestCwdHookScript_OSC7(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	dir := filepath.Join(t.TempDir(), "my dir 100%25 é")
+	require.NoError(t, os.Mkdir(dir, 0755))
+
+	cmd := exec.Command(bash, "-c", cwdHookScript+`; cd "$1" && __sshmcp_osc7`, "bash", dir)
+	cmd.Env = []string{"HOME=/home/deploy", "LANG=C.UTF-8"}
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	tracker := newCwdTracker()
+	tracker.Write(out)
+	cwd, _, _ := tracker.state()
+	assert.Equal(t, dir, cwd)
+}
+
+// TestCwdHookScript_Report tests that a shell without prompt hooks still
+// reports its pid and home
+func TestCwdHookScript_Report(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	cmd := exec.Command(sh, "-c", shellIntegrationScript+";"+cwdHookScript)
+	cmd.Env = []string{"HOME=/home/deploy"}
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	tracker := newCwdTracker()
+	tracker.Write(out)
+	_, pid, home := tracker.state()
+	assert.Greater(t, pid, 0)
+	assert.Equal(t, "/home/deploy", home)
+}
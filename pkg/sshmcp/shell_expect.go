@@ -0,0 +1,378 @@
+package sshmcp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	// DefaultExpectTimeout is used when ExpectOptions.Timeout is zero
+	DefaultExpectTimeout = 30 * time.Second
+	// MaxExpectTimeout caps how long a single Expect call may block
+	MaxExpectTimeout = 10 * time.Minute
+	// DefaultExpectMaxMatches limits how many continue-matches one call may handle
+	DefaultExpectMaxMatches = 20
+	// expectStreamLimit is the maximum amount of unconsumed text kept for matching
+	expectStreamLimit = 256 * 1024
+)
+
+// ExpectPattern is one alternative an Expect call waits for
+type ExpectPattern struct {
+	Pattern     string `json:"pattern"`                // Go RE2 正则表达式
+	Response    string `json:"response,omitempty"`     // 匹配后发送的文本，换行按回车发送
+	SpecialChar string `json:"special_char,omitempty"` // 匹配后发送的特殊按键（在 Response 之后）
+	Continue    bool   `json:"continue,omitempty"`     // 匹配并应答后继续等待（类似 exp_continue）
+}
+
+// ExpectOptions configures Expect
+type ExpectOptions struct {
+	Patterns   []ExpectPattern
+	Input      string        // 等待前先发送的输入（发送前丢弃未匹配的旧输出）
+	Timeout    time.Duration // 总超时，默认 DefaultExpectTimeout
+	Screen     bool          // 匹配终端渲染后的屏幕而非输出流
+	MaxMatches int           // continue 模式下最多匹配次数，默认 DefaultExpectMaxMatches
+}
+
+// ExpectMatch describes one successful pattern match
+type ExpectMatch struct {
+	Index     int      `json:"index"`
+	Pattern   string   `json:"pattern"`
+	Match     string   `json:"match"`
+	Groups    []string `json:"groups,omitempty"`
+	Before    string   `json:"before"`
+	Responded bool     `json:"responded"`
+}
+
+// ExpectResult represents the result of an Expect call
+type ExpectResult struct {
+	Matches  []ExpectMatch `json:"matches"`
+	TimedOut bool          `json:"timed_out"`
+	Pending  string        `json:"pending,omitempty"` // 超时时尚未匹配的输出（或当前屏幕）
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// expectStream accumulates the plain-text shell output that Expect matches
+// against. ANSI sequences are removed by a streaming parser, so sequences
+// split across reads do not leak into the text.
+type expectStream struct {
+	mu     sync.Mutex
+	text   []byte
+	parser *ansi.Parser
+	notify chan struct{}
+	closed bool
+}
+
+func newExpectStream() *expectStream {
+	es := &expectStream{notify: make(chan struct{})}
+	es.parser = ansi.NewParser()
+	es.parser.SetParamsSize(32)
+	es.parser.SetDataSize(1024)
+	es.parser.SetHandler(ansi.Handler{
+		Print: func(r rune) {
+			es.text = utf8.AppendRune(es.text, r)
+		},
+		Execute: func(b byte) {
+			// 只保留换行和制表符，\r 等控制字符丢弃
+			if b == '\n' || b == '\t' {
+				es.text = append(es.text, b)
+			}
+		},
+	})
+	return es
+}
+
+// Write feeds raw shell output into the stream and wakes up waiters
+func (es *expectStream) Write(data []byte) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.parser.Parse(data)
+	if len(es.text) > expectStreamLimit {
+		cut := len(es.text) - expectStreamLimit
+		for cut < len(es.text) && !utf8.RuneStart(es.text[cut]) {
+			cut++
+		}
+		es.text = append(es.text[:0], es.text[cut:]...)
+	}
+	es.broadcast()
+}
+
+// Close marks the stream as finished (shell output reached EOF)
+func (es *expectStream) Close() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.closed = true
+	es.broadcast()
+}
+
+// Discard drops all unconsumed text
+func (es *expectStream) Discard() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.text = es.text[:0]
+}
+
+// changed returns a channel that is closed on the next write
+func (es *expectStream) changed() <-chan struct{} {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.notify
+}
+
+// broadcast wakes up all waiters (caller must hold es.mu)
+func (es *expectStream) broadcast() {
+	close(es.notify)
+	es.notify = make(chan struct{})
+}
+
+// isClosed reports whether the shell output reached EOF
+func (es *expectStream) isClosed() bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.closed
+}
+
+// pending returns the unconsumed text
+func (es *expectStream) pending() string {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return string(es.text)
+}
+
+// match finds the earliest match among patterns and consumes the text up to
+// its end. It reports whether the stream is closed.
+func (es *expectStream) match(patterns []*regexp.Regexp) (*ExpectMatch, bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	m, end := earliestMatch(string(es.text), patterns)
+	if m != nil {
+		es.text = append(es.text[:0], es.text[end:]...)
+	}
+	return m, es.closed
+}
+
+// earliestMatch returns the match that starts first in text (ties go to the
+// lower pattern index) and the offset where it ends
+func earliestMatch(text string, patterns []*regexp.Regexp) (*ExpectMatch, int) {
+	return earliestMatchFunc(text, patterns, nil)
+}
+
+// earliestMatchFunc is earliestMatch restricted to matches whose start offset
+// keep accepts; a nil keep accepts every match
+func earliestMatchFunc(text string, patterns []*regexp.Regexp, keep func(start int) bool) (*ExpectMatch, int) {
+	var best []int
+	bestIndex := -1
+	for i, re := range patterns {
+		var loc []int
+		if keep == nil {
+			loc = re.FindStringSubmatchIndex(text)
+		} else {
+			for _, l := range re.FindAllStringSubmatchIndex(text, -1) {
+				if keep(l[0]) {
+					loc = l
+					break
+				}
+			}
+		}
+		if loc == nil {
+			continue
+		}
+		if best == nil || loc[0] < best[0] {
+			best = loc
+			bestIndex = i
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+
+	m := &ExpectMatch{
+		Index:   bestIndex,
+		Pattern: patterns[bestIndex].String(),
+		Match:   text[best[0]:best[1]],
+		Before:  text[:best[0]],
+	}
+	for g := 2; g < len(best); g += 2 {
+		if best[g] < 0 {
+			m.Groups = append(m.Groups, "")
+			continue
+		}
+		m.Groups = append(m.Groups, text[best[g]:best[g+1]])
+	}
+	return m, best[1]
+}
+
+// screenMatch remembers the screen row a match was found on, so that continue
+// mode does not answer the same prompt again while it is still on screen
+type screenMatch struct {
+	scrolled uint64 // 匹配时累计滚出屏幕的行数
+	row      int
+	line     string
+}
+
+// matchScreen finds the earliest match on the captured screen that is not on
+// a row answered before: a row counts as answered while it keeps its content,
+// following it up as the screen scrolls
+func matchScreen(capture ScreenCapture, patterns []*regexp.Regexp, answered []screenMatch) (*ExpectMatch, screenMatch) {
+	screen := capture.Plain()
+	lines := strings.Split(screen, "\n")
+	rowAt := func(start int) screenMatch {
+		row := strings.Count(screen[:start], "\n")
+		return screenMatch{scrolled: capture.scrolled, row: row, line: lines[row]}
+	}
+
+	m, _ := earliestMatchFunc(screen, patterns, func(start int) bool {
+		at := rowAt(start)
+		for _, a := range answered {
+			// 滚屏后之前的行上移
+			shift := capture.scrolled - a.scrolled
+			if uint64(a.row) >= shift && a.row-int(shift) == at.row && a.line == at.line {
+				return false
+			}
+		}
+		return true
+	})
+	if m == nil {
+		return nil, screenMatch{}
+	}
+	return m, rowAt(len(m.Before))
+}
+
+// Expect blocks until the shell output (or the rendered screen) matches one
+// of the patterns, optionally answering each match, or the timeout expires.
+// A timeout is reported in the result rather than as an error.
+func (ss *SSHShellSession) Expect(ctx context.Context, opts *ExpectOptions) (*ExpectResult, error) {
+	if opts == nil || len(opts.Patterns) == 0 {
+		return nil, fmt.Errorf("at least one pattern is required")
+	}
+	if ss.expect == nil {
+		return nil, fmt.Errorf("expect is not available for this shell")
+	}
+
+	patterns := make([]*regexp.Regexp, len(opts.Patterns))
+	for i, p := range opts.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %d %q: %w", i, p.Pattern, err)
+		}
+		patterns[i] = re
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExpectTimeout
+	}
+	if timeout > MaxExpectTimeout {
+		timeout = MaxExpectTimeout
+	}
+	maxMatches := opts.MaxMatches
+	if maxMatches <= 0 {
+		maxMatches = DefaultExpectMaxMatches
+	}
+
+	start := time.Now()
+	result := &ExpectResult{}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// 屏幕模式下，发送输入或应答后需等待屏幕变化再匹配，避免旧屏幕内容立即命中；
+	// 已应答的行在内容改变前不再匹配
+	waitForChange := false
+	var answered []screenMatch
+	if opts.Input != "" {
+		ss.expect.Discard()
+		if err := ss.WriteInput(strings.ReplaceAll(opts.Input, "\n", "\r")); err != nil {
+			return nil, fmt.Errorf("write input: %w", err)
+		}
+		waitForChange = opts.Screen
+	}
+
+	for {
+		// 先取通知 channel 再匹配，避免错过匹配期间到达的输出
+		changed := ss.expect.changed()
+
+		if !waitForChange {
+			var m *ExpectMatch
+			var closed bool
+			if opts.Screen {
+				var at screenMatch
+				m, at = matchScreen(ss.CaptureTerminal(), patterns, answered)
+				if m != nil {
+					answered = append(answered, at)
+				}
+				closed = ss.expect.isClosed()
+			} else {
+				m, closed = ss.expect.match(patterns)
+			}
+
+			if m != nil {
+				p := opts.Patterns[m.Index]
+				if p.Response != "" || p.SpecialChar != "" {
+					if err := ss.respond(p); err != nil {
+						result.Elapsed = time.Since(start)
+						return result, err
+					}
+					m.Responded = true
+				}
+				result.Matches = append(result.Matches, *m)
+
+				if !p.Continue || len(result.Matches) >= maxMatches {
+					result.Elapsed = time.Since(start)
+					return result, nil
+				}
+				waitForChange = opts.Screen
+				continue
+			}
+
+			if closed {
+				result.Elapsed = time.Since(start)
+				return result, fmt.Errorf("shell output closed before any pattern matched")
+			}
+		}
+
+		select {
+		case <-changed:
+			waitForChange = false
+		case <-timer.C:
+			result.TimedOut = true
+			result.Elapsed = time.Since(start)
+			if opts.Screen {
+				result.Pending = ss.GetTerminalSnapshot()
+			} else {
+				result.Pending = ss.expect.pending()
+			}
+			return result, nil
+		case <-ctx.Done():
+			result.Elapsed = time.Since(start)
+			return result, ctx.Err()
+		case <-ss.done:
+			result.Elapsed = time.Since(start)
+			return result, fmt.Errorf("shell closed")
+		}
+	}
+}
+
+// respond sends the response configured for a matched pattern
+func (ss *SSHShellSession) respond(p ExpectPattern) error {
+	if p.Response != "" {
+		if err := ss.WriteInput(strings.ReplaceAll(p.Response, "\n", "\r")); err != nil {
+			return fmt.Errorf("send response: %w", err)
+		}
+	}
+	if p.SpecialChar != "" {
+		if err := ss.WriteSpecialChars(p.SpecialChar); err != nil {
+			return fmt.Errorf("send special character: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package sshmcp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nopWriteCloser records shell input written by Expect responses
+type nopWriteCloser struct {
+	bytes.Buffer
+}
+
+func (w *nopWriteCloser) Close() error { return nil }
+
+var _ io.WriteCloser = (*nopWriteCloser)(nil)
+
+// TestExpectStream_StripsSplitSequences tests that ANSI sequences split across writes are removed
+func TestExpectStream_StripsSplitSequences(t *testing.T) {
+	es := newExpectStream()
+	es.Write([]byte("\x1b[1;3"))
+	es.Write([]byte("1mError\x1b[0m: bad\r\n\x1b]0;ti"))
+	es.Write([]byte("tle\x07Password: "))
+
+	assert.Equal(t, "Error: bad\nPassword: ", es.pending())
+}
+
+// TestExpectStream_MatchConsumes tests earliest-match selection and consumption
+func TestExpectStream_MatchConsumes(t *testing.T) {
+	es := newExpectStream()
+	es.Write([]byte("building...\nversion 1.2.3\n$ "))
+
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`\$ $`),
+		regexp.MustCompile(`version (\d+)\.(\d+)`),
+	}
+	m, closed := es.match(patterns)
+	require.NotNil(t, m)
+	assert.False(t, closed)
+	assert.Equal(t, 1, m.Index)
+	assert.Equal(t, "version 1.2", m.Match)
+	assert.Equal(t, []string{"1", "2"}, m.Groups)
+	assert.Equal(t, "building...\n", m.Before)
+
+	m, _ = es.match(patterns)
+	require.NotNil(t, m)
+	assert.Equal(t, 0, m.Index)
+	assert.Equal(t, ".3\n", m.Before)
+
+	m, _ = es.match(patterns)
+	assert.Nil(t, m)
+	assert.Empty(t, es.pending())
+}
+
+// TestExpectStream_Limit tests that the unconsumed text is capped
+func TestExpectStream_Limit(t *testing.T) {
+	es := newExpectStream()
+	es.Write(bytes.Repeat([]byte("a"), expectStreamLimit))
+	es.Write([]byte("tail"))
+
+	pending := es.pending()
+	assert.Len(t, pending, expectStreamLimit)
+	assert.True(t, strings.HasSuffix(pending, "tail"))
+}
+
+// TestExpect_RespondAndContinue tests responses, continue and timeout handling
+func TestExpect_RespondAndContinue(t *testing.T) {
+	stdin := &nopWriteCloser{}
+	ss := &SSHShellSession{
+		Stdin:  stdin,
+		expect: newExpectStream(),
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ss.expect.Write([]byte("Enter passphrase: "))
+		time.Sleep(20 * time.Millisecond)
+		ss.expect.Write([]byte("\r\nEnter same passphrase again: "))
+		time.Sleep(20 * time.Millisecond)
+		ss.expect.Write([]byte("\r\nKey saved\r\n$ "))
+	}()
+
+	result, err := ss.Expect(context.Background(), &ExpectOptions{
+		Patterns: []ExpectPattern{
+			{Pattern: `passphrase.*: $`, Response: "secret\n", Continue: true},
+			{Pattern: `\$ $`},
+		},
+		Timeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	assert.False(t, result.TimedOut)
+	require.Len(t, result.Matches, 3)
+	assert.True(t, result.Matches[0].Responded)
+	assert.True(t, result.Matches[1].Responded)
+	assert.Equal(t, 1, result.Matches[2].Index)
+	assert.Contains(t, result.Matches[2].Before, "Key saved")
+	assert.Equal(t, "secret\rsecret\r", stdin.String())
+
+	result, err = ss.Expect(context.Background(), &ExpectOptions{
+		Patterns: []ExpectPattern{{Pattern: `never`}},
+		Timeout:  50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.True(t, result.TimedOut)
+	assert.Empty(t, result.Matches)
+
+	_, err = ss.Expect(context.Background(), &ExpectOptions{
+		Patterns: []ExpectPattern{{Pattern: `(`}},
+	})
+	assert.Error(t, err)
+}
+
+// TestExpect_ScreenContinue tests that in screen mode an answered prompt is
+// not answered again when other rows change or the screen scrolls
+func TestExpect_ScreenContinue(t *testing.T) {
+	for _, emulatorType := range []TerminalEmulatorType{EmulatorTypeVT10x, EmulatorTypeVT100, EmulatorTypeANSI} {
+		t.Run(string(emulatorType), func(t *testing.T) {
+			capturer, err := NewTerminalCapturerWithType(40, 5, emulatorType)
+			require.NoError(t, err)
+			defer capturer.Close()
+
+			stdin := &nopWriteCloser{}
+			ss := &SSHShellSession{
+				Stdin:            stdin,
+				TerminalCapturer: capturer,
+				expect:           newExpectStream(),
+			}
+			output := func(data string) {
+				time.Sleep(20 * time.Millisecond)
+				capturer.Emulator.Write([]byte(data))
+				ss.expect.Write([]byte(data))
+			}
+
+			go func() {
+				output("Password: ")
+				// 其他行变化、屏幕滚动都不应再次应答同一个提示
+				output("\r\nchecking")
+				output("\r\n1\r\n2\r\n3\r\n4")
+				output("\r\nPassword: ")
+				output("\r\nok\r\n$ ")
+			}()
+
+			result, err := ss.Expect(context.Background(), &ExpectOptions{
+				Patterns: []ExpectPattern{
+					{Pattern: `Password: `, Response: "x\n", Continue: true},
+					{Pattern: `\$ `},
+				},
+				Screen:  true,
+				Timeout: 5 * time.Second,
+			})
+			require.NoError(t, err)
+			assert.False(t, result.TimedOut)
+			require.Len(t, result.Matches, 3)
+			assert.Equal(t, 1, result.Matches[2].Index)
+			assert.Equal(t, "x\rx\r", stdin.String())
+		})
+	}
+}
+
+// TestExpect_ClosedStream tests that Expect stops when the shell output ends
+func TestExpect_ClosedStream(t *testing.T) {
+	ss := &SSHShellSession{expect: newExpectStream()}
+	ss.expect.Write([]byte("logout\n"))
+	ss.expect.Close()
+
+	result, err := ss.Expect(context.Background(), &ExpectOptions{
+		Patterns: []ExpectPattern{{Pattern: `\$ $`}},
+		Timeout:  5 * time.Second,
+	})
+	require.Error(t, err)
+	assert.Empty(t, result.Matches)
+}
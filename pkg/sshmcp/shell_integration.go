@@ -0,0 +1,422 @@
+package sshmcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Shell integration modes reported by the installed hooks
+const (
+	ShellIntegrationBash     = "bash"     // PROMPT_COMMAND + PS0 钩子（bash 4.4+）
+	ShellIntegrationZsh      = "zsh"      // precmd/preexec 钩子
+	ShellIntegrationSentinel = "sentinel" // 其他 shell：仅 ssh_shell_run 包装的命令输出标记
+)
+
+const (
+	// DefaultShellIntegrationTimeout is how long to wait for the hooks to report back
+	DefaultShellIntegrationTimeout = 10 * time.Second
+	// DefaultShellRunTimeout is used when RunCommand is called without a timeout
+	DefaultShellRunTimeout = 60 * time.Second
+	// MaxShellRunTimeout caps how long RunCommand may block
+	MaxShellRunTimeout = 30 * time.Minute
+
+	// maxTrackedCommands is the number of finished commands kept per shell
+	maxTrackedCommands = 50
+	// maxCommandOutput is the maximum output kept per command (the tail is kept)
+	maxCommandOutput = 1024 * 1024
+
+	// osc133 is the FinalTerm semantic prompt sequence (A/B/C/D markers)
+	osc133 = 133
+	// oscIntegration is a private OSC used by the hooks to report the shell type
+	oscIntegration = 6973
+)
+
+// shellIntegrationScript installs OSC 133 prompt hooks. It is valid POSIX sh
+// syntax so that it can be typed into any shell; bash (4.4+, which added PS0)
+// and zsh get hooks that mark every command, other shells and older bash fall
+// back to sentinel markers written by RunCommand. The leading space keeps it out of bash/zsh history when
+// ignorespace is set.
+const shellIntegrationScript = ` if [ -n "$__sshmcp_m" ]; then :; ` +
+	`elif [ -n "$BASH_VERSION" ] && case $BASH_VERSION in [0-3].*|4.[0-3].*) false;; *) true;; esac; then ` +
+	`__sshmcp_d() { printf '\033]133;D;%s\007' "$?"; }; ` +
+	`PROMPT_COMMAND="__sshmcp_d${PROMPT_COMMAND:+;$PROMPT_COMMAND}"; ` +
+	`PS0='\033]133;C\007'; ` +
+	`PS1='\[\033]133;A\007\]'"$PS1"'\[\033]133;B\007\]'; ` +
+	`__sshmcp_m=bash; ` +
+	`elif [ -n "$ZSH_VERSION" ]; then ` +
+	`__sshmcp_d() { printf '\033]133;D;%s\007\033]133;A\007' "$?"; }; ` +
+	`__sshmcp_c() { printf '\033]133;C\007'; }; ` +
+	`autoload -Uz add-zsh-hook; add-zsh-hook precmd __sshmcp_d; add-zsh-hook preexec __sshmcp_c; ` +
+	`PS1="$PS1"$'%{\e]133;B\a%}'; ` +
+	`__sshmcp_m=zsh; ` +
+	`else __sshmcp_m=sentinel; fi; ` +
+	`printf '\033]6973;sshmcp;integration=%s\007' "$__sshmcp_m"`
+
+// ShellCommand is a command tracked by shell integration
+type ShellCommand struct {
+	Seq        int64         `json:"seq"`
+	Command    string        `json:"command"`
+	Output     string        `json:"output"`
+	ExitCode   int           `json:"exit_code"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Truncated  bool          `json:"truncated,omitempty"` // 输出超过 maxCommandOutput，只保留末尾
+}
+
+// command tracking states
+const (
+	trackIdle = iota
+	trackInput
+	trackRunning
+)
+
+// shellTracker parses OSC 133 markers from the shell output and splits it
+// into per-command output with exit status and duration.
+type shellTracker struct {
+	mu        sync.Mutex
+	parser    *ansi.Parser
+	mode      string
+	state     int
+	input     []byte // 提示符结束（B）到命令开始（C）之间回显的命令行
+	pending   string // RunCommand 提交、尚未开始的命令
+	current   *ShellCommand
+	output    []byte
+	truncated bool
+	completed []ShellCommand
+	seq       int64
+	notify    chan struct{}
+	finished  []ShellCommand // 本次 Write 中完成、等待回调的命令
+	onCommand func(ShellCommand)
+}
+
+func newShellTracker(onCommand func(ShellCommand)) *shellTracker {
+	t := &shellTracker{notify: make(chan struct{}), onCommand: onCommand}
+	t.parser = ansi.NewParser()
+	t.parser.SetParamsSize(32)
+	t.parser.SetDataSize(1024)
+	t.parser.SetHandler(ansi.Handler{
+		Print: func(r rune) {
+			t.appendText(utf8.AppendRune(nil, r))
+		},
+		Execute: func(b byte) {
+			if b == '\n' || b == '\t' {
+				t.appendText([]byte{b})
+			}
+		},
+		HandleOsc: t.handleOsc,
+	})
+	return t
+}
+
+// Write feeds raw shell output into the tracker
+func (t *shellTracker) Write(data []byte) {
+	t.mu.Lock()
+	t.parser.Parse(data)
+	finished := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+
+	// 在锁外回调，回调中会获取 Session 的锁
+	if t.onCommand != nil {
+		for _, cmd := range finished {
+			t.onCommand(cmd)
+		}
+	}
+}
+
+// appendText collects echoed input or command output (caller must hold t.mu)
+func (t *shellTracker) appendText(b []byte) {
+	switch t.state {
+	case trackInput:
+		t.input = append(t.input, b...)
+	case trackRunning:
+		t.output = append(t.output, b...)
+		if len(t.output) > maxCommandOutput {
+			cut := len(t.output) - maxCommandOutput
+			for cut < len(t.output) && !utf8.RuneStart(t.output[cut]) {
+				cut++
+			}
+			t.output = append(t.output[:0], t.output[cut:]...)
+			t.truncated = true
+		}
+	}
+}
+
+// handleOsc processes OSC 133 markers and the integration report (caller must hold t.mu)
+func (t *shellTracker) handleOsc(cmd int, data []byte) {
+	switch cmd {
+	case oscIntegration:
+		if mode, ok := strings.CutPrefix(string(data), "6973;sshmcp;integration="); ok {
+			t.mode = mode
+			t.broadcast()
+		}
+	case osc133:
+		parts := strings.Split(string(data), ";")
+		if len(parts) < 2 {
+			return
+		}
+		switch parts[1] {
+		case "A":
+			if t.state != trackRunning {
+				t.state = trackIdle
+			}
+		case "B":
+			if t.state != trackRunning {
+				t.state = trackInput
+				t.input = t.input[:0]
+			}
+		case "C":
+			t.startCommand()
+		case "D":
+			exitCode := -1
+			if len(parts) > 2 {
+				if code, err := strconv.Atoi(parts[2]); err == nil {
+					exitCode = code
+				}
+			}
+			t.finishCommand(exitCode)
+		}
+	}
+}
+
+// startCommand begins a new command at an OSC 133 C marker (caller must hold t.mu)
+func (t *shellTracker) startCommand() {
+	command := t.pending
+	if command == "" {
+		command = strings.TrimSpace(string(t.input))
+	}
+	t.pending = ""
+	t.input = t.input[:0]
+
+	t.seq++
+	t.current = &ShellCommand{
+		Seq:       t.seq,
+		Command:   command,
+		StartedAt: time.Now(),
+	}
+	t.output = t.output[:0]
+	t.truncated = false
+	t.state = trackRunning
+	t.broadcast()
+}
+
+// finishCommand completes the running command at an OSC 133 D marker (caller must hold t.mu)
+func (t *shellTracker) finishCommand(exitCode int) {
+	// 没有对应 C 标记的 D（如首个提示符）忽略
+	if t.state != trackRunning || t.current == nil {
+		return
+	}
+
+	cmd := *t.current
+	cmd.Output = strings.TrimPrefix(string(t.output), "\n")
+	cmd.ExitCode = exitCode
+	cmd.FinishedAt = time.Now()
+	cmd.Duration = cmd.FinishedAt.Sub(cmd.StartedAt)
+	cmd.Truncated = t.truncated
+
+	t.completed = append(t.completed, cmd)
+	if len(t.completed) > maxTrackedCommands {
+		t.completed = t.completed[len(t.completed)-maxTrackedCommands:]
+	}
+	t.finished = append(t.finished, cmd)
+
+	t.current = nil
+	t.output = t.output[:0]
+	t.state = trackIdle
+	t.broadcast()
+}
+
+// broadcast wakes up all waiters (caller must hold t.mu)
+func (t *shellTracker) broadcast() {
+	close(t.notify)
+	t.notify = make(chan struct{})
+}
+
+// snapshot returns the mode, a copy of the running command with its output so
+// far, and a channel closed on the next state change
+func (t *shellTracker) snapshot() (string, *ShellCommand, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var running *ShellCommand
+	if t.current != nil {
+		cmd := *t.current
+		cmd.Output = strings.TrimPrefix(string(t.output), "\n")
+		cmd.Truncated = t.truncated
+		cmd.Duration = time.Since(cmd.StartedAt)
+		running = &cmd
+	}
+	return t.mode, running, t.notify
+}
+
+// finishedAfter returns the first finished command with Seq > seq
+func (t *shellTracker) finishedAfter(seq int64) *ShellCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.completed {
+		if t.completed[i].Seq > seq {
+			cmd := t.completed[i]
+			return &cmd
+		}
+	}
+	return nil
+}
+
+// ShellIntegration returns the active integration mode, or "" when shell
+// integration is disabled or has not reported yet
+func (ss *SSHShellSession) ShellIntegration() string {
+	if ss.tracker == nil {
+		return ""
+	}
+	mode, _, _ := ss.tracker.snapshot()
+	return mode
+}
+
+// RecentCommands returns the most recent finished commands tracked by shell integration
+func (ss *SSHShellSession) RecentCommands(limit int) []ShellCommand {
+	if ss.tracker == nil {
+		return nil
+	}
+	ss.tracker.mu.Lock()
+	defer ss.tracker.mu.Unlock()
+
+	commands := ss.tracker.completed
+	if limit > 0 && len(commands) > limit {
+		commands = commands[len(commands)-limit:]
+	}
+	return append([]ShellCommand(nil), commands...)
+}
+
+// installPromptHooks types the shell integration and cwd hook scripts into
+// the shell as one line: a second line would run under the OSC 133 hooks
+// and be tracked as a command. The cwd hook comes last so that it is the
+// first prompt hook (see cwdHookScript).
+func (ss *SSHShellSession) installPromptHooks(integration, cwd bool) error {
+	var scripts []string
+	if integration {
+		scripts = append(scripts, shellIntegrationScript)
+	}
+	if cwd {
+		scripts = append(scripts, cwdHookScript)
+	}
+	if len(scripts) == 0 {
+		return nil
+	}
+	return ss.WriteInput(strings.Join(scripts, ";") + "\r")
+}
+
+// WaitShellIntegration waits until the installed hooks report the shell type
+func (ss *SSHShellSession) WaitShellIntegration(timeout time.Duration) (string, error) {
+	if ss.tracker == nil {
+		return "", fmt.Errorf("shell integration is not enabled for this shell")
+	}
+	if timeout <= 0 {
+		timeout = DefaultShellIntegrationTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		mode, _, changed := ss.tracker.snapshot()
+		if mode != "" {
+			return mode, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return "", fmt.Errorf("shell integration did not report within %s", timeout)
+		case <-ss.done:
+			return "", fmt.Errorf("shell closed")
+		}
+	}
+}
+
+// RunCommand writes a single command line to the shell and waits until shell
+// integration reports that it finished. On timeout the partial command (with
+// its output so far) is returned together with an error.
+func (ss *SSHShellSession) RunCommand(ctx context.Context, command string, timeout time.Duration) (*ShellCommand, error) {
+	if ss.tracker == nil {
+		return nil, fmt.Errorf("shell integration is not enabled for this shell (start it with ssh_shell(shell_integration=true))")
+	}
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+	if strings.ContainsAny(command, "\r\n") {
+		return nil, fmt.Errorf("command must be a single line; chain commands with ; or &&")
+	}
+	if timeout <= 0 {
+		timeout = DefaultShellRunTimeout
+	}
+	if timeout > MaxShellRunTimeout {
+		timeout = MaxShellRunTimeout
+	}
+
+	t := ss.tracker
+	t.mu.Lock()
+	mode := t.mode
+	if mode == "" {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("shell integration has not reported yet; the shell may still be starting")
+	}
+	if t.state == trackRunning && t.current != nil {
+		running := t.current.Command
+		t.mu.Unlock()
+		return nil, fmt.Errorf("shell is busy running %q; wait for it or send ctrl+c", running)
+	}
+	startSeq := t.seq
+	t.pending = command
+	t.mu.Unlock()
+
+	line := command
+	if mode == ShellIntegrationSentinel {
+		line = sentinelCommand(command)
+	}
+	if err := ss.WriteInput(line + "\r"); err != nil {
+		return nil, fmt.Errorf("write command: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		// 先取通知 channel 再检查，避免错过检查期间完成的命令
+		_, running, changed := t.snapshot()
+		if cmd := t.finishedAfter(startSeq); cmd != nil {
+			return cmd, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			_, running, _ = t.snapshot()
+			if running == nil {
+				return nil, fmt.Errorf("command did not start within %s", timeout)
+			}
+			return running, fmt.Errorf("command still running after %s", timeout)
+		case <-ctx.Done():
+			return running, ctx.Err()
+		case <-ss.done:
+			return running, fmt.Errorf("shell closed")
+		}
+	}
+}
+
+// sentinelCommand wraps a command with OSC 133 C/D markers for shells
+// without prompt hooks
+func sentinelCommand(command string) string {
+	command = strings.TrimRight(command, "; \t")
+	sep := "; "
+	if strings.HasSuffix(command, "&") && !strings.HasSuffix(command, "&&") {
+		sep = " "
+	}
+	return `printf '\033]133;C\007'; ` + command + sep + `printf '\033]133;D;%s\007' "$?"`
+}
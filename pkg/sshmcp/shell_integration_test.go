@@ -0,0 +1,128 @@
+package sshmcp
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShellTracker_SplitsCommands tests OSC 133 parsing into per-command output
+func TestShellTracker_SplitsCommands(t *testing.T) {
+	var recorded []ShellCommand
+	tracker := newShellTracker(func(cmd ShellCommand) {
+		recorded = append(recorded, cmd)
+	})
+
+	tracker.Write([]byte("\x1b]6973;sshmcp;integration=bash\x07"))
+	// 首个提示符的 D 没有对应的 C，应被忽略
+	tracker.Write([]byte("\x1b]133;D;0\x07\x1b]133;A\x07root@host:~# \x1b]133;B\x07"))
+	tracker.Write([]byte("ls /nope\r\n\x1b]133;C\x07\x1b[31mls: cannot access\x1b[0m"))
+	tracker.Write([]byte(" '/nope'\r\n\x1b]133;D;2\x07\x1b]133;A\x07root@host:~# \x1b]133;B\x07"))
+
+	mode, running, _ := tracker.snapshot()
+	assert.Equal(t, ShellIntegrationBash, mode)
+	assert.Nil(t, running)
+
+	require.Len(t, recorded, 1)
+	assert.Equal(t, int64(1), recorded[0].Seq)
+	assert.Equal(t, "ls /nope", recorded[0].Command)
+	assert.Equal(t, "ls: cannot access '/nope'\n", recorded[0].Output)
+	assert.Equal(t, 2, recorded[0].ExitCode)
+	assert.False(t, recorded[0].FinishedAt.IsZero())
+}
+
+// TestShellTracker_PendingCommand tests that RunCommand's text overrides the echoed input
+func TestShellTracker_PendingCommand(t *testing.T) {
+	tracker := newShellTracker(nil)
+	tracker.pending = "make test"
+	tracker.Write([]byte("\x1b]133;C\x07ok\n"))
+
+	_, running, _ := tracker.snapshot()
+	require.NotNil(t, running)
+	assert.Equal(t, "make test", running.Command)
+	assert.Equal(t, "ok\n", running.Output)
+
+	tracker.Write([]byte("\x1b]133;D\x07"))
+	cmd := tracker.finishedAfter(0)
+	require.NotNil(t, cmd)
+	assert.Equal(t, -1, cmd.ExitCode)
+	assert.Nil(t, tracker.finishedAfter(cmd.Seq))
+}
+
+// TestSentinelCommand tests wrapping commands for shells without hooks
+func TestSentinelCommand(t *testing.T) {
+	assert.Equal(t, `printf '\033]133;C\007'; make; printf '\033]133;D;%s\007' "$?"`, sentinelCommand("make;"))
+	assert.Equal(t, `printf '\033]133;C\007'; sleep 5 & printf '\033]133;D;%s\007' "$?"`, sentinelCommand("sleep 5 &"))
+	assert.True(t, strings.Contains(sentinelCommand("a && b"), "a && b; printf"))
+}
+
+// TestRunCommand tests waiting for a command via shell integration
+func TestRunCommand(t *testing.T) {
+	stdin := &nopWriteCloser{}
+	ss := &SSHShellSession{
+		Stdin:   stdin,
+		tracker: newShellTracker(nil),
+	}
+
+	_, err := ss.RunCommand(context.Background(), "true", time.Second)
+	assert.Error(t, err, "integration has not reported yet")
+
+	ss.tracker.Write([]byte("\x1b]6973;sshmcp;integration=sentinel\x07"))
+	_, err = ss.RunCommand(context.Background(), "echo a\necho b", time.Second)
+	assert.Error(t, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ss.tracker.Write([]byte("\x1b]133;C\x07hello\r\n"))
+		ss.tracker.Write([]byte("\x1b]133;D;0\x07"))
+	}()
+	cmd, err := ss.RunCommand(context.Background(), "echo hello", 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "echo hello", cmd.Command)
+	assert.Equal(t, "hello\n", cmd.Output)
+	assert.Equal(t, 0, cmd.ExitCode)
+	assert.Equal(t, sentinelCommand("echo hello")+"\r", stdin.String())
+
+	go ss.tracker.Write([]byte("\x1b]133;C\x07partial"))
+	cmd, err = ss.RunCommand(context.Background(), "sleep 100", 100*time.Millisecond)
+	require.Error(t, err)
+	require.NotNil(t, cmd)
+	assert.Equal(t, "partial", cmd.Output)
+
+	_, err = ss.RunCommand(context.Background(), "echo busy", time.Second)
+	assert.ErrorContains(t, err, "busy")
+}
+
+// TestShellIntegrationScript_BashVersion tests that bash before 4.4 (no PS0)
+// falls back to sentinel markers
+func TestShellIntegrationScript_BashVersion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+	for version, mode := range map[string]string{
+		"":                  ShellIntegrationBash, // 本机 bash
+		"4.4.20(1)-release": ShellIntegrationBash,
+		"5.2.15(1)-release": ShellIntegrationBash,
+		"4.3.48(1)-release": ShellIntegrationSentinel,
+		"3.2.57(1)-release": ShellIntegrationSentinel,
+		"10.0.0(1)-release": ShellIntegrationBash,
+	} {
+		script := shellIntegrationScript
+		if version != "" {
+			script = "BASH_VERSION='" + version + "';" + script
+		}
+		out, err := exec.Command(bash, "-c", script).Output()
+		require.NoError(t, err)
+
+		tracker := newShellTracker(nil)
+		tracker.Write(out)
+		got, _, _ := tracker.snapshot()
+		assert.Equal(t, mode, got, "BASH_VERSION=%q", version)
+	}
+}
@@ -0,0 +1,99 @@
+package sshmcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultQuietPeriod is used when WaitQuiet is called without a quiet period
+	DefaultQuietPeriod = 500 * time.Millisecond
+	// DefaultQuietTimeout is used when WaitQuiet is called without a timeout
+	DefaultQuietTimeout = 10 * time.Second
+	// MaxQuietTimeout caps how long a single WaitQuiet call may block
+	MaxQuietTimeout = 5 * time.Minute
+)
+
+// QuietResult represents the result of a WaitQuiet call
+type QuietResult struct {
+	Waited     time.Duration `json:"waited"`                // 本次等待的时长
+	TimedOut   bool          `json:"timed_out"`             // 超时时输出仍未稳定
+	Quiet      time.Duration `json:"quiet"`                 // 返回时距最后一次输出的时长
+	LastOutput time.Time     `json:"last_output,omitempty"` // 最后一次收到输出的时间
+}
+
+// touchOutput records that the output reader received new bytes
+func (ss *SSHShellSession) touchOutput() {
+	ss.lastOutput.Store(time.Now().UnixNano())
+}
+
+// LastOutputTime returns when the shell last produced output (heartbeat
+// echoes excluded), or the zero time if it has not produced any
+func (ss *SSHShellSession) LastOutputTime() time.Time {
+	if ns := ss.lastOutput.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// WaitQuiet blocks until no output has arrived for the quiet period, or the
+// timeout is reached. The quiet period is counted from the later of the
+// call and the last output, so a program that has not started drawing yet
+// is given the full period. On cancellation the partial result is returned
+// together with an error.
+func (ss *SSHShellSession) WaitQuiet(ctx context.Context, quiet, timeout time.Duration) (*QuietResult, error) {
+	if quiet <= 0 {
+		quiet = DefaultQuietPeriod
+	}
+	if timeout <= 0 {
+		timeout = DefaultQuietTimeout
+	}
+	if timeout > MaxQuietTimeout {
+		timeout = MaxQuietTimeout
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	result := func(now time.Time, timedOut bool) *QuietResult {
+		r := &QuietResult{Waited: now.Sub(start), TimedOut: timedOut, LastOutput: ss.LastOutputTime()}
+		since := start
+		if r.LastOutput.After(since) {
+			since = r.LastOutput
+		}
+		r.Quiet = now.Sub(since)
+		return r
+	}
+
+	timer := time.NewTimer(quiet)
+	defer timer.Stop()
+	for {
+		since := start
+		if last := ss.LastOutputTime(); last.After(since) {
+			since = last
+		}
+
+		now := time.Now()
+		quietUntil := since.Add(quiet)
+		if !now.Before(quietUntil) {
+			return result(now, false), nil
+		}
+		if !now.Before(deadline) {
+			return result(now, true), nil
+		}
+
+		// 睡到安静期结束（或超时），期间有新输出则重新计算
+		wake := quietUntil
+		if deadline.Before(wake) {
+			wake = deadline
+		}
+		timer.Reset(wake.Sub(now))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return result(time.Now(), false), ctx.Err()
+		case <-ss.done:
+			return result(time.Now(), false), fmt.Errorf("shell closed")
+		}
+	}
+}
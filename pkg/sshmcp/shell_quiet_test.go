@@ -0,0 +1,79 @@
+package sshmcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// produceOutput simulates the output reader receiving data every interval until stop
+func produceOutput(ss *SSHShellSession, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ss.touchOutput()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// TestWaitQuiet_NoOutput tests that a silent shell returns after one quiet period
+func TestWaitQuiet_NoOutput(t *testing.T) {
+	ss := &SSHShellSession{}
+	assert.True(t, ss.LastOutputTime().IsZero())
+
+	result, err := ss.WaitQuiet(context.Background(), 50*time.Millisecond, time.Second)
+	require.NoError(t, err)
+	assert.False(t, result.TimedOut)
+	assert.GreaterOrEqual(t, result.Waited, 50*time.Millisecond)
+	assert.Less(t, result.Waited, 500*time.Millisecond)
+	assert.True(t, result.LastOutput.IsZero())
+}
+
+// TestWaitQuiet_Settles tests waiting until output stops arriving
+func TestWaitQuiet_Settles(t *testing.T) {
+	ss := &SSHShellSession{}
+	stop := make(chan struct{})
+	go produceOutput(ss, 10*time.Millisecond, stop)
+	time.AfterFunc(200*time.Millisecond, func() { close(stop) })
+
+	result, err := ss.WaitQuiet(context.Background(), 80*time.Millisecond, 5*time.Second)
+	require.NoError(t, err)
+	assert.False(t, result.TimedOut)
+	assert.GreaterOrEqual(t, result.Waited, 200*time.Millisecond)
+	assert.GreaterOrEqual(t, result.Quiet, 80*time.Millisecond)
+	assert.False(t, result.LastOutput.IsZero())
+}
+
+// TestWaitQuiet_Timeout tests that continuous output ends at the timeout
+func TestWaitQuiet_Timeout(t *testing.T) {
+	ss := &SSHShellSession{}
+	stop := make(chan struct{})
+	defer close(stop)
+	go produceOutput(ss, 10*time.Millisecond, stop)
+
+	result, err := ss.WaitQuiet(context.Background(), 200*time.Millisecond, 150*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, result.TimedOut)
+	assert.GreaterOrEqual(t, result.Waited, 150*time.Millisecond)
+	assert.Less(t, result.Quiet, 200*time.Millisecond)
+}
+
+// TestWaitQuiet_Cancelled tests returning the partial result on cancellation
+func TestWaitQuiet_Cancelled(t *testing.T) {
+	ss := &SSHShellSession{}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	result, err := ss.WaitQuiet(ctx, time.Second, 5*time.Second)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotNil(t, result)
+	assert.False(t, result.TimedOut)
+	assert.Less(t, result.Waited, time.Second)
+}
@@ -0,0 +1,533 @@
+package sshmcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultRecordingMaxBytes is the default size limit of one recording file
+	DefaultRecordingMaxBytes = 64 * 1024 * 1024
+	// DefaultRecordingMaxFiles is the default number of recording files kept
+	DefaultRecordingMaxFiles = 100
+	// DefaultRecordingMaxAge is the default age after which recordings are deleted
+	DefaultRecordingMaxAge = 7 * 24 * time.Hour
+
+	// recordingExt is the extension of asciicast files
+	recordingExt = ".cast"
+)
+
+// RecordingConfig configures where shell recordings are written and how
+// many of them are kept. Zero limits disable the corresponding check.
+type RecordingConfig struct {
+	Dir      string        // 录制文件目录，为空时使用 ~/.sshmcp/recordings
+	MaxBytes int64         // 单个录制文件的大小上限，达到后停止写入
+	MaxFiles int           // 保留的录制文件数量上限，超出时删除最旧的
+	MaxAge   time.Duration // 录制文件的保留时长
+}
+
+// DefaultRecordingConfig returns the default recording configuration
+func DefaultRecordingConfig() RecordingConfig {
+	return RecordingConfig{
+		MaxBytes: DefaultRecordingMaxBytes,
+		MaxFiles: DefaultRecordingMaxFiles,
+		MaxAge:   DefaultRecordingMaxAge,
+	}
+}
+
+// Directory returns the recording directory, resolving the default and "~"
+func (rc RecordingConfig) Directory() (string, error) {
+	dir := rc.Dir
+	if dir == "" || dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("get home directory: %w", err)
+		}
+		switch {
+		case dir == "":
+			dir = filepath.Join(home, ".sshmcp", "recordings")
+		case dir == "~":
+			dir = home
+		default:
+			dir = filepath.Join(home, dir[2:])
+		}
+	}
+	return dir, nil
+}
+
+// RecordingInfo describes a shell recording
+type RecordingInfo struct {
+	Path      string        `json:"path"`
+	ShellID   string        `json:"shell_id"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Bytes     int64         `json:"bytes"`
+	Events    int           `json:"events"`
+	Input     bool          `json:"input"`     // 是否记录输入事件
+	Truncated bool          `json:"truncated"` // 是否因大小上限而提前停止
+	Active    bool          `json:"active"`
+}
+
+// RecordingFile is a recording found in the recording directory
+type RecordingFile struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Active  bool      `json:"active"`
+}
+
+// asciicastRecorder writes shell events as an asciinema asciicast v2 file:
+// a JSON header line followed by one [time, code, data] array per event.
+type asciicastRecorder struct {
+	mu        sync.Mutex
+	file      *os.File
+	w         *bufio.Writer
+	info      RecordingInfo
+	maxBytes  int64
+	pending   []byte // 输出末尾未完整的 UTF-8 字节，留到下一次输出
+	closed    bool
+	lastError error
+}
+
+// asciicastHeader is the first line of an asciicast v2 file
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// newAsciicastRecorder creates the file at path and writes the header
+func newAsciicastRecorder(path, shellID, title string, info TerminalInfo, input bool, maxBytes int64) (*asciicastRecorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create recording file: %w", err)
+	}
+
+	now := time.Now()
+	rec := &asciicastRecorder{
+		file:     file,
+		w:        bufio.NewWriter(file),
+		maxBytes: maxBytes,
+		info: RecordingInfo{
+			Path:      path,
+			ShellID:   shellID,
+			StartedAt: now,
+			Input:     input,
+			Active:    true,
+		},
+	}
+
+	header, _ := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     int(info.Cols),
+		Height:    int(info.Rows),
+		Timestamp: now.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": info.Term},
+	})
+	if err := rec.writeLine(header); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return rec, nil
+}
+
+// writeLine appends one line, stopping the recording when it would exceed
+// the size limit (caller must hold rec.mu)
+func (rec *asciicastRecorder) writeLine(line []byte) error {
+	if rec.closed {
+		return nil
+	}
+	if rec.maxBytes > 0 && rec.info.Bytes+int64(len(line))+1 > rec.maxBytes {
+		rec.info.Truncated = true
+		return rec.close()
+	}
+	if _, err := rec.w.Write(line); err != nil {
+		rec.lastError = err
+		return err
+	}
+	rec.w.WriteByte('\n')
+	rec.info.Bytes += int64(len(line)) + 1
+	return nil
+}
+
+// event writes one [time, code, data] event (caller must hold rec.mu)
+func (rec *asciicastRecorder) event(code, data string) {
+	if rec.closed {
+		return
+	}
+	// 时间戳保留到微秒
+	elapsed := math.Round(time.Since(rec.info.StartedAt).Seconds()*1e6) / 1e6
+	line, _ := json.Marshal([]interface{}{elapsed, code, data})
+	if rec.writeLine(line) == nil && !rec.closed {
+		rec.info.Events++
+	}
+}
+
+// Output records data read from the shell
+func (rec *asciicastRecorder) Output(data []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	// 读取可能在多字节字符中间截断，不完整的尾部留到下次拼接
+	buf := append(rec.pending, data...)
+	complete := completeUTF8Prefix(buf)
+	rec.pending = append([]byte(nil), buf[complete:]...)
+	if complete > 0 {
+		rec.event("o", string(buf[:complete]))
+	}
+}
+
+// Input records data written to the shell (ignored unless input recording is enabled)
+func (rec *asciicastRecorder) Input(data []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.info.Input {
+		rec.event("i", string(data))
+	}
+}
+
+// Resize records a terminal size change
+func (rec *asciicastRecorder) Resize(rows, cols uint16) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Info returns the current state of the recording
+func (rec *asciicastRecorder) Info() RecordingInfo {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	info := rec.info
+	if info.Active {
+		info.Duration = time.Since(info.StartedAt)
+	}
+	return info
+}
+
+// Close flushes and closes the recording file
+func (rec *asciicastRecorder) Close() (RecordingInfo, error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if len(rec.pending) > 0 {
+		rec.event("o", string(rec.pending))
+		rec.pending = nil
+	}
+	err := rec.close()
+	return rec.info, err
+}
+
+// close flushes and closes the file once and drops it from the active
+// recordings, also when the size limit stops it (caller must hold rec.mu)
+func (rec *asciicastRecorder) close() error {
+	if rec.closed {
+		return rec.lastError
+	}
+	rec.closed = true
+	rec.info.Active = false
+	rec.info.Duration = time.Since(rec.info.StartedAt)
+
+	recordingRegistry.Lock()
+	delete(recordingRegistry.paths, rec.info.Path)
+	recordingRegistry.Unlock()
+
+	if err := rec.w.Flush(); err != nil && rec.lastError == nil {
+		rec.lastError = fmt.Errorf("flush recording: %w", err)
+	}
+	if err := rec.file.Close(); err != nil && rec.lastError == nil {
+		rec.lastError = fmt.Errorf("close recording: %w", err)
+	}
+	return rec.lastError
+}
+
+// completeUTF8Prefix returns the length of data without a trailing
+// incomplete UTF-8 sequence
+func completeUTF8Prefix(data []byte) int {
+	// 最多回看 3 个字节寻找多字节字符的起始字节
+	for i := len(data) - 1; i >= 0 && i >= len(data)-3; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// unsafeFileChars matches characters not allowed in recording file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// recordingFileName builds a file name from the session and shell names
+func recordingFileName(sessionName, shellID string, at time.Time) string {
+	name := unsafeFileChars.ReplaceAllString(sessionName+"_"+shellID, "-")
+	return fmt.Sprintf("%s_%s%s", name, at.Format("20060102-150405.000"), recordingExt)
+}
+
+// listRecordingFiles lists the recordings in dir, newest first
+func listRecordingFiles(dir string) ([]RecordingFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []RecordingFile{}, nil
+		}
+		return nil, fmt.Errorf("read recording directory: %w", err)
+	}
+
+	files := []RecordingFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != recordingExt {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, RecordingFile{
+			Name:    entry.Name(),
+			Path:    filepath.Join(dir, entry.Name()),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime.After(files[j].ModTime)
+	})
+	return files, nil
+}
+
+// pruneRecordings deletes recordings older than MaxAge and the oldest ones
+// beyond MaxFiles, leaving room for one new file. Active recordings are kept.
+func pruneRecordings(dir string, config RecordingConfig, active map[string]bool) ([]string, error) {
+	files, err := listRecordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	kept := 0
+	for _, f := range files {
+		if active[f.Path] {
+			kept++
+			continue
+		}
+		expired := config.MaxAge > 0 && time.Since(f.ModTime) > config.MaxAge
+		overflow := config.MaxFiles > 0 && kept >= config.MaxFiles-1
+		if !expired && !overflow {
+			kept++
+			continue
+		}
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("remove recording %s: %w", f.Name, err)
+		}
+		removed = append(removed, f.Path)
+	}
+	return removed, nil
+}
+
+// StartRecording starts writing the shell's output to a new asciicast file
+// in the configured directory. input also records keystrokes sent to the shell.
+func (s *Session) StartRecording(shellID string, input bool) (*RecordingInfo, error) {
+	shell, err := s.GetShell(shellID)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultRecordingConfig()
+	if s.Config != nil && s.Config.Recording != nil {
+		config = *s.Config.Recording
+	}
+	dir, err := config.Directory()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create recording directory: %w", err)
+	}
+
+	if rec := shell.Recording(); rec != nil && rec.Active {
+		return nil, fmt.Errorf("shell %s is already being recorded, stop the current recording first", shell.ID)
+	}
+	if _, err := pruneRecordings(dir, config, activeRecordings()); err != nil {
+		return nil, err
+	}
+
+	name := s.Alias
+	if name == "" {
+		name = s.Host
+	}
+	path := filepath.Join(dir, recordingFileName(name, shell.ID, time.Now()))
+	title := fmt.Sprintf("%s@%s:%d (%s)", s.Username, s.Host, s.Port, shell.ID)
+	return shell.startRecording(path, title, input, config.MaxBytes)
+}
+
+// StopRecording stops the shell's recording and returns its final state
+func (s *Session) StopRecording(shellID string) (*RecordingInfo, error) {
+	shell, err := s.GetShell(shellID)
+	if err != nil {
+		return nil, err
+	}
+	return shell.StopRecording()
+}
+
+// RecordingDirectory returns the configured recording directory
+func (sm *SessionManager) RecordingDirectory() (string, error) {
+	return sm.config.Recording.Directory()
+}
+
+// ResolveRecording resolves a recording name or path for reading. Relative
+// names are looked up in the recording directory; any path that resolves
+// (after following symlinks) outside the recording directory is rejected, so
+// clients cannot read arbitrary local files through it.
+func (sm *SessionManager) ResolveRecording(name string) (string, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("recording name is required")
+	}
+	dir, err := sm.RecordingDirectory()
+	if err != nil {
+		return "", err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("recording directory %s: %w", dir, err)
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("recording %q not found in %s", name, dir)
+	}
+	rel, err := filepath.Rel(realDir, realPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("recording %q is outside the recording directory %s", name, dir)
+	}
+	return realPath, nil
+}
+
+// ListRecordings lists the recordings in the configured directory, newest first
+func (sm *SessionManager) ListRecordings() ([]RecordingFile, error) {
+	dir, err := sm.RecordingDirectory()
+	if err != nil {
+		return nil, err
+	}
+	files, err := listRecordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	active := activeRecordings()
+	for i := range files {
+		files[i].Active = active[files[i].Path]
+	}
+	return files, nil
+}
+
+// recordingRegistry tracks the files currently being written so retention
+// never deletes them
+var recordingRegistry = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// activeRecordings returns a copy of the paths being recorded
+func activeRecordings() map[string]bool {
+	recordingRegistry.Lock()
+	defer recordingRegistry.Unlock()
+
+	active := make(map[string]bool, len(recordingRegistry.paths))
+	for path := range recordingRegistry.paths {
+		active[path] = true
+	}
+	return active
+}
+
+// startRecording attaches a new recorder to the shell
+func (ss *SSHShellSession) startRecording(path, title string, input bool, maxBytes int64) (*RecordingInfo, error) {
+	// 先读取终端尺寸再加录制锁，与 Resize 的加锁顺序保持一致
+	ss.mu.Lock()
+	info := ss.TerminalInfo
+	ss.mu.Unlock()
+
+	ss.recMu.Lock()
+	defer ss.recMu.Unlock()
+
+	// 因大小上限停止的录制已关闭，可以直接替换
+	if ss.recorder != nil && ss.recorder.Info().Active {
+		return nil, fmt.Errorf("shell %s is already being recorded", ss.ID)
+	}
+
+	rec, err := newAsciicastRecorder(path, ss.ID, title, info, input, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	ss.recorder = rec
+
+	// 持有 recMu 时输出无法到达新的录制，登记前不会因大小上限而关闭
+	result := rec.Info()
+	if result.Active {
+		recordingRegistry.Lock()
+		recordingRegistry.paths[path] = true
+		recordingRegistry.Unlock()
+	}
+	return &result, nil
+}
+
+// StopRecording stops the current recording and returns its final state
+func (ss *SSHShellSession) StopRecording() (*RecordingInfo, error) {
+	ss.recMu.Lock()
+	rec := ss.recorder
+	ss.recorder = nil
+	ss.recMu.Unlock()
+
+	if rec == nil {
+		return nil, fmt.Errorf("shell %s is not being recorded", ss.ID)
+	}
+
+	info, err := rec.Close()
+	return &info, err
+}
+
+// Recording returns the state of the current recording, or nil if the shell
+// is not being recorded
+func (ss *SSHShellSession) Recording() *RecordingInfo {
+	ss.recMu.Lock()
+	defer ss.recMu.Unlock()
+
+	if ss.recorder == nil {
+		return nil
+	}
+	info := ss.recorder.Info()
+	return &info
+}
+
+// record passes an event to the active recorder, if any
+func (ss *SSHShellSession) record(fn func(rec *asciicastRecorder)) {
+	ss.recMu.Lock()
+	rec := ss.recorder
+	ss.recMu.Unlock()
+
+	if rec != nil {
+		fn(rec)
+	}
+}
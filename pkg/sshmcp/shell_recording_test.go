@@ -0,0 +1,222 @@
+package sshmcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readCast parses an asciicast file into its header and events
+func readCast(t *testing.T, path string) (asciicastHeader, [][]interface{}) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	require.True(t, scanner.Scan())
+	var header asciicastHeader
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &header))
+
+	var events [][]interface{}
+	for scanner.Scan() {
+		var event []interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		require.Len(t, event, 3)
+		events = append(events, event)
+	}
+	return header, events
+}
+
+// TestAsciicastRecorder tests the header and output, input and resize events
+func TestAsciicastRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cast")
+	rec, err := newAsciicastRecorder(path, "shell-1", "title", TerminalInfo{Term: "xterm-256color", Rows: 24, Cols: 80}, true, 0)
+	require.NoError(t, err)
+
+	rec.Output([]byte("\x1b[31mhi\x1b[0m\r\n"))
+	rec.Input([]byte("ls\r"))
+	rec.Resize(40, 120)
+	// "é" 被拆成两次读取
+	rec.Output([]byte{'a', 0xc3})
+	rec.Output([]byte{0xa9, 'b'})
+
+	info, err := rec.Close()
+	require.NoError(t, err)
+	assert.False(t, info.Active)
+	assert.Equal(t, 5, info.Events)
+
+	header, events := readCast(t, path)
+	assert.Equal(t, 2, header.Version)
+	assert.Equal(t, 80, header.Width)
+	assert.Equal(t, 24, header.Height)
+	assert.Equal(t, "xterm-256color", header.Env["TERM"])
+
+	require.Len(t, events, 5)
+	assert.Equal(t, []interface{}{"o", "\x1b[31mhi\x1b[0m\r\n"}, events[0][1:])
+	assert.Equal(t, []interface{}{"i", "ls\r"}, events[1][1:])
+	assert.Equal(t, []interface{}{"r", "120x40"}, events[2][1:])
+	assert.Equal(t, []interface{}{"o", "a"}, events[3][1:])
+	assert.Equal(t, []interface{}{"o", "éb"}, events[4][1:])
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fi.Size(), info.Bytes)
+}
+
+// TestAsciicastRecorder_NoInput tests that input events are skipped by default
+func TestAsciicastRecorder_NoInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cast")
+	rec, err := newAsciicastRecorder(path, "shell-1", "", TerminalInfo{Rows: 24, Cols: 80}, false, 0)
+	require.NoError(t, err)
+
+	rec.Input([]byte("secret\r"))
+	rec.Output([]byte("ok"))
+	_, err = rec.Close()
+	require.NoError(t, err)
+
+	_, events := readCast(t, path)
+	require.Len(t, events, 1)
+	assert.Equal(t, "o", events[0][1])
+}
+
+// TestAsciicastRecorder_SizeLimit tests that recording stops at the size limit
+func TestAsciicastRecorder_SizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cast")
+	rec, err := newAsciicastRecorder(path, "shell-1", "", TerminalInfo{Rows: 24, Cols: 80}, false, 200)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		rec.Output([]byte("0123456789"))
+	}
+	info := rec.Info()
+	assert.True(t, info.Truncated)
+	assert.False(t, info.Active)
+	assert.LessOrEqual(t, info.Bytes, int64(200))
+
+	info, err = rec.Close()
+	require.NoError(t, err)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Bytes, fi.Size())
+	_, events := readCast(t, path)
+	assert.Len(t, events, info.Events)
+}
+
+// TestShellRecording_Truncated tests that a recording stopped by the size
+// limit is no longer active and can be replaced by a new one
+func TestShellRecording_Truncated(t *testing.T) {
+	dir := t.TempDir()
+	ss := &SSHShellSession{ID: "shell-1", TerminalInfo: TerminalInfo{Rows: 24, Cols: 80}}
+	first := filepath.Join(dir, "first.cast")
+	_, err := ss.startRecording(first, "", false, 200)
+	require.NoError(t, err)
+	assert.True(t, activeRecordings()[first])
+
+	for i := 0; i < 20; i++ {
+		ss.record(func(rec *asciicastRecorder) { rec.Output([]byte("0123456789")) })
+	}
+	info := ss.Recording()
+	require.NotNil(t, info)
+	assert.True(t, info.Truncated)
+	assert.False(t, info.Active)
+	assert.False(t, activeRecordings()[first])
+
+	second := filepath.Join(dir, "second.cast")
+	started, err := ss.startRecording(second, "", false, 0)
+	require.NoError(t, err)
+	assert.True(t, started.Active)
+	_, err = ss.startRecording(filepath.Join(dir, "third.cast"), "", false, 0)
+	assert.Error(t, err)
+
+	stopped, err := ss.StopRecording()
+	require.NoError(t, err)
+	assert.Equal(t, second, stopped.Path)
+	assert.False(t, activeRecordings()[second])
+}
+
+// TestPruneRecordings tests retention by age and file count
+func TestPruneRecordings(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	create := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0600))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+		return path
+	}
+
+	create("a.cast", time.Minute)
+	create("b.cast", 2*time.Minute)
+	active := create("c.cast", 3*time.Minute)
+	create("d.cast", 4*time.Minute)
+	create("old.cast", 48*time.Hour)
+	create("notes.txt", 48*time.Hour)
+
+	removed, err := pruneRecordings(dir, RecordingConfig{MaxFiles: 4, MaxAge: 24 * time.Hour}, map[string]bool{active: true})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{filepath.Join(dir, "d.cast"), filepath.Join(dir, "old.cast")}, removed)
+
+	files, err := listRecordingFiles(dir)
+	require.NoError(t, err)
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	assert.Equal(t, []string{"a.cast", "b.cast", "c.cast"}, names)
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+}
+
+// TestRecordingFileName tests that session names are made safe for file names
+func TestRecordingFileName(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	assert.Equal(t, "my-host_shell-1_20240506-070809.000.cast", recordingFileName("my host", "shell-1", at))
+	assert.Equal(t, "..-etc-passwd_s_20240506-070809.000.cast", recordingFileName("../etc/passwd", "s", at))
+}
+
+// TestResolveRecording tests that only files inside the recording directory
+// can be resolved for replay
+func TestResolveRecording(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.cast"), []byte("{}\n"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "old"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old", "b.cast"), []byte("{}\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0600))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "link.cast")))
+
+	sm := &SessionManager{config: ManagerConfig{Recording: RecordingConfig{Dir: dir}}}
+	realDir, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	path, err := sm.ResolveRecording("a.cast")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(realDir, "a.cast"), path)
+
+	path, err = sm.ResolveRecording("old/b.cast")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(realDir, "old", "b.cast"), path)
+
+	path, err = sm.ResolveRecording(filepath.Join(dir, "a.cast"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(realDir, "a.cast"), path)
+
+	for _, name := range []string{
+		"",
+		"missing.cast",
+		"../" + filepath.Base(outside) + "/secret",
+		filepath.Join(outside, "secret"),
+		"link.cast",
+		"/etc/passwd",
+		".",
+	} {
+		_, err := sm.ResolveRecording(name)
+		assert.Error(t, err, name)
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/acarl005/stripansi"
@@ -42,9 +43,23 @@ func (s *Session) CreateShell(term string, rows, cols uint16) (*SSHShellSession,
 
 // CreateShellWithConfig creates an interactive shell session with custom configuration
 func (s *Session) CreateShellWithConfig(term string, rows, cols uint16, config *ShellConfig) (*SSHShellSession, error) {
+	return s.CreateNamedShell("", term, rows, cols, config)
+}
+
+// CreateNamedShell creates an interactive shell registered under shellID.
+// An empty shellID generates one (shell-1, shell-2, ...). The new shell
+// becomes the default shell used when tools omit shell_id.
+func (s *Session) CreateNamedShell(shellID, term string, rows, cols uint16, config *ShellConfig) (*SSHShellSession, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	shellID = strings.TrimSpace(shellID)
+	if shellID == "" {
+		shellID = s.nextShellID()
+	} else if _, exists := s.Shells[shellID]; exists {
+		return nil, fmt.Errorf("shell %q already exists in session %s", shellID, s.ID)
+	}
+
 	session, err := s.SSHClient.NewSession()
 	if err != nil {
 		return nil, fmt.Errorf("create SSH session: %w", err)
@@ -67,7 +82,7 @@ func (s *Session) CreateShellWithConfig(term string, rows, cols uint16, config *
 			ssh.VQUIT:         0, // 禁用退出字符
 			ssh.VERASE:        0, // 禁用擦除字符
 			ssh.VKILL:         0, // 禁用杀死字符
-			ssh.VEOF:           0, // 禁用 EOF 字符
+			ssh.VEOF:          0, // 禁用 EOF 字符
 		}
 	} else {
 		// Cooked mode: normal processing
@@ -109,8 +124,8 @@ func (s *Session) CreateShellWithConfig(term string, rows, cols uint16, config *
 		return nil, fmt.Errorf("start shell: %w", err)
 	}
 
-	// 初始化环形缓冲区（默认 10000 行）
-	bufferSize := 10000
+	// 初始化环形缓冲区（默认 10000 行、4MB）
+	bufferSize := DefaultBufferLines
 	if config.BufferSize > 0 {
 		bufferSize = config.BufferSize
 	}
@@ -120,27 +135,38 @@ func (s *Session) CreateShellWithConfig(term string, rows, cols uint16, config *
 	keepaliveDone := make(chan struct{})
 
 	// Create terminal capturer for snapshot support
-	termCapturer, err := NewTerminalCapturer(int(cols), int(rows))
+	var termCapturer *TerminalCapturer
+	if config.Emulator != "" {
+		termCapturer, err = NewTerminalCapturerWithType(int(cols), int(rows), config.Emulator)
+	} else {
+		termCapturer, err = NewTerminalCapturer(int(cols), int(rows))
+	}
 	if err != nil {
 		session.Close()
 		return nil, fmt.Errorf("create terminal capturer: %w", err)
 	}
 
 	shellSession := &SSHShellSession{
-		Session: session,
-		Stdin:   stdin,
-		Stdout:  stdout,
-		Stderr:  stderr,
-		PTY:     true,
-		Config:  config,
+		ID:        shellID,
+		CreatedAt: time.Now(),
+		Session:   session,
+		Stdin:     stdin,
+		Stdout:    stdout,
+		Stderr:    stderr,
+		PTY:       true,
+		Config:    config,
 		TerminalInfo: TerminalInfo{
 			Term: term,
 			Rows: rows,
 			Cols: cols,
 		},
-		OutputBuffer:     NewCircularBuffer(bufferSize),
+		OutputBuffer:     NewCircularBufferWithLimits(bufferSize, config.BufferBytes),
 		BufferSize:       bufferSize,
 		TerminalCapturer: termCapturer,
+		expect:           newExpectStream(),
+		cwd:              newCwdTracker(),
+		client:           s.SSHClient,
+		screens:          newScreenVersions(),
 		LastKeepAlive:    time.Now(),
 		KeepAliveFails:   0,
 		IsActive:         true,
@@ -149,8 +175,16 @@ func (s *Session) CreateShellWithConfig(term string, rows, cols uint16, config *
 		keepaliveDone:    keepaliveDone,
 	}
 
-	s.ShellSession = shellSession
-	s.State = SessionStateActive
+	if config.ShellIntegration {
+		shellSession.tracker = newShellTracker(func(cmd ShellCommand) {
+			// 异步写入历史，避免 ssh_exec 长时间持有会话锁时阻塞输出读取
+			go func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.addShellHistory(shellID, cmd)
+			}()
+		})
+	}
 
 	// 启动后台输出读取 goroutine
 	go shellSession.startOutputReader()
@@ -161,9 +195,131 @@ func (s *Session) CreateShellWithConfig(term string, rows, cols uint16, config *
 	// 启动应用层心跳 goroutine（层 3 保活）
 	go shellSession.startApplicationHeartbeat()
 
+	// 安装 Shell 集成钩子（OSC 133）和工作目录钩子（OSC 7），由输出读取 goroutine 解析；
+	// 失败时关闭 shell 停止上面的 goroutine，此时尚未注册，默认 shell 不变
+	if err := shellSession.installPromptHooks(config.ShellIntegration, config.CwdHook); err != nil {
+		shellSession.Close()
+		return nil, fmt.Errorf("install shell hooks: %w", err)
+	}
+
+	if s.Shells == nil {
+		s.Shells = make(map[string]*SSHShellSession)
+	}
+	s.Shells[shellID] = shellSession
+	s.ShellSession = shellSession
+	s.State = SessionStateActive
+
 	return shellSession, nil
 }
 
+// nextShellID generates an unused shell ID (caller must hold s.mu)
+func (s *Session) nextShellID() string {
+	for {
+		s.shellSeq++
+		id := fmt.Sprintf("shell-%d", s.shellSeq)
+		if _, exists := s.Shells[id]; !exists {
+			return id
+		}
+	}
+}
+
+// GetShell returns the shell registered under shellID. An empty shellID
+// returns the default shell (the most recently created one).
+func (s *Session) GetShell(shellID string) (*SSHShellSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if shellID == "" {
+		if s.ShellSession == nil {
+			return nil, fmt.Errorf("no active shell session for session_id: %s", s.ID)
+		}
+		return s.ShellSession, nil
+	}
+
+	shell, ok := s.Shells[shellID]
+	if !ok {
+		return nil, fmt.Errorf("shell %q not found in session %s (available: %s)", shellID, s.ID, strings.Join(s.shellIDs(), ", "))
+	}
+	return shell, nil
+}
+
+// ListShells returns all shells of the session ordered by creation time
+func (s *Session) ListShells() []*SSHShellSession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shells := make([]*SSHShellSession, 0, len(s.Shells))
+	for _, shell := range s.Shells {
+		shells = append(shells, shell)
+	}
+	sort.Slice(shells, func(i, j int) bool {
+		return shells[i].CreatedAt.Before(shells[j].CreatedAt)
+	})
+	return shells
+}
+
+// CloseShell closes the shell registered under shellID and removes it from
+// the session. If it was the default shell, the most recently created
+// remaining shell becomes the default.
+func (s *Session) CloseShell(shellID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shell := s.ShellSession
+	if shellID != "" {
+		shell = s.Shells[shellID]
+		if shell == nil {
+			return fmt.Errorf("shell %q not found in session %s (available: %s)", shellID, s.ID, strings.Join(s.shellIDs(), ", "))
+		}
+	} else if shell == nil {
+		return fmt.Errorf("no active shell session for session_id: %s", s.ID)
+	}
+
+	delete(s.Shells, shell.ID)
+	if s.ShellSession == shell {
+		s.ShellSession = nil
+		for _, other := range s.Shells {
+			if s.ShellSession == nil || other.CreatedAt.After(s.ShellSession.CreatedAt) {
+				s.ShellSession = other
+			}
+		}
+	}
+
+	return shell.Close()
+}
+
+// closeAllShells closes every shell of the session (caller must hold s.mu)
+func (s *Session) closeAllShells() []error {
+	var errs []error
+	for id, shell := range s.Shells {
+		if err := shell.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shell %s: %w", id, err))
+		}
+		delete(s.Shells, id)
+	}
+	// 直接赋值、未登记在 Shells 中的默认 Shell 也需要关闭
+	if s.ShellSession != nil && s.ShellSession.ID == "" {
+		if err := s.ShellSession.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.ShellSession = nil
+	return errs
+}
+
+// shellIDs returns the sorted IDs of all shells (caller must hold s.mu)
+func (s *Session) shellIDs() []string {
+	ids := make([]string, 0, len(s.Shells))
+	for id := range s.Shells {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		ids = append(ids, "none")
+	}
+	return ids
+}
+
 // WriteInput writes input to the shell
 func (ss *SSHShellSession) WriteInput(input string) error {
 	ss.mu.Lock()
@@ -176,15 +332,33 @@ func (ss *SSHShellSession) WriteInput(input string) error {
 	_, err := ss.Stdin.Write([]byte(input))
 	if err == nil {
 		ss.LastWriteTime = time.Now()
+		ss.record(func(rec *asciicastRecorder) { rec.Input([]byte(input)) })
 	}
 	return err
 }
 
+// Bracketed paste markers (enabled by programs with CSI ? 2004 h)
+const (
+	bracketedPasteStart = "\x1b[200~"
+	bracketedPasteEnd   = "\x1b[201~"
+)
+
+// WritePaste writes text as a bracketed paste, so the program receives it
+// as one paste instead of typed lines. Newlines are sent as CR like Enter;
+// an end marker inside text is removed so it cannot end the paste early.
+func (ss *SSHShellSession) WritePaste(text string) error {
+	text = strings.ReplaceAll(text, bracketedPasteEnd, "")
+	text = strings.ReplaceAll(text, "\r\n", "\r")
+	text = strings.ReplaceAll(text, "\n", "\r")
+	return ss.WriteInput(bracketedPasteStart + text + bracketedPasteEnd)
+}
+
 // extractCurrentDir 从输出中提取当前目录
 // 支持常见的提示符格式：
 // - user@host:path$  (Ubuntu/Debian)
 // - [user@host path]# (RHEL/CentOS)
 // - path$          (简单格式)
+// 返回提示符中的原始路径，~ 由 CurrentDir 按远程用户的 $HOME 展开
 func extractCurrentDir(output string) string {
 	lines := strings.Split(output, "\n")
 	if len(lines) == 0 {
@@ -196,30 +370,17 @@ func extractCurrentDir(output string) string {
 
 	// 尝试匹配 user@host:path 格式（Ubuntu/Debian）
 	if matches := regexp.MustCompile(`[\w-]+@[\w-]+:([~$\/\w\-\.\{\}]+)[\$%#]`).FindStringSubmatch(lastLine); len(matches) > 1 {
-		dir := matches[1]
-		// 展开波浪号
-		if dir == "~" {
-			return "/home/" + os.Getenv("USER")
-		}
-		return dir
+		return matches[1]
 	}
 
 	// 尝试匹配 [user@host path] 格式（RHEL/CentOS）
 	if matches := regexp.MustCompile(`\[[\w-]+@[\w-]+ ([~$\/\w\-\.\{\}]+)\][\$%#]`).FindStringSubmatch(lastLine); len(matches) > 1 {
-		dir := matches[1]
-		if dir == "~" {
-			return "/home/" + os.Getenv("USER")
-		}
-		return dir
+		return matches[1]
 	}
 
 	// 尝试匹配简单的 path$ 格式
 	if matches := regexp.MustCompile(`^([~$\/\w\-\.\{\}]+)[\$%#]$`).FindStringSubmatch(strings.TrimSpace(lastLine)); len(matches) > 1 {
-		dir := matches[1]
-		if dir == "~" {
-			return "/home/" + os.Getenv("USER")
-		}
-		return dir
+		return matches[1]
 	}
 
 	return ""
@@ -300,6 +461,8 @@ func (ss *SSHShellSession) Resize(rows, cols uint16) error {
 		if ss.TerminalCapturer != nil {
 			ss.TerminalCapturer.Resize(int(cols), int(rows))
 		}
+
+		ss.record(func(rec *asciicastRecorder) { rec.Resize(rows, cols) })
 	}
 
 	return err
@@ -307,11 +470,18 @@ func (ss *SSHShellSession) Resize(rows, cols uint16) error {
 
 // Close closes the shell session and stops all goroutines
 func (ss *SSHShellSession) Close() error {
+	var errs []error
+
+	// 结束录制，保证文件完整落盘
+	if ss.Recording() != nil {
+		if _, err := ss.StopRecording(); err != nil {
+			errs = append(errs, fmt.Errorf("stop recording: %w", err))
+		}
+	}
+
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
-	var errs []error
-
 	// Stop all goroutines (only if channels are not already closed)
 	// Use select to avoid closing closed channels
 	select {
@@ -414,13 +584,10 @@ func (ss *SSHShellSession) ReadOutputNonBlocking(timeout time.Duration) (string,
 	stdoutStr := stdoutBuf.String()
 	stderrStr := stderrBuf.String()
 
-	// 根据 ANSIMode 处理输出
+	// 根据 ANSIMode 处理输出（缓冲区保存原始数据）
 	if ss.Config != nil {
-		switch ss.Config.ANSIMode {
-		case ANSIStrip:
-			stdoutStr = stripANSI(stdoutStr)
-			stderrStr = stripANSI(stderrStr)
-		}
+		stdoutStr = RenderOutput(stdoutStr, ss.Config.ANSIMode, int(ss.TerminalInfo.Cols))
+		stderrStr = RenderOutput(stderrStr, ss.Config.ANSIMode, int(ss.TerminalInfo.Cols))
 	}
 
 	// 更新状态
@@ -457,8 +624,28 @@ func stripANSI(s string) string {
 	return cleaned.String()
 }
 
-// WriteSpecialChars writes special control characters to the shell
+// WriteSpecialChars writes special keys to the shell. char is a key or a
+// whitespace-separated key sequence, e.g. "ctrl+c", "f10", "ctrl+x ctrl+s"
+// (see EncodeKey for key names).
 func (ss *SSHShellSession) WriteSpecialChars(char string) error {
+	input, err := ParseKeySequence(char, ss.applicationCursor())
+	if err != nil {
+		return fmt.Errorf("unsupported special character: %w", err)
+	}
+	return ss.writeKeys(input)
+}
+
+// WriteKeys writes literal text mixed with <key> tokens, e.g. "<esc>:wq<enter>"
+func (ss *SSHShellSession) WriteKeys(text string) error {
+	input, err := ParseKeyInput(text, ss.applicationCursor())
+	if err != nil {
+		return err
+	}
+	return ss.writeKeys(input)
+}
+
+// writeKeys writes encoded key bytes to stdin
+func (ss *SSHShellSession) writeKeys(input []byte) error {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 
@@ -466,38 +653,19 @@ func (ss *SSHShellSession) WriteSpecialChars(char string) error {
 		return fmt.Errorf("stdin is not available")
 	}
 
-	var input []byte
-	switch strings.ToLower(char) {
-	case "ctrl+c", "sigint":
-		input = []byte{0x03} // ASCII ETX (End of Text)
-	case "ctrl+d", "eof":
-		input = []byte{0x04} // ASCII EOT (End of Transmission)
-	case "ctrl+z", "sigtstp":
-		input = []byte{0x1A} // ASCII SUB (Substitute)
-	case "ctrl+l", "clear":
-		input = []byte{0x0C} // ASCII FF (Form Feed)
-	case "enter", "return":
-		input = []byte{0x0D} // ASCII CR (Carriage Return)
-	case "tab":
-		input = []byte{0x09} // ASCII HT (Horizontal Tab)
-	case "esc":
-		input = []byte{0x1B} // ASCII ESC (Escape)
-	case "up":
-		input = []byte{0x1B, 0x5B, 0x41} // ESC [ A
-	case "down":
-		input = []byte{0x1B, 0x5B, 0x42} // ESC [ B
-	case "right":
-		input = []byte{0x1B, 0x5B, 0x43} // ESC [ C
-	case "left":
-		input = []byte{0x1B, 0x5B, 0x44} // ESC [ D
-	default:
-		return fmt.Errorf("unsupported special character: %s", char)
-	}
-
 	_, err := ss.Stdin.Write(input)
+	if err == nil {
+		ss.LastWriteTime = time.Now()
+		ss.record(func(rec *asciicastRecorder) { rec.Input(input) })
+	}
 	return err
 }
 
+// applicationCursor reports whether the running program enabled application cursor keys
+func (ss *SSHShellSession) applicationCursor() bool {
+	return ss.GetTerminalModes().AppCursor
+}
+
 // SetMode dynamically changes the terminal mode
 func (ss *SSHShellSession) SetMode(mode TerminalMode) error {
 	ss.mu.Lock()
@@ -528,7 +696,6 @@ func (ss *SSHShellSession) GetStatus() *ShellStatus {
 	ss.mu.Lock()
 
 	// 复制需要的数据
-	currentDir := ss.currentDir
 	hasUnreadData := ss.hasUnreadData
 	lastReadTime := ss.LastReadTime
 	lastWriteTime := ss.LastWriteTime
@@ -538,28 +705,53 @@ func (ss *SSHShellSession) GetStatus() *ShellStatus {
 	ansiMode := ss.Config.ANSIMode.String()
 	mode := ss.Config.Mode
 	isActive := ss.IsActive
-	bufferUsed := ss.OutputBuffer.GetCount()
+	bufferUsed := ss.OutputBuffer.Len()
+	bufferUnread := ss.OutputBuffer.GetCount()
 	bufferTotal := ss.OutputBuffer.GetCapacity()
+	bufferBytes := ss.OutputBuffer.ByteLen()
+	bufferBytesTotal := ss.OutputBuffer.ByteCapacity()
+	bufferNextSeq := ss.OutputBuffer.NextSeq()
+	bufferDropped := ss.OutputBuffer.Dropped()
 	lastKeepAlive := ss.LastKeepAlive
 	keepaliveFails := ss.KeepAliveFails
+	termCapturer := ss.TerminalCapturer
 
 	ss.mu.Unlock()
 
+	var emulator TerminalEmulatorType
+	var modes TerminalModes
+	if termCapturer != nil {
+		emulator = termCapturer.EmulatorType()
+		modes = termCapturer.GetModes()
+	}
+
+	// 只使用已知的目录，不通过 SSH 查询（由 ssh_shell_status 调用 CurrentDir 解析）
+	currentDir, currentDirSource := ss.cachedCurrentDir()
+
 	// 在锁外调用 IsAlive()，避免死锁
 	status := &ShellStatus{
-		IsActive:        isActive && ss.IsAlive(),
-		CurrentDir:      currentDir,
-		HasUnreadOutput: hasUnreadData || bufferUsed > 0,
-		LastReadTime:    lastReadTime,
-		LastWriteTime:   lastWriteTime,
-		TerminalType:    terminalType,
-		Rows:            rows,
-		Cols:            cols,
-		ANSIMode:        ansiMode,
-		BufferUsed:      bufferUsed,
-		BufferTotal:     bufferTotal,
-		LastKeepAlive:   lastKeepAlive,
-		KeepAliveFails:  keepaliveFails,
+		IsActive:         isActive && ss.IsAlive(),
+		CurrentDir:       currentDir,
+		CurrentDirSource: currentDirSource,
+		HasUnreadOutput:  hasUnreadData || bufferUnread > 0,
+		LastReadTime:     lastReadTime,
+		LastWriteTime:    lastWriteTime,
+		LastOutputTime:   ss.LastOutputTime(),
+		TerminalType:     terminalType,
+		Rows:             rows,
+		Cols:             cols,
+		ANSIMode:         ansiMode,
+		BufferUsed:       bufferUsed,
+		BufferTotal:      bufferTotal,
+		BufferBytes:      bufferBytes,
+		BufferBytesTotal: bufferBytesTotal,
+		BufferNextSeq:    bufferNextSeq,
+		BufferDropped:    bufferDropped,
+		LastKeepAlive:    lastKeepAlive,
+		KeepAliveFails:   keepaliveFails,
+		ShellIntegration: ss.ShellIntegration(),
+		Emulator:         string(emulator),
+		TerminalModes:    modes,
 	}
 
 	// Convert mode to string
@@ -578,7 +770,9 @@ func (ss *SSHShellSession) GetStatus() *ShellStatus {
 // startOutputReader starts a background goroutine that reads output into the buffer
 func (ss *SSHShellSession) startOutputReader() {
 	buf := make([]byte, 4096)
-	var lineBuffer strings.Builder
+	if ss.expect != nil {
+		defer ss.expect.Close()
+	}
 
 	for {
 		select {
@@ -597,22 +791,33 @@ func (ss *SSHShellSession) startOutputReader() {
 						ss.TerminalCapturer.Emulator.Write(data)
 					}
 
-					// Split by lines and write to buffer
-					lines := strings.Split(string(data), "\n")
-					for i, line := range lines {
-						if i > 0 {
-							// Complete line, write to buffer
-							ss.OutputBuffer.Write(lineBuffer.String())
-							lineBuffer.Reset()
-						}
-						if i < len(lines)-1 || len(data) > 0 && data[len(data)-1] == '\n' {
-							ss.OutputBuffer.Write(line)
-						} else {
-							// Last incomplete line, keep in buffer
-							lineBuffer.WriteString(line)
-						}
+					// Track the working directory reported by OSC 7
+					if ss.cwd != nil {
+						ss.cwd.Write(data)
+					}
+
+					// Feed to expect stream for pattern matching
+					if ss.expect != nil {
+						ss.expect.Write(data)
+					}
+
+					// Feed to shell integration tracker for command boundaries
+					if ss.tracker != nil {
+						ss.tracker.Write(data)
 					}
 
+					// Store raw output; ANSI handling is applied at read time
+					output := ss.heartbeats.filter(data)
+					ss.OutputBuffer.Write(output)
+
+					// Record output activity for WaitQuiet (heartbeat echoes don't count)
+					if len(output) > 0 {
+						ss.touchOutput()
+					}
+
+					// Append to the asciicast recording, if any
+					ss.record(func(rec *asciicastRecorder) { rec.Output(output) })
+
 					ss.LastReadTime = time.Now()
 				}
 				if err != nil {
@@ -665,6 +870,62 @@ func (ss *SSHShellSession) startSSHKeepAlive() {
 	}
 }
 
+// heartbeatSequence is the application-level heartbeat: ANSI cursor
+// save/restore, invisible to the user
+const heartbeatSequence = "\x1b[s\x1b[u"
+
+// heartbeatEchoWindow is how long after a heartbeat its echo is filtered
+const heartbeatEchoWindow = 5 * time.Second
+
+// heartbeatEchoes are the forms in which the terminal may echo a heartbeat
+// (as-is, or with control characters shown as ^[ when echoctl is set)
+var heartbeatEchoes = [][]byte{
+	[]byte(heartbeatSequence),
+	[]byte("^[[s^[[u"),
+}
+
+// heartbeatFilter removes the echo of heartbeats this session actually sent.
+// Output is only filtered shortly after a heartbeat, so legitimate ESC[s /
+// ESC[u sequences written by programs are kept.
+type heartbeatFilter struct {
+	mu      sync.Mutex
+	pending []time.Time // 尚未看到回显的心跳发送时间
+}
+
+// sent records that a heartbeat was written to the shell
+func (hf *heartbeatFilter) sent() {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+	hf.pending = append(hf.pending, time.Now())
+}
+
+// filter removes one echo per outstanding heartbeat from data
+func (hf *heartbeatFilter) filter(data []byte) []byte {
+	hf.mu.Lock()
+	defer hf.mu.Unlock()
+
+	// 丢弃超时未回显的心跳（例如 readline 直接吞掉了序列）
+	for len(hf.pending) > 0 && time.Since(hf.pending[0]) > heartbeatEchoWindow {
+		hf.pending = hf.pending[1:]
+	}
+
+	for len(hf.pending) > 0 {
+		// 按出现位置依次移除最早的回显
+		at, size := -1, 0
+		for _, echo := range heartbeatEchoes {
+			if i := bytes.Index(data, echo); i >= 0 && (at < 0 || i < at) {
+				at, size = i, len(echo)
+			}
+		}
+		if at < 0 {
+			break
+		}
+		data = append(data[:at:at], data[at+size:]...)
+		hf.pending = hf.pending[1:]
+	}
+	return data
+}
+
 // startApplicationHeartbeat starts a goroutine that sends application-level heartbeats (层 3 保活)
 func (ss *SSHShellSession) startApplicationHeartbeat() {
 	ticker := time.NewTicker(60 * time.Second) // 1 分钟
@@ -674,8 +935,8 @@ func (ss *SSHShellSession) startApplicationHeartbeat() {
 		select {
 		case <-ticker.C:
 			// Send ANSI cursor save/restore (invisible to user, keeps session active)
-			ansiCmd := "\x1b[s\x1b[u" // 保存光标位置 + 立即恢复（无可见效果）
-			if err := ss.WriteInput(ansiCmd); err != nil {
+			ss.heartbeats.sent()
+			if err := ss.WriteInput(heartbeatSequence); err != nil {
 				// Failed to send heartbeat, session might be dead
 				ss.mu.Lock()
 				ss.IsActive = false
@@ -705,6 +966,18 @@ func (ss *SSHShellSession) GetTerminalSnapshot() string {
 	return ss.TerminalCapturer.GetScreenSnapshot()
 }
 
+// GetTerminalModes returns the terminal modes set by the running program
+func (ss *SSHShellSession) GetTerminalModes() TerminalModes {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return TerminalModes{}
+	}
+
+	return ss.TerminalCapturer.GetModes()
+}
+
 // GetTerminalSnapshotWithColor returns a colored ANSI snapshot of the current terminal state
 func (ss *SSHShellSession) GetTerminalSnapshotWithColor() string {
 	ss.mu.Lock()
@@ -717,6 +990,55 @@ func (ss *SSHShellSession) GetTerminalSnapshotWithColor() string {
 	return ss.TerminalCapturer.GetScreenSnapshotWithColor()
 }
 
+// GetTerminalSpans returns the current screen as lines of styled spans
+func (ss *SSHShellSession) GetTerminalSpans() [][]StyledSpan {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return nil
+	}
+
+	return ss.TerminalCapturer.GetScreenSpans()
+}
+
+// GetTerminalScrollback returns up to n lines that scrolled off the top of
+// the primary screen, oldest first, as plain text
+func (ss *SSHShellSession) GetTerminalScrollback(n int) string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return ""
+	}
+
+	return ss.TerminalCapturer.GetScrollbackSnapshot(n)
+}
+
+// GetTerminalScrollbackWithColor returns up to n scrolled-off lines with ANSI colour codes
+func (ss *SSHShellSession) GetTerminalScrollbackWithColor(n int) string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return ""
+	}
+
+	return ss.TerminalCapturer.GetScrollbackSnapshotWithColor(n)
+}
+
+// GetTerminalScrollbackSpans returns up to n scrolled-off lines as styled spans
+func (ss *SSHShellSession) GetTerminalScrollbackSpans(n int) [][]StyledSpan {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.TerminalCapturer == nil {
+		return nil
+	}
+
+	return ss.TerminalCapturer.GetScrollbackSpans(n)
+}
+
 // GetTerminalSize returns the current terminal size
 func (ss *SSHShellSession) GetTerminalSize() (int, int) {
 	ss.mu.Lock()
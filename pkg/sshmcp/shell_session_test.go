@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestIsInteractiveProgram tests the interactive program detection
@@ -181,6 +182,7 @@ func TestDefaultShellConfig(t *testing.T) {
 	assert.Equal(t, 100*time.Millisecond, config.ReadTimeout)
 	assert.Equal(t, 5*time.Second, config.WriteTimeout)
 	assert.True(t, config.AutoDetectInteractive)
+	assert.True(t, config.CwdHook)
 }
 
 // TestWriteSpecialChars tests special character writing (mock test)
@@ -303,3 +305,83 @@ func BenchmarkIsInteractiveProgram(b *testing.B) {
 		IsInteractiveProgram(cmd)
 	}
 }
+
+// newTestShell creates a shell without an SSH channel for registry tests
+func newTestShell(id string, createdAt time.Time) *SSHShellSession {
+	return &SSHShellSession{
+		ID:            id,
+		CreatedAt:     createdAt,
+		IsActive:      true,
+		done:          make(chan struct{}),
+		heartbeatDone: make(chan struct{}),
+		keepaliveDone: make(chan struct{}),
+	}
+}
+
+// TestSession_NamedShells tests lookup, listing and closing of named shells
+func TestSession_NamedShells(t *testing.T) {
+	now := time.Now()
+	build := newTestShell("build", now)
+	logs := newTestShell("logs", now.Add(time.Second))
+	session := &Session{
+		ID:           "test-id",
+		Shells:       map[string]*SSHShellSession{"build": build, "logs": logs},
+		ShellSession: logs,
+	}
+
+	shell, err := session.GetShell("")
+	require.NoError(t, err)
+	assert.Same(t, logs, shell)
+
+	shell, err = session.GetShell("build")
+	require.NoError(t, err)
+	assert.Same(t, build, shell)
+
+	_, err = session.GetShell("missing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "build, logs")
+
+	shells := session.ListShells()
+	require.Len(t, shells, 2)
+	assert.Equal(t, "build", shells[0].ID)
+	assert.Equal(t, "logs", shells[1].ID)
+
+	// 关闭默认 Shell 后，剩余的 Shell 成为默认
+	require.NoError(t, session.CloseShell(""))
+	assert.False(t, logs.IsActive)
+	assert.Same(t, build, session.GetShellSession())
+
+	require.NoError(t, session.CloseShell("build"))
+	assert.Nil(t, session.GetShellSession())
+	assert.Empty(t, session.Shells)
+
+	_, err = session.GetShell("")
+	assert.Error(t, err)
+	assert.Error(t, session.CloseShell("build"))
+}
+
+// TestSession_NextShellID tests that generated shell IDs skip existing names
+func TestSession_NextShellID(t *testing.T) {
+	session := &Session{
+		Shells: map[string]*SSHShellSession{"shell-1": newTestShell("shell-1", time.Now())},
+	}
+
+	assert.Equal(t, "shell-2", session.nextShellID())
+	assert.Equal(t, "shell-3", session.nextShellID())
+}
+
+// TestSession_CloseAllShells tests that every shell is closed on session removal
+func TestSession_CloseAllShells(t *testing.T) {
+	a := newTestShell("a", time.Now())
+	b := newTestShell("b", time.Now())
+	session := &Session{
+		Shells:       map[string]*SSHShellSession{"a": a, "b": b},
+		ShellSession: b,
+	}
+
+	assert.Empty(t, session.closeAllShells())
+	assert.False(t, a.IsActive)
+	assert.False(t, b.IsActive)
+	assert.Nil(t, session.ShellSession)
+	assert.Empty(t, session.Shells)
+}
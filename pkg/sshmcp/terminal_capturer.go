@@ -105,14 +105,48 @@ func (tc *TerminalCapturer) GetScreenSnapshot() string {
 		return ""
 	}
 
+	return renderPlainScreen(tc.Emulator.GetScreenContent())
+}
+
+// Capture 在一次加锁中复制屏幕内容、格式、尺寸和光标位置
+func (tc *TerminalCapturer) Capture() ScreenCapture {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return ScreenCapture{}
+	}
+
+	content, format := tc.Emulator.GetScreenContentWithFormat()
+	width, height := tc.Emulator.GetSize()
+	x, y := tc.Emulator.GetCursorPosition()
+	var scrolled uint64
+	if counter, ok := tc.Emulator.(scrollCounter); ok {
+		scrolled = counter.scrolledLines()
+	}
+	return ScreenCapture{
+		content:  content,
+		format:   format,
+		Width:    width,
+		Height:   height,
+		CursorX:  x,
+		CursorY:  y,
+		scrolled: scrolled,
+	}
+}
+
+// renderPlainScreen 将屏幕内容渲染为纯文本，行之间用换行分隔
+func renderPlainScreen(content [][]rune) string {
 	var buf bytes.Buffer
-	content := tc.Emulator.GetScreenContent()
 
 	// 遍历整个屏幕
 	for y := 0; y < len(content); y++ {
 		row := content[y]
 		for x := 0; x < len(row); x++ {
 			char := row[x]
+			if char == WideCharPadding {
+				continue
+			}
 			if char != 0 {
 				buf.WriteRune(char)
 			} else {
@@ -136,44 +170,33 @@ func (tc *TerminalCapturer) GetScreenSnapshotWithColor() string {
 		return ""
 	}
 
+	return renderColorScreen(tc.Emulator.GetScreenContentWithFormat())
+}
+
+// renderColorScreen 将屏幕内容渲染为带ANSI颜色码的文本
+func renderColorScreen(content [][]rune, format [][]Format) string {
 	var buf bytes.Buffer
-	content, format := tc.Emulator.GetScreenContentWithFormat()
 
-	// 遍历整个屏幕并保留颜色
+	// 遍历整个屏幕并保留颜色和样式
 	for y := 0; y < len(content); y++ {
 		row := content[y]
 		rowFormat := format[y]
-		lastFgSeq := ""
-		lastBgSeq := ""
+		lastFmt := Format{}
 
 		for x := 0; x < len(row); x++ {
 			char := row[x]
+			if char == WideCharPadding {
+				continue
+			}
 			var cellFmt Format
 			if x < len(rowFormat) {
 				cellFmt = rowFormat[x]
 			}
 
-			// 应用前景色（使用类型断言检查是否为 termenv.Color）
-			if cellFmt.Fg != nil {
-				// 尝试类型断言为 termenv.Color（vt100 适配器使用）
-				if color, ok := cellFmt.Fg.(interface{ Sequence(bool) string }); ok {
-					fgSeq := color.Sequence(false)
-					if fgSeq != lastFgSeq && fgSeq != "" {
-						buf.WriteString("\x1b[" + fgSeq + "m")
-						lastFgSeq = fgSeq
-					}
-				}
-			}
-
-			// 应用背景色
-			if cellFmt.Bg != nil {
-				if color, ok := cellFmt.Bg.(interface{ Sequence(bool) string }); ok {
-					bgSeq := color.Sequence(true)
-					if bgSeq != lastBgSeq && bgSeq != "" {
-						buf.WriteString("\x1b[" + bgSeq + "m")
-						lastBgSeq = bgSeq
-					}
-				}
+			// 样式变化时输出完整的 SGR 序列（先重置再设置所有属性）
+			if cellFmt != lastFmt {
+				buf.WriteString("\x1b[" + cellFmt.SGR() + "m")
+				lastFmt = cellFmt
 			}
 
 			if char != 0 {
@@ -194,6 +217,55 @@ func (tc *TerminalCapturer) GetScreenSnapshotWithColor() string {
 	return buf.String()
 }
 
+// GetScreenSpans 获取屏幕内容的结构化样式片段（每行一组 StyledSpan）
+func (tc *TerminalCapturer) GetScreenSpans() [][]StyledSpan {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return nil
+	}
+
+	return ScreenSpans(tc.Emulator.GetScreenContentWithFormat())
+}
+
+// GetScrollbackSnapshot 获取滚出屏幕顶部的最近 n 行（纯文本）
+func (tc *TerminalCapturer) GetScrollbackSnapshot(n int) string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return ""
+	}
+
+	content, _ := tc.Emulator.GetScrollback(n)
+	return renderPlainScreen(content)
+}
+
+// GetScrollbackSnapshotWithColor 获取滚出屏幕顶部的最近 n 行（使用ANSI颜色码）
+func (tc *TerminalCapturer) GetScrollbackSnapshotWithColor(n int) string {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return ""
+	}
+
+	return renderColorScreen(tc.Emulator.GetScrollback(n))
+}
+
+// GetScrollbackSpans 获取滚出屏幕顶部的最近 n 行的结构化样式片段
+func (tc *TerminalCapturer) GetScrollbackSpans(n int) [][]StyledSpan {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return nil
+	}
+
+	return ScreenSpans(tc.Emulator.GetScrollback(n))
+}
+
 // GetCursorPosition 获取当前光标位置
 func (tc *TerminalCapturer) GetCursorPosition() (int, int) {
 	tc.mu.Lock()
@@ -218,6 +290,30 @@ func (tc *TerminalCapturer) GetSize() (int, int) {
 	return tc.Emulator.GetSize()
 }
 
+// GetModes 获取程序设置的终端模式
+func (tc *TerminalCapturer) GetModes() TerminalModes {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return TerminalModes{}
+	}
+
+	return tc.Emulator.GetModes()
+}
+
+// EmulatorType 返回使用的终端模拟器类型
+func (tc *TerminalCapturer) EmulatorType() TerminalEmulatorType {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.Emulator == nil {
+		return ""
+	}
+
+	return EmulatorTypeOf(tc.Emulator)
+}
+
 // Resize 调整终端尺寸
 func (tc *TerminalCapturer) Resize(width, height int) {
 	tc.mu.Lock()
@@ -0,0 +1,310 @@
+package sshmcp
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColorKind is the colour model of a cell colour
+type ColorKind uint8
+
+const (
+	// ColorDefault is the terminal's default foreground or background
+	ColorDefault ColorKind = iota
+	// ColorBasic is one of the 16 ANSI colours (SGR 30-37, 90-97)
+	ColorBasic
+	// ColorIndexed is an entry of the xterm 256-colour palette (SGR 38;5;n)
+	ColorIndexed
+	// ColorRGB is a 24-bit true colour (SGR 38;2;r;g;b)
+	ColorRGB
+)
+
+// Color is a cell colour; the zero value is the default colour
+type Color struct {
+	Kind    ColorKind
+	Index   uint8 // ColorBasic（0-15）或 ColorIndexed（0-255）的颜色编号
+	R, G, B uint8 // ColorRGB 的分量
+}
+
+// BasicColor returns ANSI colour index (0-15)
+func BasicColor(index int) Color {
+	return Color{Kind: ColorBasic, Index: uint8(index)}
+}
+
+// IndexedColor returns a 256-colour palette entry; indexes below 16 are
+// basic colours
+func IndexedColor(index int) Color {
+	if index < 16 {
+		return BasicColor(index)
+	}
+	return Color{Kind: ColorIndexed, Index: uint8(index)}
+}
+
+// RGBColor returns a true colour
+func RGBColor(r, g, b uint8) Color {
+	return Color{Kind: ColorRGB, R: r, G: g, B: b}
+}
+
+// IsDefault reports whether c is the terminal default colour
+func (c Color) IsDefault() bool {
+	return c.Kind == ColorDefault
+}
+
+// Name returns the colour name used in styled spans: "" for the default,
+// "red"/"bright-red" for basic colours, "256:N" and "#rrggbb"
+func (c Color) Name() string {
+	switch c.Kind {
+	case ColorBasic, ColorIndexed:
+		return paletteColorName(int(c.Index))
+	case ColorRGB:
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return ""
+}
+
+// sgr returns the SGR parameters selecting c as the foreground or background
+func (c Color) sgr(background bool) string {
+	base := 30
+	if background {
+		base = 40
+	}
+	switch c.Kind {
+	case ColorBasic:
+		if c.Index >= 8 {
+			return strconv.Itoa(base + 60 + int(c.Index) - 8)
+		}
+		return strconv.Itoa(base + int(c.Index))
+	case ColorIndexed:
+		return fmt.Sprintf("%d;5;%d", base+8, c.Index)
+	case ColorRGB:
+		return fmt.Sprintf("%d;2;%d;%d;%d", base+8, c.R, c.G, c.B)
+	}
+	return strconv.Itoa(base + 9)
+}
+
+// SGR returns the parameters of one SGR sequence that resets the terminal
+// and selects every attribute of f, e.g. "0;1;31;48;5;236"
+func (f Format) SGR() string {
+	params := []string{"0"}
+	if f.Bold {
+		params = append(params, "1")
+	}
+	if f.Faint {
+		params = append(params, "2")
+	}
+	if f.Italic {
+		params = append(params, "3")
+	}
+	if f.Underline {
+		params = append(params, "4")
+	}
+	if f.Blink {
+		params = append(params, "5")
+	}
+	if f.Reverse {
+		params = append(params, "7")
+	}
+	if !f.Fg.IsDefault() {
+		params = append(params, f.Fg.sgr(false))
+	}
+	if !f.Bg.IsDefault() {
+		params = append(params, f.Bg.sgr(true))
+	}
+	return strings.Join(params, ";")
+}
+
+// nearestPaletteIndex returns the xterm palette entry (16-255) closest to
+// an RGB colour; the 16 basic colours are skipped since their values
+// depend on the terminal theme
+func nearestPaletteIndex(r, g, b uint8) int {
+	best, bestDist := 16, -1
+	for i := 16; i < 256; i++ {
+		p := paletteRGB(i)
+		dr, dg, db := int(p.R)-int(r), int(p.G)-int(g), int(p.B)-int(b)
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// maxPendingCSI bounds how much of an unfinished CSI sequence
+// trueColorDownsampler holds back between writes
+const maxPendingCSI = 64
+
+// trueColorDownsampler rewrites true-colour SGR parameters (38;2;r;g;b,
+// 48;2;r;g;b and the colon forms) to the nearest 256-colour entry, and
+// drops underline colours (58). vt10x only understands 38;5;n: it reads
+// the r;g;b of a true colour as separate attributes, so a zero component
+// resets all styling.
+type trueColorDownsampler struct {
+	pending []byte // 上次写入末尾未结束的 CSI 序列
+}
+
+// filter returns data with true colours rewritten; an unfinished CSI
+// sequence at the end is held back until the next call
+func (d *trueColorDownsampler) filter(data []byte) []byte {
+	if len(d.pending) > 0 {
+		data = append(d.pending, data...)
+		d.pending = nil
+	}
+
+	var out []byte
+	start := 0
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0x1b {
+			continue
+		}
+		if i+1 == len(data) {
+			d.hold(&out, data, start, i)
+			return out
+		}
+		if data[i+1] != '[' {
+			continue
+		}
+
+		// 查找 CSI 结束字节（0x40-0x7e）
+		end := i + 2
+		for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+			end++
+		}
+		if end == len(data) {
+			if len(data)-i <= maxPendingCSI {
+				d.hold(&out, data, start, i)
+				return out
+			}
+			break
+		}
+
+		params := data[i+2 : end]
+		if data[end] == 'm' && sgrNeedsDownsample(params) {
+			if out == nil {
+				out = make([]byte, 0, len(data)+16)
+			}
+			out = append(out, data[start:i]...)
+			out = append(out, "\x1b["...)
+			out = append(out, downsampleSGR(string(params))...)
+			out = append(out, 'm')
+			start = end + 1
+		}
+		i = end
+	}
+
+	if out == nil {
+		return data
+	}
+	return append(out, data[start:]...)
+}
+
+// hold keeps data[from:] for the next call and completes out
+func (d *trueColorDownsampler) hold(out *[]byte, data []byte, start, from int) {
+	d.pending = append([]byte(nil), data[from:]...)
+	*out = append(*out, data[start:from]...)
+}
+
+// sgrNeedsDownsample reports whether SGR parameters contain a true colour,
+// an underline colour or colon sub-parameters
+func sgrNeedsDownsample(params []byte) bool {
+	if bytes.IndexByte(params, ':') >= 0 {
+		return true
+	}
+	fields := strings.Split(string(params), ";")
+	for i, field := range fields {
+		if (field == "38" || field == "48") && i+1 < len(fields) && fields[i+1] == "2" {
+			return true
+		}
+		if field == "58" {
+			return true
+		}
+	}
+	return false
+}
+
+// downsampleSGR rewrites SGR parameters into the subset vt10x understands
+func downsampleSGR(params string) string {
+	fields := strings.Split(params, ";")
+	out := make([]string, 0, len(fields))
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+
+		// 冒号子参数形式：38:2::r:g:b、38:2:r:g:b、38:5:n、4:3 等
+		if strings.Contains(field, ":") {
+			sub := strings.Split(field, ":")
+			switch sub[0] {
+			case "38", "48":
+				if color, ok := sgrColorArgs(sub[1:], true); ok {
+					out = append(out, sub[0]+";"+color)
+				}
+			case "58":
+			default:
+				out = append(out, sub[0])
+			}
+			continue
+		}
+
+		switch field {
+		case "38", "48", "58":
+			color, ok := "", false
+			switch {
+			case i+4 < len(fields) && fields[i+1] == "2":
+				color, ok = sgrColorArgs(fields[i+1:i+5], false)
+				i += 4
+			case i+2 < len(fields) && fields[i+1] == "5":
+				color, ok = sgrColorArgs(fields[i+1:i+3], false)
+				i += 2
+			default:
+				// 参数不完整，丢弃剩余参数以免被当作独立属性
+				i = len(fields)
+			}
+			if ok && field != "58" {
+				out = append(out, field+";"+color)
+			}
+		default:
+			out = append(out, field)
+		}
+	}
+	if len(out) == 0 {
+		// 全部被丢弃时保持原序列无效果，而不是变成 CSI m（重置）
+		return "58"
+	}
+	return strings.Join(out, ";")
+}
+
+// sgrColorArgs converts the arguments after 38/48 ("5;n" or "2;r;g;b") to
+// "5;n"; colon true colours may carry a colour space id before r:g:b
+func sgrColorArgs(args []string, colon bool) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	switch args[0] {
+	case "5":
+		if len(args) < 2 {
+			return "", false
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > 255 {
+			return "", false
+		}
+		return "5;" + strconv.Itoa(n), true
+	case "2":
+		rgb := args[1:]
+		if colon && len(rgb) > 3 {
+			rgb = rgb[len(rgb)-3:]
+		}
+		if len(rgb) != 3 {
+			return "", false
+		}
+		var c [3]uint8
+		for i, s := range rgb {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 || v > 255 {
+				return "", false
+			}
+			c[i] = uint8(v)
+		}
+		return "5;" + strconv.Itoa(nearestPaletteIndex(c[0], c[1], c[2])), true
+	}
+	return "", false
+}
@@ -0,0 +1,76 @@
+package sshmcp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ActiveState/vt10x"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFormat_SGR tests regenerating SGR parameters for every attribute
+func TestFormat_SGR(t *testing.T) {
+	assert.Equal(t, "0", Format{}.SGR())
+	assert.Equal(t, "0;31", Format{Fg: BasicColor(1)}.SGR())
+	assert.Equal(t, "0;1;2;3;4;5;7;91;104", Format{
+		Fg: BasicColor(9), Bg: BasicColor(12),
+		Bold: true, Faint: true, Italic: true, Underline: true, Blink: true, Reverse: true,
+	}.SGR())
+	assert.Equal(t, "0;38;5;208;48;2;1;2;3", Format{Fg: IndexedColor(208), Bg: RGBColor(1, 2, 3)}.SGR())
+}
+
+// TestColor_Mapping tests converting both backends' colours
+func TestColor_Mapping(t *testing.T) {
+	assert.Equal(t, Color{}, vt10xColor(vt10x.DefaultFG))
+	assert.Equal(t, BasicColor(3), vt10xColor(vt10x.Yellow))
+	assert.Equal(t, Color{Kind: ColorIndexed, Index: 200}, vt10xColor(200))
+
+	assert.Equal(t, Color{}, termenvColor(nil))
+	assert.Equal(t, BasicColor(9), termenvColor(termenv.ANSIColor(9)))
+	assert.Equal(t, IndexedColor(17), termenvColor(termenv.ANSI256Color(17)))
+	assert.Equal(t, RGBColor(0xa0, 0xb0, 0xc0), termenvColor(termenv.RGBColor("#A0B0C0")))
+
+	assert.Equal(t, "bright-red", BasicColor(9).Name())
+	assert.Equal(t, "256:17", IndexedColor(17).Name())
+	assert.Equal(t, "#0a0b0c", RGBColor(10, 11, 12).Name())
+}
+
+// TestTrueColorDownsampler tests rewriting true colours for vt10x
+func TestTrueColorDownsampler(t *testing.T) {
+	var d trueColorDownsampler
+
+	// 不含真彩色的数据原样返回
+	assert.Equal(t, "\x1b[1;31mok\x1b[0m", string(d.filter([]byte("\x1b[1;31mok\x1b[0m"))))
+
+	assert.Equal(t, "\x1b[1;38;5;196mx", string(d.filter([]byte("\x1b[1;38;2;255;0;0mx"))))
+	assert.Equal(t, "\x1b[48;5;16;4m", string(d.filter([]byte("\x1b[48:2::0:0:0;4:3m"))))
+	assert.Equal(t, "\x1b[38;5;208;1m", string(d.filter([]byte("\x1b[38:5:208;58;2;1;2;3;1m"))))
+
+	// 跨两次写入的序列
+	assert.Equal(t, "a", string(d.filter([]byte("a\x1b[38;2;0;0"))))
+	assert.Equal(t, "\x1b[38;5;21mb", string(d.filter([]byte(";255mb"))))
+	assert.Equal(t, "", string(d.filter([]byte("\x1b"))))
+	assert.Equal(t, "\x1b[0m", string(d.filter([]byte("[0m"))))
+}
+
+// TestTerminalCapturer_ColorSnapshot tests coloured snapshots from every backend
+func TestTerminalCapturer_ColorSnapshot(t *testing.T) {
+	forEachEmulator(t, 20, 2, func(t *testing.T, emu TerminalEmulator) {
+		emu.Write([]byte("\x1b[1;31mE\x1b[0m \x1b[38;5;208mo\x1b[0m \x1b[4mu\x1b[0m \x1b[38;2;255;0;0mt\x1b[0m"))
+		capturer := &TerminalCapturer{Emulator: emu}
+		out := capturer.GetScreenSnapshotWithColor()
+
+		assert.Contains(t, out, "\x1b[0;38;5;208mo\x1b[0m ")
+		// vt10x 不支持真彩色（转换为 256 色）、下划线和粗体（仅体现为亮色）
+		if _, ok := emu.(*VT10xAdapter); ok {
+			assert.Contains(t, out, "\x1b[0;91mE\x1b[0m ")
+			assert.Contains(t, out, "\x1b[0;38;5;196mt")
+		} else {
+			assert.Contains(t, out, "\x1b[0;1;31mE\x1b[0m ")
+			assert.Contains(t, out, "\x1b[0;4mu\x1b[0m ")
+			assert.Contains(t, out, "\x1b[0;38;2;255;0;0mt")
+		}
+		assert.True(t, strings.HasSuffix(out, "\x1b[0m"))
+	})
+}
@@ -1,6 +1,7 @@
 package sshmcp
 
 import (
+	"fmt"
 	"os"
 )
 
@@ -16,12 +17,18 @@ type TerminalEmulator interface {
 	// GetScreenContentWithFormat 获取屏幕内容和格式信息（包含颜色）
 	GetScreenContentWithFormat() ([][]rune, [][]Format)
 
+	// GetScrollback 获取滚出主屏幕顶部的最近 n 行（从旧到新，不含备用屏幕）
+	GetScrollback(n int) ([][]rune, [][]Format)
+
 	// GetCursorPosition 获取光标位置 (x, y)
 	GetCursorPosition() (int, int)
 
 	// GetSize 获取终端尺寸 (width, height)
 	GetSize() (int, int)
 
+	// GetModes 获取程序设置的终端模式（备用屏幕、光标可见性、括号粘贴、窗口标题等）
+	GetModes() TerminalModes
+
 	// Resize 调整终端大小
 	Resize(width, height int)
 
@@ -31,8 +38,9 @@ type TerminalEmulator interface {
 
 // Format 表示单元格的格式信息（颜色、样式等）
 type Format struct {
-	Fg, Bg    interface{} // 颜色（接口类型，兼容不同库）
+	Fg, Bg    Color // 颜色（零值为终端默认色）
 	Bold      bool
+	Faint     bool
 	Italic    bool
 	Underline bool
 	Blink     bool
@@ -48,13 +56,40 @@ const (
 
 	// EmulatorTypeVT10x 使用 ActiveState/vt10x（推荐，跨平台）
 	EmulatorTypeVT10x TerminalEmulatorType = "vt10x"
+
+	// EmulatorTypeANSI 使用基于 charmbracelet/x/ansi 的内置模拟器（支持宽字符、真彩色）
+	EmulatorTypeANSI TerminalEmulatorType = "ansi"
 )
 
+// ParseTerminalEmulatorType 解析模拟器类型名称（vt10x、vt100、ansi）
+func ParseTerminalEmulatorType(s string) (TerminalEmulatorType, error) {
+	switch t := TerminalEmulatorType(s); t {
+	case EmulatorTypeVT10x, EmulatorTypeVT100, EmulatorTypeANSI:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid terminal emulator %q (valid: vt10x, vt100, ansi)", s)
+}
+
+// EmulatorTypeOf 返回模拟器实例的类型
+func EmulatorTypeOf(emulator TerminalEmulator) TerminalEmulatorType {
+	switch emulator.(type) {
+	case *VT10xAdapter:
+		return EmulatorTypeVT10x
+	case *VT100Adapter:
+		return EmulatorTypeVT100
+	case *ANSIEmulator:
+		return EmulatorTypeANSI
+	}
+	return ""
+}
+
 // GetTerminalEmulator 根据类型创建终端模拟器
 func GetTerminalEmulator(emulatorType TerminalEmulatorType, width, height int) (TerminalEmulator, error) {
 	switch emulatorType {
 	case EmulatorTypeVT10x:
 		return NewVT10xEmulator(width, height)
+	case EmulatorTypeANSI:
+		return NewANSIEmulator(width, height)
 	case EmulatorTypeVT100:
 		fallthrough
 	default:
@@ -63,7 +98,7 @@ func GetTerminalEmulator(emulatorType TerminalEmulatorType, width, height int) (
 }
 
 // NewTerminalEmulatorFromEnv 从环境变量读取模拟器类型并创建
-// 环境变量：SSH_MCP_TERMINAL_EMULATOR (vt100 or vt10x)
+// 环境变量：SSH_MCP_TERMINAL_EMULATOR (vt100, vt10x or ansi)
 // 如果环境变量未设置，默认使用 vt10x（跨平台，推荐）
 func NewTerminalEmulatorFromEnv(width, height int) (TerminalEmulator, error) {
 	emulatorType := getTerminalEmulatorTypeFromEnv()
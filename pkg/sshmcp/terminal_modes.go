@@ -0,0 +1,156 @@
+package sshmcp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Mouse reporting modes enabled with CSI ? n h
+const (
+	MouseX10    = "x10"    // ?9：仅按下
+	MouseNormal = "normal" // ?1000：按下和释放
+	MouseButton = "button" // ?1002：按住拖动
+	MouseAny    = "any"    // ?1003：所有移动
+)
+
+// mouseModes maps DEC private mode numbers to mouse reporting modes
+var mouseModes = map[int]string{9: MouseX10, 1000: MouseNormal, 1002: MouseButton, 1003: MouseAny}
+
+// TerminalModes is the mode state the running program set in the terminal
+type TerminalModes struct {
+	AltScreen      bool   `json:"alt_screen"`      // 备用屏幕（全屏程序）
+	CursorHidden   bool   `json:"cursor_hidden"`   // 光标隐藏（DECTCEM）
+	AppCursor      bool   `json:"app_cursor"`      // 应用光标键模式（DECCKM）
+	AppKeypad      bool   `json:"app_keypad"`      // 应用小键盘模式（DECKPAM）
+	BracketedPaste bool   `json:"bracketed_paste"` // 括号粘贴模式（?2004）
+	Mouse          string `json:"mouse,omitempty"` // 鼠标报告模式，空表示关闭
+	Title          string `json:"title,omitempty"` // OSC 0/2 设置的窗口标题
+}
+
+// Flags lists the enabled modes as short names, e.g. "alt-screen", "mouse=any"
+func (m TerminalModes) Flags() []string {
+	var flags []string
+	if m.AltScreen {
+		flags = append(flags, "alt-screen")
+	}
+	if m.CursorHidden {
+		flags = append(flags, "cursor-hidden")
+	}
+	if m.AppCursor {
+		flags = append(flags, "app-cursor")
+	}
+	if m.AppKeypad {
+		flags = append(flags, "app-keypad")
+	}
+	if m.BracketedPaste {
+		flags = append(flags, "bracketed-paste")
+	}
+	if m.Mouse != "" {
+		flags = append(flags, "mouse="+m.Mouse)
+	}
+	return flags
+}
+
+// String returns the enabled modes separated by commas, or "none"
+func (m TerminalModes) String() string {
+	flags := m.Flags()
+	if len(flags) == 0 {
+		return "none"
+	}
+	return strings.Join(flags, ", ")
+}
+
+// setPrivateMode applies a DEC private mode (CSI ? n h/l)
+func (m *TerminalModes) setPrivateMode(mode int, set bool) {
+	switch mode {
+	case 1:
+		m.AppCursor = set
+	case 25:
+		m.CursorHidden = !set
+	case 47, 1047, 1049:
+		m.AltScreen = set
+	case 2004:
+		m.BracketedPaste = set
+	default:
+		name, ok := mouseModes[mode]
+		if !ok {
+			return
+		}
+		if set {
+			m.Mouse = name
+		} else if m.Mouse == name {
+			// 只关闭当前启用的鼠标模式
+			m.Mouse = ""
+		}
+	}
+}
+
+// handleEsc applies keypad modes and RIS
+func (m *TerminalModes) handleEsc(cmd ansi.Cmd) {
+	if cmd.Intermediate() != 0 {
+		return
+	}
+	switch cmd.Final() {
+	case '=': // DECKPAM
+		m.AppKeypad = true
+	case '>': // DECKPNM
+		m.AppKeypad = false
+	case 'c': // RIS 复位终端模式（标题保留）
+		*m = TerminalModes{Title: m.Title}
+	}
+}
+
+// handleOsc applies window title changes (OSC 0 and OSC 2)
+func (m *TerminalModes) handleOsc(cmd int, data []byte) {
+	if cmd != 0 && cmd != 2 {
+		return
+	}
+	// data 为 "0;标题"
+	if _, title, ok := strings.Cut(string(data), ";"); ok {
+		m.Title = title
+	}
+}
+
+// modeTracker follows terminal modes from shell output for emulators that
+// do not expose them (vt10x, vt100)
+type modeTracker struct {
+	mu     sync.Mutex
+	parser *ansi.Parser
+	modes  TerminalModes
+}
+
+// newModeTracker creates a tracker in the default modes
+func newModeTracker() *modeTracker {
+	t := &modeTracker{parser: ansi.NewParser()}
+	t.parser.SetParamsSize(32)
+	t.parser.SetDataSize(1024)
+	t.parser.SetHandler(ansi.Handler{
+		HandleCsi: func(cmd ansi.Cmd, params ansi.Params) {
+			if cmd.Prefix() != '?' || (cmd.Final() != 'h' && cmd.Final() != 'l') {
+				return
+			}
+			for _, p := range params {
+				t.modes.setPrivateMode(p.Param(0), cmd.Final() == 'h')
+			}
+		},
+		HandleEsc: t.modes.handleEsc,
+		HandleOsc: t.modes.handleOsc,
+	})
+	return t
+}
+
+// Write feeds shell output to the tracker
+func (t *modeTracker) Write(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.parser.Parse(data)
+}
+
+// Modes returns the current modes
+func (t *modeTracker) Modes() TerminalModes {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.modes
+}
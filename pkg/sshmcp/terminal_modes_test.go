@@ -0,0 +1,63 @@
+package sshmcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestModeTracker tests tracking modes from output split across writes
+func TestModeTracker(t *testing.T) {
+	m := newModeTracker()
+	assert.Equal(t, TerminalModes{}, m.Modes())
+
+	m.Write([]byte("vim\r\n\x1b[?1049h\x1b[?1"))
+	assert.False(t, m.Modes().AppCursor)
+	assert.True(t, m.Modes().AltScreen)
+	m.Write([]byte("h\x1b="))
+	assert.True(t, m.Modes().AppCursor)
+	assert.True(t, m.Modes().AppKeypad)
+
+	m.Write([]byte("\x1b[?25l\x1b[?1l"))
+	assert.False(t, m.Modes().AppCursor)
+	assert.True(t, m.Modes().CursorHidden)
+
+	m.Write([]byte("\x1b]2;vim - ma"))
+	m.Write([]byte("in.go\x07\x1b[?1;1049h"))
+	assert.True(t, m.Modes().AppCursor)
+	assert.Equal(t, "vim - main.go", m.Modes().Title)
+
+	// RIS 复位模式，保留标题
+	m.Write([]byte("\x1bc"))
+	assert.Equal(t, TerminalModes{Title: "vim - main.go"}, m.Modes())
+}
+
+// TestTerminalModes_Mouse tests that disabling another mouse mode keeps the current one
+func TestTerminalModes_Mouse(t *testing.T) {
+	var m TerminalModes
+	m.setPrivateMode(1000, true)
+	m.setPrivateMode(1002, true)
+	assert.Equal(t, MouseButton, m.Mouse)
+	m.setPrivateMode(1000, false)
+	assert.Equal(t, MouseButton, m.Mouse)
+	m.setPrivateMode(1002, false)
+	assert.Empty(t, m.Mouse)
+
+	assert.Equal(t, "none", m.String())
+	m = TerminalModes{AltScreen: true, BracketedPaste: true, Mouse: MouseAny}
+	assert.Equal(t, "alt-screen, bracketed-paste, mouse=any", m.String())
+}
+
+// TestTerminalEmulator_Modes tests that every backend reports modes
+func TestTerminalEmulator_Modes(t *testing.T) {
+	forEachEmulator(t, 20, 4, func(t *testing.T, emu TerminalEmulator) {
+		emu.Write([]byte("\x1b]0;htop\x1b\\\x1b[?1049h\x1b[?25l\x1b[?2004h\x1b[?1003h\x1b[?1h\x1b="))
+		assert.Equal(t, TerminalModes{
+			AltScreen: true, CursorHidden: true, AppCursor: true, AppKeypad: true,
+			BracketedPaste: true, Mouse: MouseAny, Title: "htop",
+		}, emu.GetModes())
+
+		emu.Write([]byte("\x1b[?1003l\x1b[?1049l\x1b[?25h\x1b[?1l\x1b>"))
+		assert.Equal(t, TerminalModes{BracketedPaste: true, Title: "htop"}, emu.GetModes())
+	})
+}
@@ -0,0 +1,395 @@
+package sshmcp
+
+import (
+	"sync"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/ansi/parser"
+)
+
+// DefaultScrollbackLines is the number of scrolled-off lines each terminal
+// emulator keeps
+const DefaultScrollbackLines = 1000
+
+// scrollbackScreen is the part of a terminal emulator the scrollback inspects
+type scrollbackScreen interface {
+	// screenRow returns one row of the screen; the slices may be reused by
+	// the emulator, so callers copy what they keep
+	screenRow(y int) ([]rune, []Format)
+	GetCursorPosition() (int, int)
+	GetSize() (int, int)
+}
+
+// scrollbackLine is one rendered line that scrolled off the screen
+type scrollbackLine struct {
+	content []rune
+	format  []Format
+}
+
+// scrollback keeps a bounded history of lines that scrolled off the top of the
+// primary screen. Emulators pass their input through write, which splits it
+// just before bytes that may scroll (a line feed or a character that may
+// autowrap on the last row) and copies the top row only then, so ordinary
+// output costs no screen reads. Lines scrolled out of the alternate screen or
+// a scroll region that does not start at the top of the screen are not kept,
+// like xterm.
+type scrollback struct {
+	mu    sync.Mutex
+	lines    []scrollbackLine // 环形缓冲，满后 next 指向最旧的一行
+	next     int
+	max      int
+	scrolled uint64 // 累计滚出主屏幕的行数，不受 max 限制，清除历史时也不归零
+
+	parser    *ansi.Parser
+	altScreen bool
+	// deferredScroll 表示模拟器在最后一行换行时不立即滚动，而是把光标留在屏幕
+	// 下方、写入下一个字符时再滚动（vito/vt100），由 checkWrap 保存滚出的行
+	deferredScroll bool
+	top            int // 滚动区域上边界（0 起始）
+	bottom         int // 滚动区域下边界，-1 表示屏幕底部
+
+	// 当前字节解析出的动作
+	lineFeed   bool // LF/VT/FF/IND/NEL：光标在滚动区域底部时滚动一行
+	scrollUp   int  // CSI n S：无条件滚动 n 行
+	clearSaved bool // CSI 3 J：清除滚动历史
+	printed    bool // 输出了一个字符
+
+	// budget 是当前行在不触及最后一列的前提下还能写入的单元格数（-1 表示未知），
+	// 用完前不需要读取光标；ASCII 按 1 格、其他字符按 2 格保守计算
+	budget int
+	// 可能自动换行滚屏的字符写入前保存的顶部行和光标位置
+	watching       bool
+	watchRow       scrollbackLine
+	watchX, watchY int
+}
+
+// newScrollback creates a scrollback keeping up to max lines
+func newScrollback(max int) *scrollback {
+	s := &scrollback{max: max, bottom: -1, budget: -1}
+	s.parser = ansi.NewParser()
+	s.parser.SetParamsSize(32)
+	s.parser.SetHandler(ansi.Handler{
+		Print: func(r rune) {
+			s.printed = true
+		},
+		Execute: func(b byte) {
+			// 控制字符（CR、BS、TAB 等）可能移动光标，重新计算预算
+			s.budget = -1
+			if b == '\n' || b == '\v' || b == '\f' {
+				s.lineFeed = true
+			}
+		},
+		HandleEsc: func(cmd ansi.Cmd) {
+			s.budget = -1
+			if cmd.Intermediate() != 0 {
+				return
+			}
+			switch cmd.Final() {
+			case 'D', 'E': // IND / NEL
+				s.lineFeed = true
+			case 'c': // RIS
+				s.altScreen = false
+				s.resetRegion()
+			}
+		},
+		HandleCsi: func(cmd ansi.Cmd, params ansi.Params) {
+			// 除 SGR 外的 CSI 序列都可能移动光标
+			if cmd.Final() != 'm' {
+				s.budget = -1
+			}
+			switch {
+			case cmd.Prefix() == '?' && (cmd.Final() == 'h' || cmd.Final() == 'l'):
+				for _, p := range params {
+					switch p.Param(0) {
+					case 47, 1047, 1049:
+						s.altScreen = cmd.Final() == 'h'
+					}
+				}
+			case cmd.Prefix() != 0 || cmd.Intermediate() != 0:
+			case cmd.Final() == 'r': // DECSTBM
+				top, _, _ := params.Param(0, 1)
+				bottom, _, _ := params.Param(1, 0)
+				s.top = top - 1
+				s.bottom = bottom - 1
+				if top <= 0 {
+					s.top = 0
+				}
+				if bottom <= 0 {
+					s.bottom = -1
+				}
+			case cmd.Final() == 'S': // SU
+				n, _, _ := params.Param(0, 1)
+				if n < 1 {
+					n = 1
+				}
+				s.scrollUp = n
+			case cmd.Final() == 'J':
+				if n, _, _ := params.Param(0, 0); n == 3 {
+					s.clearSaved = true
+				}
+			}
+		},
+	})
+	return s
+}
+
+// resetRegion resets the scroll region to the whole screen
+func (s *scrollback) resetRegion() {
+	s.top = 0
+	s.bottom = -1
+}
+
+// regionBottom returns the last row of the scroll region
+func (s *scrollback) regionBottom(height int) int {
+	if s.bottom < 0 || s.bottom >= height {
+		return height - 1
+	}
+	return s.bottom
+}
+
+// write feeds data to the emulator through emulate, saving rows that scroll
+// off the top of the primary screen
+func (s *scrollback) write(screen scrollbackScreen, data []byte, emulate func([]byte) (int, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := 0
+	var err error
+	flush := func(end int) {
+		if end > start && err == nil {
+			_, err = emulate(data[start:end])
+		}
+		start = end
+	}
+
+	for i, b := range data {
+		if s.parser.State() == parser.GroundState && b >= 0x20 && b != 0x7f {
+			// 字符的第一个字节：超出本行预算时同步模拟器并检查光标
+			cost := 1
+			if b >= 0x80 {
+				cost = 2
+			}
+			if s.budget < cost {
+				flush(i)
+				s.checkWrap(screen, cost)
+			} else {
+				s.budget -= cost
+			}
+		}
+
+		s.lineFeed, s.scrollUp, s.clearSaved, s.printed = false, 0, false, false
+		s.parser.Advance(b)
+
+		switch {
+		case s.lineFeed || s.scrollUp > 0:
+			// 在触发滚动的字节之前保存顶部的行，写入后确认确实发生了滚动
+			flush(i)
+			saved, confirm := s.rowsToScroll(screen)
+			flush(i + 1)
+			if confirm == nil || confirm() {
+				s.push(saved...)
+			}
+		case s.clearSaved:
+			s.lines = nil
+			s.next = 0
+		case s.printed && s.watching:
+			flush(i + 1)
+			s.endWatch(screen)
+		}
+	}
+	flush(len(data))
+	if s.watching {
+		s.endWatch(screen)
+	}
+	return len(data), err
+}
+
+// checkWrap reads the cursor before a character of up to cost cells that
+// may not fit the budget. If it may autowrap and scroll the primary screen,
+// the top row is saved until endWatch confirms the scroll.
+func (s *scrollback) checkWrap(screen scrollbackScreen, cost int) {
+	width, height := screen.GetSize()
+	x, y := screen.GetCursorPosition()
+	bottom := s.regionBottom(height)
+	s.budget = width - 1 - x
+	if s.budget >= cost && y <= bottom {
+		s.budget -= cost
+		return
+	}
+	// 字符会写到最后一列、换行，或光标停在屏幕下方，下一个字符重新检查
+	s.budget = 0
+	if s.altScreen || s.top != 0 || height < 2 || y < bottom {
+		return
+	}
+	content, format := screen.screenRow(0)
+	s.watching = true
+	s.watchRow = newScrollbackLine(content, format)
+	s.watchX, s.watchY = x, y
+}
+
+// endWatch saves the watched top row if the character written since
+// checkWrap scrolled the screen: it wrapped on the last row, or the cursor
+// was left below the screen (vito/vt100 scrolls on the next character)
+func (s *scrollback) endWatch(screen scrollbackScreen) {
+	s.watching = false
+	_, height := screen.GetSize()
+	x, y := screen.GetCursorPosition()
+	bottom := s.regionBottom(height)
+	if s.watchY > bottom || (s.watchY == bottom && y == bottom && x < s.watchX) {
+		s.push(s.watchRow)
+	}
+	s.watchRow = scrollbackLine{}
+}
+
+// rowsToScroll returns the rows that the pending line feed or scroll up may
+// push off the primary screen. For a line feed on the last row, confirm
+// reports whether the emulator scrolled: some emulators (vito/vt100) leave
+// the cursor below the screen and scroll on the next character instead.
+func (s *scrollback) rowsToScroll(screen scrollbackScreen) (rows []scrollbackLine, confirm func() bool) {
+	if s.altScreen || s.top != 0 {
+		return nil, nil
+	}
+	_, height := screen.GetSize()
+	bottom := s.regionBottom(height)
+
+	n := s.scrollUp
+	if s.lineFeed {
+		_, y := screen.GetCursorPosition()
+		if y < bottom {
+			return nil, nil
+		}
+		if y == bottom && s.deferredScroll {
+			return nil, nil
+		}
+		if y == bottom {
+			confirm = func() bool {
+				_, after := screen.GetCursorPosition()
+				return after == y
+			}
+		}
+		n = 1
+	}
+	if n > bottom+1 {
+		n = bottom + 1
+	}
+	for y := 0; y < n; y++ {
+		content, format := screen.screenRow(y)
+		rows = append(rows, newScrollbackLine(content, format))
+	}
+	return rows, confirm
+}
+
+// isBlankCell reports whether a cell shows nothing
+func isBlankCell(r rune) bool {
+	return r == 0 || r == ' '
+}
+
+// trimBlankCells drops trailing blank cells
+func trimBlankCells(row []rune) []rune {
+	end := len(row)
+	for end > 0 && isBlankCell(row[end-1]) {
+		end--
+	}
+	return row[:end]
+}
+
+// newScrollbackLine copies a row without trailing blanks; the emulator may
+// reuse the row slices it returns
+func newScrollbackLine(content []rune, format []Format) scrollbackLine {
+	row := trimBlankCells(content)
+	line := scrollbackLine{content: append([]rune(nil), row...)}
+	end := len(row)
+	if end > len(format) {
+		end = len(format)
+	}
+	line.format = append([]Format(nil), format[:end]...)
+	return line
+}
+
+// save stores the top n rows of the primary screen, e.g. before a resize
+// pushes them off
+func (s *scrollback) save(screen scrollbackScreen, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n <= 0 || s.altScreen {
+		return
+	}
+	for y := 0; y < n; y++ {
+		content, format := screen.screenRow(y)
+		s.push(newScrollbackLine(content, format))
+	}
+}
+
+// add stores one row scrolled off by an emulator that tracks scrolling itself
+func (s *scrollback) add(content []rune, format []Format) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.push(newScrollbackLine(content, format))
+}
+
+// clear drops all saved lines (CSI 3 J)
+func (s *scrollback) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = nil
+	s.next = 0
+}
+
+// resized resets the scroll region, as terminals do on resize
+func (s *scrollback) resized() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetRegion()
+}
+
+// push appends lines, dropping the oldest beyond the limit
+func (s *scrollback) push(lines ...scrollbackLine) {
+	s.scrolled += uint64(len(lines))
+	if s.max <= 0 {
+		return
+	}
+	for _, line := range lines {
+		if len(s.lines) < s.max {
+			s.lines = append(s.lines, line)
+			continue
+		}
+		s.lines[s.next] = line
+		s.next = (s.next + 1) % s.max
+	}
+}
+
+// count returns how many lines have scrolled off the primary screen in total
+func (s *scrollback) count() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scrolled
+}
+
+// scrollCounter is implemented by emulators that keep a scrollback, so a
+// screen capture can tell how far earlier rows have moved up since
+type scrollCounter interface {
+	scrolledLines() uint64
+}
+
+// get returns up to the last n saved lines, oldest first
+func (s *scrollback) get(n int) ([][]rune, [][]Format) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := len(s.lines)
+	if n > total {
+		n = total
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	content := make([][]rune, 0, n)
+	format := make([][]Format, 0, n)
+	for i := total - n; i < total; i++ {
+		line := s.lines[(s.next+i)%total]
+		content = append(content, append([]rune(nil), line.content...))
+		format = append(format, append([]Format(nil), line.format...))
+	}
+	return content, format
+}
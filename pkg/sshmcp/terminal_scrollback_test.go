@@ -0,0 +1,207 @@
+package sshmcp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrollbackText returns up to n scrollback lines as trimmed strings
+func scrollbackText(emu TerminalEmulator, n int) []string {
+	content, _ := emu.GetScrollback(n)
+	lines := make([]string, len(content))
+	for i, row := range content {
+		lines[i] = strings.TrimRight(strings.ReplaceAll(string(row), "\x00", " "), " ")
+	}
+	return lines
+}
+
+// forEachEmulator runs a test against every terminal emulator backend
+func forEachEmulator(t *testing.T, width, height int, fn func(t *testing.T, emu TerminalEmulator)) {
+	for _, emulatorType := range allEmulatorTypes {
+		t.Run(string(emulatorType), func(t *testing.T) {
+			emu, err := GetTerminalEmulator(emulatorType, width, height)
+			require.NoError(t, err)
+			defer emu.Close()
+			fn(t, emu)
+		})
+	}
+}
+
+// TestScrollback_LineFeed tests saving lines pushed off by line feeds
+func TestScrollback_LineFeed(t *testing.T) {
+	forEachEmulator(t, 10, 3, func(t *testing.T, emu TerminalEmulator) {
+		emu.Write([]byte("one\r\ntwo\r\nthree\r\n"))
+		emu.Write([]byte("\x1b[31mfour\x1b[0m\r\nfive"))
+
+		assert.Equal(t, []string{"one", "two"}, scrollbackText(emu, 10))
+		assert.Equal(t, []string{"two"}, scrollbackText(emu, 1))
+		assert.Empty(t, scrollbackText(emu, 0))
+
+		capturer := &TerminalCapturer{Emulator: emu}
+		assert.Equal(t, "one\ntwo", capturer.GetScrollbackSnapshot(5))
+		assert.Len(t, capturer.GetScrollbackSpans(5), 2)
+	})
+}
+
+// TestScrollback_Autowrap tests saving lines pushed off by long wrapped lines
+func TestScrollback_Autowrap(t *testing.T) {
+	forEachEmulator(t, 5, 3, func(t *testing.T, emu TerminalEmulator) {
+		emu.Write([]byte("a\r\nb\r\n"))
+		emu.Write([]byte("0123456789ABCDEFGHIJxyz"))
+
+		assert.Equal(t, []string{"a", "b", "01234", "56789"}, scrollbackText(emu, 10))
+	})
+}
+
+// TestScrollback_AltScreen tests that the alternate screen does not add history
+func TestScrollback_AltScreen(t *testing.T) {
+	// vito/vt100 不支持备用屏幕
+	emu, err := NewVT10xEmulator(10, 3)
+	require.NoError(t, err)
+
+	emu.Write([]byte("$ less\r\n"))
+	emu.Write([]byte("\x1b[?1049h"))
+	for i := 0; i < 10; i++ {
+		emu.Write([]byte("page\r\n"))
+	}
+	emu.Write([]byte("\x1b[?1049l"))
+	assert.Empty(t, scrollbackText(emu, 10))
+
+	emu.Write([]byte("\r\n\r\n"))
+	assert.Equal(t, []string{"$ less"}, scrollbackText(emu, 10))
+}
+
+// TestScrollback_Limit tests that only the newest lines are kept
+func TestScrollback_Limit(t *testing.T) {
+	forEachEmulator(t, 10, 2, func(t *testing.T, emu TerminalEmulator) {
+		var sb strings.Builder
+		for i := 0; i < DefaultScrollbackLines+50; i++ {
+			fmt.Fprintf(&sb, "line %d\r\n", i)
+		}
+		sb.WriteString("last\r\nend")
+		emu.Write([]byte(sb.String()))
+
+		lines := scrollbackText(emu, DefaultScrollbackLines*2)
+		require.Len(t, lines, DefaultScrollbackLines)
+		assert.Equal(t, "line 50", lines[0])
+		assert.Equal(t, fmt.Sprintf("line %d", DefaultScrollbackLines+49), lines[len(lines)-1])
+
+		// CSI 3 J（clear 命令）清除滚动历史
+		emu.Write([]byte("\x1b[H\x1b[2J\x1b[3J"))
+		assert.Empty(t, scrollbackText(emu, 10))
+	})
+}
+
+// TestScrollback_Region tests scroll regions and SU with the vt10x emulator
+func TestScrollback_Region(t *testing.T) {
+	emu, err := NewVT10xEmulator(10, 4)
+	require.NoError(t, err)
+
+	// 不从顶部开始的滚动区域（如状态栏下方的列表）不记录历史
+	emu.Write([]byte("title\r\n\x1b[2;4r\x1b[4;1H"))
+	emu.Write([]byte("x\r\ny\r\nz\r\n"))
+	assert.Empty(t, scrollbackText(emu, 10))
+	assert.Equal(t, "title", strings.TrimRight(string(emu.GetScreenContent()[0]), " \x00"))
+
+	// 重置滚动区域后 SU 滚出顶部的行
+	emu.Write([]byte("\x1b[r\x1b[2S"))
+	assert.Equal(t, []string{"title", "y"}, scrollbackText(emu, 10))
+}
+
+// TestScrollback_ResizeShrink tests saving rows pushed off when the height shrinks
+func TestScrollback_ResizeShrink(t *testing.T) {
+	emu, err := NewVT10xEmulator(10, 4)
+	require.NoError(t, err)
+
+	emu.Write([]byte("1\r\n2\r\n3\r\n4"))
+	emu.Resize(10, 2)
+
+	assert.Equal(t, []string{"1", "2"}, scrollbackText(emu, 10))
+	assert.Equal(t, "3", strings.TrimRight(string(emu.GetScreenContent()[0]), " \x00"))
+}
+
+// countingScreen counts the rows the scrollback reads from the screen
+type countingScreen struct {
+	scrollbackScreen
+	rows int
+}
+
+func (c *countingScreen) screenRow(y int) ([]rune, []Format) {
+	c.rows++
+	return c.scrollbackScreen.screenRow(y)
+}
+
+// TestScrollback_ReadsOnlyScrolledRows tests that the scrollback reads one
+// row per scrolled line instead of comparing whole screens
+func TestScrollback_ReadsOnlyScrolledRows(t *testing.T) {
+	vt10xEmu, err := NewVT10xEmulator(40, 10)
+	require.NoError(t, err)
+	vt100Emu, err := NewVT100Emulator(40, 10)
+	require.NoError(t, err)
+
+	for name, emu := range map[string]struct {
+		screen scrollbackScreen
+		write  func([]byte) (int, error)
+		sb     *scrollback
+	}{
+		"vt10x": {vt10xEmu, vt10xEmu.vt.Write, newScrollback(DefaultScrollbackLines)},
+		"vt100": {vt100Screen{vt100Emu.vt}, vt100Emu.vt.Write, vt100Emu.scrollback},
+	} {
+		t.Run(name, func(t *testing.T) {
+			screen := &countingScreen{scrollbackScreen: emu.screen}
+			var sb strings.Builder
+			for i := 0; i < 100; i++ {
+				// 短行、恰好一屏宽的行和自动换行的长行
+				switch i % 3 {
+				case 0:
+					fmt.Fprintf(&sb, "\x1b[1mline %d\x1b[0m\r\n", i)
+				case 1:
+					fmt.Fprintf(&sb, "%-40s\r\n", fmt.Sprintf("full %d", i))
+				default:
+					fmt.Fprintf(&sb, "%-50s\r\n", fmt.Sprintf("wrapped %d", i))
+				}
+			}
+			_, err := emu.sb.write(screen, []byte(sb.String()), emu.write)
+			require.NoError(t, err)
+
+			saved, _ := emu.sb.get(DefaultScrollbackLines)
+			require.NotEmpty(t, saved)
+			assert.Equal(t, "line 0", string(saved[0]))
+			// 整屏比较每行要读 10 行，这里每滚出一行最多读两行
+			assert.LessOrEqual(t, screen.rows, 2*len(saved))
+		})
+	}
+}
+
+// scrollbackBenchLog returns coloured log output for the scrollback benchmarks
+func scrollbackBenchLog(lines int) []byte {
+	var sb strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&sb, "\x1b[32m2024-05-06 07:08:09\x1b[0m \x1b[1mINFO\x1b[0m worker-%d request handled path=/api/v1/items/%d status=200 elapsed=%dms\r\n", i%8, i, i%250)
+	}
+	return []byte(sb.String())
+}
+
+// BenchmarkScrollback_Log measures writing a long coloured log to a full
+// screen, where every line scrolls; it should stay within a small factor of
+// the bare emulators
+func BenchmarkScrollback_Log(b *testing.B) {
+	data := scrollbackBenchLog(2000)
+	for _, emulatorType := range allEmulatorTypes {
+		b.Run(string(emulatorType), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				emu, err := GetTerminalEmulator(emulatorType, 160, 40)
+				require.NoError(b, err)
+				for off := 0; off < len(data); off += 4096 {
+					emu.Write(data[off:minInt(off+4096, len(data))])
+				}
+				emu.Close()
+			}
+		})
+	}
+}
@@ -1,12 +1,12 @@
 package sshmcp
 
 import (
+	"fmt"
 	"io"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/charmbracelet/x/ansi"
 	"golang.org/x/crypto/ssh"
 	"github.com/pkg/sftp"
 )
@@ -64,10 +64,13 @@ type Session struct {
 
 	// 客户端连接
 	SSHClient  *ssh.Client  `json:"-"`
-	SFTPClient *sftp.Client `json:"-"`
+	SFTPClient *sftp.Client `json:"-"` // 首次文件操作时创建，外部使用 Session.SFTP()
+	sftpErr    error        // SFTP 子系统不可用时缓存的错误
 
 	// 交互式 Shell
-	ShellSession *SSHShellSession `json:"-"`
+	ShellSession *SSHShellSession            `json:"-"` // 默认 Shell（最近创建的）
+	Shells       map[string]*SSHShellSession `json:"-"` // 按 shell_id 索引的全部 Shell
+	shellSeq     int                                   // 自动生成 shell_id 的序号
 
 	// 时间戳
 	CreatedAt  time.Time `json:"created_at"`
@@ -96,6 +99,7 @@ type CommandHistoryEntry struct {
 	Timestamp     time.Time     `json:"timestamp"`      // 执行时间戳
 	Success       bool          `json:"success"`        // 是否成功（exit code == 0）
 	Source        string        `json:"source"`         // 命令来源: "exec" 或 "shell"
+	ShellID       string        `json:"shell_id,omitempty"` // source 为 "shell" 时的 shell_id
 }
 
 // GetShellSession returns the shell session (used by mcp package)
@@ -128,196 +132,15 @@ type SessionConfig struct {
 	// 安全配置
 	MaxIdleTime   time.Duration
 	AutoReconnect bool
-}
-
-// CircularBuffer is a thread-safe circular buffer for storing output lines
-type CircularBuffer struct {
-	buffer []string
-	size   int
-	head   int
-	tail   int
-	count  int
-	mu     sync.Mutex
-}
-
-// NewCircularBuffer creates a new circular buffer with specified size
-func NewCircularBuffer(size int) *CircularBuffer {
-	return &CircularBuffer{
-		buffer: make([]string, size),
-		size:   size,
-		head:   0,
-		tail:   0,
-		count:  0,
-	}
-}
-
-// Write adds a new line to the buffer (filters heartbeat and ANSI data)
-func (cb *CircularBuffer) Write(line string) {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	// Filter out heartbeat data
-	if line == "\x1b[s\x1b[u" || line == "\x00" || line == "\x1b[s" || line == "\x1b[u" {
-		return
-	}
-
-	// Filter ANSI escape sequences and control characters
-	line = filterANSI(line)
-
-	// Skip empty lines after filtering
-	if len(strings.TrimSpace(line)) == 0 {
-		return
-	}
-
-	if cb.count >= cb.size {
-		// Buffer is full, overwrite oldest data
-		cb.buffer[cb.head] = line
-		cb.head = (cb.head + 1) % cb.size
-		cb.tail = (cb.tail + 1) % cb.size
-	} else {
-		cb.buffer[cb.head] = line
-		cb.head = (cb.head + 1) % cb.size
-		cb.count++
-	}
-}
-
-// ReadLatestLines reads the latest N lines from the buffer
-func (cb *CircularBuffer) ReadLatestLines(n int) []string {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	if cb.count == 0 {
-		return []string{}
-	}
-
-	// Adjust n if it's larger than the count
-	if n > cb.count {
-		n = cb.count
-	}
-
-	result := make([]string, n)
-	for i := 0; i < n; i++ {
-		// Read backwards from head
-		pos := (cb.head - 1 - i + cb.size) % cb.size
-		result[n-1-i] = cb.buffer[pos]
-	}
-
-	return result
-}
-
-// ReadAllUnread reads all unread data (from tail to head)
-func (cb *CircularBuffer) ReadAllUnread() []string {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
-	if cb.count == 0 {
-		return []string{}
-	}
-
-	result := make([]string, cb.count)
-	for i := 0; i < cb.count; i++ {
-		pos := (cb.tail + i) % cb.size
-		result[i] = cb.buffer[pos]
-	}
-
-	// Mark as read by moving tail to head
-	cb.tail = cb.head
-	cb.count = 0
 
-	return result
-}
-
-// ReadLatestBytes reads the latest N bytes from the buffer
-func (cb *CircularBuffer) ReadLatestBytes(n int) string {
-	lines := cb.ReadLatestLines(cb.count) // Read all lines
-	var result string
-	var currentSize int
-
-	// Build result from the end
-	for i := len(lines) - 1; i >= 0; i-- {
-		lineSize := len(lines[i])
-		if currentSize+lineSize > n {
-			// Would exceed limit, truncate the line
-			remaining := n - currentSize
-			if remaining > 0 {
-				result = lines[i][len(lines[i])-remaining:] + result
-			}
-			break
-		}
-		result = lines[i] + "\n" + result
-		currentSize += lineSize + 1 // +1 for newline
-	}
-
-	return result
-}
-
-// GetCount returns the current number of items in the buffer
-func (cb *CircularBuffer) GetCount() int {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	return cb.count
-}
-
-// GetCapacity returns the buffer capacity
-func (cb *CircularBuffer) GetCapacity() int {
-	return cb.size
-}
-
-// filterANSI removes ANSI escape sequences and control characters from string
-// Uses ECMA-48 compliant parser for maximum compatibility
-func filterANSI(s string) string {
-	var text strings.Builder
-
-	// Create handler with functions to process ANSI sequences
-	// Only collects printable text, ignores all control sequences
-	handler := ansi.Handler{
-		Print: func(r rune) {
-			// Only collect printable characters (newline, tab, and >= 32)
-			if r == '\n' || r == '\t' || r >= 32 {
-				text.WriteRune(r)
-			}
-		},
-		Execute: func(b byte) {
-			// Control characters - ignore
-		},
-		HandleCsi: func(cmd ansi.Cmd, params ansi.Params) {
-			// CSI sequences - ignore (colors, cursor movement, etc.)
-		},
-		HandleEsc: func(cmd ansi.Cmd) {
-			// ESC sequences - ignore
-		},
-		HandleOsc: func(cmd int, data []byte) {
-			// OSC sequences (window title, etc.) - ignore
-		},
-		HandleDcs: func(cmd ansi.Cmd, params ansi.Params, data []byte) {
-			// DCS sequences - ignore
-		},
-		HandleApc: func(data []byte) {
-			// APC sequences - ignore
-		},
-		HandlePm: func(data []byte) {
-			// PM sequences - ignore
-		},
-		HandleSos: func(data []byte) {
-			// SOS sequences - ignore
-		},
-	}
-
-	parser := ansi.NewParser()
-	parser.SetParamsSize(32)
-	parser.SetDataSize(1024)
-	parser.SetHandler(handler)
-
-	// Parse the input byte by byte
-	for _, b := range []byte(s) {
-		parser.Advance(b)
-	}
-
-	return text.String()
+	// 录制配置
+	Recording *RecordingConfig
 }
 
 // SSHShellSession represents an interactive shell session
 type SSHShellSession struct {
+	ID             string    // shell_id，在所属会话内唯一
+	CreatedAt      time.Time
 	Session        *ssh.Session
 	Stdin          io.WriteCloser
 	Stdout         io.Reader
@@ -329,6 +152,7 @@ type SSHShellSession struct {
 	// Status tracking
 	LastReadTime   time.Time
 	LastWriteTime  time.Time
+	lastOutput     atomic.Int64 // 后台读取最后一次收到输出的时间（UnixNano），用于等待输出稳定
 	currentDir     string
 	hasUnreadData  bool
 
@@ -339,6 +163,23 @@ type SSHShellSession struct {
 	// Terminal emulator for snapshot support
 	TerminalCapturer *TerminalCapturer
 
+	// Plain-text output stream for Expect
+	expect *expectStream
+
+	// Working directory tracking via OSC 7, with /proc lookups over client
+	cwd    *cwdTracker
+	client *ssh.Client
+
+	// Screen versions and per-reader snapshots for snapshot diffing
+	screens *screenVersions
+
+	// Per-command tracking via OSC 133 markers (nil unless ShellIntegration)
+	tracker *shellTracker
+
+	// asciicast recording (nil unless ssh_record_start was called)
+	recorder *asciicastRecorder
+	recMu    sync.Mutex
+
 	// Keepalive tracking
 	LastKeepAlive  time.Time
 	KeepAliveFails int
@@ -348,6 +189,7 @@ type SSHShellSession struct {
 	done           chan struct{}
 	heartbeatDone  chan struct{}
 	keepaliveDone  chan struct{}
+	heartbeats     heartbeatFilter // 过滤应用层心跳的回显
 }
 
 // TerminalInfo represents terminal information
@@ -386,7 +228,7 @@ const (
 	ANSIRaw ANSIMode = iota
 	// ANSIStrip - remove ANSI sequences
 	ANSIStrip
-	// ANSIParse - parse and provide structured data (future)
+	// ANSIParse - parse into styled spans (text plus colours and attributes) as JSON
 	ANSIParse
 )
 
@@ -403,6 +245,20 @@ func (m ANSIMode) String() string {
 	}
 }
 
+// ParseANSIMode parses "raw", "strip" or "parse"
+func ParseANSIMode(s string) (ANSIMode, error) {
+	switch s {
+	case "raw":
+		return ANSIRaw, nil
+	case "strip":
+		return ANSIStrip, nil
+	case "parse":
+		return ANSIParse, nil
+	default:
+		return ANSIStrip, fmt.Errorf("invalid ANSI mode %q (valid: raw, strip, parse)", s)
+	}
+}
+
 // ShellConfig configures the shell session behavior
 type ShellConfig struct {
 	// Terminal mode (raw or cooked)
@@ -417,15 +273,25 @@ type ShellConfig struct {
 	AutoDetectInteractive bool
 	// Output buffer size (number of lines to keep in circular buffer)
 	BufferSize int
+	// Output buffer byte capacity (raw bytes to keep in circular buffer)
+	BufferBytes int
+	// Install OSC 133 prompt hooks to track per-command output and exit codes
+	ShellIntegration bool
+	// Install a prompt hook reporting the working directory (OSC 7) and shell pid
+	CwdHook bool
+	// Terminal emulator backend for snapshots (empty uses SSH_MCP_TERMINAL_EMULATOR)
+	Emulator TerminalEmulatorType
 }
 
 // ShellStatus represents the current status of a shell session
 type ShellStatus struct {
 	IsActive      bool      `json:"is_active"`       // Shell 是否活动
 	CurrentDir    string    `json:"current_dir"`     // 当前工作目录
+	CurrentDirSource string `json:"current_dir_source,omitempty"` // 目录来源 (osc7/proc/prompt)
 	HasUnreadOutput bool    `json:"has_unread_output"` // 是否有未读取的输出
 	LastReadTime  time.Time `json:"last_read_time"`  // 最后读取时间
 	LastWriteTime time.Time `json:"last_write_time"` // 最后写入时间
+	LastOutputTime time.Time `json:"last_output_time"` // 最后收到输出的时间
 	TerminalType  string    `json:"terminal_type"`   // 终端类型
 	Rows          uint16    `json:"rows"`            // 终端行数
 	Cols          uint16    `json:"cols"`            // 终端列数
@@ -433,8 +299,15 @@ type ShellStatus struct {
 	ANSIMode      string    `json:"ansi_mode"`       // ANSI 处理模式
 	BufferUsed    int       `json:"buffer_used"`     // 缓冲区已使用行数
 	BufferTotal   int       `json:"buffer_total"`    // 缓冲区总容量
+	BufferBytes   int       `json:"buffer_bytes"`    // 缓冲区已使用字节数
+	BufferBytesTotal int    `json:"buffer_bytes_total"` // 缓冲区字节容量
+	BufferNextSeq int64     `json:"buffer_next_seq"` // 下一行输出的序号
+	BufferDropped int64     `json:"buffer_dropped"`  // 因溢出被覆盖的行数
 	LastKeepAlive time.Time `json:"last_keepalive"`  // 最后一次 keepalive 成功时间
 	KeepAliveFails int      `json:"keepalive_fails"` // 连续 keepalive 失败次数
+	ShellIntegration string `json:"shell_integration,omitempty"` // Shell 集成模式 (bash/zsh/sentinel)
+	Emulator      string    `json:"emulator"`        // 终端模拟器 (vt10x/vt100/ansi)
+	TerminalModes TerminalModes `json:"terminal_modes"` // 程序设置的终端模式（备用屏幕、括号粘贴等）
 }
 
 // DefaultShellConfig returns default configuration
@@ -445,7 +318,9 @@ func DefaultShellConfig() *ShellConfig {
 		ReadTimeout:           100 * time.Millisecond,
 		WriteTimeout:          5 * time.Second,
 		AutoDetectInteractive: true,
-		BufferSize:            10000, // 默认缓冲 10000 行（~1MB）
+		BufferSize:            DefaultBufferLines, // 默认缓冲 10000 行
+		BufferBytes:           DefaultBufferBytes, // 且不超过 4MB 原始输出
+		CwdHook:               true,               // 通过 OSC 7 跟踪工作目录
 	}
 }
 
@@ -470,6 +345,38 @@ type FileTransferResult struct {
 	Speed         string  `json:"speed,omitempty"`          // 传输速度（如 "1.5 MB/s"）
 	FilePath      string  `json:"file_path,omitempty"`      // 文件路径
 	Operation     string  `json:"operation,omitempty"`      // 操作类型 ("upload" 或 "download")
+	// 校验信息（开启 verify 时填充）
+	Verified          bool   `json:"verified,omitempty"`           // 校验和是否一致
+	VerifiedFiles     int    `json:"verified_files,omitempty"`     // 已校验的文件数
+	Checksum          string `json:"checksum,omitempty"`           // 单文件传输时的校验和
+	ChecksumAlgorithm string `json:"checksum_algorithm,omitempty"` // 校验算法
+	// 目录传输统计
+	FilesTransferred int `json:"files_transferred,omitempty"` // 传输的文件数
+	// 归档传输信息（开启 archive 时填充）
+	ArchiveFormat    string  `json:"archive_format,omitempty"`    // 实际使用的归档格式：tar、gzip、zstd
+	ArchiveBytes     int64   `json:"archive_bytes,omitempty"`     // 实际传输的归档字节数
+	CompressionRatio float64 `json:"compression_ratio,omitempty"` // 文件总大小 / 归档字节数
+	Fallback         string  `json:"fallback,omitempty"`          // 未能使用（或降级）归档模式的原因
+	// 会话间复制信息
+	Method string `json:"method,omitempty"` // 复制方式：stream（经本机中转）、rsync、scp
+	// 文件传输后端
+	Backend string `json:"backend,omitempty"` // sftp、scp 或 exec（SFTP 不可用时自动选择）
+}
+
+// TransferOptions configures file upload/download behavior
+type TransferOptions struct {
+	CreateDirs bool // 是否创建目标目录
+	Overwrite  bool // 是否覆盖已存在文件
+
+	// 端到端校验
+	Verify            bool   // 传输后比对本地与远程校验和
+	ChecksumAlgorithm string // sha256（默认）、sha1、sha512、md5
+	KeepOnMismatch    bool   // 校验失败时保留目标文件（默认删除）
+
+	// 目录传输
+	Archive string   // 归档模式：空（逐个文件 SFTP 传输）、tar、gzip、zstd
+	Include []string // 只传输匹配的文件（glob，支持 **）
+	Exclude []string // 排除匹配的路径（gitignore 语法）
 }
 
 // FileInfo represents file information for SFTP
@@ -0,0 +1,387 @@
+package sshmcp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxLCSCells limits the size of the LCS table; larger changed regions are diffed as a block replacement
+const maxLCSCells = 2_000_000
+
+// diffOpKind is the kind of a line diff operation
+type diffOpKind int
+
+const (
+	diffEqual diffOpKind = iota
+	diffDelete
+	diffInsert
+)
+
+// diffOp is a single line in a line diff
+type diffOp struct {
+	Kind diffOpKind
+	Line string // 含行尾换行符（如果有）
+}
+
+// splitLinesKeepEnds splits text into lines, keeping the trailing "\n" of each line
+func splitLinesKeepEnds(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a line diff between a and b
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{Kind: diffEqual, Line: line})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{Kind: diffEqual, Line: line})
+	}
+	return ops
+}
+
+// lcsDiff diffs two line slices using a longest-common-subsequence table
+func lcsDiff(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+
+	if len(a) == 0 || len(b) == 0 || len(a)*len(b) > maxLCSCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{Kind: diffDelete, Line: line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{Kind: diffInsert, Line: line})
+		}
+		return ops
+	}
+
+	// dp[i][j] = a[i:] 与 b[j:] 的 LCS 长度
+	width := len(b) + 1
+	dp := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i*width+j] = dp[(i+1)*width+j+1] + 1
+			} else if dp[(i+1)*width+j] >= dp[i*width+j+1] {
+				dp[i*width+j] = dp[(i+1)*width+j]
+			} else {
+				dp[i*width+j] = dp[i*width+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{Kind: diffEqual, Line: a[i]})
+			i++
+			j++
+		case dp[(i+1)*width+j] >= dp[i*width+j+1]:
+			ops = append(ops, diffOp{Kind: diffDelete, Line: a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{Kind: diffInsert, Line: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{Kind: diffDelete, Line: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{Kind: diffInsert, Line: b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff returns a unified diff of two texts, or "" if they are equal
+func unifiedDiff(oldName, newName, oldText, newText string, context int) string {
+	if oldText == newText {
+		return ""
+	}
+	ops := diffLines(splitLinesKeepEnds(oldText), splitLinesKeepEnds(newText))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// oldLine/newLine[i] 为 ops[i] 之前已经过的旧/新行数
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.Kind != diffInsert {
+			oldLine[i+1]++
+		}
+		if op.Kind != diffDelete {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == diffEqual {
+			i++
+			continue
+		}
+
+		// 合并间隔不超过 2*context 行的修改
+		start := max(0, i-context)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].Kind != diffEqual {
+				end = j + 1
+			} else if j-end >= 2*context {
+				break
+			}
+		}
+		end = min(len(ops), end+context)
+
+		oldCount := oldLine[end] - oldLine[start]
+		newCount := newLine[end] - newLine[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldLine[start], oldCount), hunkRange(newLine[start], newCount))
+
+		for _, op := range ops[start:end] {
+			prefix := " "
+			switch op.Kind {
+			case diffDelete:
+				prefix = "-"
+			case diffInsert:
+				prefix = "+"
+			}
+			sb.WriteString(prefix)
+			sb.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats a hunk range: start is the number of lines before the hunk
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return strconv.Itoa(start + 1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+// patchLine is a line of a hunk: ' ' (context), '-' (removed) or '+' (added)
+type patchLine struct {
+	Kind byte
+	Text string // 含换行符（"\ No newline at end of file" 标记的行除外）
+}
+
+// patchHunk is a parsed hunk of a unified diff
+type patchHunk struct {
+	OldStart int // 旧文件起始行号（从 1 开始，纯插入时为插入位置之前的行号）
+	Lines    []patchLine
+}
+
+// oldLines returns the context and removed lines the hunk expects in the file
+func (h *patchHunk) oldLines() []string {
+	var lines []string
+	for _, line := range h.Lines {
+		if line.Kind != '+' {
+			lines = append(lines, line.Text)
+		}
+	}
+	return lines
+}
+
+// apply returns the replacement for the matched old lines; context lines are taken from
+// the file so that tolerated whitespace differences are preserved
+func (h *patchHunk) apply(matched []string) []string {
+	var lines []string
+	i := 0
+	for _, line := range h.Lines {
+		switch line.Kind {
+		case ' ':
+			lines = append(lines, matched[i])
+			i++
+		case '-':
+			i++
+		case '+':
+			lines = append(lines, line.Text)
+		}
+	}
+	return lines
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseUnifiedPatch parses the hunks of a unified diff for a single file.
+// File headers are ignored; hunk line counts are not required to be accurate,
+// but a "--- "/"+++ " pair is only taken as the next file's header once the
+// counts from the @@ line are used up, so removed "-- x" and added "++ y"
+// lines are not mistaken for one.
+func parseUnifiedPatch(patch string) ([]patchHunk, error) {
+	lines := strings.Split(strings.TrimSuffix(patch, "\n"), "\n")
+
+	var hunks []patchHunk
+	var current *patchHunk
+	var oldLeft, newLeft int // 当前 hunk 按 @@ 行数尚未读取的旧/新文件行数
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+
+		if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+			oldStart, _ := strconv.Atoi(m[1])
+			oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+			hunks = append(hunks, patchHunk{OldStart: oldStart})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+
+		if current == nil {
+			continue // 跳过 diff/---/+++ 等文件头
+		}
+		if oldLeft <= 0 && newLeft <= 0 && strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			current = nil // 下一个文件的文件头
+			continue
+		}
+
+		// 保留原始行（可能含 \r），只有标记行和空行需要特殊处理
+		raw := lines[i]
+		switch {
+		case raw == "":
+			// 部分编辑器会去掉空上下文行前的空格
+			current.Lines = append(current.Lines, patchLine{Kind: ' ', Text: "\n"})
+			oldLeft--
+			newLeft--
+		case raw[0] == ' ' || raw[0] == '-' || raw[0] == '+':
+			current.Lines = append(current.Lines, patchLine{Kind: raw[0], Text: raw[1:] + "\n"})
+			if raw[0] != '+' {
+				oldLeft--
+			}
+			if raw[0] != '-' {
+				newLeft--
+			}
+		case raw[0] == '\\':
+			// "\ No newline at end of file" 作用于上一行
+			if n := len(current.Lines); n > 0 {
+				current.Lines[n-1].Text = strings.TrimSuffix(current.Lines[n-1].Text, "\n")
+			}
+		default:
+			return nil, fmt.Errorf("invalid patch line %d: %q", i+1, line)
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks (expected lines starting with @@)")
+	}
+	return hunks, nil
+}
+
+// hunkCount parses the optional line count of a hunk header range (default 1)
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// applyUnifiedPatch applies a unified diff to text and returns the patched text.
+// Hunks are located at their stated line first, then by searching nearby; if no exact match
+// exists, trailing whitespace differences are tolerated.
+func applyUnifiedPatch(text, patch string) (string, int, error) {
+	hunks, err := parseUnifiedPatch(patch)
+	if err != nil {
+		return "", 0, err
+	}
+
+	lines := splitLinesKeepEnds(text)
+	delta := 0    // 之前的 hunk 造成的行数变化
+	minStart := 0 // hunk 不能与之前应用的 hunk 重叠
+
+	for n, hunk := range hunks {
+		old := hunk.oldLines()
+		expected := hunk.OldStart - 1 + delta
+		if len(old) == 0 {
+			expected = hunk.OldStart + delta // 纯插入：OldStart 为插入位置之前的行号
+		}
+
+		pos := findHunk(lines, old, expected, minStart, linesEqual)
+		if pos < 0 {
+			pos = findHunk(lines, old, expected, minStart, linesEqualLoose)
+		}
+		if pos < 0 {
+			return "", n, fmt.Errorf("hunk %d (line %d) does not match the file content", n+1, hunk.OldStart)
+		}
+
+		replacement := hunk.apply(lines[pos : pos+len(old)])
+		patched := make([]string, 0, len(lines)-len(old)+len(replacement))
+		patched = append(patched, lines[:pos]...)
+		patched = append(patched, replacement...)
+		patched = append(patched, lines[pos+len(old):]...)
+		lines = patched
+
+		delta += len(replacement) - len(old)
+		minStart = pos + len(replacement)
+	}
+
+	return strings.Join(lines, ""), len(hunks), nil
+}
+
+// findHunk finds the position of old in lines closest to expected, not before minStart
+func findHunk(lines, old []string, expected, minStart int, equal func(a, b string) bool) int {
+	last := len(lines) - len(old)
+	expected = min(max(expected, minStart), max(last, minStart))
+
+	matchAt := func(pos int) bool {
+		if pos < minStart || pos > last {
+			return false
+		}
+		for i, line := range old {
+			if !equal(lines[pos+i], line) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for offset := 0; expected-offset >= minStart || expected+offset <= last; offset++ {
+		if matchAt(expected - offset) {
+			return expected - offset
+		}
+		if matchAt(expected + offset) {
+			return expected + offset
+		}
+	}
+	return -1
+}
+
+// linesEqual compares two lines exactly
+func linesEqual(a, b string) bool {
+	return a == b
+}
+
+// linesEqualLoose compares two lines ignoring trailing whitespace and line endings
+func linesEqualLoose(a, b string) bool {
+	return strings.TrimRight(a, " \t\r\n") == strings.TrimRight(b, " \t\r\n")
+}
@@ -0,0 +1,204 @@
+package sshmcp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSplitLinesKeepEnds tests line splitting
+func TestSplitLinesKeepEnds(t *testing.T) {
+	assert.Nil(t, splitLinesKeepEnds(""))
+	assert.Equal(t, []string{"a\n", "b\n"}, splitLinesKeepEnds("a\nb\n"))
+	assert.Equal(t, []string{"a\n", "b"}, splitLinesKeepEnds("a\nb"))
+}
+
+// TestUnifiedDiff tests diff output format
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "a\nb\nc\nd\ne\n"
+	newText := "a\nb\nC\nd\ne\n"
+
+	assert.Equal(t, "", unifiedDiff("a/f", "b/f", oldText, oldText, 3))
+	assert.Equal(t, `--- a/f
++++ b/f
+@@ -2,3 +2,3 @@
+ b
+-c
++C
+ d
+`, unifiedDiff("a/f", "b/f", oldText, newText, 1))
+}
+
+// TestUnifiedDiff_SeparateHunks tests that distant changes produce separate hunks
+func TestUnifiedDiff_SeparateHunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	oldText := strings.Join(lines, "")
+	lines[1] = "changed 2\n"
+	lines[17] = "changed 18\n"
+	newText := strings.Join(lines, "")
+
+	diff := unifiedDiff("a", "b", oldText, newText, 3)
+	assert.Equal(t, 2, strings.Count(diff, "@@ -"))
+	assert.Contains(t, diff, "@@ -1,5 +1,5 @@")
+	assert.Contains(t, diff, "@@ -15,6 +15,6 @@")
+}
+
+// TestUnifiedDiff_NoNewline tests the missing trailing newline marker
+func TestUnifiedDiff_NoNewline(t *testing.T) {
+	diff := unifiedDiff("a", "b", "x\ny", "x\nz", 3)
+	assert.Contains(t, diff, "-y\n\\ No newline at end of file\n+z\n\\ No newline at end of file\n")
+}
+
+// TestApplyUnifiedPatch_RoundTrip tests that generated diffs apply cleanly
+func TestApplyUnifiedPatch_RoundTrip(t *testing.T) {
+	cases := []struct{ old, new string }{
+		{"a\nb\nc\n", "a\nB\nc\n"},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\n", "new\na\nb\nc\nend\n"},
+		{"", "hello\n"},
+		{"x\ny", "x\nz"},
+		{"x\ny", "x\ny\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\nTWO\n3\n4\n5\n6\n7\n8\n9\n10\nELEVEN\n12\n"},
+	}
+
+	for _, c := range cases {
+		diff := unifiedDiff("a", "b", c.old, c.new, 3)
+		got, _, err := applyUnifiedPatch(c.old, diff)
+		require.NoError(t, err, diff)
+		assert.Equal(t, c.new, got, diff)
+
+		diff = unifiedDiff("a", "b", c.old, c.new, 0)
+		got, _, err = applyUnifiedPatch(c.old, diff)
+		require.NoError(t, err, diff)
+		assert.Equal(t, c.new, got, diff)
+	}
+}
+
+// TestApplyUnifiedPatch_Offset tests hunks whose line numbers are off
+func TestApplyUnifiedPatch_Offset(t *testing.T) {
+	text := "header\nextra\nlisten 80;\nserver_name example.com;\n"
+	patch := `--- a/nginx.conf
++++ b/nginx.conf
+@@ -1,2 +1,2 @@
+-listen 80;
++listen 8080;
+ server_name example.com;
+`
+	got, hunks, err := applyUnifiedPatch(text, patch)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hunks)
+	assert.Equal(t, "header\nextra\nlisten 8080;\nserver_name example.com;\n", got)
+}
+
+// TestApplyUnifiedPatch_DashLines tests that removed "-- x" and added "++ y"
+// lines inside a hunk are not taken as a file header
+func TestApplyUnifiedPatch_DashLines(t *testing.T) {
+	text := "select 1;\n-- old comment\nselect 2;\n"
+	patch := `--- a/q.sql
++++ b/q.sql
+@@ -1,3 +1,3 @@
+ select 1;
+--- old comment
++++ new comment
+ select 2;
+`
+	got, hunks, err := applyUnifiedPatch(text, patch)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hunks)
+	assert.Equal(t, "select 1;\n++ new comment\nselect 2;\n", got)
+
+	// 行数用完后的 ---/+++ 仍按下一个文件的文件头跳过
+	parsed, err := parseUnifiedPatch(patch + "--- a/other\n+++ b/other\n")
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	assert.Len(t, parsed[0].Lines, 4)
+}
+
+// TestApplyUnifiedPatch_Loose tests tolerance of trailing whitespace differences
+func TestApplyUnifiedPatch_Loose(t *testing.T) {
+	text := "a  \r\nb\r\n"
+	patch := "@@ -1,2 +1,2 @@\n a\n-b\n+c\n"
+	got, _, err := applyUnifiedPatch(text, patch)
+	require.NoError(t, err)
+	assert.Equal(t, "a  \r\nc\n", got)
+}
+
+// TestApplyUnifiedPatch_Errors tests patches that do not apply
+func TestApplyUnifiedPatch_Errors(t *testing.T) {
+	_, _, err := applyUnifiedPatch("a\n", "not a patch")
+	assert.Error(t, err)
+
+	_, _, err = applyUnifiedPatch("a\nb\n", "@@ -1,2 +1,2 @@\n a\n-x\n+y\n")
+	assert.Error(t, err)
+
+	_, _, err = applyUnifiedPatch("a\n", "@@ -1 +1 @@\n?bad\n")
+	assert.Error(t, err)
+}
+
+// TestApplyFileEdits tests exact and regex replacements
+func TestApplyFileEdits(t *testing.T) {
+	text := "listen 80;\nlisten 80;\nserver_name old.example.com;\n"
+
+	got, n, err := applyFileEdits(text, []FileEdit{
+		{OldText: "listen 80;", NewText: "listen 8080;", ExpectedCount: 2},
+		{OldText: `server_name (\w+)\.example\.com;`, NewText: "server_name ${1}-new.example.com;", Regex: true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, "listen 8080;\nlisten 8080;\nserver_name old-new.example.com;\n", got)
+
+	// 默认期望 1 次，匹配 2 次时失败
+	_, _, err = applyFileEdits(text, []FileEdit{{OldText: "listen 80;", NewText: "x"}})
+	assert.ErrorContains(t, err, "expected 1 occurrence(s)")
+	assert.ErrorContains(t, err, "found 2")
+
+	_, _, err = applyFileEdits(text, []FileEdit{{OldText: "missing", NewText: "x"}})
+	assert.ErrorContains(t, err, "found 0")
+
+	_, _, err = applyFileEdits(text, []FileEdit{{OldText: "(", NewText: "x", Regex: true}})
+	assert.ErrorContains(t, err, "invalid regex")
+
+	_, _, err = applyFileEdits(text, []FileEdit{{OldText: "", NewText: "x"}})
+	assert.Error(t, err)
+}
+
+// TestEditRemoteFile_Symlink tests that editing through a symlink changes the
+// target and keeps the link
+func TestEditRemoteFile_Symlink(t *testing.T) {
+	s := newLocalSFTPSession(t)
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf"), 0755))
+	target := filepath.Join(dir, "conf", "app.conf")
+	link := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(target, []byte("port = 80\n"), 0640))
+	require.NoError(t, os.Symlink("conf/app.conf", link))
+
+	result, err := s.EditRemoteFile(link, &EditFileOptions{
+		Edits: []FileEdit{{OldText: "80", NewText: "8080"}},
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Changed)
+
+	info, err := os.Lstat(link)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink, "link was replaced")
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "port = 8080\n", string(data))
+	info, err = os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// 临时文件建在目标所在目录并已重命名
+	entries, err := os.ReadDir(filepath.Join(dir, "conf"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
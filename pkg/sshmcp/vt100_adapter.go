@@ -1,71 +1,179 @@
 package sshmcp
 
 import (
+	"fmt"
+	"sync"
+
+	"github.com/muesli/termenv"
 	"github.com/vito/vt100"
 )
 
 // VT100Adapter 适配 vito/vt100 库到 TerminalEmulator 接口
 type VT100Adapter struct {
-	vt *vt100.VT100
+	mu         sync.Mutex // vt100 本身不加锁，读写屏幕都要持有
+	vt         *vt100.VT100
+	scrollback *scrollback
+	modes      *modeTracker
 }
 
 // NewVT100Emulator 创建 VT100 终端模拟器
 func NewVT100Emulator(width, height int) (*VT100Adapter, error) {
 	vt := vt100.NewVT100(height, width)
-	return &VT100Adapter{vt: vt}, nil
+	scrollback := newScrollback(DefaultScrollbackLines)
+	// vt100 在最后一行换行时把光标留在屏幕下方，写入下一个字符时才滚动
+	scrollback.deferredScroll = true
+	return &VT100Adapter{vt: vt, scrollback: scrollback, modes: newModeTracker()}, nil
 }
 
 // Write 实现 TerminalEmulator 接口
 func (a *VT100Adapter) Write(data []byte) (int, error) {
-	return a.vt.Write(data)
+	// vt100 不记录终端模式，单独解析
+	a.modes.Write(data)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.scrollback.write(vt100Screen{a.vt}, data, a.vt.Write)
 }
 
 // GetScreenContent 实现 TerminalEmulator 接口
 func (a *VT100Adapter) GetScreenContent() [][]rune {
-	return a.vt.Content
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// 返回副本，vt100 的内部数组会被后续写入修改
+	content := make([][]rune, len(a.vt.Content))
+	for y, row := range a.vt.Content {
+		content[y] = append([]rune(nil), row...)
+	}
+	return content
 }
 
 // GetScreenContentWithFormat 实现 TerminalEmulator 接口
 func (a *VT100Adapter) GetScreenContentWithFormat() ([][]rune, [][]Format) {
-	content := a.vt.Content
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	content := make([][]rune, len(a.vt.Content))
 	vtFormat := a.vt.Format
 
 	// 转换格式
 	format := make([][]Format, len(content))
-	for y := range content {
-		format[y] = make([]Format, len(content[y]))
-		for x := range content[y] {
-			if x < len(vtFormat) && y < len(vtFormat) {
-				vtCellFmt := vtFormat[y][x]
-				format[y][x] = Format{
-					Fg:        vtCellFmt.Fg,
-					Bg:        vtCellFmt.Bg,
-					Bold:      vtCellFmt.Intensity == 1,
-					Italic:    vtCellFmt.Italic,
-					Underline: vtCellFmt.Underline,
-					Blink:     vtCellFmt.Blink,
-					Reverse:   vtCellFmt.Reverse,
-				}
-			}
+	for y, row := range a.vt.Content {
+		content[y] = append([]rune(nil), row...)
+		var rowFormat []vt100.Format
+		if y < len(vtFormat) {
+			rowFormat = vtFormat[y]
 		}
+		format[y] = vt100RowFormat(content[y], rowFormat)
 	}
 
 	return content, format
 }
 
+// vt100Screen reads the screen for the scrollback while Write holds a.mu
+type vt100Screen struct {
+	vt *vt100.VT100
+}
+
+// screenRow returns one row with formats (used by scrollback)
+func (s vt100Screen) screenRow(y int) ([]rune, []Format) {
+	if y < 0 || y >= len(s.vt.Content) {
+		return nil, nil
+	}
+	// 只转换到最后一个非空白单元格，scrollback 不保存行尾空白
+	content := trimBlankCells(s.vt.Content[y])
+	var row []vt100.Format
+	if y < len(s.vt.Format) {
+		row = s.vt.Format[y]
+	}
+	return content, vt100RowFormat(content, row)
+}
+
+// GetCursorPosition returns the cursor position
+func (s vt100Screen) GetCursorPosition() (int, int) {
+	return int(s.vt.Cursor.X), int(s.vt.Cursor.Y)
+}
+
+// GetSize returns the screen size
+func (s vt100Screen) GetSize() (int, int) {
+	return s.vt.Width, s.vt.Height
+}
+
+// vt100RowFormat converts the formats of one vt100 row
+func vt100RowFormat(content []rune, vtFormat []vt100.Format) []Format {
+	format := make([]Format, len(content))
+	for x := range content {
+		if x < len(vtFormat) {
+			vtCellFmt := vtFormat[x]
+			format[x] = Format{
+				Fg:        termenvColor(vtCellFmt.Fg),
+				Bg:        termenvColor(vtCellFmt.Bg),
+				Bold:      vtCellFmt.Intensity == vt100.Bold,
+				Faint:     vtCellFmt.Intensity == vt100.Faint,
+				Italic:    vtCellFmt.Italic,
+				Underline: vtCellFmt.Underline,
+				Blink:     vtCellFmt.Blink,
+				Reverse:   vtCellFmt.Reverse,
+			}
+		}
+	}
+	return format
+}
+
+// termenvColor 将 vito/vt100 使用的 termenv 颜色转换为 Color
+func termenvColor(c termenv.Color) Color {
+	switch v := c.(type) {
+	case termenv.ANSIColor:
+		return BasicColor(int(v))
+	case termenv.ANSI256Color:
+		return IndexedColor(int(v))
+	case termenv.RGBColor:
+		var r, g, b uint8
+		if _, err := fmt.Sscanf(string(v), "#%02x%02x%02x", &r, &g, &b); err == nil {
+			return RGBColor(r, g, b)
+		}
+	}
+	return Color{}
+}
+
+// GetScrollback 实现 TerminalEmulator 接口
+func (a *VT100Adapter) GetScrollback(n int) ([][]rune, [][]Format) {
+	return a.scrollback.get(n)
+}
+
+// scrolledLines 实现 scrollCounter 接口
+func (a *VT100Adapter) scrolledLines() uint64 {
+	return a.scrollback.count()
+}
+
 // GetCursorPosition 实现 TerminalEmulator 接口
 func (a *VT100Adapter) GetCursorPosition() (int, int) {
-	return int(a.vt.Cursor.X), int(a.vt.Cursor.Y)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return vt100Screen{a.vt}.GetCursorPosition()
+}
+
+// GetModes 实现 TerminalEmulator 接口
+func (a *VT100Adapter) GetModes() TerminalModes {
+	return a.modes.Modes()
 }
 
 // GetSize 实现 TerminalEmulator 接口
 func (a *VT100Adapter) GetSize() (int, int) {
-	return a.vt.Width, a.vt.Height
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return vt100Screen{a.vt}.GetSize()
 }
 
 // Resize 实现 TerminalEmulator 接口
 func (a *VT100Adapter) Resize(width, height int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	a.vt.Resize(height, width)
+	a.scrollback.resized()
 }
 
 // Close 实现 TerminalEmulator 接口
@@ -1,37 +1,45 @@
 package sshmcp
 
 import (
+	"io"
+
 	"github.com/ActiveState/vt10x"
 )
 
 // VT10xAdapter 适配 vt10x 库到 TerminalEmulator 接口
 // vt10x 是一个跨平台的 headless terminal emulator
 type VT10xAdapter struct {
-	state *vt10x.State
-	vt    *vt10x.VT
+	state      *vt10x.State
+	vt         *vt10x.VT
+	scrollback *scrollback
+	trueColor  trueColorDownsampler
+	modes      *modeTracker
 }
 
 // NewVT10xEmulator 创建 VT10x 终端模拟器
 func NewVT10xEmulator(width, height int) (*VT10xAdapter, error) {
 	// 创建 State（存储屏幕状态）
 	state := &vt10x.State{
-		// RecordHistory: true, // 可选：记录滚动历史
+		// 不启用 RecordHistory：其历史无上限且包含备用屏幕，滚动历史由 scrollback 维护
 	}
 
-	// 创建 VT10x 终端（不需要 Reader 和 Writer，用于 headless 模式）
-	vt, err := vt10x.New(state, nil, nil)
+	// 创建 VT10x 终端（headless 模式，不需要 Reader）
+	// 设备状态查询（如 vim 发送的 CSI 6 n）的应答写入 Writer，传 nil 会 panic
+	vt, err := vt10x.New(state, nil, io.Discard)
 	if err != nil {
 		return nil, err
 	}
 
 	adapter := &VT10xAdapter{
-		state: state,
-		vt:    vt,
+		state:      state,
+		vt:         vt,
+		scrollback: newScrollback(DefaultScrollbackLines),
+		modes:      newModeTracker(),
 	}
 
-	// 初始化终端尺寸（通过写入 ANSI 序列）
-	// 使用 Device Attributes 请求来设置尺寸
-	adapter.state.WriteString("", height, width)
+	// 初始化终端尺寸
+	// 注意：State.WriteString 会交换行列并清屏，这里使用 VT.Resize
+	adapter.vt.Resize(width, height)
 
 	return adapter, nil
 }
@@ -39,9 +47,14 @@ func NewVT10xEmulator(width, height int) (*VT10xAdapter, error) {
 // Write 实现 TerminalEmulator 接口
 // 将 ANSI 序列喂给终端模拟器
 func (a *VT10xAdapter) Write(data []byte) (int, error) {
-	// vt10x 会解析 ANSI 序列并更新 state
-	n, err := a.vt.Write(data)
-	return n, err
+	// vt10x 会解析 ANSI 序列并更新 state，滚出屏幕的行保存到 scrollback
+	// 终端模式由 modes 单独解析
+	a.modes.Write(data)
+	// vt10x 不支持真彩色，先转换为最接近的 256 色
+	if _, err := a.scrollback.write(a, a.trueColor.filter(data), a.vt.Write); err != nil {
+		return 0, err
+	}
+	return len(data), nil
 }
 
 // GetScreenContent 实现 TerminalEmulator 接口
@@ -78,21 +91,62 @@ func (a *VT10xAdapter) GetScreenContentWithFormat() ([][]rune, [][]Format) {
 	format := make([][]Format, rows)
 
 	for y := 0; y < rows; y++ {
-		content[y] = make([]rune, cols)
-		format[y] = make([]Format, cols)
-		for x := 0; x < cols; x++ {
-			ch, fg, bg := a.state.Cell(x, y)
-			content[y][x] = ch
-			format[y][x] = Format{
-				Fg: fg,
-				Bg: bg,
-			}
-		}
+		content[y], format[y] = a.rowLocked(y, cols)
+	}
+
+	return content, format
+}
+
+// screenRow returns one row with formats (used by scrollback)
+func (a *VT10xAdapter) screenRow(y int) ([]rune, []Format) {
+	a.state.Lock()
+	defer a.state.Unlock()
+
+	rows, cols := a.state.Size()
+	if y < 0 || y >= rows {
+		return nil, nil
 	}
+	return a.rowLocked(y, cols)
+}
 
+// rowLocked reads row y (caller must hold the state lock)
+func (a *VT10xAdapter) rowLocked(y, cols int) ([]rune, []Format) {
+	content := make([]rune, cols)
+	format := make([]Format, cols)
+	for x := 0; x < cols; x++ {
+		ch, fg, bg := a.state.Cell(x, y)
+		content[x] = ch
+		format[x] = Format{
+			Fg: vt10xColor(fg),
+			Bg: vt10xColor(bg),
+		}
+		// vt10x 写入时已交换反显单元格的前景/背景色（粗体仅体现为亮色），
+		// 默认色互换说明是反显，还原为 Reverse 标志
+		if fg == vt10x.DefaultBG || bg == vt10x.DefaultFG {
+			format[x] = Format{Fg: vt10xColor(bg), Bg: vt10xColor(fg), Reverse: true}
+		}
+	}
 	return content, format
 }
 
+// vt10xColor 将 vt10x 颜色（0-255 调色板或默认色）转换为 Color
+func vt10xColor(c vt10x.Color) Color {
+	if c > 255 {
+		return Color{}
+	}
+	return IndexedColor(int(c))
+}
+
+// GetScrollback 实现 TerminalEmulator 接口
+func (a *VT10xAdapter) GetScrollback(n int) ([][]rune, [][]Format) {
+	return a.scrollback.get(n)
+}
+
+// scrolledLines 实现 scrollCounter 接口
+func (a *VT10xAdapter) scrolledLines() uint64 {
+	return a.scrollback.count()
+}
+
 // GetCursorPosition 实现 TerminalEmulator 接口
 func (a *VT10xAdapter) GetCursorPosition() (int, int) {
 	a.state.Lock()
@@ -101,6 +155,11 @@ func (a *VT10xAdapter) GetCursorPosition() (int, int) {
 	return a.state.Cursor()
 }
 
+// GetModes 实现 TerminalEmulator 接口
+func (a *VT10xAdapter) GetModes() TerminalModes {
+	return a.modes.Modes()
+}
+
 // GetSize 实现 TerminalEmulator 接口
 func (a *VT10xAdapter) GetSize() (int, int) {
 	a.state.Lock()
@@ -112,10 +171,14 @@ func (a *VT10xAdapter) GetSize() (int, int) {
 
 // Resize 实现 TerminalEmulator 接口
 func (a *VT10xAdapter) Resize(width, height int) {
-	// 使用 State.WriteString 来更新尺寸
-	a.state.Lock()
-	defer a.state.Unlock()
-	a.state.WriteString("", height, width)
+	// 缩小高度时 vt10x 会把光标上方的行移出屏幕，先保存到 scrollback
+	if _, y := a.GetCursorPosition(); y >= height && height > 0 {
+		a.scrollback.save(a, y-height+1)
+	}
+
+	// VT.Resize 保留屏幕内容（自行加锁）
+	a.vt.Resize(width, height)
+	a.scrollback.resized()
 }
 
 // Close 实现 TerminalEmulator 接口